@@ -0,0 +1,7 @@
+alter table cars
+    drop column if exists "longitude",
+    drop column if exists "latitude",
+    drop column if exists "pickup_address",
+    drop column if exists "garage_id";
+
+drop table if exists garages;
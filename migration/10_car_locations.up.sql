@@ -0,0 +1,27 @@
+create table garages
+(
+    "id"         serial primary key,
+    "name"       varchar(255)     not null default '',
+    "address"    varchar(1023)    not null default '',
+    "latitude"   double precision not null default 0,
+    "longitude"  double precision not null default 0,
+    "created_at" timestamptz               DEFAULT (now()),
+    "updated_at" timestamptz               DEFAULT (now())
+);
+
+alter table cars
+    add column "garage_id"      bigint references garages (id),
+    add column "pickup_address" varchar(1023) not null default '',
+    add column "latitude"       double precision,
+    add column "longitude"      double precision;
+
+create index cars_garage_id_idx on cars (garage_id);
+
+-- the single garage cars were parked at so far, admins set its address and the coordinates
+-- reach its cars when they update it
+insert into garages (name)
+values ('Main garage');
+
+update cars
+set garage_id = (select id from garages order by id limit 1)
+where parking_lot = 'garage';
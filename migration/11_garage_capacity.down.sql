@@ -0,0 +1,23 @@
+create table garage_configs
+(
+    "id"         serial primary key,
+    "type"       varchar(255) not null default '',
+    "maximum"    bigint       not null default 0,
+    "created_at" timestamptz           DEFAULT (now()),
+    "updated_at" timestamptz           DEFAULT (now())
+);
+
+insert into garage_configs(type, maximum)
+select 'MAX_4_SEATS', coalesce(sum(max_4_seats), 0)
+from garages;
+insert into garage_configs(type, maximum)
+select 'MAX_7_SEATS', coalesce(sum(max_7_seats), 0)
+from garages;
+insert into garage_configs(type, maximum)
+select 'MAX_15_SEATS', coalesce(sum(max_15_seats), 0)
+from garages;
+
+alter table garages
+    drop column if exists "max_15_seats",
+    drop column if exists "max_7_seats",
+    drop column if exists "max_4_seats";
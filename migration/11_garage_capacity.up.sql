@@ -0,0 +1,13 @@
+alter table garages
+    add column "max_4_seats"  bigint not null default 0,
+    add column "max_7_seats"  bigint not null default 0,
+    add column "max_15_seats" bigint not null default 0;
+
+-- the global limits applied to the single garage cars were parked at so far
+update garages
+set max_4_seats  = coalesce((select maximum from garage_configs where type = 'MAX_4_SEATS'), 0),
+    max_7_seats  = coalesce((select maximum from garage_configs where type = 'MAX_7_SEATS'), 0),
+    max_15_seats = coalesce((select maximum from garage_configs where type = 'MAX_15_SEATS'), 0)
+where id = (select id from garages order by id limit 1);
+
+drop table if exists garage_configs;
@@ -0,0 +1,2 @@
+drop table if exists customer_contract_deliveries;
+drop table if exists delivery_fee_tiers;
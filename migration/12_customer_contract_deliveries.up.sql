@@ -0,0 +1,42 @@
+create table delivery_fee_tiers
+(
+    "id"                        serial primary key,
+    "customer_contract_rule_id" bigint references customer_contract_rules (id),
+    "max_distance_km"           double precision not null default 0,
+    "fee"                       bigint           not null default 0,
+    "created_at"                timestamptz               DEFAULT (now()),
+    "updated_at"                timestamptz               DEFAULT (now())
+);
+
+create index delivery_fee_tiers_rule_id_idx on delivery_fee_tiers (customer_contract_rule_id);
+
+-- existing rules deliver up to 30km away
+insert into delivery_fee_tiers(customer_contract_rule_id, max_distance_km, fee)
+select id, 5, 50000
+from customer_contract_rules;
+insert into delivery_fee_tiers(customer_contract_rule_id, max_distance_km, fee)
+select id, 15, 100000
+from customer_contract_rules;
+insert into delivery_fee_tiers(customer_contract_rule_id, max_distance_km, fee)
+select id, 30, 200000
+from customer_contract_rules;
+
+create table customer_contract_deliveries
+(
+    "id"                   serial primary key,
+    "customer_contract_id" bigint references customer_contracts (id),
+    "type"                 varchar(255)     not null default '',
+    "address"              varchar(1023)    not null default '',
+    "latitude"             double precision not null default 0,
+    "longitude"            double precision not null default 0,
+    "distance_km"          double precision not null default 0,
+    "fee"                  bigint           not null default 0,
+    "scheduled_at"         timestamptz,
+    "technician_id"        bigint references accounts (id),
+    "status"               varchar(255)     not null default '',
+    "created_at"           timestamptz               DEFAULT (now()),
+    "updated_at"           timestamptz               DEFAULT (now())
+);
+
+create index customer_contract_deliveries_contract_id_idx on customer_contract_deliveries (customer_contract_id);
+create index customer_contract_deliveries_technician_id_idx on customer_contract_deliveries (technician_id, scheduled_at);
@@ -0,0 +1,18 @@
+delete
+from car_reservations
+where customer_contract_id is null;
+
+alter table car_reservations
+    drop constraint car_reservations_no_overlap;
+
+alter table car_reservations
+    add constraint car_reservations_no_overlap exclude using gist (
+        car_id with =,
+        tstzrange(start_date, end_date, '[]') with &&
+        ) where (status in ('hold', 'booked'));
+
+alter table car_reservations
+    drop column if exists "note";
+
+alter table car_reservations
+    alter column customer_contract_id set not null;
@@ -0,0 +1,15 @@
+-- a blackout is a reservation of the partner without a customer contract
+alter table car_reservations
+    alter column customer_contract_id drop not null;
+
+alter table car_reservations
+    add column "note" varchar(1023) not null default '';
+
+alter table car_reservations
+    drop constraint car_reservations_no_overlap;
+
+alter table car_reservations
+    add constraint car_reservations_no_overlap exclude using gist (
+        car_id with =,
+        tstzrange(start_date, end_date, '[]') with &&
+        ) where (status in ('hold', 'booked', 'blocked'));
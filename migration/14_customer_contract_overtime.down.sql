@@ -0,0 +1,7 @@
+alter table customer_contracts
+    drop column if exists "overtime_fee";
+
+alter table customer_contract_rules
+    drop column if exists "overtime_fee_unit",
+    drop column if exists "overtime_fee_percent",
+    drop column if exists "overtime_grace_minutes";
@@ -0,0 +1,9 @@
+-- a car returned late is charged overtime_fee_percent of its daily price for each started hour or
+-- day after the end of the contract, once the grace period is over
+alter table customer_contract_rules
+    add column "overtime_fee_unit"      varchar(255)  not null default 'hour',
+    add column "overtime_fee_percent"   numeric(4, 1) not null default 10.0,
+    add column "overtime_grace_minutes" bigint        not null default 30;
+
+alter table customer_contracts
+    add column "overtime_fee" bigint not null default 0;
@@ -0,0 +1,7 @@
+drop table if exists customer_contract_charges;
+
+alter table customer_contracts
+    drop column if exists "pickup_fuel_percent",
+    drop column if exists "pickup_odometer",
+    drop column if exists "return_fuel_percent",
+    drop column if exists "return_odometer";
@@ -0,0 +1,25 @@
+-- fuel or battery level in percent and odometer in km, read by the technician at pickup and at return
+alter table customer_contracts
+    add column "pickup_fuel_percent" bigint,
+    add column "pickup_odometer"     bigint,
+    add column "return_fuel_percent" bigint,
+    add column "return_odometer"     bigint;
+
+-- a charge is deducted from the cash collateral as far as it goes, the rest is charged with an
+-- 'other' customer payment
+create table customer_contract_charges
+(
+    "id"                   serial primary key,
+    "customer_contract_id" bigint references customer_contracts (id),
+    "category"             varchar(255)  not null default '',
+    "description"          varchar(1023) not null default '',
+    "amount"               bigint        not null default 0,
+    "image_urls"           text          not null default '[]',
+    "collateral_amount"    bigint        not null default 0,
+    "customer_payment_id"  bigint references customer_payments (id),
+    "created_by"           bigint references accounts (id),
+    "created_at"           timestamptz            DEFAULT (now()),
+    "updated_at"           timestamptz            DEFAULT (now())
+);
+
+create index customer_contract_charges_contract_id_idx on customer_contract_charges (customer_contract_id);
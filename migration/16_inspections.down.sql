@@ -0,0 +1,4 @@
+drop table if exists customer_contract_inspection_items;
+drop table if exists customer_contract_inspections;
+drop table if exists inspection_template_items;
+drop table if exists inspection_templates;
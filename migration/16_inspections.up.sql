@@ -0,0 +1,72 @@
+create table inspection_templates
+(
+    "id"         serial primary key,
+    "name"       varchar(255) not null default '',
+    "created_at" timestamptz           DEFAULT (now()),
+    "updated_at" timestamptz           DEFAULT (now())
+);
+
+-- kind 'condition' items are rated good, damaged or missing, kind 'reading' items take a number
+create table inspection_template_items
+(
+    "id"                     serial primary key,
+    "inspection_template_id" bigint references inspection_templates (id),
+    "section"                varchar(255) not null default '',
+    "name"                   varchar(255) not null default '',
+    "kind"                   varchar(255) not null default 'condition',
+    "position"               bigint       not null default 0,
+    "created_at"             timestamptz           DEFAULT (now()),
+    "updated_at"             timestamptz           DEFAULT (now())
+);
+
+create index inspection_template_items_template_id_idx on inspection_template_items (inspection_template_id);
+
+create table customer_contract_inspections
+(
+    "id"                     serial primary key,
+    "customer_contract_id"   bigint references customer_contracts (id),
+    "inspection_template_id" bigint references inspection_templates (id),
+    "stage"                  varchar(255)  not null default '',
+    "technician_id"          bigint references accounts (id),
+    "note"                   varchar(1023) not null default '',
+    "created_at"             timestamptz            DEFAULT (now()),
+    "updated_at"             timestamptz            DEFAULT (now())
+);
+
+-- a car replaced after a rejected appraisal is inspected again, the latest inspection of a stage counts
+create index customer_contract_inspections_contract_id_idx on customer_contract_inspections (customer_contract_id);
+
+create table customer_contract_inspection_items
+(
+    "id"                              serial primary key,
+    "customer_contract_inspection_id" bigint references customer_contract_inspections (id),
+    "inspection_template_item_id"     bigint references inspection_template_items (id),
+    "condition"                       varchar(255)  not null default '',
+    "value"                           bigint,
+    "note"                            varchar(1023) not null default '',
+    "image_urls"                      text          not null default '[]',
+    "created_at"                      timestamptz            DEFAULT (now()),
+    "updated_at"                      timestamptz            DEFAULT (now())
+);
+
+create index customer_contract_inspection_items_inspection_id_idx on customer_contract_inspection_items (customer_contract_inspection_id);
+
+-- the default checklist, the latest template is the one technicians fill in
+insert into inspection_templates(name)
+values ('Default');
+
+insert into inspection_template_items(inspection_template_id, section, name, kind, position)
+values (currval('inspection_templates_id_seq'), 'exterior', 'Front bumper', 'condition', 1),
+       (currval('inspection_templates_id_seq'), 'exterior', 'Rear bumper', 'condition', 2),
+       (currval('inspection_templates_id_seq'), 'exterior', 'Left side panels', 'condition', 3),
+       (currval('inspection_templates_id_seq'), 'exterior', 'Right side panels', 'condition', 4),
+       (currval('inspection_templates_id_seq'), 'exterior', 'Windshield and windows', 'condition', 5),
+       (currval('inspection_templates_id_seq'), 'tires', 'Front tires', 'condition', 6),
+       (currval('inspection_templates_id_seq'), 'tires', 'Rear tires', 'condition', 7),
+       (currval('inspection_templates_id_seq'), 'tires', 'Spare tire', 'condition', 8),
+       (currval('inspection_templates_id_seq'), 'interior', 'Seats', 'condition', 9),
+       (currval('inspection_templates_id_seq'), 'interior', 'Dashboard', 'condition', 10),
+       (currval('inspection_templates_id_seq'), 'documents', 'Registration certificate', 'condition', 11),
+       (currval('inspection_templates_id_seq'), 'documents', 'Insurance certificate', 'condition', 12),
+       (currval('inspection_templates_id_seq'), 'odometer', 'Odometer (km)', 'reading', 13),
+       (currval('inspection_templates_id_seq'), 'fuel', 'Fuel or battery level (%)', 'reading', 14);
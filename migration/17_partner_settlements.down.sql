@@ -0,0 +1,12 @@
+drop table if exists partner_payment_adjustments;
+
+drop index if exists partner_payment_customer_contracts_contract_id_idx;
+
+alter table partner_payment_customer_contracts
+    drop column if exists "revenue_sharing_percent",
+    drop column if exists "gross_amount",
+    drop column if exists "platform_amount",
+    drop column if exists "net_amount";
+
+alter table partner_payment_histories
+    drop constraint if exists partner_payment_histories_partner_period_key;
@@ -0,0 +1,135 @@
+-- every settled contract keeps the split it was paid with
+alter table partner_payment_customer_contracts
+    add column "revenue_sharing_percent" numeric(4, 1) not null default 0.0,
+    add column "gross_amount"            bigint        not null default 0,
+    add column "platform_amount"         bigint        not null default 0,
+    add column "net_amount"              bigint        not null default 0;
+
+update partner_payment_customer_contracts p
+set revenue_sharing_percent = r.revenue_sharing_percent,
+    gross_amount            = c.rent_price,
+    platform_amount         = round(c.rent_price * r.revenue_sharing_percent / 100),
+    net_amount              = c.rent_price - round(c.rent_price * r.revenue_sharing_percent / 100)
+from customer_contracts c
+         join cars on cars.id = c.car_id
+         join partner_contract_rules r on r.id = cars.partner_contract_rule_id
+where c.id = p.customer_contract_id;
+
+-- settling a partner for a period again reuses its payment, so the payments of a partner and
+-- period are ranked with the non-pending ones first, the first one surviving
+create temporary table partner_payment_duplicates as
+select h.id,
+       h.status,
+       row_number() over w      as rn,
+       first_value(h.id) over w as survivor_id
+from partner_payment_histories h
+window w as (partition by h.partner_id, h.start_date, h.end_date order by (h.status = 'pending'), h.id);
+
+create temporary table partner_payment_touched
+(
+    "id" bigint primary key
+);
+
+-- the contracts of a duplicated pending payment move to a pending survivor, a paid survivor does
+-- not pay them so they go back to unsettled and the next settlement takes them
+insert into partner_payment_touched (id)
+select distinct d.survivor_id
+from partner_payment_duplicates d
+         join partner_payment_histories s on s.id = d.survivor_id
+where d.rn > 1
+  and d.status = 'pending'
+  and s.status = 'pending';
+
+update partner_payment_customer_contracts p
+set partner_payment_history_id = d.survivor_id
+from partner_payment_duplicates d
+         join partner_payment_histories s on s.id = d.survivor_id
+where p.partner_payment_history_id = d.id
+  and d.rn > 1
+  and d.status = 'pending'
+  and s.status = 'pending';
+
+delete
+from partner_payment_customer_contracts p
+using partner_payment_duplicates d
+where p.partner_payment_history_id = d.id
+  and d.rn > 1
+  and d.status = 'pending';
+
+delete
+from partner_payment_histories h
+using partner_payment_duplicates d
+where h.id = d.id
+  and d.rn > 1
+  and d.status = 'pending';
+
+-- duplicated payments that are already paid both went out and can not be merged, the migration
+-- stops listing them so they are reconciled by hand first
+do
+$$
+    declare
+        duplicates text;
+    begin
+        select string_agg(format('partner %s from %s to %s: payments %s', d.partner_id, d.start_date, d.end_date, d.ids), '; ')
+        into duplicates
+        from (select partner_id, start_date, end_date, string_agg(id::text, ', ' order by id) as ids
+              from partner_payment_histories
+              group by partner_id, start_date, end_date
+              having count(*) > 1) d;
+
+        if duplicates is not null then
+            raise exception 'paid partner payments share their period, reconcile them first: %', duplicates;
+        end if;
+    end
+$$;
+
+alter table partner_payment_histories
+    add constraint partner_payment_histories_partner_period_key unique (partner_id, start_date, end_date);
+
+-- a contract is settled by one payment only, the paid or else the first one keeps it
+insert into partner_payment_touched (id)
+select distinct p.partner_payment_history_id
+from partner_payment_customer_contracts p
+         join (select p.id,
+                      row_number() over (partition by p.customer_contract_id
+                          order by (h.status = 'pending'), p.id) as rn
+               from partner_payment_customer_contracts p
+                        join partner_payment_histories h on h.id = p.partner_payment_history_id) r on r.id = p.id
+where r.rn > 1
+on conflict do nothing;
+
+delete
+from partner_payment_customer_contracts p
+using (select p.id,
+              row_number() over (partition by p.customer_contract_id
+                  order by (h.status = 'pending'), p.id) as rn
+       from partner_payment_customer_contracts p
+                join partner_payment_histories h on h.id = p.partner_payment_history_id) r
+where p.id = r.id
+  and r.rn > 1;
+
+update partner_payment_histories h
+set amount = coalesce((select sum(p.net_amount)
+                       from partner_payment_customer_contracts p
+                       where p.partner_payment_history_id = h.id), 0)
+from partner_payment_touched t
+where h.id = t.id
+  and h.status = 'pending';
+
+drop table partner_payment_touched;
+drop table partner_payment_duplicates;
+
+create unique index partner_payment_customer_contracts_contract_id_idx on partner_payment_customer_contracts (customer_contract_id);
+
+-- a positive amount is paid to the partner on top of the settled contracts, a negative one is deducted
+create table partner_payment_adjustments
+(
+    "id"                         serial primary key,
+    "partner_payment_history_id" bigint references partner_payment_histories (id),
+    "category"                   varchar(255)  not null default '',
+    "description"                varchar(1023) not null default '',
+    "amount"                     bigint        not null default 0,
+    "created_by"                 bigint references accounts (id),
+    "created_at"                 timestamptz            DEFAULT (now()),
+    "updated_at"                 timestamptz            DEFAULT (now())
+);
@@ -0,0 +1,3 @@
+drop table if exists ledger_lines;
+drop table if exists ledger_entries;
+drop table if exists ledger_accounts;
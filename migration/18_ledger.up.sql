@@ -0,0 +1,251 @@
+-- double-entry ledger of the money the platform moves, every entry balances its debits and credits
+create table ledger_accounts
+(
+    "id"         serial primary key,
+    "code"       varchar(255) not null unique,
+    "name"       varchar(255) not null default '',
+    "type"       varchar(255) not null default '',
+    "created_at" timestamptz           DEFAULT (now()),
+    "updated_at" timestamptz           DEFAULT (now())
+);
+
+insert into ledger_accounts(code, name, type)
+values ('cash', 'Cash at payment gateways', 'asset'),
+       ('customer_receivable', 'Customer receivable', 'asset'),
+       ('collateral_liability', 'Collateral held for customers', 'liability'),
+       ('partner_payable', 'Partner payable', 'liability'),
+       ('insurance_pool', 'Insurance pool', 'liability'),
+       ('platform_revenue', 'Platform revenue', 'revenue');
+
+-- reference names what an entry was posted for, like customer_payment:12, so it is posted once
+create table ledger_entries
+(
+    "id"                   serial primary key,
+    "reference"            varchar(255)  not null unique,
+    "description"          varchar(1023) not null default '',
+    "customer_contract_id" bigint references customer_contracts (id),
+    "partner_id"           bigint references accounts (id),
+    "posted_at"            timestamptz            DEFAULT (now()),
+    "created_at"           timestamptz            DEFAULT (now()),
+    "updated_at"           timestamptz            DEFAULT (now())
+);
+
+create index ledger_entries_posted_at_idx on ledger_entries (posted_at);
+
+create table ledger_lines
+(
+    "id"              serial primary key,
+    "ledger_entry_id" bigint references ledger_entries (id),
+    "account_code"    varchar(255) references ledger_accounts (code),
+    "debit"           bigint not null default 0,
+    "credit"          bigint not null default 0,
+    "created_at"      timestamptz     DEFAULT (now()),
+    "updated_at"      timestamptz     DEFAULT (now())
+);
+
+create index ledger_lines_account_code_idx on ledger_lines (account_code);
+create index ledger_lines_entry_id_idx on ledger_lines (ledger_entry_id);
+
+-- opening balances: the money moved before the ledger is posted as the entries it would have been
+-- posted as, with the same references so nothing is posted twice
+create temporary table ledger_opening_entries
+(
+    "reference"            varchar(255) primary key,
+    "description"          varchar(1023),
+    "customer_contract_id" bigint,
+    "partner_id"           bigint,
+    "posted_at"            timestamptz
+);
+
+create temporary table ledger_opening_lines
+(
+    "reference"    varchar(255),
+    "account_code" varchar(255),
+    "debit"        bigint not null default 0,
+    "credit"       bigint not null default 0
+);
+
+-- paid collateral, rent and other payments, rent split into its insurance part and its rent part
+create temporary table ledger_opening_payments as
+select p.id,
+       p.customer_contract_id,
+       p.payment_type,
+       p.amount,
+       p.updated_at,
+       case
+           when c.rent_price + c.insurance_amount > 0
+               then floor(p.amount::numeric * c.insurance_amount / (c.rent_price + c.insurance_amount))::bigint
+           else 0 end as insurance_amount
+from customer_payments p
+         join customer_contracts c on c.id = p.customer_contract_id
+where p.status = 'paid'
+  and p.amount > 0
+  and p.payment_type in ('collateral_cash', 'pre_pay', 'remaining_pay', 'extension', 'other');
+
+insert into ledger_opening_entries (reference, description, customer_contract_id, posted_at)
+select 'customer_payment:' || id,
+       payment_type || ' payment of contract ' || customer_contract_id,
+       customer_contract_id,
+       updated_at
+from ledger_opening_payments;
+
+insert into ledger_opening_lines (reference, account_code, debit, credit)
+select 'customer_payment:' || id, 'cash', amount, 0
+from ledger_opening_payments
+union all
+select 'customer_payment:' || id,
+       case payment_type
+           when 'collateral_cash' then 'collateral_liability'
+           when 'other' then 'customer_receivable'
+           else 'platform_revenue' end,
+       0,
+       amount - case when payment_type in ('collateral_cash', 'other') then 0 else insurance_amount end
+from ledger_opening_payments
+union all
+select 'customer_payment:' || id, 'insurance_pool', 0, insurance_amount
+from ledger_opening_payments
+where payment_type not in ('collateral_cash', 'other');
+
+-- charges, taken from the collateral as far as they were deducted from it
+insert into ledger_opening_entries (reference, description, customer_contract_id, posted_at)
+select 'customer_contract_charge:' || id,
+       category || ' charge of contract ' || customer_contract_id || ': ' || description,
+       customer_contract_id,
+       created_at
+from customer_contract_charges
+where amount > 0;
+
+insert into ledger_opening_lines (reference, account_code, debit, credit)
+select 'customer_contract_charge:' || id, 'collateral_liability', collateral_amount, 0
+from customer_contract_charges
+where amount > 0
+union all
+select 'customer_contract_charge:' || id, 'customer_receivable', amount - collateral_amount, 0
+from customer_contract_charges
+where amount > 0
+union all
+select 'customer_contract_charge:' || id, 'platform_revenue', 0, amount
+from customer_contract_charges
+where amount > 0;
+
+-- succeeded refunds reverse the payment they gave money back from
+create temporary table ledger_opening_refunds as
+select r.id,
+       r.amount,
+       r.reason,
+       r.updated_at,
+       p.id   as customer_payment_id,
+       p.customer_contract_id,
+       p.payment_type,
+       case
+           when p.payment_type in ('pre_pay', 'remaining_pay', 'extension')
+               and c.rent_price + c.insurance_amount > 0
+               then floor(r.amount::numeric * c.insurance_amount / (c.rent_price + c.insurance_amount))::bigint
+           else 0 end as insurance_amount
+from customer_refunds r
+         join customer_payments p on p.id = r.customer_payment_id
+         join customer_contracts c on c.id = p.customer_contract_id
+where r.status = 'succeeded'
+  and r.amount > 0;
+
+insert into ledger_opening_entries (reference, description, customer_contract_id, posted_at)
+select 'customer_refund:' || id,
+       'refund of ' || payment_type || ' payment ' || customer_payment_id || ': ' || reason,
+       customer_contract_id,
+       updated_at
+from ledger_opening_refunds;
+
+insert into ledger_opening_lines (reference, account_code, debit, credit)
+select 'customer_refund:' || id, 'cash', 0, amount
+from ledger_opening_refunds
+union all
+select 'customer_refund:' || id,
+       case payment_type when 'collateral_cash' then 'collateral_liability' else 'platform_revenue' end,
+       amount - insurance_amount,
+       0
+from ledger_opening_refunds
+union all
+select 'customer_refund:' || id, 'insurance_pool', insurance_amount, 0
+from ledger_opening_refunds;
+
+-- the net of the contracts settled into pending and paid partner payments is owed to the partners
+insert into ledger_opening_entries (reference, description, partner_id, posted_at)
+select 'partner_payment_customer_contract:' || min(p.id),
+       count(*) || ' contracts settled into partner payment ' || h.id,
+       h.partner_id,
+       h.created_at
+from partner_payment_histories h
+         join partner_payment_customer_contracts p on p.partner_payment_history_id = h.id
+group by h.id;
+
+insert into ledger_opening_lines (reference, account_code, debit, credit)
+select 'partner_payment_customer_contract:' || min(p.id), 'platform_revenue', sum(p.net_amount), 0
+from partner_payment_customer_contracts p
+group by p.partner_payment_history_id
+union all
+select 'partner_payment_customer_contract:' || min(p.id), 'partner_payable', 0, sum(p.net_amount)
+from partner_payment_customer_contracts p
+group by p.partner_payment_history_id;
+
+insert into ledger_opening_entries (reference, description, partner_id, posted_at)
+select 'partner_payment_adjustment:' || a.id,
+       a.category || ' of partner payment ' || h.id || ': ' || a.description,
+       h.partner_id,
+       a.created_at
+from partner_payment_adjustments a
+         join partner_payment_histories h on h.id = a.partner_payment_history_id
+where a.amount <> 0;
+
+insert into ledger_opening_lines (reference, account_code, debit, credit)
+select 'partner_payment_adjustment:' || id,
+       case when amount > 0 then 'platform_revenue' else 'partner_payable' end,
+       abs(amount),
+       0
+from partner_payment_adjustments
+where amount <> 0
+union all
+select 'partner_payment_adjustment:' || id,
+       case when amount > 0 then 'partner_payable' else 'platform_revenue' end,
+       0,
+       abs(amount)
+from partner_payment_adjustments
+where amount <> 0;
+
+-- paid partner payments cleared their payable
+insert into ledger_opening_entries (reference, description, partner_id, posted_at)
+select 'partner_payment:' || id, 'partner payment ' || id, partner_id, updated_at
+from partner_payment_histories
+where status = 'paid'
+  and amount > 0;
+
+insert into ledger_opening_lines (reference, account_code, debit, credit)
+select 'partner_payment:' || id, 'partner_payable', amount, 0
+from partner_payment_histories
+where status = 'paid'
+  and amount > 0
+union all
+select 'partner_payment:' || id, 'cash', 0, amount
+from partner_payment_histories
+where status = 'paid'
+  and amount > 0;
+
+-- lines of zero are dropped like the ledger does, and so are entries left without lines
+delete
+from ledger_opening_lines
+where debit = 0
+  and credit = 0;
+
+insert into ledger_entries (reference, description, customer_contract_id, partner_id, posted_at)
+select e.reference, e.description, e.customer_contract_id, e.partner_id, coalesce(e.posted_at, now())
+from ledger_opening_entries e
+where exists (select 1 from ledger_opening_lines l where l.reference = e.reference);
+
+insert into ledger_lines (ledger_entry_id, account_code, debit, credit)
+select e.id, l.account_code, l.debit, l.credit
+from ledger_opening_lines l
+         join ledger_entries e on e.reference = l.reference;
+
+drop table ledger_opening_refunds;
+drop table ledger_opening_payments;
+drop table ledger_opening_lines;
+drop table ledger_opening_entries;
@@ -0,0 +1,2 @@
+drop table if exists invoices;
+drop table if exists invoice_sequences;
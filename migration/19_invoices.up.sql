@@ -0,0 +1,39 @@
+-- invoice numbers run without gaps per series and year, the next number is taken in the transaction
+-- issuing the invoice
+create table invoice_sequences
+(
+    "series"      varchar(255) not null,
+    "year"        bigint       not null,
+    "last_number" bigint       not null default 0,
+    primary key ("series", "year")
+);
+
+-- an invoice keeps the seller and buyer details it was issued with, so it renders the same later
+create table invoices
+(
+    "id"                         serial primary key,
+    "number"                     varchar(255)  not null unique,
+    "kind"                       varchar(255)  not null default '',
+    "customer_payment_id"        bigint unique references customer_payments (id),
+    "partner_payment_history_id" bigint unique references partner_payment_histories (id),
+    "customer_contract_id"       bigint references customer_contracts (id),
+    "account_id"                 bigint references accounts (id),
+    "description"                varchar(1023) not null default '',
+    "seller_name"                varchar(255)  not null default '',
+    "seller_tax_code"            varchar(255)  not null default '',
+    "seller_address"             varchar(1023) not null default '',
+    "seller_phone"               varchar(255)  not null default '',
+    "seller_email"               varchar(255)  not null default '',
+    "buyer_name"                 varchar(255)  not null default '',
+    "buyer_phone"                varchar(255)  not null default '',
+    "subtotal"                   bigint        not null default 0,
+    "vat_percent"                numeric(4, 1) not null default 0.0,
+    "vat_amount"                 bigint        not null default 0,
+    "total"                      bigint        not null default 0,
+    "url"                        varchar(1023) not null default '',
+    "issued_at"                  timestamptz            DEFAULT (now()),
+    "created_at"                 timestamptz            DEFAULT (now()),
+    "updated_at"                 timestamptz            DEFAULT (now())
+);
+
+create index invoices_customer_contract_id_idx on invoices (customer_contract_id);
@@ -0,0 +1,5 @@
+alter table cars
+    drop column if exists "partner_contract_template_version";
+
+alter table customer_contracts
+    drop column if exists "template_version";
@@ -0,0 +1,7 @@
+-- the version of the template a contract was rendered with, 0 when it was rendered by the external
+-- pdf service
+alter table customer_contracts
+    add column "template_version" bigint not null default 0;
+
+alter table cars
+    add column "partner_contract_template_version" bigint not null default 0;
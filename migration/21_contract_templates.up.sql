@@ -0,0 +1,17 @@
+-- contract template versions never change once created: admins create a draft, preview it and
+-- publish it, which retires the version published before. Contracts keep the version they were
+-- rendered with in customer_contracts.template_version and cars.partner_contract_template_version.
+create table contract_templates
+(
+    "id"           serial primary key,
+    "type"         varchar(255)  not null default '',
+    "version"      bigint        not null,
+    "body"         text          not null default '',
+    "note"         varchar(1023) not null default '',
+    "status"       varchar(255)  not null default '',
+    "created_by"   bigint references accounts (id),
+    "published_at" timestamptz,
+    "created_at"   timestamptz            DEFAULT (now()),
+    "updated_at"   timestamptz            DEFAULT (now()),
+    unique ("type", "version")
+);
@@ -0,0 +1,5 @@
+drop index if exists customer_refunds_status_idx;
+drop index if exists customer_refunds_return_payment_id_idx;
+
+alter table customer_refunds
+    drop column if exists "return_payment_id";
@@ -0,0 +1,6 @@
+-- the pending return_* payment a refund pays out, it becomes paid once the refund succeeds
+alter table customer_refunds
+    add column "return_payment_id" bigint references customer_payments (id);
+
+create index customer_refunds_return_payment_id_idx on customer_refunds (return_payment_id);
+create index customer_refunds_status_idx on customer_refunds (status);
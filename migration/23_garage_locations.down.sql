@@ -0,0 +1,9 @@
+update garages
+set latitude  = coalesce(latitude, 0),
+    longitude = coalesce(longitude, 0);
+
+alter table garages
+    alter column "latitude" set default 0,
+    alter column "latitude" set not null,
+    alter column "longitude" set default 0,
+    alter column "longitude" set not null;
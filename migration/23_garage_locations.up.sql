@@ -0,0 +1,19 @@
+-- a garage without coordinates has null ones instead of 0, 0, like the main garage seeded by
+-- migration 10. Its cars have no coordinates either, which keeps them out of the nearby search
+-- until an admin sets the location of the garage.
+alter table garages
+    alter column "latitude" drop not null,
+    alter column "latitude" drop default,
+    alter column "longitude" drop not null,
+    alter column "longitude" drop default;
+
+update garages
+set latitude  = null,
+    longitude = null
+where latitude = 0
+  and longitude = 0;
+
+update cars
+set latitude  = null,
+    longitude = null
+where garage_id in (select id from garages where latitude is null);
@@ -0,0 +1,18 @@
+create table sessions
+(
+    "id"                      uuid primary key,
+    "family_id"               uuid         not null,
+    "account_id"              bigint references accounts (id),
+    "access_token_id"         uuid         not null,
+    "access_token_expires_at" timestamptz,
+    "user_agent"              varchar(1023) not null default '',
+    "client_ip"               varchar(255)  not null default '',
+    "status"                  varchar(255)  not null default '',
+    "expires_at"              timestamptz,
+    "created_at"              timestamptz            DEFAULT (now()),
+    "updated_at"              timestamptz            DEFAULT (now())
+);
+
+create index sessions_account_id_idx on sessions (account_id);
+create index sessions_family_id_idx on sessions (family_id);
+create index sessions_access_token_id_idx on sessions (access_token_id);
@@ -0,0 +1,13 @@
+create table customer_contract_events
+(
+    "id"                   serial primary key,
+    "customer_contract_id" bigint references customer_contracts (id),
+    "from_status"          varchar(255) not null default '',
+    "to_status"            varchar(255) not null default '',
+    "actor_id"             bigint references accounts (id),
+    "actor_role"           varchar(255) not null default '',
+    "reason"               varchar(1023) not null default '',
+    "created_at"           timestamptz           DEFAULT (now())
+);
+
+create index customer_contract_events_customer_contract_id_idx on customer_contract_events (customer_contract_id);
@@ -0,0 +1,22 @@
+create table payment_transactions
+(
+    "id"             serial primary key,
+    "gateway"        varchar(255)  not null default '',
+    "transaction_no" varchar(255)  not null,
+    "txn_ref"        varchar(255)  not null default '',
+    "order_info"     varchar(1023) not null default '',
+    "amount"         bigint        not null default 0,
+    "response_code"  varchar(255)  not null default '',
+    "bank_code"      varchar(255)  not null default '',
+    "pay_date"       varchar(255)  not null default '',
+    "status"         varchar(255)  not null default '',
+    "created_at"     timestamptz            DEFAULT (now()),
+    "updated_at"     timestamptz            DEFAULT (now())
+);
+
+-- gateways send the same transaction number (e.g. VNPay's 0) for every failure, so only
+-- successful transaction numbers are unique and a failure is kept once per order and response code
+create unique index unique_gateway_transaction_no on payment_transactions (gateway, transaction_no)
+    where status = 'succeeded';
+create unique index unique_gateway_failed_result on payment_transactions (gateway, txn_ref, response_code)
+    where status <> 'succeeded';
@@ -0,0 +1,5 @@
+alter table customer_payments
+    drop column if exists "gateway",
+    drop column if exists "txn_ref",
+    drop column if exists "txn_created_at",
+    drop column if exists "external_transaction_id";
@@ -0,0 +1,9 @@
+alter table customer_payments
+    add column "gateway"                 varchar(255) not null default '',
+    add column "txn_ref"                 varchar(255) not null default '',
+    add column "txn_created_at"          timestamptz           DEFAULT (now()),
+    add column "external_transaction_id" varchar(255) not null default '';
+
+update customer_payments
+set gateway = 'vnpay'
+where payment_url <> '';
@@ -0,0 +1 @@
+drop table if exists customer_refunds;
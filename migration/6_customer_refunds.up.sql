@@ -0,0 +1,16 @@
+create table customer_refunds
+(
+    "id"                  serial primary key,
+    "customer_payment_id" bigint references customer_payments (id),
+    "gateway"             varchar(255)  not null default '',
+    "amount"              bigint        not null default 0,
+    "reason"              varchar(1023) not null default '',
+    "status"              varchar(255)  not null default '',
+    "external_refund_id"  varchar(255)  not null default '',
+    "response_code"       varchar(255)  not null default '',
+    "message"             varchar(1023) not null default '',
+    "created_at"          timestamptz            DEFAULT (now()),
+    "updated_at"          timestamptz            DEFAULT (now())
+);
+
+create index customer_refunds_customer_payment_id_idx on customer_refunds (customer_payment_id);
@@ -0,0 +1,5 @@
+drop table if exists cancellation_refund_tiers;
+
+alter table customer_contract_rules
+    drop column if exists "cancellable_statuses",
+    drop column if exists "partner_cancel_warning_penalty";
@@ -0,0 +1,23 @@
+alter table customer_contract_rules
+    add column "cancellable_statuses"           varchar(1023) not null default 'waiting_partner_approval,waiting_for_agreement,waiting_contract_payment,ordered',
+    add column "partner_cancel_warning_penalty" bigint        not null default 1;
+
+create table cancellation_refund_tiers
+(
+    "id"                        serial primary key,
+    "customer_contract_rule_id" bigint references customer_contract_rules (id),
+    "min_hours_before_start"    bigint        not null default 0,
+    "refund_percent"            numeric(4, 1) not null default 0.0,
+    "created_at"                timestamptz            DEFAULT (now()),
+    "updated_at"                timestamptz            DEFAULT (now())
+);
+
+create index cancellation_refund_tiers_rule_id_idx on cancellation_refund_tiers (customer_contract_rule_id);
+
+-- existing rules refund everything 3 days ahead, half 1 day ahead and nothing after that
+insert into cancellation_refund_tiers(customer_contract_rule_id, min_hours_before_start, refund_percent)
+select id, 72, 100.0
+from customer_contract_rules;
+insert into cancellation_refund_tiers(customer_contract_rule_id, min_hours_before_start, refund_percent)
+select id, 24, 50.0
+from customer_contract_rules;
@@ -0,0 +1,2 @@
+drop table if exists holidays;
+drop table if exists pricing_rules;
@@ -0,0 +1,27 @@
+create table pricing_rules
+(
+    "id"               serial primary key,
+    "car_id"           bigint references cars (id),
+    "car_model_id"     bigint references car_models (id),
+    "type"             varchar(255)  not null default '',
+    "name"             varchar(255)  not null default '',
+    "price_percent"    numeric(5, 1) not null default 100.0,
+    "discount_percent" numeric(4, 1) not null default 0.0,
+    "min_days"         bigint        not null default 0,
+    "start_date"       date,
+    "end_date"         date,
+    "created_at"       timestamptz            DEFAULT (now()),
+    "updated_at"       timestamptz            DEFAULT (now())
+);
+
+create index pricing_rules_car_id_idx on pricing_rules (car_id);
+create index pricing_rules_car_model_id_idx on pricing_rules (car_model_id);
+
+create table holidays
+(
+    "id"         serial primary key,
+    "date"       date unique  not null,
+    "name"       varchar(255) not null default '',
+    "created_at" timestamptz           DEFAULT (now()),
+    "updated_at" timestamptz           DEFAULT (now())
+);
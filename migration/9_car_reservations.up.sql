@@ -0,0 +1,29 @@
+create extension if not exists btree_gist;
+
+create table car_reservations
+(
+    "id"                   serial primary key,
+    "car_id"               bigint references cars (id)               not null,
+    "customer_contract_id" bigint references customer_contracts (id) not null,
+    "start_date"           timestamptz                               not null,
+    "end_date"             timestamptz                               not null,
+    "status"               varchar(255)                              not null default '',
+    "expires_at"           timestamptz,
+    "created_at"           timestamptz                                        DEFAULT (now()),
+    "updated_at"           timestamptz                                        DEFAULT (now()),
+    constraint car_reservations_no_overlap exclude using gist (
+        car_id with =,
+        tstzrange(start_date, end_date, '[]') with &&
+        ) where (status in ('hold', 'booked'))
+);
+
+create index car_reservations_customer_contract_id_idx on car_reservations (customer_contract_id);
+create index car_reservations_hold_expires_at_idx on car_reservations (expires_at) where (status = 'hold');
+
+-- existing firm bookings, the first of overlapping legacy contracts wins
+insert into car_reservations (car_id, customer_contract_id, start_date, end_date, status)
+select car_id, id, start_date, end_date, 'booked'
+from customer_contracts
+where status in ('ordered', 'appraising_car_approved', 'appraising_car_rejected', 'renting')
+order by id
+on conflict do nothing;
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
 	"github.com/godev111222333/capstone-backend/src/model"
 	"github.com/godev111222333/capstone-backend/src/token"
 )
@@ -61,9 +63,11 @@ type rawLoginRequest struct {
 }
 
 type rawLoginResponse struct {
-	AccessToken          string           `json:"access_token"`
-	AccessTokenExpiresAt time.Time        `json:"access_token_expires_at"`
-	User                 *accountResponse `json:"user"`
+	AccessToken           string           `json:"access_token"`
+	AccessTokenExpiresAt  time.Time        `json:"access_token_expires_at"`
+	RefreshToken          string           `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time        `json:"refresh_token_expires_at"`
+	User                  *accountResponse `json:"user"`
 }
 
 type accountResponse struct {
@@ -131,16 +135,23 @@ func (s *Server) HandleRawLogin(c *gin.Context) {
 		return
 	}
 
-	accessToken, accessTokenPayload, err := s.tokenMaker.CreateToken(req.PhoneNumber, acct.Role.RoleName, s.cfg.AccessTokenDuration)
+	tokens, session, err := s.newSession(c, acct, uuid.Nil)
 	if err != nil {
 		responseInternalServerError(c, err)
 		return
 	}
 
+	if err := s.store.SessionStore.Create(session); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
 	responseSuccess(c, rawLoginResponse{
-		AccessToken:          accessToken,
-		AccessTokenExpiresAt: accessTokenPayload.ExpiredAt,
-		User:                 s.newAccountResponse(acct),
+		AccessToken:           tokens.AccessToken,
+		AccessTokenExpiresAt:  tokens.AccessTokenExpiresAt,
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
+		User:                  s.newAccountResponse(acct),
 	})
 }
 
@@ -100,6 +100,65 @@ func TestRenewAccessToken(t *testing.T) {
 	})
 }
 
+func TestRefreshTokenRotation(t *testing.T) {
+	renew := func(refreshToken string) *httptest.ResponseRecorder {
+		route := TestServer.AllRoutes()[RouteRenewAccessToken]
+		bz, _ := json.Marshal(renewAccessTokenRequest{RefreshToken: refreshToken})
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(route.Method, route.Path, bytes.NewReader(bz))
+		TestServer.route.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	getProfile := func(accessToken string) int {
+		route := TestServer.AllRoutes()[RouteGetProfile]
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(route.Method, route.Path, nil)
+		req.Header.Set(authorizationHeaderKey, "Bearer "+accessToken)
+		TestServer.route.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	t.Run("rotate refresh token and detect reuse", func(t *testing.T) {
+		t.Parallel()
+
+		_, loginResp := seedAccountAndLogin("0977000001", "password", model.RoleIDCustomer)
+		require.NotEmpty(t, loginResp.RefreshToken)
+
+		recorder := renew(loginResp.RefreshToken)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		bz, err := io.ReadAll(recorder.Body)
+		require.NoError(t, err)
+		rotated := tokenPairResponse{}
+		require.NoError(t, unmarshalFromCommResponse(bz, &rotated))
+		require.NotEqual(t, loginResp.RefreshToken, rotated.RefreshToken)
+
+		// old access token is revoked after rotation
+		require.Equal(t, http.StatusUnauthorized, getProfile(loginResp.AccessToken))
+		require.Equal(t, http.StatusOK, getProfile(rotated.AccessToken))
+
+		// reusing the old refresh token terminates the whole family
+		require.Equal(t, http.StatusUnauthorized, renew(loginResp.RefreshToken).Code)
+		require.Equal(t, http.StatusUnauthorized, getProfile(rotated.AccessToken))
+		require.Equal(t, http.StatusUnauthorized, renew(rotated.RefreshToken).Code)
+	})
+
+	t.Run("logout revokes access token", func(t *testing.T) {
+		t.Parallel()
+
+		_, loginResp := seedAccountAndLogin("0977000002", "password", model.RoleIDCustomer)
+		route := TestServer.AllRoutes()[RouteLogout]
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(route.Method, route.Path, nil)
+		req.Header.Set(authorizationHeaderKey, "Bearer "+loginResp.AccessToken)
+		TestServer.route.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		require.Equal(t, http.StatusUnauthorized, getProfile(loginResp.AccessToken))
+		require.Equal(t, http.StatusUnauthorized, renew(loginResp.RefreshToken).Code)
+	})
+}
+
 func TestUpdateProfile(t *testing.T) {
 	t.Parallel()
 
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"github.com/godev111222333/capstone-backend/src/model"
 	"github.com/godev111222333/capstone-backend/src/service"
@@ -79,17 +80,12 @@ func (s *Server) HandleGetCarDetail(c *gin.Context) {
 	responseSuccess(c, resp)
 }
 
-type getGarageConfigResponse struct {
-	Max4Seats      int `json:"max_4_seats"`
-	Max7Seats      int `json:"max_7_seats"`
-	Max15Seats     int `json:"max_15_seats"`
-	Total          int `json:"total"`
-	Current4Seats  int `json:"current_4_seats"`
-	Current7Seats  int `json:"current_7_seats"`
-	Current15Seats int `json:"current_15_seats"`
-	CurrentTotal   int `json:"current_total"`
+type getGarageConfigRequest struct {
+	GarageID int `form:"garage_id"`
 }
 
+// HandleGetGarageConfigs reports the capacity and the slots taken of a garage, or of every garage
+// together when no garage is given
 func (s *Server) HandleGetGarageConfigs(c *gin.Context) {
 	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
 	if authPayload.Role != model.RoleNameAdmin {
@@ -97,46 +93,53 @@ func (s *Server) HandleGetGarageConfigs(c *gin.Context) {
 		return
 	}
 
-	configs, err := s.store.GarageConfigStore.Get()
+	req := getGarageConfigRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidUpdateGarageConfigRequest, err)
+		return
+	}
+
+	occupancies, err := s.garageOccupancies()
 	if err != nil {
 		responseGormErr(c, err)
 		return
 	}
 
-	countCurrentSeats := func(seatType int) int {
-		counter, err := s.store.CarStore.CountBySeats(seatType, model.ParkingLotGarage, []model.CarStatus{model.CarStatusActive, model.CarStatusWaitingDelivery})
-		if err != nil {
-			responseGormErr(c, err)
-			return -1
+	if req.GarageID != 0 {
+		for _, o := range occupancies {
+			if o.GarageID == req.GarageID {
+				responseSuccess(c, o)
+				return
+			}
 		}
 
-		return counter
+		responseGormErr(c, gorm.ErrRecordNotFound)
+		return
 	}
 
-	cur4Seats := countCurrentSeats(4)
-	cur7Seats := countCurrentSeats(7)
-	cur15Seats := countCurrentSeats(15)
+	total := &getGarageConfigResponse{}
+	for _, o := range occupancies {
+		total.Max4Seats += o.Max4Seats
+		total.Max7Seats += o.Max7Seats
+		total.Max15Seats += o.Max15Seats
+		total.Total += o.Total
+		total.Current4Seats += o.Current4Seats
+		total.Current7Seats += o.Current7Seats
+		total.Current15Seats += o.Current15Seats
+		total.CurrentTotal += o.CurrentTotal
+	}
 
-	responseSuccess(c, getGarageConfigResponse{
-		Max4Seats:  configs[model.GarageConfigTypeMax4Seats],
-		Max7Seats:  configs[model.GarageConfigTypeMax7Seats],
-		Max15Seats: configs[model.GarageConfigTypeMax15Seats],
-		Total: configs[model.GarageConfigTypeMax4Seats] +
-			configs[model.GarageConfigTypeMax7Seats] +
-			configs[model.GarageConfigTypeMax15Seats],
-		Current4Seats:  cur4Seats,
-		Current7Seats:  cur7Seats,
-		Current15Seats: cur15Seats,
-		CurrentTotal:   cur4Seats + cur7Seats + cur15Seats,
-	})
+	responseSuccess(c, total)
 }
 
 type updateGarageConfigRequest struct {
+	GarageID   int `json:"garage_id" binding:"required"`
 	Max4Seats  int `json:"max_4_seats"`
 	Max7Seats  int `json:"max_7_seats"`
 	Max15Seats int `json:"max_15_seats"`
 }
 
+// HandleUpdateGarageConfigs sets the capacity of a garage, a zero capacity keeps the current one
 func (s *Server) HandleUpdateGarageConfigs(c *gin.Context) {
 	req := updateGarageConfigRequest{}
 	if err := c.BindJSON(&req); err != nil {
@@ -144,8 +147,18 @@ func (s *Server) HandleUpdateGarageConfigs(c *gin.Context) {
 		return
 	}
 
+	garage, err := s.store.GarageStore.GetByID(req.GarageID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
 	checkValidOfSeats := func(seatType, maxSeat int) bool {
-		counter, err := s.store.CarStore.CountBySeats(seatType, model.ParkingLotGarage, []model.CarStatus{model.CarStatusActive, model.CarStatusWaitingDelivery})
+		if maxSeat == 0 {
+			return true
+		}
+
+		counter, err := s.store.CarStore.CountBySeats(seatType, garage.ID, model.GarageSlotStatuses)
 		if err != nil {
 			responseGormErr(c, err)
 			return false
@@ -163,13 +176,17 @@ func (s *Server) HandleUpdateGarageConfigs(c *gin.Context) {
 		return
 	}
 
-	updateParams := map[model.GarageConfigType]int{
-		model.GarageConfigTypeMax4Seats:  req.Max4Seats,
-		model.GarageConfigTypeMax7Seats:  req.Max7Seats,
-		model.GarageConfigTypeMax15Seats: req.Max15Seats,
+	if req.Max4Seats != 0 {
+		garage.Max4Seats = req.Max4Seats
+	}
+	if req.Max7Seats != 0 {
+		garage.Max7Seats = req.Max7Seats
+	}
+	if req.Max15Seats != 0 {
+		garage.Max15Seats = req.Max15Seats
 	}
 
-	if err := s.store.GarageConfigStore.Update(updateParams); err != nil {
+	if err := s.store.GarageStore.Update(garage); err != nil {
 		responseInternalServerError(c, err)
 		return
 	}
@@ -188,6 +205,9 @@ const (
 type adminApproveOrRejectRequest struct {
 	CarID  int               `json:"car_id" binding:"required"`
 	Action ApplicationAction `json:"action" binding:"required"`
+	// GarageID moves a garage car to another garage on approval, by default the car stays at its
+	// garage while it has a free slot
+	GarageID int `json:"garage_id"`
 }
 
 func (s *Server) HandleAdminApproveOrRejectCar(c *gin.Context) {
@@ -203,15 +223,16 @@ func (s *Server) HandleAdminApproveOrRejectCar(c *gin.Context) {
 		return
 	}
 
+	var garage *model.Garage
 	if car.ParkingLot == model.ParkingLotGarage && (req.Action == ApplicationActionApproveRegister || req.Action == ApplicationActionApproveAppraisingCar) {
-		validSeat, err := s.checkIfInsertableNewSeat(car.CarModel.NumberOfSeats)
+		garage, err = s.assignGarage(car, req.GarageID)
 		if err != nil {
-			responseGormErr(c, err)
-			return
-		}
+			if errors.Is(err, errNotEnoughSlotAtGarage) {
+				responseCustomErr(c, ErrCodeNotEnoughSlotAtGarage, err)
+				return
+			}
 
-		if !validSeat {
-			responseCustomErr(c, ErrCodeNotEnoughSlotAtGarage, errors.New("not enough slot at garage"))
+			responseGormErr(c, err)
 			return
 		}
 	}
@@ -277,6 +298,14 @@ func (s *Server) HandleAdminApproveOrRejectCar(c *gin.Context) {
 		updateValues["partner_contract_status"] = string(model.PartnerContractStatusWaitingForAgreement)
 	}
 
+	if garage != nil {
+		car.PickUpAt(garage)
+		updateValues["garage_id"] = car.GarageID
+		updateValues["pickup_address"] = car.PickupAddress
+		updateValues["latitude"] = car.Latitude
+		updateValues["longitude"] = car.Longitude
+	}
+
 	if err := s.store.CarStore.Update(car.ID, updateValues); err != nil {
 		responseInternalServerError(c, err)
 		return
@@ -341,31 +370,6 @@ func (s *Server) HandleAdminInactiveCar(c *gin.Context) {
 	responseSuccess(c, gin.H{"status": "set car status to inactive successfully"})
 }
 
-func seatNumberToGarageConfigType(seatNumber int) model.GarageConfigType {
-	seatCode := model.GarageConfigTypeMax4Seats
-	if seatNumber == 7 {
-		seatCode = model.GarageConfigTypeMax7Seats
-	} else if seatNumber == 15 {
-		seatCode = model.GarageConfigTypeMax15Seats
-	}
-
-	return seatCode
-}
-
-func (s *Server) checkIfInsertableNewSeat(seatNumber int) (bool, error) {
-	garageCfg, err := s.store.GarageConfigStore.Get()
-	if err != nil {
-		return false, err
-	}
-
-	cur, err := s.store.CarStore.CountBySeats(seatNumber, model.ParkingLotGarage, []model.CarStatus{model.CarStatusActive, model.CarStatusWaitingDelivery})
-	if err != nil {
-		return false, err
-	}
-
-	return cur < garageCfg[seatNumberToGarageConfigType(seatNumber)], nil
-}
-
 func convertUTCToGmt7(t time.Time) time.Time {
 	return t.Add(7 * time.Hour)
 }
@@ -387,7 +391,7 @@ func (s *Server) InternalRenderPartnerContractPDF(partner *model.Account, car *m
 	startYear, startMonth, startDate := contract.StartDate.Date()
 	endYear, endMonth, endDate := contract.EndDate.Date()
 
-	docUUID, err := s.pdfService.Render(service.RenderTypePartner, map[string]string{
+	rendered, err := s.pdfService.Render(service.RenderTypePartner, car.PartnerContractTemplateVersion, map[string]string{
 		"now_date":                strconv.Itoa(date),
 		"now_month":               strconv.Itoa(int(month)),
 		"now_year":                strconv.Itoa(year),
@@ -417,7 +421,10 @@ func (s *Server) InternalRenderPartnerContractPDF(partner *model.Account, car *m
 
 	if err := s.store.CarStore.Update(
 		car.ID,
-		map[string]interface{}{"partner_contract_url": s.fromUUIDToURL(docUUID, model.ExtensionPDF)},
+		map[string]interface{}{
+			"partner_contract_url":              s.fromUUIDToURL(rendered.UUID, model.ExtensionPDF),
+			"partner_contract_template_version": rendered.TemplateVersion,
+		},
 	); err != nil {
 		fmt.Printf("error when update partner contract URL %v\n", err)
 		return err
@@ -451,7 +458,7 @@ func (s *Server) InternalRenderCustomerContractPDF(
 		collateralAmount = rule.CollateralCashAmount
 	}
 
-	docUUID, err := s.pdfService.Render(service.RenderTypeCustomer, map[string]string{
+	rendered, err := s.pdfService.Render(service.RenderTypeCustomer, contract.TemplateVersion, map[string]string{
 		"now_date":               strconv.Itoa(nowDate),
 		"now_month":              strconv.Itoa(int(nowMonth)),
 		"now_year":               strconv.Itoa(nowYear),
@@ -486,7 +493,10 @@ func (s *Server) InternalRenderCustomerContractPDF(
 
 	if err := s.store.CustomerContractStore.Update(
 		contract.ID,
-		map[string]interface{}{"url": s.fromUUIDToURL(docUUID, model.ExtensionPDF)},
+		map[string]interface{}{
+			"url":              s.fromUUIDToURL(rendered.UUID, model.ExtensionPDF),
+			"template_version": rendered.TemplateVersion,
+		},
 	); err != nil {
 		fmt.Printf("error when update customer contract URL %v\n", err)
 		return err
@@ -587,7 +597,9 @@ func (s *Server) HandleAdminApproveOrRejectCustomerContract(c *gin.Context) {
 	}
 
 	newStatus := string(model.CustomerContractStatusCancel)
+	var fromStatuses []model.CustomerContractStatus
 	if req.Action == CustomerContractActionApprove {
+		fromStatuses = []model.CustomerContractStatus{model.CustomerContractStatusAppraisingCarApproved}
 		if contract.Status != model.CustomerContractStatusAppraisingCarApproved {
 			responseCustomErr(c, ErrCodeInvalidCustomerContractStatus, errors.New(
 				fmt.Sprintf("invalid customer contract status. expect %s, found %s",
@@ -609,6 +621,23 @@ func (s *Server) HandleAdminApproveOrRejectCustomerContract(c *gin.Context) {
 		newStatus = string(model.CustomerContractStatusRenting)
 	}
 
+	t := &service.CustomerContractTransition{
+		CustomerContractID: contract.ID,
+		From:               fromStatuses,
+		To:                 model.CustomerContractStatus(newStatus),
+		Actor:              s.contractActor(c),
+		Reason:             req.Reason,
+	}
+	if newStatus == string(model.CustomerContractStatusCancel) {
+		if _, err := s.cancellationEngine.Cancel(t); err != nil {
+			responseCancelErr(c, err)
+			return
+		}
+	} else if _, err := s.contractStateMachine.Transit(t); err != nil {
+		responseTransitErr(c, err)
+		return
+	}
+
 	go func() {
 		if newStatus == string(model.CustomerContractStatusRenting) {
 			expoToken, phone := s.getExpoToken(contract.Customer.PhoneNumber), contract.Customer.PhoneNumber
@@ -619,16 +648,6 @@ func (s *Server) HandleAdminApproveOrRejectCustomerContract(c *gin.Context) {
 		}
 	}()
 
-	updatedValues := map[string]interface{}{"status": newStatus}
-	if len(req.Reason) >= 0 && newStatus == string(model.CustomerContractStatusCancel) {
-		updatedValues["reason"] = req.Reason
-	}
-
-	if err := s.store.CustomerContractStore.Update(contract.ID, updatedValues); err != nil {
-		responseGormErr(c, err)
-		return
-	}
-
 	go func() {
 		if req.Action == CustomerContractActionReject {
 			phone, expoToken := contract.Customer.PhoneNumber, s.getExpoToken(contract.Customer.PhoneNumber)
@@ -702,7 +721,12 @@ type customerPaymentResponse struct {
 	Payer string `json:"payer"`
 }
 
-var AdminAsPayer = []model.PaymentType{model.PaymentTypeReturnCollateralCash, model.PaymentTypeReturnPrepay}
+var AdminAsPayer = []model.PaymentType{
+	model.PaymentTypeReturnCollateralCash,
+	model.PaymentTypeReturnPrepay,
+	model.PaymentTypeReturnExtension,
+	model.PaymentTypeReturnRemainingPay,
+}
 
 func newCustomerPaymentResponse(p *model.CustomerPayment) *customerPaymentResponse {
 	r := &customerPaymentResponse{CustomerPayment: p}
@@ -744,11 +768,12 @@ func (s *Server) HandleAdminGetCustomerPayments(c *gin.Context) {
 }
 
 type generateCustomerPaymentQRCode struct {
-	CustomerContractID int               `json:"customer_contract_id" binding:"required"`
-	ReturnURL          string            `json:"return_url" binding:"required"`
-	PaymentType        model.PaymentType `json:"payment_type" binding:"required"`
-	Amount             int               `json:"amount" binding:"required"`
-	Note               string            `json:"note"`
+	CustomerContractID int                  `json:"customer_contract_id" binding:"required"`
+	ReturnURL          string               `json:"return_url" binding:"required"`
+	PaymentType        model.PaymentType    `json:"payment_type" binding:"required"`
+	Amount             int                  `json:"amount" binding:"required"`
+	Note               string               `json:"note"`
+	Gateway            model.PaymentGateway `json:"gateway"`
 }
 
 func (s *Server) HandleAdminGenerateCustomerPaymentQRCode(c *gin.Context) {
@@ -758,10 +783,16 @@ func (s *Server) HandleAdminGenerateCustomerPaymentQRCode(c *gin.Context) {
 		return
 	}
 
+	if _, err := s.PaymentGateways.Get(req.Gateway); err != nil {
+		responseCustomErr(c, ErrCodeUnsupportedPaymentGateway, err)
+		return
+	}
+
 	originURL, err := s.GenerateCustomerContractPaymentQRCode(
 		req.CustomerContractID,
 		req.Amount,
 		req.PaymentType,
+		req.Gateway,
 		req.ReturnURL,
 		req.Note,
 	)
@@ -785,8 +816,9 @@ func (s *Server) HandleAdminGenerateCustomerPaymentQRCode(c *gin.Context) {
 }
 
 type generateMultipleCustomerPaymentQRCode struct {
-	CustomerPaymentIDs []int  `json:"customer_payment_ids" binding:"required"`
-	ReturnURL          string `json:"return_url"`
+	CustomerPaymentIDs []int                `json:"customer_payment_ids" binding:"required"`
+	ReturnURL          string               `json:"return_url"`
+	Gateway            model.PaymentGateway `json:"gateway"`
 }
 
 func (s *Server) HandleAdminGenerateMultipleCustomerPayments(c *gin.Context) {
@@ -796,6 +828,11 @@ func (s *Server) HandleAdminGenerateMultipleCustomerPayments(c *gin.Context) {
 		return
 	}
 
+	if _, err := s.PaymentGateways.Get(req.Gateway); err != nil {
+		responseCustomErr(c, ErrCodeUnsupportedPaymentGateway, err)
+		return
+	}
+
 	pendingPayments, err := s.store.CustomerPaymentStore.GetPendingBatch(req.CustomerPaymentIDs)
 	if err != nil {
 		responseGormErr(c, err)
@@ -809,7 +846,7 @@ func (s *Server) HandleAdminGenerateMultipleCustomerPayments(c *gin.Context) {
 		ids[i] = p.ID
 	}
 
-	url, err := s.PaymentService.GeneratePaymentURL(ids, amt, time.Now().Format("02150405"), req.ReturnURL)
+	url, err := s.generateCustomerPaymentURL(req.Gateway, ids, amt, req.ReturnURL)
 	if err != nil {
 		responseCustomErr(c, ErrCodeGenerateQRCode, err)
 		return
@@ -844,7 +881,7 @@ func (s *Server) HandleAdminGenerateMultiplePartnerPayments(c *gin.Context) {
 	}
 
 	txnRef := fmt.Sprintf("%s__%s", PrefixPartnerPayment, time.Now().Format("02150405"))
-	url, err := s.PaymentService.GeneratePaymentURL(ids, amt, txnRef, req.ReturnURL)
+	url, err := s.PaymentGateways.Default().GeneratePaymentURL(newPaymentOrder(ids, amt, txnRef, req.ReturnURL))
 	if err != nil {
 		responseCustomErr(c, ErrCodeGenerateQRCode, err)
 		return
@@ -857,6 +894,25 @@ type returnCarCustomerContractRequest struct {
 	CustomerContractID int `json:"customer_contract_id" binding:"required"`
 }
 
+// chargeOvertimeAtReturn charges the overtime of a contract up to now, as the background checker
+// may be behind, and tells the customer about it
+func (s *Server) chargeOvertimeAtReturn(contract *model.CustomerContract) error {
+	charge, err := s.contractStateMachine.ChargeOvertime(contract.ID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if charge != nil {
+		go func() {
+			phone, expoToken := contract.Customer.PhoneNumber, s.getExpoToken(contract.Customer.PhoneNumber)
+			msg := s.notificationPushService.NewCustomerOvertimeFeeMsg(contract.ID, charge.Payment.Amount, expoToken, phone)
+			_ = s.notificationPushService.Push(contract.CustomerID, msg)
+		}()
+	}
+
+	return nil
+}
+
 func (s *Server) HandleAdminReturnCarCustomerContract(c *gin.Context) {
 	req := returnCarCustomerContractRequest{}
 	if err := c.BindJSON(&req); err != nil {
@@ -870,16 +926,19 @@ func (s *Server) HandleAdminReturnCarCustomerContract(c *gin.Context) {
 		return
 	}
 
-	if contract.Status != model.CustomerContractStatusRenting {
-		responseCustomErr(c, ErrCodeInvalidCustomerContractStatus,
-			fmt.Errorf("customer contract status required %s, found %s", model.CustomerContractStatusRenting, contract.Status))
+	if err := s.chargeOvertimeAtReturn(contract); err != nil {
+		responseGormErr(c, err)
 		return
 	}
 
-	if err := s.store.CustomerContractStore.Update(req.CustomerContractID, map[string]interface{}{
-		"status": string(model.CustomerContractStatusReturnedCar),
+	if _, err := s.contractStateMachine.Transit(&service.CustomerContractTransition{
+		CustomerContractID: contract.ID,
+		From:               []model.CustomerContractStatus{model.CustomerContractStatusRenting},
+		To:                 model.CustomerContractStatusReturnedCar,
+		Actor:              s.contractActor(c),
+		Reason:             "customer returned car",
 	}); err != nil {
-		responseGormErr(c, err)
+		responseTransitErr(c, err)
 		return
 	}
 
@@ -923,11 +982,14 @@ func (s *Server) HandleAdminCompleteCustomerContract(c *gin.Context) {
 		return
 	}
 
-	if err := s.store.CustomerContractStore.Update(
-		req.CustomerContractID,
-		map[string]interface{}{"status": model.CustomerContractStatusCompleted},
-	); err != nil {
-		responseGormErr(c, err)
+	if _, err := s.contractStateMachine.Transit(&service.CustomerContractTransition{
+		CustomerContractID: req.CustomerContractID,
+		From:               []model.CustomerContractStatus{model.CustomerContractStatusAppraisedReturnCar},
+		To:                 model.CustomerContractStatusCompleted,
+		Actor:              s.contractActor(c),
+		Reason:             "admin completed contract",
+	}); err != nil {
+		responseTransitErr(c, err)
 		return
 	}
 
@@ -1077,6 +1139,19 @@ func (s *Server) HandleAdminUpdateReturnCollateralAsset(c *gin.Context) {
 		return
 	}
 
+	contract, err := s.store.CustomerContractStore.FindByID(req.CustomerContractID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if req.NewStatus {
+		if err := s.refundCollateralCash(contract); err != nil {
+			responseCustomErr(c, ErrCodeRefundCustomerPayment, err)
+			return
+		}
+	}
+
 	if err := s.store.CustomerContractStore.Update(
 		req.CustomerContractID,
 		map[string]interface{}{"is_return_collateral_asset": req.NewStatus},
@@ -1086,12 +1161,6 @@ func (s *Server) HandleAdminUpdateReturnCollateralAsset(c *gin.Context) {
 	}
 
 	if req.NewStatus {
-		contract, err := s.store.CustomerContractStore.FindByID(req.CustomerContractID)
-		if err != nil {
-			responseGormErr(c, err)
-			return
-		}
-
 		acct, err := s.store.AccountStore.GetByID(contract.CustomerID)
 		if err != nil {
 			responseGormErr(c, err)
@@ -1137,6 +1206,8 @@ type AdminMakeMonthlyPartnerPayments struct {
 	ReturnURL string    `json:"return_url" binding:"required"`
 }
 
+// HandleAdminMakeMonthlyPartnerPayments settles the partners for a period, settling the same
+// period again only picks up contracts completed since
 func (s *Server) HandleAdminMakeMonthlyPartnerPayments(c *gin.Context) {
 	req := AdminMakeMonthlyPartnerPayments{}
 	if err := c.BindJSON(&req); err != nil {
@@ -1144,100 +1215,33 @@ func (s *Server) HandleAdminMakeMonthlyPartnerPayments(c *gin.Context) {
 		return
 	}
 
-	completedContracts, err := s.store.CustomerContractStore.
-		GetByStatusEndTimeInRange(req.StartDate, req.EndDate, model.CustomerContractStatusCompleted)
+	payments, err := s.partnerSettlement.Settle(req.StartDate, req.EndDate)
 	if err != nil {
 		responseGormErr(c, err)
 		return
 	}
 
-	// partnerID -> list of customer contract IDs
-	partnerPayments := make(map[int][]int, 0)
-
-	// partnerID -> needed pay amount
-	amounts := make(map[int]int, 0)
-
-	for _, contract := range completedContracts {
-		partnerID := contract.Car.PartnerID
-		_, existed := partnerPayments[partnerID]
-		if !existed {
-			partnerPayments[partnerID] = []int{}
-		}
-		partnerPayments[partnerID] = append(partnerPayments[partnerID], contract.ID)
-
-		_, existed = amounts[partnerID]
-		if !existed {
-			amounts[partnerID] = 0
-		}
-		amounts[partnerID] += contract.RentPrice * int(100-contract.Car.PartnerContractRule.RevenueSharingPercent) / 100
-	}
-
-	for partnerID, cusContractIds := range partnerPayments {
-		history := &model.PartnerPaymentHistory{
-			PartnerID: partnerID,
-			StartDate: req.StartDate,
-			EndDate:   req.EndDate,
-			Amount:    amounts[partnerID],
-			Status:    model.PartnerPaymentHistoryStatusPending,
-		}
-		if err := s.store.PartnerPaymentHistoryStore.Create(history, cusContractIds); err != nil {
-			responseGormErr(c, err)
-			return
-		}
-
-		if err := s.generatePartnerPaymentQRCode(history.ID, history.Amount, req.ReturnURL); err != nil {
+	for _, payment := range payments {
+		if err := s.generatePartnerPaymentQRCode(payment.ID, payment.Amount, req.ReturnURL); err != nil {
 			responseCustomErr(c, ErrCodeGenerateQRCode, err)
 			return
 		}
 	}
 
-	responseSuccess(c, gin.H{"status": "generate monthly partner payment successfully"})
+	responseSuccess(c, payments)
 }
 
 func (s *Server) InternalMakeMonthlyPayment(
 	startDate, endDate time.Time,
 	returnURL string,
 ) error {
-	completedContracts, err := s.store.CustomerContractStore.
-		GetByStatusEndTimeInRange(startDate, endDate, model.CustomerContractStatusCompleted)
+	payments, err := s.partnerSettlement.Settle(startDate, endDate)
 	if err != nil {
 		return err
 	}
 
-	// partnerID -> list of customer contract IDs
-	partnerPayments := make(map[int][]int, 0)
-
-	// partnerID -> needed pay amount
-	amounts := make(map[int]int, 0)
-
-	for _, contract := range completedContracts {
-		partnerID := contract.Car.PartnerID
-		_, existed := partnerPayments[partnerID]
-		if !existed {
-			partnerPayments[partnerID] = []int{}
-		}
-		partnerPayments[partnerID] = append(partnerPayments[partnerID], contract.ID)
-
-		_, existed = amounts[partnerID]
-		if !existed {
-			amounts[partnerID] = 0
-		}
-		amounts[partnerID] += contract.RentPrice * int(100-contract.Car.PartnerContractRule.RevenueSharingPercent) / 100
-	}
-
-	for partnerID, cusContractIds := range partnerPayments {
-		history := &model.PartnerPaymentHistory{
-			PartnerID: partnerID,
-			StartDate: startDate,
-			EndDate:   endDate,
-			Amount:    amounts[partnerID],
-			Status:    model.PartnerPaymentHistoryStatusPending,
-		}
-		if err := s.store.PartnerPaymentHistoryStore.Create(history, cusContractIds); err != nil {
-			return err
-		}
-
-		if err := s.generatePartnerPaymentQRCode(history.ID, history.Amount, returnURL); err != nil {
+	for _, payment := range payments {
+		if err := s.generatePartnerPaymentQRCode(payment.ID, payment.Amount, returnURL); err != nil {
 			return err
 		}
 	}
@@ -1249,7 +1253,7 @@ const PrefixPartnerPayment = "partner_payment"
 
 func (s *Server) generatePartnerPaymentQRCode(partnerPaymentID, amount int, returnURL string) error {
 	txnRef := fmt.Sprintf("%s__%s", PrefixPartnerPayment, time.Now().Format("02150405"))
-	url, err := s.PaymentService.GeneratePaymentURL([]int{partnerPaymentID}, amount, txnRef, returnURL)
+	url, err := s.PaymentGateways.Default().GeneratePaymentURL(newPaymentOrder([]int{partnerPaymentID}, amount, txnRef, returnURL))
 	if err != nil {
 		return err
 	}
@@ -1317,23 +1321,18 @@ func (s *Server) HandleAdminChangeCar(c *gin.Context) {
 		responseCustomErr(c, ErrCodeInvalidCustomerContractStatus, err)
 		return
 	}
+	prevStatus := contract.Status
 
-	isOverlap, err := s.store.CustomerContractStore.IsOverlap(req.NewCarID, contract.StartDate, contract.EndDate)
-	if err != nil {
-		responseGormErr(c, err)
-		return
-	}
-
-	if isOverlap {
-		responseCustomErr(c, ErrCodeOverlapOtherContract, err)
-		return
-	}
-
-	if err := s.store.CustomerContractStore.Update(req.CustomerContractID, map[string]interface{}{
-		"car_id": req.NewCarID,
-		"status": model.CustomerContractStatusOrdered,
+	// the booking moves to the new car with the transition, it fails if the new car is reserved
+	if _, err := s.contractStateMachine.Transit(&service.CustomerContractTransition{
+		CustomerContractID: req.CustomerContractID,
+		From:               []model.CustomerContractStatus{prevStatus},
+		To:                 model.CustomerContractStatusOrdered,
+		Actor:              s.contractActor(c),
+		Reason:             fmt.Sprintf("admin changed car from %d to %d", contract.CarID, req.NewCarID),
+		Values:             map[string]interface{}{"car_id": req.NewCarID},
 	}); err != nil {
-		responseGormErr(c, err)
+		responseTransitErr(c, err)
 		return
 	}
 
@@ -1390,6 +1389,24 @@ type AdminCreateCustomerContractRuleRequest struct {
 	InsurancePercent     float64 `json:"insurance_percent" binding:"required"`
 	PrepayPercent        float64 `json:"prepay_percent" binding:"required"`
 	CollateralCashAmount int     `json:"collateral_cash_amount" binding:"required"`
+	// the cancellation policy falls back to the defaults when it is left out
+	CancellableStatuses         []model.CustomerContractStatus  `json:"cancellable_statuses"`
+	PartnerCancelWarningPenalty *int                            `json:"partner_cancel_warning_penalty"`
+	CancellationRefundTiers     []cancellationRefundTierRequest `json:"cancellation_refund_tiers" binding:"dive"`
+	DeliveryFeeTiers            []deliveryFeeTierRequest        `json:"delivery_fee_tiers" binding:"dive"`
+	OvertimeFeeUnit             model.OvertimeFeeUnit           `json:"overtime_fee_unit" binding:"omitempty,oneof=hour day"`
+	OvertimeFeePercent          *float64                        `json:"overtime_fee_percent" binding:"omitempty,min=0"`
+	OvertimeGraceMinutes        *int                            `json:"overtime_grace_minutes" binding:"omitempty,min=0"`
+}
+
+type cancellationRefundTierRequest struct {
+	MinHoursBeforeStart int     `json:"min_hours_before_start" binding:"min=0"`
+	RefundPercent       float64 `json:"refund_percent" binding:"min=0,max=100"`
+}
+
+type deliveryFeeTierRequest struct {
+	MaxDistanceKm float64 `json:"max_distance_km" binding:"gt=0"`
+	Fee           int     `json:"fee" binding:"min=0"`
 }
 
 func (s *Server) HandleAdminCreateCustomerContractRule(c *gin.Context) {
@@ -1399,11 +1416,53 @@ func (s *Server) HandleAdminCreateCustomerContractRule(c *gin.Context) {
 		return
 	}
 
-	if err := s.store.CustomerContractRuleStore.Create(&model.CustomerContractRule{
-		InsurancePercent:     req.InsurancePercent,
-		PrepayPercent:        req.PrepayPercent,
-		CollateralCashAmount: req.CollateralCashAmount,
-	}); err != nil {
+	rule := &model.CustomerContractRule{
+		InsurancePercent:            req.InsurancePercent,
+		PrepayPercent:               req.PrepayPercent,
+		CollateralCashAmount:        req.CollateralCashAmount,
+		CancellableStatuses:         model.JoinCustomerContractStatuses(model.DefaultCancellableStatuses),
+		PartnerCancelWarningPenalty: model.DefaultPartnerCancelWarningPenalty,
+		CancellationRefundTiers:     model.DefaultCancellationRefundTiers(),
+		DeliveryFeeTiers:            model.DefaultDeliveryFeeTiers(),
+		OvertimeFeeUnit:             model.DefaultOvertimeFeeUnit,
+		OvertimeFeePercent:          model.DefaultOvertimeFeePercent,
+		OvertimeGraceMinutes:        model.DefaultOvertimeGraceMinutes,
+	}
+	if len(req.CancellableStatuses) > 0 {
+		rule.CancellableStatuses = model.JoinCustomerContractStatuses(req.CancellableStatuses)
+	}
+	if req.PartnerCancelWarningPenalty != nil {
+		rule.PartnerCancelWarningPenalty = *req.PartnerCancelWarningPenalty
+	}
+	if req.CancellationRefundTiers != nil {
+		rule.CancellationRefundTiers = make([]*model.CancellationRefundTier, len(req.CancellationRefundTiers))
+		for i, tier := range req.CancellationRefundTiers {
+			rule.CancellationRefundTiers[i] = &model.CancellationRefundTier{
+				MinHoursBeforeStart: tier.MinHoursBeforeStart,
+				RefundPercent:       tier.RefundPercent,
+			}
+		}
+	}
+	if req.DeliveryFeeTiers != nil {
+		rule.DeliveryFeeTiers = make([]*model.DeliveryFeeTier, len(req.DeliveryFeeTiers))
+		for i, tier := range req.DeliveryFeeTiers {
+			rule.DeliveryFeeTiers[i] = &model.DeliveryFeeTier{
+				MaxDistanceKm: tier.MaxDistanceKm,
+				Fee:           tier.Fee,
+			}
+		}
+	}
+	if req.OvertimeFeeUnit != "" {
+		rule.OvertimeFeeUnit = req.OvertimeFeeUnit
+	}
+	if req.OvertimeFeePercent != nil {
+		rule.OvertimeFeePercent = *req.OvertimeFeePercent
+	}
+	if req.OvertimeGraceMinutes != nil {
+		rule.OvertimeGraceMinutes = *req.OvertimeGraceMinutes
+	}
+
+	if err := s.store.CustomerContractRuleStore.Create(rule); err != nil {
 		responseGormErr(c, err)
 		return
 	}
@@ -1459,12 +1518,28 @@ func (s *Server) HandleAdminUpdateWarningCount(c *gin.Context) {
 		return
 	}
 
-	acct, err := s.store.AccountStore.GetByID(car.PartnerID)
+	inactivated, err := s.applyWarningCount(car)
 	if err != nil {
 		responseGormErr(c, err)
 		return
 	}
 
+	if inactivated {
+		responseSuccess(c, gin.H{"status": "update warning count successfully. Car status changed to inactive"})
+		return
+	}
+
+	responseSuccess(c, gin.H{"status": "update warning count successfully"})
+}
+
+// applyWarningCount deactivates a car whose warning count is over its max, otherwise it warns the
+// partner about the new count. It returns whether the car was deactivated.
+func (s *Server) applyWarningCount(car *model.Car) (bool, error) {
+	acct, err := s.store.AccountStore.GetByID(car.PartnerID)
+	if err != nil {
+		return false, err
+	}
+
 	if car.WarningCount > car.PartnerContractRule.MaxWarningCount {
 		msg := s.notificationPushService.NewInactiveCarMsg(car.ID, s.getExpoToken(car.Account.PhoneNumber), car.Account.PhoneNumber)
 		_ = s.notificationPushService.Push(car.Account.ID, msg)
@@ -1472,12 +1547,10 @@ func (s *Server) HandleAdminUpdateWarningCount(c *gin.Context) {
 		if err := s.store.CarStore.Update(car.ID, map[string]interface{}{
 			"status": model.CarStatusInactive,
 		}); err != nil {
-			responseGormErr(c, err)
-			return
+			return false, err
 		}
 
-		responseSuccess(c, gin.H{"status": "update warning count successfully. Car status changed to inactive"})
-		return
+		return true, nil
 	}
 
 	msg := s.notificationPushService.NewWarningCountMsg(
@@ -1489,7 +1562,7 @@ func (s *Server) HandleAdminUpdateWarningCount(c *gin.Context) {
 	)
 
 	_ = s.notificationPushService.Push(car.PartnerID, msg)
-	responseSuccess(c, gin.H{"status": "update warning count successfully"})
+	return false, nil
 }
 
 func (s *Server) HandleAdminGetCarModels(c *gin.Context) {
@@ -1611,9 +1684,14 @@ func (s *Server) HandleAdminSetCustomerContractResolveStatus(c *gin.Context) {
 		return
 	}
 
-	if err := s.store.CustomerContractStore.Update(
-		req.CustomerContractID, map[string]interface{}{"status": string(req.NewStatus)}); err != nil {
-		responseGormErr(c, err)
+	if _, err := s.contractStateMachine.Transit(&service.CustomerContractTransition{
+		CustomerContractID: req.CustomerContractID,
+		From:               []model.CustomerContractStatus{requiredPrevStatus},
+		To:                 req.NewStatus,
+		Actor:              s.contractActor(c),
+		Reason:             "admin set resolve status",
+	}); err != nil {
+		responseTransitErr(c, err)
 		return
 	}
 
@@ -1648,6 +1726,9 @@ func (s *Server) HandleAdminSetCustomerContractResolveStatus(c *gin.Context) {
 type checkPaymentStatusRequest struct {
 	OrderInfo string `form:"vnp_OrderInfo"`
 	TxnRef    string `form:"vnp_TxnRef"`
+	// order_info and txn_ref are used by return urls of gateways other than VNPay
+	GatewayOrderInfo string `form:"order_info"`
+	GatewayTxnRef    string `form:"txn_ref"`
 }
 
 func (s *Server) HandleCheckPaymentStatus(c *gin.Context) {
@@ -1657,6 +1738,10 @@ func (s *Server) HandleCheckPaymentStatus(c *gin.Context) {
 		return
 	}
 
+	if req.OrderInfo == "" {
+		req.OrderInfo, req.TxnRef = req.GatewayOrderInfo, req.GatewayTxnRef
+	}
+
 	ids := decodeOrderInfo(req.OrderInfo)
 	status := "paid"
 	if strings.HasPrefix(req.TxnRef, PrefixPartnerPayment) {
@@ -1673,6 +1758,7 @@ func (s *Server) HandleCheckPaymentStatus(c *gin.Context) {
 			}
 		}
 	} else {
+		payments := make([]*model.CustomerPayment, 0, len(ids))
 		for _, id := range ids {
 			p, err := s.store.CustomerPaymentStore.GetByID(id)
 			if err != nil {
@@ -1680,11 +1766,15 @@ func (s *Server) HandleCheckPaymentStatus(c *gin.Context) {
 				return
 			}
 
+			payments = append(payments, p)
 			if p.Status == model.PaymentStatusPending {
 				status = string(model.PaymentStatusPending)
-				break
 			}
 		}
+
+		if status == string(model.PaymentStatusPending) && s.queryCustomerPaymentStatus(payments) {
+			status = string(model.PaymentStatusPaid)
+		}
 	}
 
 	responseSuccess(c, gin.H{"status": status})
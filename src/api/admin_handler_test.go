@@ -22,10 +22,14 @@ import (
 func TestAdminHandler_GarageConfigs(t *testing.T) {
 	t.Parallel()
 
+	garage := &model.Garage{Name: "Config garage", Address: "1 Config street"}
+	require.NoError(t, TestDb.GarageStore.Create(garage))
+
 	route := TestServer.AllRoutes()[RouteUpdateGarageConfigs]
 	_, accessPayload := seedAccountAndLogin("admin1", "admin1", model.RoleIDAdmin)
 
 	r := updateGarageConfigRequest{
+		GarageID:   garage.ID,
 		Max4Seats:  3,
 		Max7Seats:  6,
 		Max15Seats: 9,
@@ -38,7 +42,7 @@ func TestAdminHandler_GarageConfigs(t *testing.T) {
 	require.Equal(t, http.StatusOK, recorder.Code)
 
 	route = TestServer.AllRoutes()[RouteGetGarageConfigs]
-	req, _ = http.NewRequest(route.Method, route.Path, nil)
+	req, _ = http.NewRequest(route.Method, route.Path+"?garage_id="+strconv.Itoa(garage.ID), nil)
 	req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+accessPayload.AccessToken)
 	recorder = httptest.NewRecorder()
 	TestServer.route.ServeHTTP(recorder, req)
@@ -48,10 +52,12 @@ func TestAdminHandler_GarageConfigs(t *testing.T) {
 	resp := getGarageConfigResponse{}
 	require.NoError(t, unmarshalFromCommResponse(bz, &resp))
 
+	require.Equal(t, garage.ID, resp.GarageID)
 	require.Equal(t, 3, resp.Max4Seats)
 	require.Equal(t, 6, resp.Max7Seats)
 	require.Equal(t, 9, resp.Max15Seats)
 	require.Equal(t, 18, resp.Total)
+	require.Equal(t, 0, resp.CurrentTotal)
 }
 
 func TestAdminHandler_GetCar(t *testing.T) {
@@ -174,6 +180,64 @@ func TestHandleApproveCar(t *testing.T) {
 		time.Sleep(2 * time.Second)
 	})
 
+	t.Run("approve registration at a garage requires a free slot", func(t *testing.T) {
+		previousPdfService := TestServer.pdfService
+		TestServer.pdfService = &MockPDFService{}
+		defer func() {
+			TestServer.pdfService = previousPdfService
+		}()
+
+		fullGarage := &model.Garage{Name: "Full garage", Address: "1 Full street"}
+		require.NoError(t, TestDb.GarageStore.Create(fullGarage))
+		latitude, longitude := 10.5, 106.5
+		freeGarage := &model.Garage{Name: "Free garage", Address: "2 Free street", Latitude: &latitude, Longitude: &longitude, Max7Seats: 1}
+		require.NoError(t, TestDb.GarageStore.Create(freeGarage))
+
+		carModel := &model.CarModel{Brand: "toyota", NumberOfSeats: 7}
+		require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+		partner, _ := seedAccountAndLogin("partner_garage", "aaa", model.RoleIDPartner)
+		car := &model.Car{
+			PartnerID:             partner.ID,
+			CarModelID:            carModel.ID,
+			LicensePlate:          "69G001",
+			ParkingLot:            model.ParkingLotGarage,
+			Status:                model.CarStatusPendingApproval,
+			PartnerContractRuleID: 1,
+		}
+		car.PickUpAt(fullGarage)
+		require.NoError(t, TestDb.CarStore.Create(car))
+		accessToken := loginAdmin()
+
+		approve := func(carID, garageID int) *httptest.ResponseRecorder {
+			reqBz, err := json.Marshal(adminApproveOrRejectRequest{CarID: carID, Action: "approve_register", GarageID: garageID})
+			require.NoError(t, err)
+			route := TestServer.AllRoutes()[RouteAdminApproveCar]
+			req, err := http.NewRequest(
+				route.Method,
+				routeWithRole(model.RoleNameAdmin, route.Path),
+				bytes.NewReader(reqBz),
+			)
+			require.NoError(t, err)
+			req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+accessToken.AccessToken)
+			recorder := httptest.NewRecorder()
+			TestServer.route.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		recorder := approve(car.ID, fullGarage.ID)
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		recorder = approve(car.ID, freeGarage.ID)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		updatedCar, err := TestDb.CarStore.GetByID(car.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CarStatusApproved, updatedCar.Status)
+		require.Equal(t, freeGarage.ID, *updatedCar.GarageID)
+		require.Equal(t, freeGarage.Address, updatedCar.PickupAddress)
+		require.Equal(t, latitude, *updatedCar.Latitude)
+		time.Sleep(2 * time.Second)
+	})
+
 	t.Run("approve_appraising_car car", func(t *testing.T) {
 		carModel := &model.CarModel{Brand: "toyota"}
 		require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
@@ -3,6 +3,8 @@ package api
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +20,7 @@ const (
 )
 
 type NotificationMsg struct {
+	ID        int         `json:"id,omitempty"`
 	AccountID int         `json:"-"`
 	Title     string      `json:"title,omitempty"`
 	Body      string      `json:"body,omitempty"`
@@ -82,6 +85,17 @@ func (s *Server) NewCustomerContractPaymentNotificationMsg(adminID, cusContractI
 	}
 }
 
+func (s *Server) NewCustomerContractOverdueNotificationMsg(adminID, cusContractID int, licensePlate string) NotificationMsg {
+	return NotificationMsg{
+		AccountID: adminID,
+		Title:     "Thông báo của khách hàng",
+		Body:      fmt.Sprintf("Hợp đồng xe biển số %s đã quá hạn trả xe", licensePlate),
+		Data: map[string]interface{}{
+			"redirect_url": fmt.Sprintf("%scontracts/%d?fromNoti=true", s.feCfg.AdminBaseURL, cusContractID),
+		},
+	}
+}
+
 func (s *Server) NewAppraisingCarNotificationMsg(techID, carID int) NotificationMsg {
 	return NotificationMsg{
 		AccountID: techID,
@@ -104,13 +118,85 @@ func (s *Server) NewAppraisingCarOfCusContract(techID, cusContractID int) Notifi
 	}
 }
 
+var deliveryTypeTexts = map[model.DeliveryType]string{
+	model.DeliveryTypeDelivery: "giao xe cho khách hàng",
+	model.DeliveryTypeReturn:   "nhận lại xe từ khách hàng",
+}
+
+var deliveryStatusTexts = map[model.DeliveryStatus]string{
+	model.DeliveryStatusOnTheWay:  "đang di chuyển",
+	model.DeliveryStatusCompleted: "hoàn thành",
+}
+
+func (s *Server) newDeliveryMsg(techID int, delivery *model.CustomerContractDelivery, body string) NotificationMsg {
+	return NotificationMsg{
+		AccountID: techID,
+		Title:     "Thông báo lịch giao nhận xe",
+		Body:      body,
+		Data: map[string]interface{}{
+			"redirect_url": fmt.Sprintf("%s/contracts/%d", s.feCfg.TechBaseURL, delivery.CustomerContractID),
+		},
+	}
+}
+
+func (s *Server) NewDeliveryAssignedMsg(techID int, delivery *model.CustomerContractDelivery) NotificationMsg {
+	return s.newDeliveryMsg(techID, delivery, fmt.Sprintf(
+		"Bạn được phân công %s lúc %s tại %s",
+		deliveryTypeTexts[delivery.Type],
+		delivery.ScheduledAt.In(rentalLocation).Format("15:04 02/01/2006"),
+		delivery.Address,
+	))
+}
+
+func (s *Server) NewDeliveryCanceledMsg(techID int, delivery *model.CustomerContractDelivery) NotificationMsg {
+	return s.newDeliveryMsg(techID, delivery, fmt.Sprintf(
+		"Lịch %s lúc %s của bạn đã bị hủy",
+		deliveryTypeTexts[delivery.Type],
+		delivery.ScheduledAt.In(rentalLocation).Format("15:04 02/01/2006"),
+	))
+}
+
+func (s *Server) NewDeliveryStatusMsg(techID int, delivery *model.CustomerContractDelivery) NotificationMsg {
+	return s.newDeliveryMsg(techID, delivery, fmt.Sprintf(
+		"Lịch %s lúc %s đã chuyển sang trạng thái %s",
+		deliveryTypeTexts[delivery.Type],
+		delivery.ScheduledAt.In(rentalLocation).Format("15:04 02/01/2006"),
+		deliveryStatusTexts[delivery.Status],
+	))
+}
+
 type ConversationMsg struct {
 	ConversationID int    `json:"conversation_id"`
 	Sender         string `json:"sender"`
 }
 
 type AuthMsg struct {
-	AccessToken string `json:"access_token"`
+	AccessToken        string `json:"access_token"`
+	LastNotificationID int    `json:"last_notification_id"`
+}
+
+// wsSubKey identifies the subscribers of one channel for one account
+type wsSubKey struct {
+	Channel   int
+	AccountID int
+}
+
+// wsSubscriber serializes writes, gorilla websocket allows only one concurrent writer
+type wsSubscriber struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (sub *wsSubscriber) writeJSON(v interface{}) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.conn.WriteJSON(v)
+}
+
+func (sub *wsSubscriber) writeMessage(messageType int, data []byte) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.conn.WriteMessage(messageType, data)
 }
 
 func (s *Server) HandleAdminSubscribeNotification(c *gin.Context) {
@@ -125,42 +211,112 @@ func (s *Server) HandleTechnicianSubscribeNotification(c *gin.Context) {
 	s.processWsWithKey(c, TechnicianNotificationSubsKey, model.RoleNameTechnician)
 }
 
-func (s *Server) processWsWithKey(c *gin.Context, key int, role string) {
-	conn, err := s.initWsConnectionWithRole(c, role)
+func (s *Server) processWsWithKey(c *gin.Context, channel int, role string) {
+	sub, acct, auth, err := s.initWsConnectionWithRole(c, role)
 	if err != nil {
 		return
 	}
 
-	s.subscribeTo(conn, key)
-	go s.checkWsConnection(conn, key)
+	key := wsSubKey{Channel: channel, AccountID: acct.ID}
+	s.subscribeTo(sub, key)
+	if channel != AdminConversationSubsKey && auth.LastNotificationID > 0 {
+		s.replayNotifications(sub, key, auth.LastNotificationID)
+	}
+	go s.checkWsConnection(sub, key)
 }
 
-func (s *Server) initWsConnectionWithRole(c *gin.Context, role string) (*websocket.Conn, error) {
+// initWsConnectionWithRole authenticates the bearer token from the authorization header or the
+// access_token query param before upgrading. Clients sending neither authenticate with an AuthMsg
+// as the first websocket message.
+func (s *Server) initWsConnectionWithRole(c *gin.Context, role string) (*wsSubscriber, *model.Account, *AuthMsg, error) {
+	auth := &AuthMsg{}
+	auth.LastNotificationID, _ = strconv.Atoi(c.Query("last_notification_id"))
+	authorize := c.GetHeader(authorizationHeaderKey)
+	if authorize == "" && c.Query("access_token") != "" {
+		authorize = fmt.Sprintf("%s %s", authorizationTypeBearer, c.Query("access_token"))
+	}
+
+	if authorize != "" {
+		acct, err := s.authorizeWsAccount(authorize, role)
+		if err != nil {
+			responseCustomErr(c, ErrCodeVerifyAccessToken, err)
+			return nil, nil, nil, err
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			responseCustomErr(c, ErrCodeUnableUpgradeWebsocket, err)
+			return nil, nil, nil, err
+		}
+
+		return &wsSubscriber{conn: conn}, acct, auth, nil
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		responseCustomErr(c, ErrCodeUnableUpgradeWebsocket, err)
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	auth := AuthMsg{}
-	if err := conn.ReadJSON(&auth); err != nil {
+	if err := conn.ReadJSON(auth); err != nil {
 		_ = sendError(conn, err)
-		return nil, err
+		_ = conn.Close()
+		return nil, nil, nil, err
 	}
 
-	authPayload, err := s.decodeBearerAccessToken(auth.AccessToken)
+	acct, err := s.authorizeWsAccount(auth.AccessToken, role)
 	if err != nil {
 		_ = sendError(conn, err)
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+
+	return &wsSubscriber{conn: conn}, acct, auth, nil
+}
+
+func (s *Server) authorizeWsAccount(authorize string, role string) (*model.Account, error) {
+	authPayload, err := s.decodeBearerAccessToken(authorize)
+	if err != nil {
 		return nil, err
 	}
 
 	if authPayload.Role != role {
-		err := errors.New("invalid role")
-		_ = sendError(conn, err)
+		return nil, errors.New("invalid role")
+	}
+
+	acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+	if err != nil {
 		return nil, err
 	}
 
-	return conn, nil
+	if acct.Status != model.AccountStatusActive {
+		return nil, errors.New("account is not active")
+	}
+
+	return acct, nil
+}
+
+// replayNotifications sends the notifications persisted while the account was disconnected
+func (s *Server) replayNotifications(sub *wsSubscriber, key wsSubKey, lastNotificationID int) {
+	notifications, err := s.store.NotificationStore.GetByAcctIDAfterID(key.AccountID, lastNotificationID, 0)
+	if err != nil {
+		return
+	}
+
+	for _, n := range notifications {
+		if err := sub.writeJSON(NotificationMsg{
+			ID:        n.ID,
+			AccountID: n.AccountID,
+			Title:     n.Title,
+			Body:      n.Content,
+			Data: map[string]interface{}{
+				"redirect_url": n.URL,
+			},
+		}); err != nil {
+			s.removeSub(sub, key)
+			return
+		}
+	}
 }
 
 func (s *Server) startAdminAndTechSub() {
@@ -168,89 +324,106 @@ func (s *Server) startAdminAndTechSub() {
 		for {
 			select {
 			case msg := <-s.adminNotificationQueue:
-				_ = s.store.NotificationStore.Create(&model.Notification{
-					AccountID: msg.AccountID,
-					Title:     msg.Title,
-					Content:   msg.Body,
-					URL:       misc.MapGetString(msg.Data, "redirect_url"),
-					Status:    model.NotificationStatusActive,
-				})
-
-				s.sendMsgToClient(msg, AdminNotificationSubsKey)
+				s.sendMsgToClient(s.persistNotification(msg), wsSubKey{AdminNotificationSubsKey, msg.AccountID})
 				break
 			case msg := <-s.technicianNotificationQueue:
-				_ = s.store.NotificationStore.Create(&model.Notification{
-					AccountID: msg.AccountID,
-					Title:     msg.Title,
-					Content:   msg.Body,
-					URL:       misc.MapGetString(msg.Data, "redirect_url"),
-					Status:    model.NotificationStatusActive,
-				})
-
-				s.sendMsgToClient(msg, TechnicianNotificationSubsKey)
+				s.sendMsgToClient(s.persistNotification(msg), wsSubKey{TechnicianNotificationSubsKey, msg.AccountID})
 				break
 
 			case msg := <-s.adminNewConversationQueue:
-				s.sendMsgToClient(msg, AdminConversationSubsKey)
+				s.broadcastToChannel(msg, AdminConversationSubsKey)
 				break
 			}
 		}
 	}()
 }
 
-func (s *Server) sendMsgToClient(msg interface{}, key int) {
+func (s *Server) persistNotification(msg NotificationMsg) NotificationMsg {
+	notification := &model.Notification{
+		AccountID: msg.AccountID,
+		Title:     msg.Title,
+		Content:   msg.Body,
+		URL:       misc.MapGetString(msg.Data, "redirect_url"),
+		Status:    model.NotificationStatusActive,
+	}
+	if err := s.store.NotificationStore.Create(notification); err == nil {
+		msg.ID = notification.ID
+	}
+
+	return msg
+}
+
+func (s *Server) sendMsgToClient(msg interface{}, key wsSubKey) {
 	subs, ok := s.wsConnections.Load(key)
 	if !ok {
 		return
 	}
 
-	toSubs, _ := subs.([]*websocket.Conn)
+	toSubs, _ := subs.([]*wsSubscriber)
 	for _, sub := range toSubs {
-		if err := sub.WriteJSON(msg); err != nil {
+		if err := sub.writeJSON(msg); err != nil {
 			s.removeSub(sub, key)
 		}
 	}
 }
 
-func (s *Server) checkWsConnection(conn *websocket.Conn, key int) {
+// broadcastToChannel sends msg to every account subscribed to the channel
+func (s *Server) broadcastToChannel(msg interface{}, channel int) {
+	s.wsConnections.Range(func(k, _ any) bool {
+		if key, ok := k.(wsSubKey); ok && key.Channel == channel {
+			s.sendMsgToClient(msg, key)
+		}
+		return true
+	})
+}
+
+func (s *Server) checkWsConnection(sub *wsSubscriber, key wsSubKey) {
 	pingTicker := time.NewTicker(5 * time.Second)
 	defer pingTicker.Stop()
 loop:
 	for {
 		select {
 		case <-pingTicker.C:
-			if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-				s.removeSub(conn, key)
+			if err := sub.writeMessage(websocket.PingMessage, []byte{}); err != nil {
+				s.removeSub(sub, key)
 				break loop
 			}
 		}
 	}
 }
 
-func (s *Server) removeSub(conn *websocket.Conn, key int) {
+func (s *Server) removeSub(sub *wsSubscriber, key wsSubKey) {
+	s.wsSubsMu.Lock()
+	defer s.wsSubsMu.Unlock()
+
 	subs, ok := s.wsConnections.Load(key)
 	if ok {
-		curSubs, _ := subs.([]*websocket.Conn)
-		newSubs := make([]*websocket.Conn, 0)
+		curSubs, _ := subs.([]*wsSubscriber)
+		newSubs := make([]*wsSubscriber, 0)
 		for _, e := range curSubs {
-			if e != conn {
+			if e != sub {
 				newSubs = append(newSubs, e)
 			}
 		}
 
+		if len(newSubs) == 0 {
+			s.wsConnections.Delete(key)
+			return
+		}
 		s.wsConnections.Store(key, newSubs)
 	}
 }
 
-func (s *Server) subscribeTo(conn *websocket.Conn, key int) {
-	curSubscribers, isLoaded := s.wsConnections.LoadOrStore(key, []*websocket.Conn{conn})
-	if curSubs, ok := curSubscribers.([]*websocket.Conn); ok && isLoaded {
-		curSubscribers = append(curSubs, conn)
-		s.wsConnections.Store(key, curSubscribers)
+func (s *Server) subscribeTo(sub *wsSubscriber, key wsSubKey) {
+	s.wsSubsMu.Lock()
+	curSubscribers, isLoaded := s.wsConnections.LoadOrStore(key, []*wsSubscriber{sub})
+	if curSubs, ok := curSubscribers.([]*wsSubscriber); ok && isLoaded {
+		s.wsConnections.Store(key, append(curSubs, sub))
 	}
+	s.wsSubsMu.Unlock()
 
-	conn.SetCloseHandler(func(code int, text string) error {
-		s.removeSub(conn, key)
+	sub.conn.SetCloseHandler(func(code int, text string) error {
+		s.removeSub(sub, key)
 		return nil
 	})
 }
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+	"github.com/godev111222333/capstone-backend/src/token"
+)
+
+func responseCancelErr(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrCustomerContractNotCancellable) {
+		responseCustomErr(c, ErrCodeCustomerContractNotCancellable, err)
+		return
+	}
+
+	responseTransitErr(c, err)
+}
+
+// getOwnCustomerContract returns the contract when it belongs to the authenticated customer
+func (s *Server) getOwnCustomerContract(c *gin.Context, contractID int) (*model.Account, *model.CustomerContract, bool) {
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+	if err != nil {
+		responseGormErr(c, err)
+		return nil, nil, false
+	}
+
+	contract, err := s.store.CustomerContractStore.FindByID(contractID)
+	if err != nil {
+		responseGormErr(c, err)
+		return nil, nil, false
+	}
+
+	if contract.CustomerID != acct.ID {
+		responseCustomErr(c, ErrCodeInvalidOwnership, nil)
+		return nil, nil, false
+	}
+
+	return acct, contract, true
+}
+
+type customerGetCancellationQuoteRequest struct {
+	CustomerContractID int `form:"customer_contract_id" binding:"required"`
+}
+
+func (s *Server) HandleCustomerGetCancellationQuote(c *gin.Context) {
+	req := customerGetCancellationQuoteRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetCancellationQuoteRequest, err)
+		return
+	}
+
+	acct, contract, ok := s.getOwnCustomerContract(c, req.CustomerContractID)
+	if !ok {
+		return
+	}
+
+	quote, err := s.cancellationEngine.Quote(
+		contract.ID,
+		service.ContractActor{AccountID: acct.ID, Role: model.RoleNameCustomer},
+	)
+	if err != nil {
+		responseCancelErr(c, err)
+		return
+	}
+
+	responseSuccess(c, quote)
+}
+
+type customerCancelContractRequest struct {
+	CustomerContractID int    `json:"customer_contract_id" binding:"required"`
+	Reason             string `json:"reason"`
+}
+
+func (s *Server) HandleCustomerCancelContract(c *gin.Context) {
+	req := customerCancelContractRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCustomerCancelContractRequest, err)
+		return
+	}
+
+	acct, contract, ok := s.getOwnCustomerContract(c, req.CustomerContractID)
+	if !ok {
+		return
+	}
+
+	cancellation, err := s.cancellationEngine.Cancel(&service.CustomerContractTransition{
+		CustomerContractID: contract.ID,
+		Actor:              service.ContractActor{AccountID: acct.ID, Role: model.RoleNameCustomer},
+		Reason:             req.Reason,
+	})
+	if err != nil {
+		responseCancelErr(c, err)
+		return
+	}
+
+	go func() {
+		adminIds, err := s.store.AccountStore.GetAllAdminIDs()
+		if err == nil {
+			for _, id := range adminIds {
+				s.adminNotificationQueue <- s.NewCustomerContractNotificationMsg(id, contract.ID, contract.Car.LicensePlate)
+			}
+		}
+	}()
+
+	responseSuccess(c, cancellation)
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/token"
+)
+
+const (
+	DefaultCarCalendarDays = 30
+	MaxCarCalendarDays     = 92
+	MaxCarCalendarCars     = 100
+)
+
+type getCarCalendarRequest struct {
+	// CarIDs is a comma separated list of car ids
+	CarIDs string    `form:"car_ids" binding:"required"`
+	From   time.Time `form:"from"`
+	To     time.Time `form:"to"`
+}
+
+// HandleGetCarCalendar returns the booked, held and blocked ranges of the cars from now until
+// DefaultCarCalendarDays ahead unless a window is given
+func (s *Server) HandleGetCarCalendar(c *gin.Context) {
+	req := getCarCalendarRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetCarCalendarRequest, err)
+		return
+	}
+
+	arr := strings.Split(req.CarIDs, ",")
+	if len(arr) > MaxCarCalendarCars {
+		responseCustomErr(c, ErrCodeInvalidGetCarCalendarRequest, errors.New("too many car_ids"))
+		return
+	}
+
+	carIDs := make([]int, len(arr))
+	for i, str := range arr {
+		var err error
+		carIDs[i], err = strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			responseCustomErr(c, ErrCodeInvalidGetCarCalendarRequest, err)
+			return
+		}
+	}
+
+	if req.From.IsZero() {
+		req.From = time.Now()
+	}
+	if req.To.IsZero() {
+		req.To = req.From.AddDate(0, 0, DefaultCarCalendarDays)
+	}
+
+	if !req.To.After(req.From) || req.To.Sub(req.From) > MaxCarCalendarDays*24*time.Hour {
+		responseCustomErr(c, ErrCodeInvalidGetCarCalendarRequest, errors.New("invalid calendar window"))
+		return
+	}
+
+	calendar, err := s.store.CarStore.GetCalendar(carIDs, req.From, req.To)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, gin.H{
+		"from":   req.From,
+		"to":     req.To,
+		"ranges": calendar,
+	})
+}
+
+// authorizeCarOwner loads the car and checks that a partner only manages their own cars. Admins
+// manage every car.
+func (s *Server) authorizeCarOwner(c *gin.Context, carID int) (*model.Car, bool) {
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	car, err := s.store.CarStore.GetByID(carID)
+	if err != nil {
+		responseGormErr(c, err)
+		return nil, false
+	}
+
+	if authPayload.Role == model.RoleNameAdmin {
+		return car, true
+	}
+
+	acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+	if err != nil {
+		responseGormErr(c, err)
+		return nil, false
+	}
+
+	if car.PartnerID != acct.ID {
+		responseCustomErr(c, ErrCodeInvalidOwnership, nil)
+		return nil, false
+	}
+
+	return car, true
+}
+
+type createCarBlackoutRequest struct {
+	CarID     int       `json:"car_id" binding:"required"`
+	StartDate time.Time `json:"start_date" binding:"required"`
+	EndDate   time.Time `json:"end_date" binding:"required"`
+	Note      string    `json:"note"`
+}
+
+// HandleCreateCarBlackout blocks a car for personal use of its partner, customers can neither find
+// nor rent it in that period
+func (s *Server) HandleCreateCarBlackout(c *gin.Context) {
+	req := createCarBlackoutRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreateCarBlackoutRequest, err)
+		return
+	}
+
+	if !req.EndDate.After(req.StartDate) || req.EndDate.Before(time.Now()) {
+		responseCustomErr(c, ErrCodeInvalidCreateCarBlackoutRequest, errors.New("start_date must be before end_date and end_date in the future"))
+		return
+	}
+
+	if _, ok := s.authorizeCarOwner(c, req.CarID); !ok {
+		return
+	}
+
+	blackout := &model.CarReservation{
+		CarID:     req.CarID,
+		StartDate: req.StartDate,
+		EndDate:   req.EndDate,
+		Note:      strings.TrimSpace(req.Note),
+	}
+	created, err := s.store.CarReservationStore.CreateBlackout(blackout)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if !created {
+		responseCustomErr(c, ErrCodeCarReserved, errors.New("car is booked, held or blocked in that period"))
+		return
+	}
+
+	responseSuccess(c, blackout)
+}
+
+type deleteCarBlackoutRequest struct {
+	ID int `form:"id" binding:"required"`
+}
+
+func (s *Server) HandleDeleteCarBlackout(c *gin.Context) {
+	req := deleteCarBlackoutRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidDeleteCarBlackoutRequest, err)
+		return
+	}
+
+	blackout, err := s.store.CarReservationStore.GetByID(req.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if blackout.CustomerContractID != nil {
+		responseCustomErr(c, ErrCodeInvalidDeleteCarBlackoutRequest, errors.New("reservation is not a blackout"))
+		return
+	}
+
+	if _, ok := s.authorizeCarOwner(c, blackout.CarID); !ok {
+		return
+	}
+
+	released, err := s.store.CarReservationStore.ReleaseBlackout(blackout.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if !released {
+		responseCustomErr(c, ErrCodeInvalidDeleteCarBlackoutRequest, errors.New("blackout was already lifted"))
+		return
+	}
+
+	responseSuccess(c, gin.H{"status": "delete blackout successfully"})
+}
+
+type getCarBlackoutsRequest struct {
+	CarID int `form:"car_id" binding:"required"`
+}
+
+// HandleGetCarBlackouts lists the blackouts of a car that are not over yet
+func (s *Server) HandleGetCarBlackouts(c *gin.Context) {
+	req := getCarBlackoutsRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetCarBlackoutsRequest, err)
+		return
+	}
+
+	if _, ok := s.authorizeCarOwner(c, req.CarID); !ok {
+		return
+	}
+
+	blackouts, err := s.store.CarReservationStore.GetBlackouts(req.CarID, time.Now())
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, blackouts)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/store"
+)
+
+func TestCarCalendarHandler_Blackouts(t *testing.T) {
+	t.Parallel()
+
+	carModel := &model.CarModel{Brand: "Blackout", Model: "B1", NumberOfSeats: 4}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+	partner, partnerLogin := seedAccountAndLogin("0988300000", "password", model.RoleIDPartner)
+	_, otherPartnerLogin := seedAccountAndLogin("0988300001", "password", model.RoleIDPartner)
+	customer, customerLogin := seedAccountAndLogin("0988300002", "password", model.RoleIDCustomer)
+	require.NoError(t, TestDb.AccountStore.Update(customer.ID, map[string]interface{}{
+		"bank_name": "VCB", "bank_number": "0123456789", "bank_owner": "BLACKOUT",
+	}))
+	require.NoError(t, TestDb.DrivingLicenseImageStore.Create([]*model.DrivingLicenseImage{
+		{AccountID: customer.ID, URL: "front", Status: model.DrivingLicenseImageStatusActive},
+		{AccountID: customer.ID, URL: "back", Status: model.DrivingLicenseImageStatusActive},
+	}))
+
+	car := &model.Car{
+		PartnerID:             partner.ID,
+		CarModelID:            carModel.ID,
+		LicensePlate:          "BLACKOUT-1",
+		ParkingLot:            model.ParkingLotGarage,
+		Status:                model.CarStatusActive,
+		Price:                 500_000,
+		PartnerContractRuleID: 1,
+		EndDate:               time.Now().AddDate(1, 0, 0),
+	}
+	require.NoError(t, TestDb.CarStore.Create(car))
+
+	call := func(method, path, accessToken string, body interface{}) *httptest.ResponseRecorder {
+		bz, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(method, path, bytes.NewReader(bz))
+		require.NoError(t, err)
+		req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+accessToken)
+		recorder := httptest.NewRecorder()
+		TestServer.route.ServeHTTP(recorder, req)
+		return recorder
+	}
+	requireErrCode := func(recorder *httptest.ResponseRecorder, code ErrorCode) {
+		require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		resp := &CommResponse{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), resp))
+		require.Equal(t, code, resp.ErrorCode)
+	}
+
+	startDate := time.Now().AddDate(0, 0, 10).Truncate(time.Second)
+	createRoute := TestServer.AllRoutes()[RouteCreateCarBlackout]
+	createPath := routeWithRole(model.RoleNamePartner, createRoute.Path)
+	recorder := call(createRoute.Method, createPath, partnerLogin.AccessToken, createCarBlackoutRequest{
+		CarID:     car.ID,
+		StartDate: startDate,
+		EndDate:   startDate.AddDate(0, 0, 2),
+		Note:      "family trip",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	blackout := &model.CarReservation{}
+	require.NoError(t, unmarshalFromCommResponse(recorder.Body.Bytes(), blackout))
+	require.Equal(t, model.CarReservationStatusBlocked, blackout.Status)
+	require.Nil(t, blackout.CustomerContractID)
+
+	t.Run("partners can only block their cars", func(t *testing.T) {
+		recorder := call(createRoute.Method, createPath, otherPartnerLogin.AccessToken, createCarBlackoutRequest{
+			CarID:     car.ID,
+			StartDate: startDate.AddDate(0, 1, 0),
+			EndDate:   startDate.AddDate(0, 1, 1),
+		})
+		requireErrCode(recorder, ErrCodeInvalidOwnership)
+	})
+
+	t.Run("blackouts do not overlap", func(t *testing.T) {
+		recorder := call(createRoute.Method, createPath, partnerLogin.AccessToken, createCarBlackoutRequest{
+			CarID:     car.ID,
+			StartDate: startDate.AddDate(0, 0, 1),
+			EndDate:   startDate.AddDate(0, 0, 3),
+		})
+		requireErrCode(recorder, ErrCodeCarReserved)
+	})
+
+	t.Run("blocked cars can neither be found nor rented", func(t *testing.T) {
+		found, err := TestDb.CarStore.FindCars(&store.CarSearchParams{
+			StartDate: startDate.AddDate(0, 0, 1),
+			EndDate:   startDate.AddDate(0, 0, 4),
+			Keyword:   "Blackout B1",
+		})
+		require.NoError(t, err)
+		require.Empty(t, found.Cars)
+
+		rentRoute := TestServer.AllRoutes()[RouteCustomerRentCar]
+		recorder := call(rentRoute.Method, rentRoute.Path, customerLogin.AccessToken, customerRentCarRequest{
+			CarID:          car.ID,
+			StartDate:      startDate.AddDate(0, 0, 1),
+			EndDate:        startDate.AddDate(0, 0, 4),
+			CollateralType: model.CollateralTypeMotorbike,
+		})
+		requireErrCode(recorder, ErrCodeCarReserved)
+	})
+
+	getCalendar := func() []*store.CarCalendarRange {
+		calendarRoute := TestServer.AllRoutes()[RouteGetCarCalendar]
+		req, err := http.NewRequest(calendarRoute.Method, routeWithRole(model.RoleNameCustomer, calendarRoute.Path), nil)
+		require.NoError(t, err)
+		query := req.URL.Query()
+		query.Add("car_ids", fmt.Sprintf("%d", car.ID))
+		req.URL.RawQuery = query.Encode()
+		req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+customerLogin.AccessToken)
+		recorder := httptest.NewRecorder()
+		TestServer.route.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		calendar := struct {
+			Ranges []*store.CarCalendarRange `json:"ranges"`
+		}{}
+		require.NoError(t, unmarshalFromCommResponse(recorder.Body.Bytes(), &calendar))
+		return calendar.Ranges
+	}
+
+	ranges := getCalendar()
+	require.Len(t, ranges, 1)
+	require.Equal(t, store.CarCalendarRangeBlocked, ranges[0].Type)
+	require.True(t, startDate.Equal(ranges[0].StartDate))
+	require.True(t, startDate.Add(-store.BufferAtGarage).Equal(ranges[0].BufferedStartDate))
+	require.True(t, startDate.AddDate(0, 0, 2).Add(store.BufferAtGarage).Equal(ranges[0].BufferedEndDate))
+
+	deleteRoute := TestServer.AllRoutes()[RouteDeleteCarBlackout]
+	req, err := http.NewRequest(deleteRoute.Method, routeWithRole(model.RoleNamePartner, deleteRoute.Path), nil)
+	require.NoError(t, err)
+	query := req.URL.Query()
+	query.Add("id", fmt.Sprintf("%d", blackout.ID))
+	req.URL.RawQuery = query.Encode()
+	req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+partnerLogin.AccessToken)
+	recorder = httptest.NewRecorder()
+	TestServer.route.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	require.Empty(t, getCalendar())
+}
@@ -102,26 +102,21 @@ func (s *Server) HandleGetParkingLotMetadata(c *gin.Context) {
 		return
 	}
 
-	totalCarInGarage, err := s.store.CarStore.CountBySeats(req.SeatType, model.ParkingLotGarage, []model.CarStatus{model.CarStatusActive, model.CarStatusWaitingDelivery})
+	occupancies, err := s.garageOccupancies()
 	if err != nil {
 		responseGormErr(c, err)
 		return
 	}
 
-	garageConfig, err := s.store.GarageConfigStore.Get()
-	if err != nil {
-		responseGormErr(c, err)
-		return
-	}
-
-	typeCode := model.GarageConfigTypeMax4Seats
-	if req.SeatType == 7 {
-		typeCode = model.GarageConfigTypeMax7Seats
-	} else if req.SeatType == 15 {
-		typeCode = model.GarageConfigTypeMax15Seats
+	hasFreeSlot := false
+	for _, o := range occupancies {
+		if o.freeSlots(req.SeatType) > 0 {
+			hasFreeSlot = true
+			break
+		}
 	}
 
-	if totalCarInGarage >= garageConfig[typeCode] {
+	if !hasFreeSlot {
 		responseSuccess(c, []OptionResponse{
 			{
 				Code: string(model.ParkingLotHome),
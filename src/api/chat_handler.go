@@ -121,7 +121,7 @@ func (s *Server) decodeBearerAccessToken(authorize string) (*token.Payload, erro
 	}
 
 	accessToken := fields[1]
-	payload, err := s.tokenMaker.VerifyToken(accessToken)
+	payload, err := s.verifyAccessToken(accessToken)
 	if err != nil {
 		return nil, err
 	}
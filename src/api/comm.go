@@ -114,6 +114,63 @@ const (
 	ErrCodeInvalidInactiveCarRequest                          ErrorCode = 100101
 	ErrCodeInvalidPartnerGetRevenueRequest                    ErrorCode = 100102
 	ErrCodeOverWithOtherContractRequest                       ErrorCode = 100103
+	ErrCodeInvalidRenewAccessTokenRequest                     ErrorCode = 100104
+	ErrCodeInvalidRefreshToken                                ErrorCode = 100105
+	ErrCodeRefreshTokenReused                                 ErrorCode = 100106
+	ErrCodeInvalidTerminateAccountSessionsRequest             ErrorCode = 100107
+	ErrCodeInvalidGetCustomerContractEventsRequest            ErrorCode = 100108
+	ErrCodeUnsupportedPaymentGateway                          ErrorCode = 100109
+	ErrCodeInvalidRefundCustomerPaymentRequest                ErrorCode = 100110
+	ErrCodeRefundCustomerPayment                              ErrorCode = 100111
+	ErrCodeInvalidGetCustomerRefundsRequest                   ErrorCode = 100112
+	ErrCodeInvalidCustomerCancelContractRequest               ErrorCode = 100113
+	ErrCodeCustomerContractNotCancellable                     ErrorCode = 100114
+	ErrCodeInvalidGetCancellationQuoteRequest                 ErrorCode = 100115
+	ErrCodeInvalidCreatePricingRuleRequest                    ErrorCode = 100116
+	ErrCodeInvalidDeletePricingRuleRequest                    ErrorCode = 100117
+	ErrCodeInvalidGetPricingRulesRequest                      ErrorCode = 100118
+	ErrCodeInvalidCreateHolidayRequest                        ErrorCode = 100119
+	ErrCodeInvalidDeleteHolidayRequest                        ErrorCode = 100120
+	ErrCodeInvalidGetHolidaysRequest                          ErrorCode = 100121
+	ErrCodeCarReserved                                        ErrorCode = 100122
+	ErrCodeInvalidCreateGarageRequest                         ErrorCode = 100123
+	ErrCodeInvalidUpdateGarageRequest                         ErrorCode = 100124
+	ErrCodeDeliveryOutOfRange                                 ErrorCode = 100125
+	ErrCodeInvalidAssignDeliveryRequest                       ErrorCode = 100126
+	ErrCodeTechnicianBusy                                     ErrorCode = 100127
+	ErrCodeInvalidGetDeliveryScheduleRequest                  ErrorCode = 100128
+	ErrCodeInvalidUpdateDeliveryStatusRequest                 ErrorCode = 100129
+	ErrCodeInvalidDeliveryStatus                              ErrorCode = 100130
+	ErrCodeInvalidGetCarCalendarRequest                       ErrorCode = 100131
+	ErrCodeInvalidCreateCarBlackoutRequest                    ErrorCode = 100132
+	ErrCodeInvalidDeleteCarBlackoutRequest                    ErrorCode = 100133
+	ErrCodeInvalidGetCarBlackoutsRequest                      ErrorCode = 100134
+	ErrCodeInvalidExtendCustomerContractRequest               ErrorCode = 100135
+	ErrCodeInvalidEarlyReturnRequest                          ErrorCode = 100136
+	ErrCodeCustomerContractNotChangeable                      ErrorCode = 100137
+	ErrCodeInvalidCreateCustomerContractChargesRequest        ErrorCode = 100138
+	ErrCodeCustomerContractNotChargeable                      ErrorCode = 100139
+	ErrCodeInvalidCreateInspectionTemplateRequest             ErrorCode = 100140
+	ErrCodeInvalidInspection                                  ErrorCode = 100141
+	ErrCodeInvalidGetCustomerContractInspectionsRequest       ErrorCode = 100142
+	ErrCodeInvalidCreatePartnerPaymentAdjustmentRequest       ErrorCode = 100143
+	ErrCodePartnerPaymentNotAdjustable                        ErrorCode = 100144
+	ErrCodeInvalidPartnerPaymentAdjustment                    ErrorCode = 100145
+	ErrCodeInvalidGetPartnerPaymentStatementRequest           ErrorCode = 100146
+	ErrCodeInvalidGetTrialBalanceRequest                      ErrorCode = 100147
+	ErrCodeInvalidGetLedgerAccountStatementRequest            ErrorCode = 100148
+	ErrCodeInvalidGetCustomerContractInvoicesRequest          ErrorCode = 100149
+	ErrCodeInvalidGetPartnerPaymentReceiptRequest             ErrorCode = 100150
+	ErrCodeInvoiceNotIssuable                                 ErrorCode = 100151
+	ErrCodeInvalidGetContractTemplatesRequest                 ErrorCode = 100152
+	ErrCodeInvalidCreateContractTemplateRequest               ErrorCode = 100153
+	ErrCodeInvalidContractTemplate                            ErrorCode = 100154
+	ErrCodeInvalidPreviewContractTemplateRequest              ErrorCode = 100155
+	ErrCodeInvalidPublishContractTemplateRequest              ErrorCode = 100156
+	ErrCodeContractTemplateNotDraft                           ErrorCode = 100157
+	ErrCodeInvalidResolveCustomerRefundRequest                ErrorCode = 100158
+	ErrCodeResolveCustomerRefund                              ErrorCode = 100159
+	ErrCodeLocalRendererDisabled                              ErrorCode = 100160
 )
 
 var customErrMapping = map[ErrorCode]CommResponse{
@@ -125,6 +182,8 @@ var customErrMapping = map[ErrorCode]CommResponse{
 	ErrCodeExistPendingPayments:       {ErrCodeExistPendingPayments, "exist pending payments for this contract", nil},
 	ErrCodeMissingPaymentInformation:  {ErrCodeMissingPaymentInformation, "missing bank information", nil},
 	ErrCodeMissingDrivingLicence:      {ErrCodeMissingDrivingLicence, "missing driving license images", nil},
+	ErrCodeInvalidRefreshToken:        {ErrCodeInvalidRefreshToken, "invalid refresh token", nil},
+	ErrCodeRefreshTokenReused:         {ErrCodeRefreshTokenReused, "refresh token was reused, all sessions of this login are terminated", nil},
 	ErrCodeSuccess:                    {ErrCodeSuccess, "success", nil},
 }
 
@@ -199,6 +258,8 @@ func errCodeToResponseCode(errCode ErrorCode) int {
 		ErrCodeInvalidOwnership,
 		ErrCodeInvalidAuthorizeType,
 		ErrCodeVerifyAccessToken,
+		ErrCodeInvalidRefreshToken,
+		ErrCodeRefreshTokenReused,
 	}
 	for _, c := range authorizeCode {
 		if errCode == c {
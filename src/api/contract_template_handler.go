@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+)
+
+// errLocalRendererDisabled rejects publishing while the external renderer renders contracts, it
+// never reads the templates
+var errLocalRendererDisabled = errors.New("contracts are rendered by the external pdf service, templates take effect once pdf_service.renderer is local")
+
+func (s *Server) localRendererEnabled() bool {
+	_, ok := s.pdfService.(*service.LocalPDFService)
+	return ok
+}
+
+func responseContractTemplateErr(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidContractTemplate) {
+		responseCustomErr(c, ErrCodeInvalidContractTemplate, err)
+		return
+	}
+
+	if errors.Is(err, service.ErrContractTemplateNotDraft) {
+		responseCustomErr(c, ErrCodeContractTemplateNotDraft, err)
+		return
+	}
+
+	responseGormErr(c, err)
+}
+
+type adminGetContractTemplatesRequest struct {
+	Type model.ContractTemplateType `form:"type" binding:"required,oneof=customer partner"`
+}
+
+// HandleAdminGetContractTemplates lists the template versions of a contract type, latest first
+func (s *Server) HandleAdminGetContractTemplates(c *gin.Context) {
+	req := adminGetContractTemplatesRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetContractTemplatesRequest, err)
+		return
+	}
+
+	templates, err := s.store.ContractTemplateStore.GetByType(req.Type)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, templates)
+}
+
+// HandleAdminGetContractTemplateFields lists the placeholders the templates of a contract type can use
+func (s *Server) HandleAdminGetContractTemplateFields(c *gin.Context) {
+	req := adminGetContractTemplatesRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetContractTemplatesRequest, err)
+		return
+	}
+
+	responseSuccess(c, service.ContractTemplateFields[req.Type])
+}
+
+type adminCreateContractTemplateRequest struct {
+	Type model.ContractTemplateType `json:"type" binding:"required,oneof=customer partner"`
+	Body string                     `json:"body" binding:"required"`
+	Note string                     `json:"note"`
+}
+
+// HandleAdminCreateContractTemplate stores a draft as the next template version of a contract type
+func (s *Server) HandleAdminCreateContractTemplate(c *gin.Context) {
+	req := adminCreateContractTemplateRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreateContractTemplateRequest, err)
+		return
+	}
+
+	createdBy := s.contractActor(c).AccountID
+	template := &model.ContractTemplate{
+		Type:      req.Type,
+		Body:      req.Body,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: &createdBy,
+	}
+	if err := s.contractTemplateService.Create(template); err != nil {
+		responseContractTemplateErr(c, err)
+		return
+	}
+
+	responseSuccess(c, template)
+}
+
+type adminPreviewContractTemplateRequest struct {
+	ID      int                        `json:"id"`
+	Type    model.ContractTemplateType `json:"type" binding:"required_without=ID,omitempty,oneof=customer partner"`
+	Body    string                     `json:"body" binding:"required_without=ID"`
+	Payload map[string]string          `json:"payload"`
+}
+
+// HandleAdminPreviewContractTemplate renders a stored version, or a body not stored yet, with the
+// sample payload of its type overridden by payload and returns the url of the PDF
+func (s *Server) HandleAdminPreviewContractTemplate(c *gin.Context) {
+	req := adminPreviewContractTemplateRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidPreviewContractTemplateRequest, err)
+		return
+	}
+
+	template := &model.ContractTemplate{Type: req.Type, Body: req.Body}
+	if req.ID != 0 {
+		var err error
+		template, err = s.store.ContractTemplateStore.GetByID(req.ID)
+		if err != nil {
+			responseGormErr(c, err)
+			return
+		}
+	}
+
+	bz, err := s.contractTemplateService.Preview(template, req.Payload)
+	if err != nil {
+		responseContractTemplateErr(c, err)
+		return
+	}
+
+	url, err := s.uploadDocument(bytes.NewReader(bz), "preview."+model.ExtensionPDF)
+	if err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	responseSuccess(c, gin.H{"url": url})
+}
+
+type adminPublishContractTemplateRequest struct {
+	ID int `json:"id" binding:"required"`
+}
+
+// HandleAdminPublishContractTemplate makes a draft the version new contracts are rendered with,
+// contracts rendered before keep their version. It is rejected unless contracts are rendered in
+// process, drafts can still be created and previewed.
+func (s *Server) HandleAdminPublishContractTemplate(c *gin.Context) {
+	req := adminPublishContractTemplateRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidPublishContractTemplateRequest, err)
+		return
+	}
+
+	if !s.localRendererEnabled() {
+		responseCustomErr(c, ErrCodeLocalRendererDisabled, errLocalRendererDisabled)
+		return
+	}
+
+	template, err := s.contractTemplateService.Publish(req.ID)
+	if err != nil {
+		responseContractTemplateErr(c, err)
+		return
+	}
+
+	responseSuccess(c, template)
+}
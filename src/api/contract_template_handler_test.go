@@ -0,0 +1,34 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestContractTemplateHandler_PublishWithExternalRenderer(t *testing.T) {
+	previousPdfService := TestServer.pdfService
+	TestServer.pdfService = &MockPDFService{}
+	defer func() {
+		TestServer.pdfService = previousPdfService
+	}()
+
+	_, loginResp := seedAccountAndLogin("admin_templates", "admin_templates", model.RoleIDAdmin)
+	route := TestServer.AllRoutes()[RouteAdminPublishContractTemplate]
+	bz, _ := json.Marshal(adminPublishContractTemplateRequest{ID: 1})
+	req, _ := http.NewRequest(route.Method, route.Path, bytes.NewReader(bz))
+	req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+loginResp.AccessToken)
+	recorder := httptest.NewRecorder()
+	TestServer.route.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	resp := CommResponse{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Equal(t, ErrCodeLocalRendererDisabled, resp.ErrorCode)
+}
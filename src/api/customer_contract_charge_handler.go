@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"mime/multipart"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+)
+
+const MaxNumberChargeImages = 10
+
+type customerContractChargeRequest struct {
+	Category    model.CustomerContractChargeCategory `json:"category" binding:"required,oneof=damage fuel mileage traffic_fine other"`
+	Description string                               `json:"description" binding:"required"`
+	Amount      int                                  `json:"amount" binding:"required,gt=0"`
+	ImageURLs   []string                             `json:"image_urls"`
+}
+
+func newCustomerContractCharges(reqs []customerContractChargeRequest, createdBy int) []*model.CustomerContractCharge {
+	res := make([]*model.CustomerContractCharge, len(reqs))
+	for i, req := range reqs {
+		imageURLs := req.ImageURLs
+		if imageURLs == nil {
+			imageURLs = []string{}
+		}
+
+		res[i] = &model.CustomerContractCharge{
+			Category:    req.Category,
+			Description: strings.TrimSpace(req.Description),
+			Amount:      req.Amount,
+			ImageURLs:   imageURLs,
+			CreatedBy:   createdBy,
+		}
+	}
+
+	return res
+}
+
+func responseChargeErr(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrCustomerContractNotChargeable) {
+		responseCustomErr(c, ErrCodeCustomerContractNotChargeable, err)
+		return
+	}
+
+	responseTransitErr(c, err)
+}
+
+// notifyCustomerOfCharges tells the customer about the charges not covered by the collateral
+func (s *Server) notifyCustomerOfCharges(contractID int, charges []*model.CustomerContractCharge) {
+	charged := false
+	for _, charge := range charges {
+		charged = charged || charge.CustomerPaymentID != nil
+	}
+
+	if !charged {
+		return
+	}
+
+	go func() {
+		contract, err := s.store.CustomerContractStore.FindByID(contractID)
+		if err != nil {
+			return
+		}
+
+		phone, expoToken := contract.Customer.PhoneNumber, s.getExpoToken(contract.Customer.PhoneNumber)
+		msg := s.notificationPushService.NewCustomerAdditionalPaymentMsg(contract.ID, expoToken, phone)
+		_ = s.notificationPushService.Push(contract.CustomerID, msg)
+	}()
+}
+
+type createCustomerContractChargesRequest struct {
+	CustomerContractID int                             `json:"customer_contract_id" binding:"required"`
+	Charges            []customerContractChargeRequest `json:"charges" binding:"required,min=1,dive"`
+}
+
+// HandleCreateCustomerContractCharges charges a returned car for findings after its appraisal,
+// like traffic fines arriving later
+func (s *Server) HandleCreateCustomerContractCharges(c *gin.Context) {
+	req := createCustomerContractChargesRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreateCustomerContractChargesRequest, err)
+		return
+	}
+
+	charges := newCustomerContractCharges(req.Charges, s.contractActor(c).AccountID)
+	if err := s.contractStateMachine.Charge(req.CustomerContractID, charges); err != nil {
+		responseChargeErr(c, err)
+		return
+	}
+
+	s.notifyCustomerOfCharges(req.CustomerContractID, charges)
+	responseSuccess(c, charges)
+}
+
+// HandleUploadCustomerContractChargeImages uploads the photos of charges and returns their urls
+func (s *Server) HandleUploadCustomerContractChargeImages(c *gin.Context) {
+	req := struct {
+		Files []*multipart.FileHeader `form:"files"`
+	}{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidUploadDocumentRequest, err)
+		return
+	}
+
+	urls, ok := s.uploadImageFiles(c, req.Files, MaxNumberChargeImages)
+	if !ok {
+		return
+	}
+
+	responseSuccess(c, gin.H{"image_urls": urls})
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+	"github.com/godev111222333/capstone-backend/src/token"
+)
+
+// contractActor returns the authenticated account as actor of a contract transition
+func (s *Server) contractActor(c *gin.Context) service.ContractActor {
+	authPayload, ok := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !ok {
+		return service.SystemContractActor
+	}
+
+	acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+	if err != nil {
+		return service.ContractActor{Role: authPayload.Role}
+	}
+
+	return service.ContractActor{AccountID: acct.ID, Role: authPayload.Role}
+}
+
+func responseTransitErr(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidCustomerContractTransition) {
+		responseCustomErr(c, ErrCodeInvalidCustomerContractStatus, err)
+		return
+	}
+
+	if errors.Is(err, service.ErrCarReserved) {
+		responseCustomErr(c, ErrCodeCarReserved, err)
+		return
+	}
+
+	responseGormErr(c, err)
+}
+
+// authorizeCustomerContractParty loads the contract and checks that a customer only sees their own
+// contracts and a partner only the contracts of their cars. Admins and technicians see every
+// contract.
+func (s *Server) authorizeCustomerContractParty(c *gin.Context, contractID int) (*model.CustomerContract, bool) {
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+	if err != nil {
+		responseGormErr(c, err)
+		return nil, false
+	}
+
+	contract, err := s.store.CustomerContractStore.FindByID(contractID)
+	if err != nil {
+		responseGormErr(c, err)
+		return nil, false
+	}
+
+	if authPayload.Role == model.RoleNameCustomer && contract.CustomerID != acct.ID {
+		responseCustomErr(c, ErrCodeInvalidOwnership, nil)
+		return nil, false
+	} else if authPayload.Role == model.RoleNamePartner && contract.Car.PartnerID != acct.ID {
+		responseCustomErr(c, ErrCodeInvalidOwnership, nil)
+		return nil, false
+	}
+
+	return contract, true
+}
+
+func (s *Server) HandleGetCustomerContractEvents(c *gin.Context) {
+	idInt, err := strconv.Atoi(c.Param("customer_contract_id"))
+	if err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetCustomerContractEventsRequest, err)
+		return
+	}
+
+	contract, ok := s.authorizeCustomerContractParty(c, idInt)
+	if !ok {
+		return
+	}
+
+	events, err := s.store.CustomerContractEventStore.GetByCustomerContractID(contract.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, events)
+}
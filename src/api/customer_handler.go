@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
 	"github.com/godev111222333/capstone-backend/src/token"
 )
 
@@ -60,13 +61,25 @@ func (s *Server) HandleRegisterCustomer(c *gin.Context) {
 }
 
 type customerFindCarsRequest struct {
-	StartDate     time.Time `form:"start_date" binding:"required"`
-	EndDate       time.Time `form:"end_date" binding:"required"`
-	Brands        string    `form:"brands"`
-	Fuels         string    `form:"fuels"`
-	Motions       string    `form:"motions"`
-	NumberOfSeats string    `form:"number_of_seats"`
-	ParkingLots   string    `form:"parking_lots"`
+	StartDate     time.Time           `form:"start_date" binding:"required"`
+	EndDate       time.Time           `form:"end_date" binding:"required"`
+	Brands        string              `form:"brands"`
+	Fuels         string              `form:"fuels"`
+	Motions       string              `form:"motions"`
+	NumberOfSeats string              `form:"number_of_seats"`
+	ParkingLots   string              `form:"parking_lots"`
+	MinPrice      int                 `form:"min_price"`
+	MaxPrice      int                 `form:"max_price"`
+	MinYear       int                 `form:"min_year"`
+	MaxYear       int                 `form:"max_year"`
+	MinRating     float64             `form:"min_rating"`
+	Keyword       string              `form:"keyword"`
+	Latitude      *float64            `form:"latitude"`
+	Longitude     *float64            `form:"longitude"`
+	RadiusKm      float64             `form:"radius_km"`
+	Sort          store.CarSearchSort `form:"sort"`
+	Cursor        string              `form:"cursor"`
+	Limit         int                 `form:"limit"`
 }
 
 func (s *Server) HandleCustomerFindCars(c *gin.Context) {
@@ -87,21 +100,64 @@ func (s *Server) HandleCustomerFindCars(c *gin.Context) {
 		return
 	}
 
+	if !req.Sort.IsValid() {
+		responseCustomErr(c, ErrCodeInvalidFindCarsRequest, errors.New("sort must be one of price_asc, price_desc, rating, trips and distance"))
+		return
+	}
+
+	var center *store.GeoPoint
+	if req.Latitude != nil || req.Longitude != nil {
+		if req.Latitude == nil || req.Longitude == nil || !isValidCoordinate(*req.Latitude, *req.Longitude) {
+			responseCustomErr(c, ErrCodeInvalidFindCarsRequest, errors.New("invalid latitude and longitude"))
+			return
+		}
+		center = &store.GeoPoint{Latitude: *req.Latitude, Longitude: *req.Longitude}
+
+		// nearest first unless asked otherwise
+		if req.Sort == store.CarSearchSortDefault {
+			req.Sort = store.CarSearchSortDistance
+		}
+	}
+
+	if (center == nil && (req.RadiusKm != 0 || req.Sort == store.CarSearchSortDistance)) || req.RadiusKm < 0 {
+		responseCustomErr(c, ErrCodeInvalidFindCarsRequest, errors.New("radius_km and sorting by distance require latitude and longitude"))
+		return
+	}
+
+	if req.Limit < 0 || (req.MaxPrice > 0 && req.MinPrice > req.MaxPrice) || (req.MaxYear > 0 && req.MinYear > req.MaxYear) {
+		responseCustomErr(c, ErrCodeInvalidFindCarsRequest, errors.New("invalid limit, price range or year range"))
+		return
+	}
+
 	if isOverlap, err := s.isOverlapOtherContract(acct.ID, req.StartDate, req.EndDate); isOverlap || err != nil {
 		responseCustomErr(c, ErrCodeOverWithOtherContractRequest, errors.New("overlap other contract"))
 		return
 	}
 
-	findQueries := make(map[string]interface{}, 0)
+	params := &store.CarSearchParams{
+		StartDate: req.StartDate,
+		EndDate:   req.EndDate,
+		MinPrice:  req.MinPrice,
+		MaxPrice:  req.MaxPrice,
+		MinYear:   req.MinYear,
+		MaxYear:   req.MaxYear,
+		MinRating: req.MinRating,
+		Keyword:   strings.TrimSpace(req.Keyword),
+		Center:    center,
+		RadiusKm:  req.RadiusKm,
+		Sort:      req.Sort,
+		Cursor:    req.Cursor,
+		Limit:     req.Limit,
+	}
 	separator := ","
 	if len(req.Brands) > 0 {
-		findQueries["brands"] = strings.Split(req.Brands, separator)
+		params.Brands = strings.Split(req.Brands, separator)
 	}
 	if len(req.Fuels) > 0 {
-		findQueries["fuels"] = strings.Split(req.Fuels, separator)
+		params.Fuels = strings.Split(req.Fuels, separator)
 	}
 	if len(req.Motions) > 0 {
-		findQueries["motions"] = strings.Split(req.Motions, separator)
+		params.Motions = strings.Split(req.Motions, separator)
 	}
 	if len(req.NumberOfSeats) > 0 {
 		arr := strings.Split(req.NumberOfSeats, separator)
@@ -114,27 +170,35 @@ func (s *Server) HandleCustomerFindCars(c *gin.Context) {
 				return
 			}
 		}
-		findQueries["number_of_seats"] = arrInt
+		params.NumberOfSeats = arrInt
 	}
 	if len(req.ParkingLots) > 0 {
-		findQueries["parking_lots"] = strings.Split(req.ParkingLots, separator)
+		params.ParkingLots = strings.Split(req.ParkingLots, separator)
 	}
 
-	foundCars, err := s.store.CarStore.FindCars(req.StartDate, req.EndDate, findQueries)
+	found, err := s.store.CarStore.FindCars(params)
 	if err != nil {
+		if errors.Is(err, store.ErrInvalidCarSearchCursor) {
+			responseCustomErr(c, ErrCodeInvalidFindCarsRequest, err)
+			return
+		}
 		responseGormErr(c, err)
 		return
 	}
-	respCars := make([]*carResponse, len(foundCars))
-	for i, car := range foundCars {
+	respCars := make([]*carResponse, len(found.Cars))
+	for i, car := range found.Cars {
 		respCars[i], err = s.newCarResponse(car)
 		if err != nil {
 			responseGormErr(c, err)
 			return
 		}
+
+		if distance, ok := found.DistancesKm[car.ID]; ok {
+			respCars[i].Distance = &distance
+		}
 	}
 
-	responseSuccess(c, respCars)
+	responseSuccess(c, gin.H{"cars": respCars, "next_cursor": found.NextCursor})
 }
 
 type customerRentCarRequest struct {
@@ -142,6 +206,7 @@ type customerRentCarRequest struct {
 	StartDate      time.Time            `json:"start_date" binding:"required"`
 	EndDate        time.Time            `json:"end_date" binding:"required"`
 	CollateralType model.CollateralType `json:"collateral_type" binding:"required"`
+	DeliveryRequest
 }
 
 func validateStartEndDate(c *gin.Context, startDate, endDate time.Time) bool {
@@ -212,18 +277,6 @@ func (s *Server) HandleCustomerRentCar(c *gin.Context) {
 		return
 	}
 
-	// Check not overlap with other contracts
-	isOverlap, err := s.store.CustomerContractStore.IsOverlap(req.CarID, req.StartDate, req.EndDate)
-	if err != nil {
-		responseGormErr(c, err)
-		return
-	}
-
-	if isOverlap {
-		responseCustomErr(c, ErrCodeInvalidRentCarRequest, errors.New("start_date and end_date is overlap with other contracts"))
-		return
-	}
-
 	customer, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
 	if err != nil {
 		responseGormErr(c, err)
@@ -271,7 +324,26 @@ func (s *Server) HandleCustomerRentCar(c *gin.Context) {
 		nextStatus = model.CustomerContractStatusWaitingPartnerApproval
 	}
 
-	pricing := calculateRentPrice(car, rule, req.StartDate, req.EndDate)
+	pricingRules, err := s.loadPricingRules(car, req.StartDate, req.EndDate)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	deliveries, err := newDeliveries(car, rule, &req.DeliveryRequest, req.StartDate, req.EndDate)
+	if err != nil {
+		responseDeliveryErr(c, ErrCodeInvalidRentCarRequest, err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if len(delivery.Address) == 0 {
+			responseCustomErr(c, ErrCodeInvalidRentCarRequest, errors.New("delivery_address and return_address are required"))
+			return
+		}
+	}
+
+	pricing := calculateRentPrice(car, rule, pricingRules, req.StartDate, req.EndDate, deliveries)
 	contract := &model.CustomerContract{
 		CustomerID:              customer.ID,
 		CarID:                   req.CarID,
@@ -286,9 +358,15 @@ func (s *Server) HandleCustomerRentCar(c *gin.Context) {
 		BankNumber:              customer.BankNumber,
 		BankOwner:               customer.BankOwner,
 		IsReturnCollateralAsset: false,
+		Deliveries:              deliveries,
 	}
-	if err := s.store.CustomerContractStore.Create(contract); err != nil {
-		responseGormErr(c, err)
+	// the hold on the car is what rejects overlapping requests, even concurrent ones
+	if err := s.contractStateMachine.Reserve(
+		contract,
+		service.ContractActor{AccountID: customer.ID, Role: model.RoleNameCustomer},
+		s.reservationHoldTTL(),
+	); err != nil {
+		responseTransitErr(c, err)
 		return
 	}
 
@@ -315,9 +393,22 @@ func (s *Server) HandleCustomerRentCar(c *gin.Context) {
 	responseSuccess(c, contract)
 }
 
+// DefaultReservationHoldTTL is how long a car is held for each step before the prepay: partner
+// approval, agreeing to the contract and paying. Approving and agreeing extend the hold.
+const DefaultReservationHoldTTL = 2 * time.Hour
+
+func (s *Server) reservationHoldTTL() time.Duration {
+	if s.cfg.ReservationHoldTTL > 0 {
+		return s.cfg.ReservationHoldTTL
+	}
+
+	return DefaultReservationHoldTTL
+}
+
 type customerAgreeContractRequest struct {
-	CustomerContractID int    `json:"customer_contract_id" binding:"required"`
-	ReturnURL          string `json:"return_url" binding:"required"`
+	CustomerContractID int                  `json:"customer_contract_id" binding:"required"`
+	ReturnURL          string               `json:"return_url" binding:"required"`
+	Gateway            model.PaymentGateway `json:"gateway"`
 }
 
 func (s *Server) HandleCustomerAgreeContract(c *gin.Context) {
@@ -334,6 +425,11 @@ func (s *Server) HandleCustomerAgreeContract(c *gin.Context) {
 		return
 	}
 
+	if _, err := s.PaymentGateways.Get(req.Gateway); err != nil {
+		responseCustomErr(c, ErrCodeUnsupportedPaymentGateway, err)
+		return
+	}
+
 	contract, err := s.store.CustomerContractStore.FindByID(req.CustomerContractID)
 	if err != nil {
 		responseGormErr(c, err)
@@ -345,30 +441,23 @@ func (s *Server) HandleCustomerAgreeContract(c *gin.Context) {
 		return
 	}
 
-	if contract.Status != model.CustomerContractStatusWaitingContractAgreement {
-		responseCustomErr(c, ErrCodeInvalidCustomerContractStatus, errors.New("invalid customer contract status"))
-		return
-	}
-
-	if err := s.store.CustomerContractStore.Update(
-		req.CustomerContractID,
-		map[string]interface{}{"status": string(model.CustomerContractStatusWaitingContractPayment)},
-	); err != nil {
-		responseGormErr(c, err)
+	if _, err := s.contractStateMachine.Transit(&service.CustomerContractTransition{
+		CustomerContractID: req.CustomerContractID,
+		From:               []model.CustomerContractStatus{model.CustomerContractStatusWaitingContractAgreement},
+		To:                 model.CustomerContractStatusWaitingContractPayment,
+		Actor:              service.ContractActor{AccountID: acct.ID, Role: model.RoleNameCustomer},
+		Reason:             "customer agreed contract",
+		HoldTTL:            s.reservationHoldTTL(),
+	}); err != nil {
+		responseTransitErr(c, err)
 		return
 	}
 
-	rule, err := s.store.CustomerContractRuleStore.GetLast()
-	if err != nil {
-		responseGormErr(c, err)
-		return
-	}
-
-	pricing := calculateRentPrice(&contract.Car, rule, contract.StartDate, contract.EndDate)
 	prepayPayment, err := s.GenerateCustomerContractPaymentQRCode(
 		contract.ID,
-		pricing.PrepaidAmount,
+		contractPrepaidAmount(contract),
 		model.PaymentTypePrePay,
+		req.Gateway,
 		req.ReturnURL,
 		"",
 	)
@@ -380,7 +469,7 @@ func (s *Server) HandleCustomerAgreeContract(c *gin.Context) {
 	// if this is collateral cash type, pre-generate collateral payment
 	if contract.CollateralType == model.CollateralTypeCash && contract.CustomerContractRule.CollateralCashAmount > 0 {
 		_, err := s.GenerateCustomerContractPaymentQRCode(
-			contract.ID, contract.CustomerContractRule.CollateralCashAmount, model.PaymentTypeCollateralCash, req.ReturnURL, "")
+			contract.ID, contract.CustomerContractRule.CollateralCashAmount, model.PaymentTypeCollateralCash, req.Gateway, req.ReturnURL, "")
 		if err != nil {
 			responseCustomErr(c, ErrCodeGenerateQRCode, err)
 			return
@@ -394,6 +483,7 @@ func (s *Server) GenerateCustomerContractPaymentQRCode(
 	contractID int,
 	amount int,
 	paymentType model.PaymentType,
+	gateway model.PaymentGateway,
 	returnURL string,
 	note string,
 ) (*model.CustomerPayment, error) {
@@ -408,7 +498,7 @@ func (s *Server) GenerateCustomerContractPaymentQRCode(
 		return nil, err
 	}
 
-	url, err := s.PaymentService.GeneratePaymentURL([]int{payment.ID}, amount, time.Now().Format("02150405"), returnURL)
+	url, err := s.generateCustomerPaymentURL(gateway, []int{payment.ID}, amount, returnURL)
 	if err != nil {
 		return nil, err
 	}
@@ -499,6 +589,7 @@ type calculateRentingPricingRequest struct {
 	CarID     int       `form:"car_id" binding:"required"`
 	StartDate time.Time `form:"start_date" binding:"required"`
 	EndDate   time.Time `form:"end_date" binding:"required"`
+	DeliveryRequest
 }
 
 func (s *Server) HandleCustomerCalculateRentPricing(c *gin.Context) {
@@ -520,7 +611,19 @@ func (s *Server) HandleCustomerCalculateRentPricing(c *gin.Context) {
 		return
 	}
 
-	responseSuccess(c, calculateRentPrice(car, rule, req.StartDate, req.EndDate))
+	pricingRules, err := s.loadPricingRules(car, req.StartDate, req.EndDate)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	deliveries, err := newDeliveries(car, rule, &req.DeliveryRequest, req.StartDate, req.EndDate)
+	if err != nil {
+		responseDeliveryErr(c, ErrCodeInvalidCalculateRentingPriceRequest, err)
+		return
+	}
+
+	responseSuccess(c, calculateRentPrice(car, rule, pricingRules, req.StartDate, req.EndDate, deliveries))
 }
 
 type getLastPaymentDetailRequest struct {
@@ -659,43 +762,30 @@ func (s *Server) HandleGetFeedbackByCar(c *gin.Context) {
 	responseSuccess(c, gin.H{"total": counter, "feedbacks": feedbacks})
 }
 
-type RentPricing struct {
-	RentPriceQuotation      int `json:"rent_price_quotation"`
-	InsurancePriceQuotation int `json:"insurance_price_quotation"`
-
-	TotalRentPriceAmount int `json:"total_rent_price_amount"`
-	TotalInsuranceAmount int `json:"total_insurance_amount"`
-	TotalAmount          int `json:"total_amount"`
-	PrepaidAmount        int `json:"prepaid_amount"`
-}
-
-func calculateRentPrice(car *model.Car, rule *model.CustomerContractRule, startDate, endDate time.Time) *RentPricing {
-	totalRentPriceAmount := car.Price * int(((endDate.Sub(startDate)).Hours())/24.0)
-	if int(endDate.Sub(startDate).Seconds())%(24*60*60) != 0 {
-		totalRentPriceAmount += car.Price
-	}
-
-	totalInsuranceAmount := float64(totalRentPriceAmount) * rule.InsurancePercent / 100.0
-	return &RentPricing{
-		RentPriceQuotation:      car.Price,
-		InsurancePriceQuotation: int(float64(car.Price) * rule.InsurancePercent / 100.0),
-		TotalRentPriceAmount:    totalRentPriceAmount,
-		TotalInsuranceAmount:    int(totalInsuranceAmount),
-		TotalAmount:             totalRentPriceAmount + int(totalInsuranceAmount),
-		PrepaidAmount:           int((float64(totalRentPriceAmount) + totalInsuranceAmount) * rule.PrepayPercent / 100.0),
-	}
-}
+// SuggestedCarsWindow and SuggestedCarsLimit bound the suggested cars: the first SuggestedCarsLimit
+// cars by id that are free for the next SuggestedCarsWindow. The window isn't open ended as before
+// the car search checked overlaps properly, since a car with any booking ahead would then never be
+// suggested.
+const (
+	SuggestedCarsWindow = 24 * time.Hour
+	SuggestedCarsLimit  = 1000
+)
 
 func (s *Server) HandleCustomerGetSuggestedCars(c *gin.Context) {
+	// suggest the cars that can be rented right away
 	now := time.Now()
-	foundCars, err := s.store.CarStore.FindCars(now, now.AddDate(100, 0, 0), nil)
+	found, err := s.store.CarStore.FindCars(&store.CarSearchParams{
+		StartDate: now,
+		EndDate:   now.Add(SuggestedCarsWindow),
+		Limit:     SuggestedCarsLimit,
+	})
 	if err != nil {
 		responseGormErr(c, err)
 		return
 	}
 
-	respCars := make([]*carResponse, len(foundCars))
-	for i, car := range foundCars {
+	respCars := make([]*carResponse, len(found.Cars))
+	for i, car := range found.Cars {
 		respCars[i], err = s.newCarResponse(car)
 		if err != nil {
 			responseGormErr(c, err)
@@ -26,12 +26,13 @@ func TestCustomerHandler_FindCars(t *testing.T) {
 	partner := &model.Account{RoleID: model.RoleIDPartner, Email: "pn1@gmail@gmail.com", Status: model.AccountStatusActive}
 	require.NoError(t, TestDb.AccountStore.Create(partner))
 	PartnerContractRuleID := 1
+	endDate := time.Now().AddDate(1, 0, 0)
 	cars := []*model.Car{
-		{PartnerID: partner.ID, CarModelID: carModels[0].ID, Status: model.CarStatusActive, LicensePlate: "232222", ParkingLot: model.ParkingLotHome, PartnerContractRuleID: PartnerContractRuleID},
-		{PartnerID: partner.ID, CarModelID: carModels[1].ID, Status: model.CarStatusActive, LicensePlate: "242222", ParkingLot: model.ParkingLotGarage, PartnerContractRuleID: PartnerContractRuleID},
-		{PartnerID: partner.ID, CarModelID: carModels[2].ID, Status: model.CarStatusActive, LicensePlate: "252222", ParkingLot: model.ParkingLotHome, PartnerContractRuleID: PartnerContractRuleID},
-		{PartnerID: partner.ID, CarModelID: carModels[1].ID, Status: model.CarStatusRejected, LicensePlate: "262222", ParkingLot: model.ParkingLotGarage, PartnerContractRuleID: PartnerContractRuleID},
-		{PartnerID: partner.ID, CarModelID: carModels[2].ID, Status: model.CarStatusWaitingDelivery, LicensePlate: "272222", ParkingLot: model.ParkingLotHome, PartnerContractRuleID: PartnerContractRuleID},
+		{PartnerID: partner.ID, CarModelID: carModels[0].ID, Status: model.CarStatusActive, LicensePlate: "232222", ParkingLot: model.ParkingLotHome, PartnerContractRuleID: PartnerContractRuleID, EndDate: endDate},
+		{PartnerID: partner.ID, CarModelID: carModels[1].ID, Status: model.CarStatusActive, LicensePlate: "242222", ParkingLot: model.ParkingLotGarage, PartnerContractRuleID: PartnerContractRuleID, EndDate: endDate},
+		{PartnerID: partner.ID, CarModelID: carModels[2].ID, Status: model.CarStatusActive, LicensePlate: "252222", ParkingLot: model.ParkingLotHome, PartnerContractRuleID: PartnerContractRuleID, EndDate: endDate},
+		{PartnerID: partner.ID, CarModelID: carModels[1].ID, Status: model.CarStatusRejected, LicensePlate: "262222", ParkingLot: model.ParkingLotGarage, PartnerContractRuleID: PartnerContractRuleID, EndDate: endDate},
+		{PartnerID: partner.ID, CarModelID: carModels[2].ID, Status: model.CarStatusWaitingDelivery, LicensePlate: "272222", ParkingLot: model.ParkingLotHome, PartnerContractRuleID: PartnerContractRuleID, EndDate: endDate},
 	}
 	for _, c := range cars {
 		require.NoError(t, TestDb.CarStore.Create(c))
@@ -56,9 +57,10 @@ func TestCustomerHandler_FindCars(t *testing.T) {
 		bz, err := io.ReadAll(recorder.Body)
 		require.NoError(t, err)
 
-		var foundCars []*carResponse
-		require.NoError(t, unmarshalFromCommResponse(bz, &foundCars))
-		require.Len(t, foundCars, 3)
+		var resp findCarsResponse
+		require.NoError(t, unmarshalFromCommResponse(bz, &resp))
+		require.Len(t, resp.Cars, 3)
+		require.Empty(t, resp.NextCursor)
 	})
 
 	t.Run("start_date and two queries", func(t *testing.T) {
@@ -80,10 +82,55 @@ func TestCustomerHandler_FindCars(t *testing.T) {
 		bz, err := io.ReadAll(recorder.Body)
 		require.NoError(t, err)
 
-		var foundCars []*carResponse
-		require.NoError(t, unmarshalFromCommResponse(bz, &foundCars))
-		require.Len(t, foundCars, 1)
+		var resp findCarsResponse
+		require.NoError(t, unmarshalFromCommResponse(bz, &resp))
+		require.Len(t, resp.Cars, 1)
 	})
+
+	t.Run("pages with a cursor", func(t *testing.T) {
+		find := func(cursor string) (int, findCarsResponse) {
+			req, err := http.NewRequest(route.Method, route.Path, nil)
+			require.NoError(t, err)
+			query := req.URL.Query()
+			now := time.Now()
+
+			query.Add("start_date", now.Add(time.Second).Format(time.RFC3339))
+			query.Add("end_date", now.AddDate(0, 0, 1).Add(time.Hour*time.Duration(3)).Format(time.RFC3339))
+			query.Add("sort", "price_asc")
+			query.Add("limit", "2")
+			if len(cursor) > 0 {
+				query.Add("cursor", cursor)
+			}
+			req.URL.RawQuery = query.Encode()
+			req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+accessPayload.AccessToken)
+
+			recorder := httptest.NewRecorder()
+			TestServer.route.ServeHTTP(recorder, req)
+			var resp findCarsResponse
+			if recorder.Code == http.StatusOK {
+				require.NoError(t, unmarshalFromCommResponse(recorder.Body.Bytes(), &resp))
+			}
+			return recorder.Code, resp
+		}
+
+		code, first := find("")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, first.Cars, 2)
+		require.NotEmpty(t, first.NextCursor)
+
+		code, second := find(first.NextCursor)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, second.Cars, 1)
+		require.Empty(t, second.NextCursor)
+
+		code, _ = find("garbage")
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+type findCarsResponse struct {
+	Cars       []*carResponse `json:"cars"`
+	NextCursor string         `json:"next_cursor"`
 }
 
 func TestServer_HandleCustomerCalculateRentPricing(t *testing.T) {
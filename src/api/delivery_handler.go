@@ -0,0 +1,390 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+	"github.com/godev111222333/capstone-backend/src/store"
+	"github.com/godev111222333/capstone-backend/src/token"
+)
+
+const (
+	// DeliverySlotDuration is how long a technician is busy with one delivery or return
+	DeliverySlotDuration = 2 * time.Hour
+
+	DefaultDeliveryScheduleDays = 7
+)
+
+var (
+	errCarHasNoPickupPoint = errors.New("car has no pickup point to deliver from")
+	errDeliveryOutOfRange  = errors.New("address is farther than every delivery fee tier")
+)
+
+// DeliveryRequest asks for the car to be brought to an address when the rental starts and to be
+// collected from an address when it ends, either can be left out
+type DeliveryRequest struct {
+	DeliveryAddress   string   `json:"delivery_address" form:"delivery_address"`
+	DeliveryLatitude  *float64 `json:"delivery_latitude" form:"delivery_latitude"`
+	DeliveryLongitude *float64 `json:"delivery_longitude" form:"delivery_longitude"`
+	ReturnAddress     string   `json:"return_address" form:"return_address"`
+	ReturnLatitude    *float64 `json:"return_latitude" form:"return_latitude"`
+	ReturnLongitude   *float64 `json:"return_longitude" form:"return_longitude"`
+}
+
+// newDeliveries builds the pending delivery and return slots asked for in req, scheduled at the
+// start and the end of the rental
+func newDeliveries(
+	car *model.Car,
+	rule *model.CustomerContractRule,
+	req *DeliveryRequest,
+	startDate, endDate time.Time,
+) ([]*model.CustomerContractDelivery, error) {
+	slots := []struct {
+		typ                 model.DeliveryType
+		address             string
+		latitude, longitude *float64
+		scheduledAt         time.Time
+	}{
+		{model.DeliveryTypeDelivery, req.DeliveryAddress, req.DeliveryLatitude, req.DeliveryLongitude, startDate},
+		{model.DeliveryTypeReturn, req.ReturnAddress, req.ReturnLatitude, req.ReturnLongitude, endDate},
+	}
+
+	res := make([]*model.CustomerContractDelivery, 0, len(slots))
+	for _, slot := range slots {
+		if slot.latitude == nil && slot.longitude == nil {
+			continue
+		}
+
+		if slot.latitude == nil || slot.longitude == nil || !isValidCoordinate(*slot.latitude, *slot.longitude) {
+			return nil, errInvalidCoordinate
+		}
+
+		if car.Latitude == nil || car.Longitude == nil {
+			return nil, errCarHasNoPickupPoint
+		}
+
+		distance := store.GeoPoint{Latitude: *car.Latitude, Longitude: *car.Longitude}.
+			DistanceKm(store.GeoPoint{Latitude: *slot.latitude, Longitude: *slot.longitude})
+		distance = math.Round(distance*10) / 10
+		if _, ok := rule.DeliveryFee(distance); !ok {
+			return nil, errDeliveryOutOfRange
+		}
+
+		res = append(res, &model.CustomerContractDelivery{
+			Type:        slot.typ,
+			Address:     strings.TrimSpace(slot.address),
+			Latitude:    *slot.latitude,
+			Longitude:   *slot.longitude,
+			DistanceKm:  distance,
+			ScheduledAt: slot.scheduledAt,
+			Status:      model.DeliveryStatusPending,
+		})
+	}
+
+	return res, nil
+}
+
+func responseDeliveryErr(c *gin.Context, code ErrorCode, err error) {
+	if errors.Is(err, errCarHasNoPickupPoint) || errors.Is(err, errDeliveryOutOfRange) {
+		responseCustomErr(c, ErrCodeDeliveryOutOfRange, err)
+		return
+	}
+
+	responseCustomErr(c, code, err)
+}
+
+type adminAssignDeliveryRequest struct {
+	DeliveryID   int `json:"delivery_id" binding:"required"`
+	TechnicianID int `json:"technician_id" binding:"required"`
+	// ScheduledAt moves the slot, it keeps its time by default
+	ScheduledAt *time.Time `json:"scheduled_at"`
+}
+
+func (s *Server) HandleAdminAssignDelivery(c *gin.Context) {
+	req := adminAssignDeliveryRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidAssignDeliveryRequest, err)
+		return
+	}
+
+	delivery, err := s.store.CustomerContractDeliveryStore.GetByID(req.DeliveryID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if !model.CanTransitDelivery(delivery.Status, model.DeliveryStatusAssigned) {
+		responseCustomErr(c, ErrCodeInvalidDeliveryStatus, errors.New("delivery can not be assigned anymore"))
+		return
+	}
+
+	technician, err := s.store.AccountStore.GetByID(req.TechnicianID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if technician.RoleID != model.RoleIDTechnician || technician.Status != model.AccountStatusActive {
+		responseCustomErr(c, ErrCodeInvalidAssignDeliveryRequest, errors.New("deliveries are driven by active technicians"))
+		return
+	}
+
+	scheduledAt := delivery.ScheduledAt
+	if req.ScheduledAt != nil {
+		scheduledAt = *req.ScheduledAt
+	}
+
+	busy, err := s.store.CustomerContractDeliveryStore.CountTechnicianSlots(
+		technician.ID,
+		scheduledAt.Add(-DeliverySlotDuration),
+		scheduledAt.Add(DeliverySlotDuration),
+		delivery.ID,
+	)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if busy > 0 {
+		responseCustomErr(c, ErrCodeTechnicianBusy, errors.New("technician has another delivery at that time"))
+		return
+	}
+
+	affected, err := s.store.CustomerContractDeliveryStore.UpdateWhenCurStatus(delivery.ID, delivery.Status, map[string]interface{}{
+		"status":        string(model.DeliveryStatusAssigned),
+		"technician_id": technician.ID,
+		"scheduled_at":  scheduledAt,
+	})
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if affected == 0 {
+		responseCustomErr(c, ErrCodeInvalidDeliveryStatus, errors.New("status of delivery changed concurrently"))
+		return
+	}
+
+	previousTechnicianID := delivery.TechnicianID
+	delivery, err = s.store.CustomerContractDeliveryStore.GetByID(delivery.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	s.technicianNotificationQueue <- s.NewDeliveryAssignedMsg(technician.ID, delivery)
+	if previousTechnicianID != nil && *previousTechnicianID != technician.ID {
+		s.technicianNotificationQueue <- s.NewDeliveryCanceledMsg(*previousTechnicianID, delivery)
+	}
+
+	responseSuccess(c, delivery)
+}
+
+type getDeliveryScheduleRequest struct {
+	From time.Time `form:"from"`
+	To   time.Time `form:"to"`
+	// TechnicianID filters the schedule of admins, technicians always get their own
+	TechnicianID int    `form:"technician_id"`
+	Status       string `form:"status"`
+}
+
+// HandleGetDeliverySchedule lists the delivery and return slots from now until
+// DefaultDeliveryScheduleDays ahead unless a period is given
+func (s *Server) HandleGetDeliverySchedule(c *gin.Context) {
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	req := getDeliveryScheduleRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetDeliveryScheduleRequest, err)
+		return
+	}
+
+	if req.From.IsZero() {
+		req.From = time.Now()
+	}
+	if req.To.IsZero() {
+		req.To = req.From.AddDate(0, 0, DefaultDeliveryScheduleDays)
+	}
+
+	if authPayload.Role == model.RoleNameTechnician {
+		acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+		if err != nil {
+			responseGormErr(c, err)
+			return
+		}
+
+		req.TechnicianID = acct.ID
+	}
+
+	var statuses []model.DeliveryStatus
+	if len(req.Status) > 0 {
+		statuses = []model.DeliveryStatus{model.DeliveryStatus(req.Status)}
+	}
+
+	schedule, err := s.store.CustomerContractDeliveryStore.GetSchedule(req.TechnicianID, req.From, req.To, statuses)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, schedule)
+}
+
+type updateDeliveryStatusRequest struct {
+	DeliveryID int                  `json:"delivery_id" binding:"required"`
+	Status     model.DeliveryStatus `json:"status" binding:"required"`
+}
+
+// deliveryStartStatuses are the contract statuses a slot can be driven in: a car is delivered
+// once a technician approved it and collected while it is rented
+var deliveryStartStatuses = map[model.DeliveryType]model.CustomerContractStatus{
+	model.DeliveryTypeDelivery: model.CustomerContractStatusAppraisingCarApproved,
+	model.DeliveryTypeReturn:   model.CustomerContractStatusRenting,
+}
+
+// deliveryCompleteStatuses are the contract statuses completing a slot moves the contract to: the
+// rental starts once the car is delivered and the car is returned once it is collected
+var deliveryCompleteStatuses = map[model.DeliveryType]model.CustomerContractStatus{
+	model.DeliveryTypeDelivery: model.CustomerContractStatusRenting,
+	model.DeliveryTypeReturn:   model.CustomerContractStatusReturnedCar,
+}
+
+var errDeliveryStatusChanged = errors.New("status of delivery changed concurrently")
+
+func (s *Server) HandleUpdateDeliveryStatus(c *gin.Context) {
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	req := updateDeliveryStatusRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidUpdateDeliveryStatusRequest, err)
+		return
+	}
+
+	delivery, err := s.store.CustomerContractDeliveryStore.GetByID(req.DeliveryID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if authPayload.Role == model.RoleNameTechnician && (delivery.TechnicianID == nil || *delivery.TechnicianID != acct.ID) {
+		responseCustomErr(c, ErrCodeInvalidOwnership, nil)
+		return
+	}
+
+	if (req.Status != model.DeliveryStatusOnTheWay && req.Status != model.DeliveryStatusCompleted) ||
+		!model.CanTransitDelivery(delivery.Status, req.Status) {
+		responseCustomErr(c, ErrCodeInvalidDeliveryStatus, errors.New("invalid delivery status"))
+		return
+	}
+
+	if req.Status == model.DeliveryStatusOnTheWay && delivery.CustomerContract.Status != deliveryStartStatuses[delivery.Type] {
+		responseCustomErr(c, ErrCodeInvalidCustomerContractStatus, errors.New("contract is not ready for the delivery"))
+		return
+	}
+
+	// completing a slot moves the contract along, unless an admin already did
+	contract := delivery.CustomerContract
+	var t *service.CustomerContractTransition
+	if req.Status == model.DeliveryStatusCompleted && contract.Status == deliveryStartStatuses[delivery.Type] {
+		t = &service.CustomerContractTransition{
+			CustomerContractID: contract.ID,
+			From:               []model.CustomerContractStatus{deliveryStartStatuses[delivery.Type]},
+			To:                 deliveryCompleteStatuses[delivery.Type],
+			Actor:              s.contractActor(c),
+			Reason:             fmt.Sprintf("%s %d completed", delivery.Type, delivery.ID),
+		}
+
+		// like the admin approval, a car taken off the platform meanwhile is not handed over
+		if t.To == model.CustomerContractStatusRenting {
+			car, err := s.store.CarStore.GetByID(contract.CarID)
+			if err != nil {
+				responseGormErr(c, err)
+				return
+			}
+
+			if car.Status != model.CarStatusActive {
+				responseCustomErr(c, ErrCodeInvalidCarStatus, nil)
+				return
+			}
+		}
+
+		if t.To == model.CustomerContractStatusReturnedCar {
+			// the slot does not load the customer the overtime notification goes to
+			contract, err := s.store.CustomerContractStore.FindByID(contract.ID)
+			if err != nil {
+				responseGormErr(c, err)
+				return
+			}
+
+			if err := s.chargeOvertimeAtReturn(contract); err != nil {
+				responseGormErr(c, err)
+				return
+			}
+		}
+	}
+
+	var transited *model.CustomerContract
+	if err := s.store.DB.Transaction(func(tx *gorm.DB) error {
+		affected, err := s.store.CustomerContractDeliveryStore.UpdateWhenCurStatusTx(tx, delivery.ID, delivery.Status, map[string]interface{}{
+			"status": string(req.Status),
+		})
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return errDeliveryStatusChanged
+		}
+
+		if t == nil {
+			return nil
+		}
+
+		transited, err = s.contractStateMachine.TransitTx(tx, t)
+		return err
+	}); err != nil {
+		if errors.Is(err, errDeliveryStatusChanged) {
+			responseCustomErr(c, ErrCodeInvalidDeliveryStatus, err)
+			return
+		}
+		responseTransitErr(c, err)
+		return
+	}
+
+	if t != nil {
+		s.contractStateMachine.AfterCommit(transited, t)
+	}
+
+	delivery.Status = req.Status
+	if delivery.TechnicianID != nil && *delivery.TechnicianID != acct.ID {
+		s.technicianNotificationQueue <- s.NewDeliveryStatusMsg(*delivery.TechnicianID, delivery)
+	}
+
+	responseSuccess(c, delivery)
+}
+
+// notifyCanceledDeliveries tells technicians their slots of a canceled contract are called off
+func (s *Server) notifyCanceledDeliveries(contract *model.CustomerContract, _ *service.CustomerContractTransition) {
+	deliveries, err := s.store.CustomerContractDeliveryStore.GetByCustomerContractID(contract.ID)
+	if err != nil {
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if delivery.Status == model.DeliveryStatusCanceled && delivery.TechnicianID != nil {
+			s.technicianNotificationQueue <- s.NewDeliveryCanceledMsg(*delivery.TechnicianID, delivery)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+)
+
+func TestDeliveryHandler_ScheduleAndDrive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockNotificationService := service.NewMockINotificationPushService(ctrl)
+	mockNotificationService.EXPECT().Push(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+	mockNotificationService.EXPECT().NewPartnerReceiveNewRentingRequest(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+	previousNotificationService, previousPdfService := TestServer.notificationPushService, TestServer.pdfService
+	TestServer.notificationPushService, TestServer.pdfService = mockNotificationService, &MockPDFService{}
+	defer func() {
+		TestServer.notificationPushService, TestServer.pdfService = previousNotificationService, previousPdfService
+	}()
+
+	require.NoError(t, TestDb.CustomerContractRuleStore.Create(&model.CustomerContractRule{
+		InsurancePercent: 10, PrepayPercent: 30, CollateralCashAmount: 20_000_000,
+		CancellableStatuses:     model.JoinCustomerContractStatuses(model.DefaultCancellableStatuses),
+		CancellationRefundTiers: model.DefaultCancellationRefundTiers(),
+		DeliveryFeeTiers:        model.DefaultDeliveryFeeTiers(),
+	}))
+	carModel := &model.CarModel{Brand: "Delivery", Model: "D1", NumberOfSeats: 4}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+	partner := &model.Account{RoleID: model.RoleIDPartner, PhoneNumber: "0988200000", Status: model.AccountStatusActive}
+	require.NoError(t, TestDb.AccountStore.Create(partner))
+	customer, customerLogin := seedAccountAndLogin("0988200001", "password", model.RoleIDCustomer)
+	require.NoError(t, TestDb.AccountStore.Update(customer.ID, map[string]interface{}{
+		"bank_name": "VCB", "bank_number": "0123456789", "bank_owner": "DELIVERY",
+	}))
+	require.NoError(t, TestDb.DrivingLicenseImageStore.Create([]*model.DrivingLicenseImage{
+		{AccountID: customer.ID, URL: "front", Status: model.DrivingLicenseImageStatusActive},
+		{AccountID: customer.ID, URL: "back", Status: model.DrivingLicenseImageStatusActive},
+	}))
+	technician, technicianLogin := seedAccountAndLogin("0988200002", "password", model.RoleIDTechnician)
+	adminLogin := loginAdmin()
+
+	latitude, longitude := 10.0, 106.0
+	car := &model.Car{
+		PartnerID:             partner.ID,
+		CarModelID:            carModel.ID,
+		LicensePlate:          "DELIVERY-1",
+		ParkingLot:            model.ParkingLotGarage,
+		Status:                model.CarStatusActive,
+		Price:                 500_000,
+		PartnerContractRuleID: 1,
+		EndDate:               time.Now().AddDate(1, 0, 0),
+		Latitude:              &latitude,
+		Longitude:             &longitude,
+	}
+	require.NoError(t, TestDb.CarStore.Create(car))
+
+	call := func(method, path, accessToken string, body interface{}) *httptest.ResponseRecorder {
+		bz, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(method, path, bytes.NewReader(bz))
+		require.NoError(t, err)
+		req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+accessToken)
+		recorder := httptest.NewRecorder()
+		TestServer.route.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// about 5.6km north of the car, then back at its garage
+	deliveryLatitude := 10.05
+	startDate := time.Now().AddDate(0, 0, 3)
+	route := TestServer.AllRoutes()[RouteCustomerRentCar]
+	recorder := call(route.Method, route.Path, customerLogin.AccessToken, customerRentCarRequest{
+		CarID:          car.ID,
+		StartDate:      startDate,
+		EndDate:        startDate.AddDate(0, 0, 2),
+		CollateralType: model.CollateralTypeMotorbike,
+		DeliveryRequest: DeliveryRequest{
+			DeliveryAddress:   "1 Customer street",
+			DeliveryLatitude:  &deliveryLatitude,
+			DeliveryLongitude: &longitude,
+			ReturnAddress:     "2 Customer street",
+			ReturnLatitude:    &latitude,
+			ReturnLongitude:   &longitude,
+		},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	contract := &model.CustomerContract{}
+	require.NoError(t, unmarshalFromCommResponse(recorder.Body.Bytes(), contract))
+	require.Len(t, contract.Deliveries, 2)
+
+	deliveries := map[model.DeliveryType]*model.CustomerContractDelivery{}
+	for _, delivery := range contract.Deliveries {
+		deliveries[delivery.Type] = delivery
+	}
+	delivery := deliveries[model.DeliveryTypeDelivery]
+	require.InDelta(t, 5.6, delivery.DistanceKm, 0.1)
+	require.Equal(t, 100_000, delivery.Fee)
+	require.Equal(t, model.DeliveryStatusPending, delivery.Status)
+	require.Equal(t, 50_000, deliveries[model.DeliveryTypeReturn].Fee)
+
+	t.Run("addresses out of range are rejected", func(t *testing.T) {
+		farLatitude := 11.0
+		recorder := call(route.Method, route.Path, customerLogin.AccessToken, customerRentCarRequest{
+			CarID:          car.ID,
+			StartDate:      startDate.AddDate(0, 1, 0),
+			EndDate:        startDate.AddDate(0, 1, 2),
+			CollateralType: model.CollateralTypeMotorbike,
+			DeliveryRequest: DeliveryRequest{
+				DeliveryAddress:   "far away",
+				DeliveryLatitude:  &farLatitude,
+				DeliveryLongitude: &longitude,
+			},
+		})
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		resp := &CommResponse{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), resp))
+		require.Equal(t, ErrCodeDeliveryOutOfRange, resp.ErrorCode)
+	})
+
+	assignRoute := TestServer.AllRoutes()[RouteAdminAssignDelivery]
+	recorder = call(assignRoute.Method, assignRoute.Path, adminLogin.AccessToken, adminAssignDeliveryRequest{
+		DeliveryID:   delivery.ID,
+		TechnicianID: technician.ID,
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	t.Run("a technician can not drive two slots at once", func(t *testing.T) {
+		recorder := call(assignRoute.Method, assignRoute.Path, adminLogin.AccessToken, adminAssignDeliveryRequest{
+			DeliveryID:   deliveries[model.DeliveryTypeReturn].ID,
+			TechnicianID: technician.ID,
+			ScheduledAt:  &startDate,
+		})
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	scheduleRoute := TestServer.AllRoutes()[RouteGetDeliverySchedule]
+	req, err := http.NewRequest(scheduleRoute.Method, routeWithRole(model.RoleNameTechnician, scheduleRoute.Path), nil)
+	require.NoError(t, err)
+	query := req.URL.Query()
+	query.Add("to", startDate.AddDate(0, 0, 7).Format(time.RFC3339))
+	req.URL.RawQuery = query.Encode()
+	req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+technicianLogin.AccessToken)
+	recorder = httptest.NewRecorder()
+	TestServer.route.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	schedule := make([]*model.CustomerContractDelivery, 0)
+	require.NoError(t, unmarshalFromCommResponse(recorder.Body.Bytes(), &schedule))
+	require.Len(t, schedule, 1)
+	require.Equal(t, delivery.ID, schedule[0].ID)
+	require.Equal(t, model.DeliveryStatusAssigned, schedule[0].Status)
+
+	statusRoute := TestServer.AllRoutes()[RouteUpdateDeliveryStatus]
+	statusPath := routeWithRole(model.RoleNameTechnician, statusRoute.Path)
+	recorder = call(statusRoute.Method, statusPath, technicianLogin.AccessToken, updateDeliveryStatusRequest{
+		DeliveryID: delivery.ID,
+		Status:     model.DeliveryStatusOnTheWay,
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, "the car is not approved for delivery yet")
+
+	for _, to := range []model.CustomerContractStatus{
+		model.CustomerContractStatusWaitingContractPayment,
+		model.CustomerContractStatusOrdered,
+		model.CustomerContractStatusAppraisingCarApproved,
+	} {
+		_, err := TestServer.contractStateMachine.Transit(&service.CustomerContractTransition{
+			CustomerContractID: contract.ID,
+			To:                 to,
+			Actor:              service.SystemContractActor,
+		})
+		require.NoError(t, err)
+	}
+
+	recorder = call(statusRoute.Method, statusPath, technicianLogin.AccessToken, updateDeliveryStatusRequest{
+		DeliveryID: delivery.ID,
+		Status:     model.DeliveryStatusOnTheWay,
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	t.Run("an inactive car is not handed over", func(t *testing.T) {
+		require.NoError(t, TestDb.CarStore.Update(car.ID, map[string]interface{}{"status": string(model.CarStatusInactive)}))
+		defer func() {
+			require.NoError(t, TestDb.CarStore.Update(car.ID, map[string]interface{}{"status": string(model.CarStatusActive)}))
+		}()
+
+		recorder := call(statusRoute.Method, statusPath, technicianLogin.AccessToken, updateDeliveryStatusRequest{
+			DeliveryID: delivery.ID,
+			Status:     model.DeliveryStatusCompleted,
+		})
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		resp := &CommResponse{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), resp))
+		require.Equal(t, ErrCodeInvalidCarStatus, resp.ErrorCode)
+	})
+
+	recorder = call(statusRoute.Method, statusPath, technicianLogin.AccessToken, updateDeliveryStatusRequest{
+		DeliveryID: delivery.ID,
+		Status:     model.DeliveryStatusCompleted,
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	updated, err := TestDb.CustomerContractDeliveryStore.GetByID(delivery.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.DeliveryStatusCompleted, updated.Status)
+	require.Equal(t, technician.ID, *updated.TechnicianID)
+
+	rented, err := TestDb.CustomerContractStore.FindByID(contract.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.CustomerContractStatusRenting, rented.Status, "delivering the car starts the rental")
+}
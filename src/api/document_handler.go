@@ -315,6 +315,40 @@ func (s *Server) HandleAdminUploadCustomerContractDocument(c *gin.Context) {
 	responseSuccess(c, gin.H{"status": "upload customer contract document successfully"})
 }
 
+// uploadImageFiles uploads at most maxFiles images to S3 and returns their urls. The error is
+// already responded when ok is false.
+func (s *Server) uploadImageFiles(c *gin.Context, files []*multipart.FileHeader, maxFiles int) ([]string, bool) {
+	if len(files) > maxFiles {
+		responseCustomErr(c, ErrCodeInvalidNumberOfFiles, fmt.Errorf("exceed maximum number of files, max %d, has %d", maxFiles, len(files)))
+		return nil, false
+	}
+
+	urls := make([]string, 0, len(files))
+	for _, f := range files {
+		if f.Size > MaxUploadFileSize {
+			responseCustomErr(c, ErrCodeInvalidFileSize, fmt.Errorf("exceed maximum file size, max %d, has %d", MaxUploadFileSize, f.Size))
+			return nil, false
+		}
+
+		body, err := f.Open()
+		if err != nil {
+			responseCustomErr(c, ErrCodeReadingDocumentRequest, err)
+			return nil, false
+		}
+
+		url, err := s.uploadDocument(body, f.Filename)
+		body.Close()
+		if err != nil {
+			responseInternalServerError(c, err)
+			return nil, false
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls, true
+}
+
 func (s *Server) uploadDocument(
 	reader io.Reader,
 	fileName string,
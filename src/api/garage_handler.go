@@ -0,0 +1,242 @@
+package api
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type adminCreateGarageRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	Address    string   `json:"address" binding:"required"`
+	Latitude   *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude  *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	Max4Seats  int      `json:"max_4_seats"`
+	Max7Seats  int      `json:"max_7_seats"`
+	Max15Seats int      `json:"max_15_seats"`
+}
+
+func (s *Server) HandleAdminCreateGarage(c *gin.Context) {
+	req := adminCreateGarageRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreateGarageRequest, err)
+		return
+	}
+
+	if req.Max4Seats < 0 || req.Max7Seats < 0 || req.Max15Seats < 0 {
+		responseCustomErr(c, ErrCodeInvalidCreateGarageRequest, errors.New("garage capacity must not be negative"))
+		return
+	}
+
+	garage := &model.Garage{
+		Name:       req.Name,
+		Address:    req.Address,
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		Max4Seats:  req.Max4Seats,
+		Max7Seats:  req.Max7Seats,
+		Max15Seats: req.Max15Seats,
+	}
+	if err := s.store.GarageStore.Create(garage); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, garage)
+}
+
+type adminUpdateGarageRequest struct {
+	ID        int      `json:"id" binding:"required"`
+	Name      string   `json:"name" binding:"required"`
+	Address   string   `json:"address" binding:"required"`
+	Latitude  *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+// HandleAdminUpdateGarage also moves the pickup point of the cars parked at the garage
+func (s *Server) HandleAdminUpdateGarage(c *gin.Context) {
+	req := adminUpdateGarageRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidUpdateGarageRequest, err)
+		return
+	}
+
+	garage, err := s.store.GarageStore.GetByID(req.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	garage.Name = req.Name
+	garage.Address = req.Address
+	garage.Latitude = req.Latitude
+	garage.Longitude = req.Longitude
+	if err := s.store.GarageStore.Update(garage); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, garage)
+}
+
+func (s *Server) HandleGetGarages(c *gin.Context) {
+	garages, err := s.store.GarageStore.GetAll()
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, garages)
+}
+
+type getGarageConfigResponse struct {
+	GarageID       int    `json:"garage_id,omitempty"`
+	GarageName     string `json:"garage_name,omitempty"`
+	Max4Seats      int    `json:"max_4_seats"`
+	Max7Seats      int    `json:"max_7_seats"`
+	Max15Seats     int    `json:"max_15_seats"`
+	Total          int    `json:"total"`
+	Current4Seats  int    `json:"current_4_seats"`
+	Current7Seats  int    `json:"current_7_seats"`
+	Current15Seats int    `json:"current_15_seats"`
+	CurrentTotal   int    `json:"current_total"`
+}
+
+func (r *getGarageConfigResponse) addCars(numberOfSeats, count int) {
+	switch numberOfSeats {
+	case 7:
+		r.Current7Seats += count
+	case 15:
+		r.Current15Seats += count
+	default:
+		r.Current4Seats += count
+	}
+	r.CurrentTotal += count
+}
+
+func (r *getGarageConfigResponse) freeSlots(numberOfSeats int) int {
+	switch numberOfSeats {
+	case 7:
+		return r.Max7Seats - r.Current7Seats
+	case 15:
+		return r.Max15Seats - r.Current15Seats
+	default:
+		return r.Max4Seats - r.Current4Seats
+	}
+}
+
+// garageOccupancies reports the capacity and the slots taken of every garage
+func (s *Server) garageOccupancies() ([]*getGarageConfigResponse, error) {
+	garages, err := s.store.GarageStore.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.store.CarStore.CountSeatsByGarage(model.GarageSlotStatuses)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*getGarageConfigResponse, 0, len(garages))
+	byGarageID := make(map[int]*getGarageConfigResponse, len(garages))
+	for _, g := range garages {
+		o := &getGarageConfigResponse{
+			GarageID:   g.ID,
+			GarageName: g.Name,
+			Max4Seats:  g.Max4Seats,
+			Max7Seats:  g.Max7Seats,
+			Max15Seats: g.Max15Seats,
+			Total:      g.Max4Seats + g.Max7Seats + g.Max15Seats,
+		}
+		res = append(res, o)
+		byGarageID[g.ID] = o
+	}
+
+	for _, count := range counts {
+		if o, ok := byGarageID[count.GarageID]; ok {
+			o.addCars(count.NumberOfSeats, count.Count)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Server) checkIfInsertableNewSeat(garage *model.Garage, seatNumber int) (bool, error) {
+	cur, err := s.store.CarStore.CountBySeats(seatNumber, garage.ID, model.GarageSlotStatuses)
+	if err != nil {
+		return false, err
+	}
+
+	return cur < garage.MaxSeats(seatNumber), nil
+}
+
+var errNotEnoughSlotAtGarage = errors.New("not enough slot at garage")
+
+// hasSlotFor tells whether the car fits at the garage, a car already taking a slot there keeps it
+func (s *Server) hasSlotFor(car *model.Car, garage *model.Garage) (bool, error) {
+	if car.GarageID != nil && *car.GarageID == garage.ID && slices.Contains(model.GarageSlotStatuses, car.Status) {
+		return true, nil
+	}
+
+	return s.checkIfInsertableNewSeat(garage, car.CarModel.NumberOfSeats)
+}
+
+// assignGarage picks the garage a garage car is parked at. The requested garage must have a free
+// slot for the car. Without one the car stays at its current garage while it has room, otherwise it
+// goes to the first garage with a free slot.
+func (s *Server) assignGarage(car *model.Car, garageID int) (*model.Garage, error) {
+	if garageID == 0 && car.GarageID != nil {
+		garage, err := s.store.GarageStore.GetByID(*car.GarageID)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := s.hasSlotFor(car, garage)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return garage, nil
+		}
+	}
+
+	if garageID != 0 {
+		garage, err := s.store.GarageStore.GetByID(garageID)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := s.hasSlotFor(car, garage)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, errNotEnoughSlotAtGarage
+		}
+
+		return garage, nil
+	}
+
+	garages, err := s.store.GarageStore.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, garage := range garages {
+		ok, err := s.hasSlotFor(car, garage)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return garage, nil
+		}
+	}
+
+	return nil, errNotEnoughSlotAtGarage
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"mime/multipart"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+)
+
+const MaxNumberInspectionImages = 20
+
+type inspectionRequest struct {
+	InspectionTemplateID int                     `json:"inspection_template_id" binding:"required"`
+	Note                 string                  `json:"note"`
+	Items                []inspectionItemRequest `json:"items" binding:"required,dive"`
+}
+
+type inspectionItemRequest struct {
+	InspectionTemplateItemID int                           `json:"inspection_template_item_id" binding:"required"`
+	Condition                model.InspectionItemCondition `json:"condition" binding:"omitempty,oneof=good damaged missing"`
+	Value                    *int                          `json:"value" binding:"omitempty,min=0"`
+	Note                     string                        `json:"note"`
+	ImageURLs                []string                      `json:"image_urls"`
+}
+
+func newCustomerContractInspection(
+	req *inspectionRequest,
+	contractID int,
+	stage model.InspectionStage,
+	technicianID int,
+) *model.CustomerContractInspection {
+	items := make([]*model.CustomerContractInspectionItem, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = &model.CustomerContractInspectionItem{
+			InspectionTemplateItemID: item.InspectionTemplateItemID,
+			Condition:                item.Condition,
+			Value:                    item.Value,
+			Note:                     strings.TrimSpace(item.Note),
+			ImageURLs:                item.ImageURLs,
+		}
+	}
+
+	return &model.CustomerContractInspection{
+		CustomerContractID:   contractID,
+		InspectionTemplateID: req.InspectionTemplateID,
+		Stage:                stage,
+		TechnicianID:         technicianID,
+		Note:                 strings.TrimSpace(req.Note),
+		Items:                items,
+	}
+}
+
+func responseInspectionErr(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidInspection) {
+		responseCustomErr(c, ErrCodeInvalidInspection, err)
+		return
+	}
+
+	responseChargeErr(c, err)
+}
+
+func (s *Server) HandleGetInspectionTemplate(c *gin.Context) {
+	template, err := s.store.InspectionStore.GetLastTemplate()
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, template)
+}
+
+type adminCreateInspectionTemplateRequest struct {
+	Name  string                          `json:"name" binding:"required"`
+	Items []inspectionTemplateItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type inspectionTemplateItemRequest struct {
+	Section model.InspectionSection  `json:"section" binding:"required,oneof=exterior tires interior documents odometer fuel"`
+	Name    string                   `json:"name" binding:"required"`
+	Kind    model.InspectionItemKind `json:"kind" binding:"required,oneof=condition reading"`
+}
+
+// HandleAdminCreateInspectionTemplate creates the checklist technicians fill in from now on.
+// Inspections made before keep the template they were made with.
+func (s *Server) HandleAdminCreateInspectionTemplate(c *gin.Context) {
+	req := adminCreateInspectionTemplateRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreateInspectionTemplateRequest, err)
+		return
+	}
+
+	template := &model.InspectionTemplate{
+		Name:  strings.TrimSpace(req.Name),
+		Items: make([]*model.InspectionTemplateItem, len(req.Items)),
+	}
+	for i, item := range req.Items {
+		template.Items[i] = &model.InspectionTemplateItem{
+			Section:  item.Section,
+			Name:     strings.TrimSpace(item.Name),
+			Kind:     item.Kind,
+			Position: i + 1,
+		}
+	}
+
+	if err := s.store.InspectionStore.CreateTemplate(template); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, template)
+}
+
+type getCustomerContractInspectionsRequest struct {
+	CustomerContractID int `form:"customer_contract_id" binding:"required"`
+}
+
+type customerContractInspectionsResponse struct {
+	Pickup *model.CustomerContractInspection `json:"pickup"`
+	Return *model.CustomerContractInspection `json:"return"`
+	Diff   []*service.InspectionItemDiff     `json:"diff"`
+}
+
+// HandleGetCustomerContractInspections returns the pickup and the return inspection of a contract
+// with their differences item by item, so disputes about the car are settled from what was recorded
+func (s *Server) HandleGetCustomerContractInspections(c *gin.Context) {
+	req := getCustomerContractInspectionsRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetCustomerContractInspectionsRequest, err)
+		return
+	}
+
+	contract, ok := s.authorizeCustomerContractParty(c, req.CustomerContractID)
+	if !ok {
+		return
+	}
+
+	inspections, err := s.store.InspectionStore.GetByCustomerContractID(contract.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	resp := &customerContractInspectionsResponse{}
+	for _, inspection := range inspections {
+		switch inspection.Stage {
+		case model.InspectionStagePickup:
+			resp.Pickup = inspection
+		case model.InspectionStageReturn:
+			resp.Return = inspection
+		}
+	}
+	resp.Diff = service.DiffInspections(resp.Pickup, resp.Return)
+
+	responseSuccess(c, resp)
+}
+
+// HandleUploadInspectionImages uploads the photos of inspected items and returns their urls
+func (s *Server) HandleUploadInspectionImages(c *gin.Context) {
+	req := struct {
+		Files []*multipart.FileHeader `form:"files"`
+	}{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidUploadDocumentRequest, err)
+		return
+	}
+
+	urls, ok := s.uploadImageFiles(c, req.Files, MaxNumberInspectionImages)
+	if !ok {
+		return
+	}
+
+	responseSuccess(c, gin.H{"image_urls": urls})
+}
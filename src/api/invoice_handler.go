@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+	"github.com/godev111222333/capstone-backend/src/token"
+)
+
+// issueCustomerPaymentInvoice issues and uploads the invoice of a paid customer payment, payments
+// without an invoice like refunds are skipped
+func (s *Server) issueCustomerPaymentInvoice(paymentID int) (*model.Invoice, error) {
+	invoice, err := s.invoiceService.IssueForCustomerPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return invoice, s.uploadInvoice(invoice)
+}
+
+// uploadInvoice renders an invoice and stores its url, unless it is already uploaded
+func (s *Server) uploadInvoice(invoice *model.Invoice) error {
+	if invoice.URL != "" {
+		return nil
+	}
+
+	bz, err := s.invoiceService.Render(invoice)
+	if err != nil {
+		return err
+	}
+
+	url, err := s.uploadDocument(bytes.NewReader(bz), "invoice."+model.ExtensionPDF)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.InvoiceStore.Update(invoice.ID, map[string]interface{}{"url": url}); err != nil {
+		return err
+	}
+
+	invoice.URL = url
+	return nil
+}
+
+type getCustomerContractInvoicesRequest struct {
+	CustomerContractID int `form:"customer_contract_id" binding:"required"`
+}
+
+// HandleGetCustomerContractInvoices returns the invoices and receipts of the paid payments of a
+// contract. Payments paid before invoicing was set up, or whose upload failed, are invoiced now.
+func (s *Server) HandleGetCustomerContractInvoices(c *gin.Context) {
+	req := getCustomerContractInvoicesRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetCustomerContractInvoicesRequest, err)
+		return
+	}
+
+	contract, ok := s.authorizeCustomerContractParty(c, req.CustomerContractID)
+	if !ok {
+		return
+	}
+
+	payments, err := s.store.CustomerPaymentStore.GetByCustomerContractID(contract.ID, model.PaymentStatusPaid, 0, 0)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	for _, payment := range payments {
+		if _, err := s.issueCustomerPaymentInvoice(payment.ID); err != nil && !errors.Is(err, service.ErrInvoiceNotIssuable) {
+			responseInternalServerError(c, err)
+			return
+		}
+	}
+
+	invoices, err := s.store.InvoiceStore.GetByCustomerContractID(contract.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, invoices)
+}
+
+type getPartnerPaymentReceiptRequest struct {
+	PartnerPaymentHistoryID int `form:"partner_payment_history_id" binding:"required"`
+}
+
+// HandleGetPartnerPaymentReceipt returns the receipt of a paid partner payment, partners only see
+// their own
+func (s *Server) HandleGetPartnerPaymentReceipt(c *gin.Context) {
+	req := getPartnerPaymentReceiptRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetPartnerPaymentReceiptRequest, err)
+		return
+	}
+
+	history, err := s.store.PartnerPaymentHistoryStore.GetByID(req.PartnerPaymentHistoryID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.Role == model.RoleNamePartner {
+		acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+		if err != nil {
+			responseGormErr(c, err)
+			return
+		}
+
+		if history.PartnerID != acct.ID {
+			responseCustomErr(c, ErrCodeInvalidOwnership, nil)
+			return
+		}
+	}
+
+	receipt, err := s.invoiceService.IssueForPartnerPayment(history.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvoiceNotIssuable) {
+			responseCustomErr(c, ErrCodeInvoiceNotIssuable, err)
+			return
+		}
+		responseGormErr(c, err)
+		return
+	}
+
+	if err := s.uploadInvoice(receipt); err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	responseSuccess(c, receipt)
+}
+
+// issuePartnerPaymentReceipts issues and uploads the receipts of paid partner payments
+func (s *Server) issuePartnerPaymentReceipts(payments []*model.PartnerPaymentHistory) {
+	for _, payment := range payments {
+		receipt, err := s.invoiceService.IssueForPartnerPayment(payment.ID)
+		if err == nil {
+			err = s.uploadInvoice(receipt)
+		}
+
+		if err != nil {
+			fmt.Printf("error when issuing receipt of partner payment %d %v\n", payment.ID, err)
+		}
+	}
+}
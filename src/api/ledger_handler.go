@@ -0,0 +1,55 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type adminGetTrialBalanceRequest struct {
+	AsOf time.Time `form:"as_of"`
+}
+
+// HandleAdminGetTrialBalance returns the totals of every ledger account as of a time, or now
+func (s *Server) HandleAdminGetTrialBalance(c *gin.Context) {
+	req := adminGetTrialBalanceRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetTrialBalanceRequest, err)
+		return
+	}
+
+	trialBalance, err := s.ledger.TrialBalance(req.AsOf)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, trialBalance)
+}
+
+type adminGetLedgerAccountStatementRequest struct {
+	Account   model.LedgerAccountCode `form:"account" binding:"required"`
+	PartnerID int                     `form:"partner_id"`
+	StartDate time.Time               `form:"start_date" binding:"required"`
+	EndDate   time.Time               `form:"end_date" binding:"required"`
+}
+
+// HandleAdminGetLedgerAccountStatement returns the lines of a ledger account in a period, of one
+// partner when partner_id is given
+func (s *Server) HandleAdminGetLedgerAccountStatement(c *gin.Context) {
+	req := adminGetLedgerAccountStatementRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetLedgerAccountStatementRequest, err)
+		return
+	}
+
+	statement, err := s.ledger.AccountStatement(req.Account, req.PartnerID, req.StartDate, req.EndDate)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, statement)
+}
@@ -3,11 +3,13 @@ package api
 import (
 	"fmt"
 	"io"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"testing"
 
 	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/paysim"
 	"github.com/godev111222333/capstone-backend/src/service"
 	"github.com/godev111222333/capstone-backend/src/store"
 	"github.com/redis/go-redis/v9"
@@ -23,6 +25,10 @@ var (
 	TestS3Store  *store.S3Store
 	TestConfig   *misc.GlobalConfig
 	TestFeConfig *misc.FEConfig
+	// TestPaySim is the fake VNPay the payment urls of TestServer point to. Its IPN reaches
+	// TestServer through TestApiServer.
+	TestPaySim    *paysim.Simulator
+	TestApiServer *httptest.Server
 )
 
 func TestMain(m *testing.M) {
@@ -71,6 +77,12 @@ func initTestServer(cfg *misc.GlobalConfig) {
 		Password: cfg.Redis.Password,
 	})
 
+	TestPaySim = paysim.NewSimulator(cfg.VNPay.HashSecret, "")
+	paySimServer := httptest.NewServer(TestPaySim.Handler())
+	vnPayCfg := *cfg.VNPay
+	vnPayCfg.PayURL = paySimServer.URL + paysim.PayPath
+	vnPayCfg.ApiURL = paySimServer.URL + paysim.APIPath
+
 	TestServer = NewServer(
 		cfg.ApiServer,
 		TestFeConfig,
@@ -78,8 +90,12 @@ func initTestServer(cfg *misc.GlobalConfig) {
 		TestS3Store,
 		service.NewOTPService(cfg.OTP, nil),
 		bankMetadata,
-		nil, nil, nil, redisClient, nil,
+		nil,
+		NewPaymentGatewayRegistry(NewVnPayService(&vnPayCfg)),
+		nil, redisClient, nil, nil,
 	)
+	TestApiServer = httptest.NewServer(TestServer.route)
+	TestPaySim.IPNURL = TestApiServer.URL + TestServer.AllRoutes()[RouteVNPayIPNURL].Path
 }
 
 func ResetDb(cfg *misc.DatabaseConfig) error {
@@ -17,8 +17,8 @@ const (
 	authorizationPayloadKey = "authorization_payload"
 )
 
-// AuthMiddleware creates a gin middleware for authorization
-func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+// authMiddleware creates a gin middleware for authorization
+func (s *Server) authMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 
@@ -43,7 +43,7 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 		}
 
 		accessToken := fields[1]
-		payload, err := tokenMaker.VerifyToken(accessToken)
+		payload, err := s.verifyAccessToken(accessToken)
 		if err != nil {
 			responseCustomErr(ctx, ErrCodeVerifyAccessToken, err)
 			return
@@ -54,6 +54,29 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 	}
 }
 
+// verifyAccessToken rejects refresh tokens and access tokens in the revocation list
+func (s *Server) verifyAccessToken(accessToken string) (*token.Payload, error) {
+	payload, err := s.tokenMaker.VerifyToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.IsRefreshToken() {
+		return nil, errors.New("refresh token can not be used as access token")
+	}
+
+	revoked, err := s.isTokenRevoked(payload.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, errors.New("token has been revoked")
+	}
+
+	return payload, nil
+}
+
 func (s *Server) activeAccountMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
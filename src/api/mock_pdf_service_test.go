@@ -6,6 +6,6 @@ var _ service.IPDFService = (*MockPDFService)(nil)
 
 type MockPDFService struct{}
 
-func (m *MockPDFService) Render(tz service.RenderType, payload map[string]string) (string, error) {
-	return "rendered_url", nil
+func (m *MockPDFService) Render(tz service.RenderType, version int, payload map[string]string) (*service.RenderedContract, error) {
+	return &service.RenderedContract{UUID: "rendered_url"}, nil
 }
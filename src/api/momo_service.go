@@ -0,0 +1,390 @@
+package api
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+var _ IPaymentService = (*MoMoService)(nil)
+
+const (
+	moMoResultCodeSuccess = 0
+)
+
+// moMoPendingResultCodes are the resultCode of an order that is created but not paid yet
+var moMoPendingResultCodes = map[int]bool{1000: true, 7000: true, 7002: true}
+
+type MoMoService struct {
+	cfg    *misc.MoMoConfig
+	client *http.Client
+}
+
+func NewMoMoService(cfg *misc.MoMoConfig) *MoMoService {
+	return &MoMoService{cfg: cfg, client: &http.Client{Timeout: paymentGatewayTimeout}}
+}
+
+func (s *MoMoService) Gateway() model.PaymentGateway {
+	return model.PaymentGatewayMoMo
+}
+
+type moMoCreateRequest struct {
+	PartnerCode string `json:"partnerCode"`
+	RequestID   string `json:"requestId"`
+	Amount      int64  `json:"amount"`
+	OrderID     string `json:"orderId"`
+	OrderInfo   string `json:"orderInfo"`
+	RedirectURL string `json:"redirectUrl"`
+	IpnURL      string `json:"ipnUrl"`
+	RequestType string `json:"requestType"`
+	ExtraData   string `json:"extraData"`
+	Lang        string `json:"lang"`
+	Signature   string `json:"signature"`
+}
+
+type moMoCreateResponse struct {
+	ResultCode int    `json:"resultCode"`
+	Message    string `json:"message"`
+	PayURL     string `json:"payUrl"`
+}
+
+// GeneratePaymentURL creates a MoMo order. TxnRef is used as both orderId and requestId.
+func (s *MoMoService) GeneratePaymentURL(order *PaymentOrder) (string, error) {
+	req := moMoCreateRequest{
+		PartnerCode: s.cfg.PartnerCode,
+		RequestID:   order.TxnRef,
+		Amount:      int64(order.Amount),
+		OrderID:     order.TxnRef,
+		OrderInfo:   encodeOrderInfo(order.PaymentIDs),
+		RedirectURL: order.ReturnURL,
+		IpnURL:      s.cfg.IpnURL,
+		RequestType: s.cfg.RequestType,
+		Lang:        s.cfg.Lang,
+	}
+	req.Signature = s.sign(fmt.Sprintf(
+		"accessKey=%s&amount=%d&extraData=%s&ipnUrl=%s&orderId=%s&orderInfo=%s&partnerCode=%s&redirectUrl=%s&requestId=%s&requestType=%s",
+		s.cfg.AccessKey, req.Amount, req.ExtraData, req.IpnURL, req.OrderID, req.OrderInfo,
+		req.PartnerCode, req.RedirectURL, req.RequestID, req.RequestType,
+	))
+
+	resp := moMoCreateResponse{}
+	if err := postJSON(s.client, s.cfg.Endpoint+"/v2/gateway/api/create", req, &resp); err != nil {
+		return "", err
+	}
+
+	if resp.ResultCode != moMoResultCodeSuccess {
+		return "", fmt.Errorf("momo create order result code %d: %s", resp.ResultCode, resp.Message)
+	}
+
+	return resp.PayURL, nil
+}
+
+type moMoIPNRequest struct {
+	PartnerCode  string `json:"partnerCode"`
+	OrderID      string `json:"orderId"`
+	RequestID    string `json:"requestId"`
+	Amount       int64  `json:"amount"`
+	OrderInfo    string `json:"orderInfo"`
+	OrderType    string `json:"orderType"`
+	TransID      int64  `json:"transId"`
+	ResultCode   int    `json:"resultCode"`
+	Message      string `json:"message"`
+	PayType      string `json:"payType"`
+	ResponseTime int64  `json:"responseTime"`
+	ExtraData    string `json:"extraData"`
+	Signature    string `json:"signature"`
+}
+
+func (s *MoMoService) VerifyCallback(r *http.Request) (*PaymentResult, error) {
+	req := moMoIPNRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+
+	expected := s.sign(fmt.Sprintf(
+		"accessKey=%s&amount=%d&extraData=%s&message=%s&orderId=%s&orderInfo=%s&orderType=%s&partnerCode=%s&payType=%s&requestId=%s&responseTime=%d&resultCode=%d&transId=%d",
+		s.cfg.AccessKey, req.Amount, req.ExtraData, req.Message, req.OrderID, req.OrderInfo, req.OrderType,
+		req.PartnerCode, req.PayType, req.RequestID, req.ResponseTime, req.ResultCode, req.TransID,
+	))
+	if !hmac.Equal([]byte(strings.ToLower(req.Signature)), []byte(expected)) {
+		return nil, ErrInvalidPaymentSignature
+	}
+
+	return &PaymentResult{
+		Gateway:       model.PaymentGatewayMoMo,
+		TransactionNo: strconv.FormatInt(req.TransID, 10),
+		TxnRef:        req.OrderID,
+		OrderInfo:     req.OrderInfo,
+		Amount:        int(req.Amount),
+		ResponseCode:  strconv.Itoa(req.ResultCode),
+		BankCode:      req.PayType,
+		PayDate:       time.UnixMilli(req.ResponseTime).Format(layoutyyyyMMddHHmmss),
+		Succeeded:     req.ResultCode == moMoResultCodeSuccess,
+	}, nil
+}
+
+type moMoQueryRequest struct {
+	PartnerCode string `json:"partnerCode"`
+	RequestID   string `json:"requestId"`
+	OrderID     string `json:"orderId"`
+	Lang        string `json:"lang"`
+	Signature   string `json:"signature"`
+}
+
+type moMoQueryResponse struct {
+	PartnerCode  string `json:"partnerCode"`
+	RequestID    string `json:"requestId"`
+	OrderID      string `json:"orderId"`
+	ExtraData    string `json:"extraData"`
+	Amount       int64  `json:"amount"`
+	TransID      int64  `json:"transId"`
+	ResultCode   int    `json:"resultCode"`
+	Message      string `json:"message"`
+	PayType      string `json:"payType"`
+	ResponseTime int64  `json:"responseTime"`
+	Signature    string `json:"signature"`
+}
+
+// verifyQueryResponse checks the signature of a query response and that it answers the order that was asked
+func (s *MoMoService) verifyQueryResponse(req *moMoQueryRequest, resp *moMoQueryResponse) error {
+	expected := s.sign(fmt.Sprintf(
+		"accessKey=%s&amount=%d&extraData=%s&message=%s&orderId=%s&partnerCode=%s&payType=%s&requestId=%s&responseTime=%d&resultCode=%d&transId=%d",
+		s.cfg.AccessKey, resp.Amount, resp.ExtraData, resp.Message, resp.OrderID, resp.PartnerCode,
+		resp.PayType, resp.RequestID, resp.ResponseTime, resp.ResultCode, resp.TransID,
+	))
+	if !hmac.Equal([]byte(strings.ToLower(resp.Signature)), []byte(expected)) {
+		return ErrInvalidPaymentSignature
+	}
+
+	if resp.OrderID != req.OrderID || resp.RequestID != req.RequestID || resp.PartnerCode != req.PartnerCode {
+		return fmt.Errorf("%w: momo query response is for order %s", ErrInvalidPaymentSignature, resp.OrderID)
+	}
+
+	return nil
+}
+
+func (s *MoMoService) QueryStatus(order *PaymentOrder) (*PaymentResult, error) {
+	req := moMoQueryRequest{
+		PartnerCode: s.cfg.PartnerCode,
+		RequestID:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		OrderID:     order.TxnRef,
+		Lang:        s.cfg.Lang,
+	}
+	req.Signature = s.sign(fmt.Sprintf(
+		"accessKey=%s&orderId=%s&partnerCode=%s&requestId=%s",
+		s.cfg.AccessKey, req.OrderID, req.PartnerCode, req.RequestID,
+	))
+
+	resp := moMoQueryResponse{}
+	if err := postJSON(s.client, s.cfg.Endpoint+"/v2/gateway/api/query", req, &resp); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyQueryResponse(&req, &resp); err != nil {
+		return nil, err
+	}
+
+	if moMoPendingResultCodes[resp.ResultCode] {
+		return nil, errPaymentPending
+	}
+
+	return &PaymentResult{
+		Gateway:       model.PaymentGatewayMoMo,
+		TransactionNo: strconv.FormatInt(resp.TransID, 10),
+		TxnRef:        order.TxnRef,
+		OrderInfo:     encodeOrderInfo(order.PaymentIDs),
+		Amount:        int(resp.Amount),
+		ResponseCode:  strconv.Itoa(resp.ResultCode),
+		BankCode:      resp.PayType,
+		PayDate:       time.UnixMilli(resp.ResponseTime).Format(layoutyyyyMMddHHmmss),
+		Succeeded:     resp.ResultCode == moMoResultCodeSuccess,
+	}, nil
+}
+
+type moMoRefundRequest struct {
+	PartnerCode string `json:"partnerCode"`
+	OrderID     string `json:"orderId"`
+	RequestID   string `json:"requestId"`
+	Amount      int64  `json:"amount"`
+	TransID     int64  `json:"transId"`
+	Lang        string `json:"lang"`
+	Description string `json:"description"`
+	Signature   string `json:"signature"`
+}
+
+type moMoRefundResponse struct {
+	PartnerCode  string `json:"partnerCode"`
+	OrderID      string `json:"orderId"`
+	RequestID    string `json:"requestId"`
+	Amount       int64  `json:"amount"`
+	TransID      int64  `json:"transId"`
+	ResultCode   int    `json:"resultCode"`
+	Message      string `json:"message"`
+	ResponseTime int64  `json:"responseTime"`
+	Signature    string `json:"signature"`
+}
+
+func (s *MoMoService) verifyRefundResponse(req *moMoRefundRequest, resp *moMoRefundResponse) error {
+	expected := s.sign(fmt.Sprintf(
+		"accessKey=%s&amount=%d&message=%s&orderId=%s&partnerCode=%s&requestId=%s&responseTime=%d&resultCode=%d&transId=%d",
+		s.cfg.AccessKey, resp.Amount, resp.Message, resp.OrderID, resp.PartnerCode, resp.RequestID,
+		resp.ResponseTime, resp.ResultCode, resp.TransID,
+	))
+	if !hmac.Equal([]byte(strings.ToLower(resp.Signature)), []byte(expected)) {
+		return ErrInvalidPaymentSignature
+	}
+
+	if resp.OrderID != req.OrderID || resp.RequestID != req.RequestID || resp.PartnerCode != req.PartnerCode {
+		return fmt.Errorf("%w: momo refund response is for order %s", ErrInvalidPaymentSignature, resp.OrderID)
+	}
+
+	return nil
+}
+
+// Refund refunds a MoMo transaction. The refund is a new MoMo order identified by RefundRef.
+func (s *MoMoService) Refund(order *RefundOrder) (*RefundResult, error) {
+	transID, err := strconv.ParseInt(order.Payment.ExternalTransactionID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	req := moMoRefundRequest{
+		PartnerCode: s.cfg.PartnerCode,
+		OrderID:     order.RefundRef,
+		RequestID:   order.RefundRef,
+		Amount:      int64(order.Amount),
+		TransID:     transID,
+		Lang:        s.cfg.Lang,
+		Description: order.Reason,
+	}
+	req.Signature = s.sign(fmt.Sprintf(
+		"accessKey=%s&amount=%d&description=%s&orderId=%s&partnerCode=%s&requestId=%s&transId=%d",
+		s.cfg.AccessKey, req.Amount, req.Description, req.OrderID, req.PartnerCode, req.RequestID, req.TransID,
+	))
+
+	resp := moMoRefundResponse{}
+	if err := postJSON(s.client, s.cfg.Endpoint+"/v2/gateway/api/refund", req, &resp); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyRefundResponse(&req, &resp); err != nil {
+		return nil, err
+	}
+
+	status := model.CustomerRefundStatusFailed
+	if resp.ResultCode == moMoResultCodeSuccess {
+		status = model.CustomerRefundStatusSucceeded
+	} else if moMoPendingResultCodes[resp.ResultCode] {
+		status = model.CustomerRefundStatusPending
+	}
+
+	return &RefundResult{
+		ExternalRefundID: strconv.FormatInt(resp.TransID, 10),
+		ResponseCode:     strconv.Itoa(resp.ResultCode),
+		Message:          resp.Message,
+		Status:           status,
+	}, nil
+}
+
+type moMoRefundQueryRequest struct {
+	PartnerCode string `json:"partnerCode"`
+	OrderID     string `json:"orderId"`
+	RequestID   string `json:"requestId"`
+	Lang        string `json:"lang"`
+	Signature   string `json:"signature"`
+}
+
+type moMoRefundTrans struct {
+	OrderID    string `json:"orderId"`
+	Amount     int64  `json:"amount"`
+	ResultCode int    `json:"resultCode"`
+	TransID    int64  `json:"transId"`
+}
+
+type moMoRefundQueryResponse struct {
+	PartnerCode string             `json:"partnerCode"`
+	OrderID     string             `json:"orderId"`
+	RequestID   string             `json:"requestId"`
+	ResultCode  int                `json:"resultCode"`
+	Message     string             `json:"message"`
+	RefundTrans []*moMoRefundTrans `json:"refundTrans"`
+}
+
+// QueryRefund lists the refunds of the paid order and picks the one identified by RefundRef.
+// A refund MoMo does not list never reached it.
+func (s *MoMoService) QueryRefund(order *RefundOrder) (*RefundResult, error) {
+	req := moMoRefundQueryRequest{
+		PartnerCode: s.cfg.PartnerCode,
+		OrderID:     order.Payment.TxnRef,
+		RequestID:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Lang:        s.cfg.Lang,
+	}
+	req.Signature = s.sign(fmt.Sprintf(
+		"accessKey=%s&orderId=%s&partnerCode=%s&requestId=%s",
+		s.cfg.AccessKey, req.OrderID, req.PartnerCode, req.RequestID,
+	))
+
+	resp := moMoRefundQueryResponse{}
+	if err := postJSON(s.client, s.cfg.Endpoint+"/v2/gateway/api/refund/query", req, &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.OrderID != req.OrderID || resp.RequestID != req.RequestID || resp.PartnerCode != req.PartnerCode {
+		return nil, fmt.Errorf("%w: momo refund query response is for order %s", ErrInvalidPaymentSignature, resp.OrderID)
+	}
+
+	if resp.ResultCode != moMoResultCodeSuccess {
+		return nil, fmt.Errorf("momo refund query result code %d: %s", resp.ResultCode, resp.Message)
+	}
+
+	for _, trans := range resp.RefundTrans {
+		if trans.OrderID != order.RefundRef {
+			continue
+		}
+
+		status := model.CustomerRefundStatusFailed
+		if trans.ResultCode == moMoResultCodeSuccess {
+			status = model.CustomerRefundStatusSucceeded
+		} else if moMoPendingResultCodes[trans.ResultCode] {
+			status = model.CustomerRefundStatusPending
+		}
+
+		return &RefundResult{
+			ExternalRefundID: strconv.FormatInt(trans.TransID, 10),
+			ResponseCode:     strconv.Itoa(trans.ResultCode),
+			Message:          resp.Message,
+			Status:           status,
+		}, nil
+	}
+
+	return &RefundResult{
+		ResponseCode: strconv.Itoa(resp.ResultCode),
+		Message:      "refund not found at momo",
+		Status:       model.CustomerRefundStatusFailed,
+	}, nil
+}
+
+// RespondCallback answers an IPN. MoMo only expects 204 No Content once the IPN is handled.
+func (s *MoMoService) RespondCallback(c *gin.Context, code PaymentCallbackCode) {
+	switch code {
+	case PaymentCallbackSuccess, PaymentCallbackAlreadyConfirmed:
+		c.Status(http.StatusNoContent)
+	case PaymentCallbackUnknownError:
+		c.AbortWithStatus(http.StatusInternalServerError)
+	default:
+		c.AbortWithStatus(http.StatusBadRequest)
+	}
+}
+
+func (s *MoMoService) sign(data string) string {
+	return hmacSHA256(s.cfg.SecretKey, data)
+}
@@ -0,0 +1,44 @@
+package api
+
+import "github.com/godev111222333/capstone-backend/src/service"
+
+// startOvertimeChargeSub notifies the parties of overdue contracts about the overtime charged by
+// the background service. The customer hears of every charge, the partner and the admins only of
+// the first one.
+func (s *Server) startOvertimeChargeSub() {
+	go func() {
+		for charge := range s.overtimeChargeQueue {
+			s.notifyOvertimeCharge(charge)
+		}
+	}()
+}
+
+func (s *Server) notifyOvertimeCharge(charge *service.OvertimeCharge) {
+	contract, err := s.store.CustomerContractStore.FindByID(charge.CustomerContractID)
+	if err != nil {
+		return
+	}
+
+	phone, expoToken := contract.Customer.PhoneNumber, s.getExpoToken(contract.Customer.PhoneNumber)
+	msg := s.notificationPushService.NewCustomerOvertimeFeeMsg(contract.ID, charge.Payment.Amount, expoToken, phone)
+	_ = s.notificationPushService.Push(contract.CustomerID, msg)
+
+	if !charge.FirstCharge {
+		return
+	}
+
+	if contract.Car.Account != nil {
+		phone, expoToken := contract.Car.Account.PhoneNumber, s.getExpoToken(contract.Car.Account.PhoneNumber)
+		msg := s.notificationPushService.NewPartnerCarOverdueMsg(contract.CarID, contract.ID, expoToken, phone)
+		_ = s.notificationPushService.Push(contract.Car.PartnerID, msg)
+	}
+
+	adminIds, err := s.store.AccountStore.GetAllAdminIDs()
+	if err != nil {
+		return
+	}
+
+	for _, id := range adminIds {
+		s.adminNotificationQueue <- s.NewCustomerContractOverdueNotificationMsg(id, contract.ID, contract.Car.LicensePlate)
+	}
+}
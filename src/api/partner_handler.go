@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"github.com/godev111222333/capstone-backend/src/model"
 	"github.com/godev111222333/capstone-backend/src/service"
@@ -66,6 +68,50 @@ type registerCarRequest struct {
 	ParkingLot   model.ParkingLot `json:"parking_lot" binding:"required"`
 	PeriodCode   string           `json:"period_code" binding:"required"`
 	Description  string           `json:"description"`
+	// GarageID is where a garage car is parked, cars parked at home are picked up at
+	// PickupAddress, Latitude and Longitude instead
+	GarageID      int      `json:"garage_id"`
+	PickupAddress string   `json:"pickup_address"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
+}
+
+// pickupPoint sets where the car is picked up from the request
+func (s *Server) pickupPoint(car *model.Car, req *registerCarRequest) error {
+	switch req.ParkingLot {
+	case model.ParkingLotGarage:
+		if req.GarageID == 0 {
+			return errors.New("garage_id is required for cars parked at a garage")
+		}
+
+		garage, err := s.store.GarageStore.GetByID(req.GarageID)
+		if err != nil {
+			return err
+		}
+
+		car.PickUpAt(garage)
+	case model.ParkingLotHome:
+		if len(strings.TrimSpace(req.PickupAddress)) == 0 || req.Latitude == nil || req.Longitude == nil {
+			return errors.New("pickup_address, latitude and longitude are required for cars parked at home")
+		}
+
+		if !isValidCoordinate(*req.Latitude, *req.Longitude) {
+			return errInvalidCoordinate
+		}
+
+		car.PickupAddress = strings.TrimSpace(req.PickupAddress)
+		car.Latitude, car.Longitude = req.Latitude, req.Longitude
+	default:
+		return errors.New("invalid parking_lot")
+	}
+
+	return nil
+}
+
+var errInvalidCoordinate = errors.New("latitude must be within [-90, 90] and longitude within [-180, 180]")
+
+func isValidCoordinate(latitude, longitude float64) bool {
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
 }
 
 func (s *Server) HandleRegisterCar(c *gin.Context) {
@@ -124,6 +170,15 @@ func (s *Server) HandleRegisterCar(c *gin.Context) {
 		Status:                model.CarStatusPendingApplicationPendingCarImages,
 	}
 
+	if err := s.pickupPoint(car, &req); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseGormErr(c, err)
+			return
+		}
+		responseCustomErr(c, ErrCodeInvalidRegisterCarRequest, err)
+		return
+	}
+
 	if err := s.store.CarStore.Create(car); err != nil {
 		responseGormErr(c, err)
 		return
@@ -203,6 +258,11 @@ type carResponse struct {
 	CarModel            model.CarModel            `json:"car_model"`
 	LicensePlate        string                    `json:"license_plate"`
 	ParkingLot          model.ParkingLot          `json:"parking_lot"`
+	GarageID            *int                      `json:"garage_id"`
+	PickupAddress       string                    `json:"pickup_address"`
+	Latitude            *float64                  `json:"latitude"`
+	Longitude           *float64                  `json:"longitude"`
+	Distance            *float64                  `json:"distance,omitempty"`
 	Description         string                    `json:"description"`
 	Fuel                model.Fuel                `json:"fuel"`
 	Motion              model.Motion              `json:"motion"`
@@ -244,6 +304,10 @@ func (s *Server) newCarResponse(car *model.Car) (*carResponse, error) {
 		CarModel:            car.CarModel,
 		LicensePlate:        car.LicensePlate,
 		ParkingLot:          car.ParkingLot,
+		GarageID:            car.GarageID,
+		PickupAddress:       car.PickupAddress,
+		Latitude:            car.Latitude,
+		Longitude:           car.Longitude,
 		Description:         car.Description,
 		Fuel:                car.Fuel,
 		Motion:              car.Motion,
@@ -340,22 +404,36 @@ func (s *Server) HandlePartnerAgreeContract(c *gin.Context) {
 		return
 	}
 
+	updateValues := map[string]interface{}{
+		"partner_contract_status": string(model.PartnerContractStatusAgreed),
+	}
 	if car.ParkingLot == model.ParkingLotGarage {
-		isValid, err := s.checkIfInsertableNewSeat(car.CarModel.NumberOfSeats)
+		// the car goes to the garage it was approved at, cars approved before garages had their
+		// own capacity get one with a free slot
+		garageID := 0
+		if car.GarageID != nil {
+			garageID = *car.GarageID
+		}
+
+		garage, err := s.assignGarage(car, garageID)
 		if err != nil {
+			if errors.Is(err, errNotEnoughSlotAtGarage) {
+				responseCustomErr(c, ErrCodeNotEnoughSlotAtGarage, err)
+				return
+			}
+
 			responseGormErr(c, err)
 			return
 		}
 
-		if !isValid {
-			responseCustomErr(c, ErrCodeNotEnoughSlotAtGarage, errors.New("not enough slot at garage"))
-			return
-		}
+		car.PickUpAt(garage)
+		updateValues["garage_id"] = car.GarageID
+		updateValues["pickup_address"] = car.PickupAddress
+		updateValues["latitude"] = car.Latitude
+		updateValues["longitude"] = car.Longitude
 	}
 
-	if err := s.store.CarStore.Update(car.ID, map[string]interface{}{
-		"partner_contract_status": string(model.PartnerContractStatusAgreed),
-	}); err != nil {
+	if err := s.store.CarStore.Update(car.ID, updateValues); err != nil {
 		responseGormErr(c, err)
 		return
 	}
@@ -474,10 +552,8 @@ func (s *Server) HandlePartnerGetActivityDetail(c *gin.Context) {
 	}
 	resp := make([]*contractWNetReceive, len(contracts))
 	for i, contract := range contracts {
-		wNetReceive := &contractWNetReceive{
-			contract,
-			contract.RentPrice * int(100.0-contract.Car.PartnerContractRule.RevenueSharingPercent) / 100}
-		resp[i] = wNetReceive
+		_, net := contract.Car.PartnerContractRule.SplitRevenue(contract.RentPrice)
+		resp[i] = &contractWNetReceive{contract, net}
 	}
 
 	responseSuccess(c, resp)
@@ -581,22 +657,32 @@ func (s *Server) HandlePartnerApproveCustomerContract(c *gin.Context) {
 		return
 	}
 
-	if contract.Status != model.CustomerContractStatusWaitingPartnerApproval {
-		responseCustomErr(c, ErrCodeInvalidCustomerContractStatus,
-			fmt.Errorf("require %s, found %s", string(model.CustomerContractStatusWaitingPartnerApproval), string(contract.Status)))
-		return
+	t := &service.CustomerContractTransition{
+		CustomerContractID: req.CustomerContractID,
+		From:               []model.CustomerContractStatus{model.CustomerContractStatusWaitingPartnerApproval},
+		To:                 model.CustomerContractStatusWaitingContractAgreement,
+		Actor:              service.ContractActor{AccountID: acct.ID, Role: model.RoleNamePartner},
+		Reason:             fmt.Sprintf("partner %s", req.Action),
 	}
-
-	nextStatus := model.CustomerContractStatusWaitingContractAgreement
 	if req.Action == PartnerActionReject {
-		nextStatus = model.CustomerContractStatusCancel
-	}
+		cancellation, err := s.cancellationEngine.Cancel(t)
+		if err != nil {
+			responseCancelErr(c, err)
+			return
+		}
 
-	if err := s.store.CustomerContractStore.Update(req.CustomerContractID, map[string]interface{}{
-		"status": string(nextStatus),
-	}); err != nil {
-		responseGormErr(c, err)
-		return
+		if cancellation.WarningPenalty > 0 {
+			if car, err := s.store.CarStore.GetByID(contract.CarID); err == nil {
+				_, _ = s.applyWarningCount(car)
+			}
+		}
+	} else {
+		// the customer still has to agree and pay, so the hold starts over
+		t.HoldTTL = s.reservationHoldTTL()
+		if _, err := s.contractStateMachine.Transit(t); err != nil {
+			responseTransitErr(c, err)
+			return
+		}
 	}
 
 	msg := &service.PushMessage{}
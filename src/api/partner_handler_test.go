@@ -51,14 +51,18 @@ func TestRegisterCarHandler(t *testing.T) {
 			BasedPrice:    350_000,
 		}
 		require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+		latitude, longitude := 10.7797, 106.6990
 		body := registerCarRequest{
-			LicensePlate: "59F1234",
-			CarModelID:   carModel.ID,
-			Motion:       model.MotionManualTransmission,
-			Fuel:         model.FuelGas,
-			ParkingLot:   model.ParkingLotHome,
-			PeriodCode:   "1",
-			Description:  "Super dude",
+			LicensePlate:  "59F1234",
+			CarModelID:    carModel.ID,
+			Motion:        model.MotionManualTransmission,
+			Fuel:          model.FuelGas,
+			ParkingLot:    model.ParkingLotHome,
+			PeriodCode:    "1",
+			Description:   "Super dude",
+			PickupAddress: "1 Le Duan, District 1",
+			Latitude:      &latitude,
+			Longitude:     &longitude,
 		}
 		bz, _ := json.Marshal(body)
 		req, _ := http.NewRequest(route.Method, route.Path, bytes.NewReader(bz))
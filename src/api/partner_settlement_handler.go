@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+	"github.com/godev111222333/capstone-backend/src/token"
+)
+
+func responseSettlementErr(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrPartnerPaymentNotAdjustable) {
+		responseCustomErr(c, ErrCodePartnerPaymentNotAdjustable, err)
+		return
+	}
+
+	if errors.Is(err, service.ErrInvalidPartnerPaymentAdjustment) {
+		responseCustomErr(c, ErrCodeInvalidPartnerPaymentAdjustment, err)
+		return
+	}
+
+	responseGormErr(c, err)
+}
+
+type adminCreatePartnerPaymentAdjustmentRequest struct {
+	PartnerPaymentHistoryID int                                    `json:"partner_payment_history_id" binding:"required"`
+	Category                model.PartnerPaymentAdjustmentCategory `json:"category" binding:"required,oneof=penalty bonus damage_reimbursement other"`
+	Description             string                                 `json:"description" binding:"required"`
+	Amount                  int                                    `json:"amount" binding:"required"`
+	ReturnURL               string                                 `json:"return_url" binding:"required"`
+}
+
+// HandleAdminCreatePartnerPaymentAdjustment adds a penalty, bonus, damage reimbursement or other
+// line item to a pending partner payment and renews its payment url for the new amount
+func (s *Server) HandleAdminCreatePartnerPaymentAdjustment(c *gin.Context) {
+	req := adminCreatePartnerPaymentAdjustmentRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreatePartnerPaymentAdjustmentRequest, err)
+		return
+	}
+
+	adjustment := &model.PartnerPaymentAdjustment{
+		PartnerPaymentHistoryID: req.PartnerPaymentHistoryID,
+		Category:                req.Category,
+		Description:             strings.TrimSpace(req.Description),
+		Amount:                  req.Amount,
+		CreatedBy:               s.contractActor(c).AccountID,
+	}
+	payment, err := s.partnerSettlement.AddAdjustment(adjustment)
+	if err != nil {
+		responseSettlementErr(c, err)
+		return
+	}
+
+	if err := s.generatePartnerPaymentQRCode(payment.ID, payment.Amount, req.ReturnURL); err != nil {
+		responseCustomErr(c, ErrCodeGenerateQRCode, err)
+		return
+	}
+
+	responseSuccess(c, adjustment)
+}
+
+type getPartnerPaymentStatementRequest struct {
+	PartnerPaymentHistoryID int `form:"partner_payment_history_id" binding:"required"`
+}
+
+// HandleGetPartnerPaymentStatement returns the statement of a partner payment, partners only see
+// their own
+func (s *Server) HandleGetPartnerPaymentStatement(c *gin.Context) {
+	req := getPartnerPaymentStatementRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetPartnerPaymentStatementRequest, err)
+		return
+	}
+
+	statement, err := s.partnerSettlement.Statement(req.PartnerPaymentHistoryID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.Role == model.RoleNamePartner {
+		acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+		if err != nil {
+			responseGormErr(c, err)
+			return
+		}
+
+		if statement.Payment.PartnerID != acct.ID {
+			responseCustomErr(c, ErrCodeInvalidOwnership, nil)
+			return
+		}
+	}
+
+	responseSuccess(c, statement)
+}
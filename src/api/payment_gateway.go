@@ -0,0 +1,170 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+const paymentGatewayTimeout = 15 * time.Second
+
+var (
+	ErrUnsupportedPaymentGateway = errors.New("unsupported payment gateway")
+	ErrInvalidPaymentSignature   = errors.New("invalid payment signature")
+	errPaymentPending            = errors.New("payment is still pending at gateway")
+	errPaymentAlreadyConfirmed   = errors.New("order already confirmed")
+	errCarHoldLapsed             = errors.New("the hold on the car lapsed, the contract can not be paid anymore")
+)
+
+// PaymentOrder is what we send to a gateway. TxnRef and CreatedAt are stored on the payments,
+// so the same order can be rebuilt later to query its status.
+type PaymentOrder struct {
+	PaymentIDs []int
+	Amount     int
+	TxnRef     string
+	ReturnURL  string
+	CreatedAt  time.Time
+}
+
+// PaymentResult is a verified callback or a status query answer, normalized across gateways.
+// Amount is in VND.
+type PaymentResult struct {
+	Gateway       model.PaymentGateway
+	TransactionNo string
+	TxnRef        string
+	OrderInfo     string
+	Amount        int
+	ResponseCode  string
+	BankCode      string
+	PayDate       string
+	Succeeded     bool
+}
+
+func (r *PaymentResult) PaymentIDs() []int {
+	return decodeOrderInfo(r.OrderInfo)
+}
+
+func (r *PaymentResult) toPaymentTransaction() *model.PaymentTransaction {
+	status := model.PaymentTransactionStatusSucceeded
+	if !r.Succeeded {
+		status = model.PaymentTransactionStatusFailed
+	}
+
+	return &model.PaymentTransaction{
+		Gateway:       r.Gateway,
+		TransactionNo: r.TransactionNo,
+		TxnRef:        r.TxnRef,
+		OrderInfo:     r.OrderInfo,
+		Amount:        r.Amount,
+		ResponseCode:  r.ResponseCode,
+		BankCode:      r.BankCode,
+		PayDate:       r.PayDate,
+		Status:        status,
+	}
+}
+
+// RefundOrder returns Amount of a paid payment. RefundRef is our unique reference of the refund.
+type RefundOrder struct {
+	RefundRef string
+	Payment   *model.CustomerPayment
+	Amount    int
+	Reason    string
+	CreatedAt time.Time
+}
+
+func (o *RefundOrder) isFull() bool {
+	return o.Amount == o.Payment.Amount
+}
+
+type RefundResult struct {
+	ExternalRefundID string
+	ResponseCode     string
+	Message          string
+	Status           model.CustomerRefundStatus
+}
+
+// PaymentCallbackCode is the outcome of processing a callback. Each gateway translates it
+// into the acknowledgement format it expects.
+type PaymentCallbackCode int
+
+const (
+	PaymentCallbackSuccess PaymentCallbackCode = iota
+	PaymentCallbackOrderNotFound
+	PaymentCallbackAlreadyConfirmed
+	PaymentCallbackInvalidAmount
+	PaymentCallbackInvalidSignature
+	PaymentCallbackUnknownError
+)
+
+type IPaymentService interface {
+	Gateway() model.PaymentGateway
+	GeneratePaymentURL(order *PaymentOrder) (string, error)
+	// VerifyCallback checks the signature of a gateway callback and parses it.
+	// It returns ErrInvalidPaymentSignature when the signature does not match.
+	VerifyCallback(r *http.Request) (*PaymentResult, error)
+	// QueryStatus asks the gateway for the result of an order. It returns errPaymentPending
+	// while the customer has not finished paying.
+	QueryStatus(order *PaymentOrder) (*PaymentResult, error)
+	// Refund returns money of a paid payment with the gateway's refund command. An error means
+	// the outcome is unknown; a refund the gateway declined is a result with failed status.
+	Refund(order *RefundOrder) (*RefundResult, error)
+	// QueryRefund asks the gateway for the outcome of a refund sent with Refund. A refund the
+	// gateway never received is a result with failed status.
+	QueryRefund(order *RefundOrder) (*RefundResult, error)
+	RespondCallback(c *gin.Context, code PaymentCallbackCode)
+}
+
+type PaymentGatewayRegistry struct {
+	defaultGateway model.PaymentGateway
+	services       map[model.PaymentGateway]IPaymentService
+}
+
+func NewPaymentGatewayRegistry(defaultService IPaymentService, services ...IPaymentService) *PaymentGatewayRegistry {
+	registry := &PaymentGatewayRegistry{
+		defaultGateway: defaultService.Gateway(),
+		services:       map[model.PaymentGateway]IPaymentService{},
+	}
+
+	registry.Register(defaultService)
+	for _, service := range services {
+		registry.Register(service)
+	}
+
+	return registry
+}
+
+func (r *PaymentGatewayRegistry) Register(service IPaymentService) {
+	r.services[service.Gateway()] = service
+}
+
+// Get returns the service of a gateway. An empty gateway means the default one.
+func (r *PaymentGatewayRegistry) Get(gateway model.PaymentGateway) (IPaymentService, error) {
+	if gateway == "" {
+		gateway = r.defaultGateway
+	}
+
+	service, ok := r.services[gateway]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPaymentGateway, gateway)
+	}
+
+	return service, nil
+}
+
+func (r *PaymentGatewayRegistry) Default() IPaymentService {
+	return r.services[r.defaultGateway]
+}
+
+func hmacSHA256(key, data string) string {
+	signer := hmac.New(sha256.New, []byte(key))
+	signer.Write([]byte(data))
+	return hex.EncodeToString(signer.Sum(nil))
+}
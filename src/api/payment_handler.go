@@ -1,21 +1,26 @@
 package api
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"hash"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/go-querystring/query"
+	"gorm.io/gorm"
 
 	"github.com/godev111222333/capstone-backend/src/misc"
 	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
 )
 
 type PayRequest struct {
@@ -37,46 +42,42 @@ type PayRequest struct {
 
 var _ IPaymentService = (*VnPayService)(nil)
 
-type IPaymentService interface {
-	GeneratePaymentURL(paymentIDs []int, amount int, txnRef, returnURL string) (string, error)
-}
-
 type VnPayService struct {
 	cfg    *misc.VNPayConfig
-	signer hash.Hash
+	client *http.Client
 }
 
 func NewVnPayService(cfg *misc.VNPayConfig) *VnPayService {
-	signer := hmac.New(sha512.New, []byte(cfg.HashSecret))
-	return &VnPayService{cfg: cfg, signer: signer}
+	return &VnPayService{cfg: cfg, client: &http.Client{Timeout: paymentGatewayTimeout}}
 }
 
-func (s *VnPayService) GeneratePaymentURL(
-	paymentIDs []int, amount int,
-	txnRef, returnURL string,
-) (string, error) {
+const layoutyyyyMMddHHmmss = "20060102150405"
+
+func (s *VnPayService) Gateway() model.PaymentGateway {
+	return model.PaymentGatewayVNPay
+}
+
+func (s *VnPayService) GeneratePaymentURL(order *PaymentOrder) (string, error) {
 	req, err := http.NewRequest(http.MethodGet, s.cfg.PayURL, nil)
 	if err != nil {
 		fmt.Printf("error when generating payment url %v\n", err)
 		return "", err
 	}
 
-	now := time.Now()
-	layoutyyyyMMddHHmmss := "20060102150405"
 	reqBody := PayRequest{
 		Version:     s.cfg.Version,
 		Command:     s.cfg.Command,
 		TmnCode:     s.cfg.TMNCode,
-		Amount:      amount * 100,
-		CreatedDate: now.Format(layoutyyyyMMddHHmmss),
-		ExpireDate:  now.AddDate(0, 0, 7).Format(layoutyyyyMMddHHmmss),
+		Amount:      order.Amount * 100,
+		CreatedDate: order.CreatedAt.Format(layoutyyyyMMddHHmmss),
+		ExpireDate:  order.CreatedAt.AddDate(0, 0, 7).Format(layoutyyyyMMddHHmmss),
 		CurrCode:    "VND",
 		IpAddress:   "::1",
 		Locale:      s.cfg.Locale,
-		OrderInfo:   encodeOrderInfo(paymentIDs),
+		OrderInfo:   encodeOrderInfo(order.PaymentIDs),
 		OrderType:   "other",
-		ReturnURL:   returnURL,
-		TxnRef:      txnRef,
+		ReturnURL:   order.ReturnURL,
+		TxnRef:      order.TxnRef,
 		BankCode:    s.cfg.BankCode,
 	}
 
@@ -87,195 +88,746 @@ func (s *VnPayService) GeneratePaymentURL(
 	}
 
 	signData := values.Encode()
+	req.URL.RawQuery = signData + "&vnp_SecureHash=" + s.sign(signData)
+	return req.URL.String(), nil
+}
 
-	s.signer.Reset()
-	s.signer.Write([]byte(signData))
-	secureHash := hex.EncodeToString(s.signer.Sum(nil))
+// VerifySecureHash checks vnp_SecureHash of a callback. VNPay signs every vnp_ param except
+// the hash itself, sorted by key and url encoded.
+func (s *VnPayService) VerifySecureHash(values url.Values) bool {
+	secureHash := values.Get("vnp_SecureHash")
+	if secureHash == "" {
+		return false
+	}
 
-	req.URL.RawQuery = signData + "&vnp_SecureHash=" + secureHash
-	return req.URL.String(), nil
+	signValues := url.Values{}
+	for k, v := range values {
+		if strings.HasPrefix(k, "vnp_") && k != "vnp_SecureHash" && k != "vnp_SecureHashType" {
+			signValues[k] = v
+		}
+	}
+
+	expected := s.sign(signValues.Encode())
+	return hmac.Equal([]byte(strings.ToLower(secureHash)), []byte(expected))
+}
+
+func (s *VnPayService) VerifyCallback(r *http.Request) (*PaymentResult, error) {
+	values := r.URL.Query()
+	if !s.VerifySecureHash(values) {
+		return nil, ErrInvalidPaymentSignature
+	}
+
+	amount, err := strconv.Atoi(values.Get("vnp_Amount"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaymentResult{
+		Gateway:       model.PaymentGatewayVNPay,
+		TransactionNo: values.Get("vnp_TransactionNo"),
+		TxnRef:        values.Get("vnp_TxnRef"),
+		OrderInfo:     values.Get("vnp_OrderInfo"),
+		Amount:        amount / 100,
+		ResponseCode:  values.Get("vnp_ResponseCode"),
+		BankCode:      values.Get("vnp_BankCode"),
+		PayDate:       values.Get("vnp_PayDate"),
+		Succeeded:     values.Get("vnp_ResponseCode") == VnPayRspCodeSuccess,
+	}, nil
 }
 
-type VnPayIPNRequest struct {
-	TmnCode           string `form:"vnp_TmnCode"`
-	Amount            int    `form:"vnp_Amount"`
-	BankCode          string `form:"vnp_BankCode"`
-	BankTranNo        string `form:"vnp_BankTranNo"`
-	CardType          string `form:"vnp_CardType"`
-	PayDate           string `form:"vnp_PayDate"`
-	OrderInfo         string `form:"vnp_OrderInfo"`
-	TransactionNo     string `form:"vnp_TransactionNo"`
-	ResponseCode      string `form:"vnp_ResponseCode"`
-	TransactionStatus string `form:"vnp_TransactionStatus"`
-	TxnRef            string `form:"vnp_TxnRef"`
-	SecureHashType    string `form:"vnp_SecureHashType"`
-	SecureHash        string `form:"vnp_SecureHash"`
+type vnPayQueryResponse struct {
+	ResponseID        string `json:"vnp_ResponseId"`
+	Command           string `json:"vnp_Command"`
+	ResponseCode      string `json:"vnp_ResponseCode"`
+	Message           string `json:"vnp_Message"`
+	TmnCode           string `json:"vnp_TmnCode"`
+	TxnRef            string `json:"vnp_TxnRef"`
+	Amount            string `json:"vnp_Amount"`
+	BankCode          string `json:"vnp_BankCode"`
+	PayDate           string `json:"vnp_PayDate"`
+	TransactionNo     string `json:"vnp_TransactionNo"`
+	TransactionType   string `json:"vnp_TransactionType"`
+	TransactionStatus string `json:"vnp_TransactionStatus"`
+	OrderInfo         string `json:"vnp_OrderInfo"`
+	PromotionCode     string `json:"vnp_PromotionCode"`
+	PromotionAmount   string `json:"vnp_PromotionAmount"`
+	SecureHash        string `json:"vnp_SecureHash"`
+}
+
+// queryDR calls the querydr API. Both the request and the response are signed over their fields
+// joined by '|' in the order given by VNPay.
+func (s *VnPayService) queryDR(txnRef, orderInfo string, transactionDate time.Time) (*vnPayQueryResponse, error) {
+	now := time.Now()
+	reqBody := map[string]string{
+		"vnp_RequestId":       strconv.FormatInt(now.UnixNano(), 10),
+		"vnp_Version":         s.cfg.Version,
+		"vnp_Command":         "querydr",
+		"vnp_TmnCode":         s.cfg.TMNCode,
+		"vnp_TxnRef":          txnRef,
+		"vnp_OrderInfo":       orderInfo,
+		"vnp_TransactionDate": transactionDate.Format(layoutyyyyMMddHHmmss),
+		"vnp_CreateDate":      now.Format(layoutyyyyMMddHHmmss),
+		"vnp_IpAddr":          "::1",
+	}
+	reqBody["vnp_SecureHash"] = s.sign(strings.Join([]string{
+		reqBody["vnp_RequestId"],
+		reqBody["vnp_Version"],
+		reqBody["vnp_Command"],
+		reqBody["vnp_TmnCode"],
+		reqBody["vnp_TxnRef"],
+		reqBody["vnp_TransactionDate"],
+		reqBody["vnp_CreateDate"],
+		reqBody["vnp_IpAddr"],
+		reqBody["vnp_OrderInfo"],
+	}, "|"))
+
+	resp := &vnPayQueryResponse{}
+	if err := postJSON(s.client, s.cfg.ApiURL, reqBody, resp); err != nil {
+		return nil, err
+	}
+
+	expected := s.sign(strings.Join([]string{
+		resp.ResponseID, resp.Command, resp.ResponseCode, resp.Message, resp.TmnCode, resp.TxnRef,
+		resp.Amount, resp.BankCode, resp.PayDate, resp.TransactionNo, resp.TransactionType,
+		resp.TransactionStatus, resp.OrderInfo, resp.PromotionCode, resp.PromotionAmount,
+	}, "|"))
+	if !hmac.Equal([]byte(strings.ToLower(resp.SecureHash)), []byte(expected)) {
+		return nil, ErrInvalidPaymentSignature
+	}
+
+	if resp.ResponseCode != VnPayRspCodeSuccess {
+		return nil, fmt.Errorf("vnpay querydr response code %s: %s", resp.ResponseCode, resp.Message)
+	}
+
+	return resp, nil
+}
+
+// QueryStatus queries the order with querydr
+func (s *VnPayService) QueryStatus(order *PaymentOrder) (*PaymentResult, error) {
+	resp, err := s.queryDR(order.TxnRef, encodeOrderInfo(order.PaymentIDs), order.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.TransactionStatus == vnPayTransactionStatusPending {
+		return nil, errPaymentPending
+	}
+
+	amount, err := strconv.Atoi(resp.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaymentResult{
+		Gateway:       model.PaymentGatewayVNPay,
+		TransactionNo: resp.TransactionNo,
+		TxnRef:        resp.TxnRef,
+		OrderInfo:     resp.OrderInfo,
+		Amount:        amount / 100,
+		ResponseCode:  resp.TransactionStatus,
+		BankCode:      resp.BankCode,
+		PayDate:       resp.PayDate,
+		Succeeded:     resp.TransactionStatus == VnPayRspCodeSuccess,
+	}, nil
+}
+
+// Refund calls the refund API. vnp_TransactionType is 02 for a full refund and 03 for a partial one.
+func (s *VnPayService) Refund(order *RefundOrder) (*RefundResult, error) {
+	transactionType := vnPayTransactionTypePartialRefund
+	if order.isFull() {
+		transactionType = vnPayTransactionTypeFullRefund
+	}
+
+	reqBody := map[string]string{
+		"vnp_RequestId":       order.RefundRef,
+		"vnp_Version":         s.cfg.Version,
+		"vnp_Command":         "refund",
+		"vnp_TmnCode":         s.cfg.TMNCode,
+		"vnp_TransactionType": transactionType,
+		"vnp_TxnRef":          order.Payment.TxnRef,
+		"vnp_Amount":          strconv.Itoa(order.Amount * 100),
+		"vnp_OrderInfo":       order.Reason,
+		"vnp_TransactionNo":   order.Payment.ExternalTransactionID,
+		"vnp_TransactionDate": order.Payment.TxnCreatedAt.Format(layoutyyyyMMddHHmmss),
+		"vnp_CreateBy":        "admin",
+		"vnp_CreateDate":      order.CreatedAt.Format(layoutyyyyMMddHHmmss),
+		"vnp_IpAddr":          "::1",
+	}
+	reqBody["vnp_SecureHash"] = s.sign(strings.Join([]string{
+		reqBody["vnp_RequestId"],
+		reqBody["vnp_Version"],
+		reqBody["vnp_Command"],
+		reqBody["vnp_TmnCode"],
+		reqBody["vnp_TransactionType"],
+		reqBody["vnp_TxnRef"],
+		reqBody["vnp_Amount"],
+		reqBody["vnp_TransactionNo"],
+		reqBody["vnp_TransactionDate"],
+		reqBody["vnp_CreateBy"],
+		reqBody["vnp_CreateDate"],
+		reqBody["vnp_IpAddr"],
+		reqBody["vnp_OrderInfo"],
+	}, "|"))
+
+	resp := vnPayQueryResponse{}
+	if err := postJSON(s.client, s.cfg.ApiURL, reqBody, &resp); err != nil {
+		return nil, err
+	}
+
+	expected := s.sign(strings.Join([]string{
+		resp.ResponseID, resp.Command, resp.ResponseCode, resp.Message, resp.TmnCode, resp.TxnRef,
+		resp.Amount, resp.BankCode, resp.PayDate, resp.TransactionNo, resp.TransactionType,
+		resp.TransactionStatus, resp.OrderInfo,
+	}, "|"))
+	if !hmac.Equal([]byte(strings.ToLower(resp.SecureHash)), []byte(expected)) {
+		return nil, ErrInvalidPaymentSignature
+	}
+
+	status := model.CustomerRefundStatusFailed
+	if resp.ResponseCode == VnPayRspCodeSuccess {
+		status = model.CustomerRefundStatusSucceeded
+	}
+
+	return &RefundResult{
+		ExternalRefundID: resp.TransactionNo,
+		ResponseCode:     resp.ResponseCode,
+		Message:          resp.Message,
+		Status:           status,
+	}, nil
+}
+
+// QueryRefund queries the paid transaction, as VNPay has no query by refund. Once refunded the
+// transaction reports the refund type (02 full, 03 partial) and the refund status, while a
+// transaction still reporting type 01 never got the refund.
+func (s *VnPayService) QueryRefund(order *RefundOrder) (*RefundResult, error) {
+	resp, err := s.queryDR(order.Payment.TxnRef, order.Reason, order.Payment.TxnCreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	status := model.CustomerRefundStatusFailed
+	if resp.TransactionType == vnPayTransactionTypeFullRefund || resp.TransactionType == vnPayTransactionTypePartialRefund {
+		switch resp.TransactionStatus {
+		case VnPayRspCodeSuccess:
+			status = model.CustomerRefundStatusSucceeded
+		case vnPayTransactionStatusRefunding, vnPayTransactionStatusRefundSentToBank:
+			status = model.CustomerRefundStatusPending
+		}
+	}
+
+	return &RefundResult{
+		ExternalRefundID: resp.TransactionNo,
+		ResponseCode:     resp.TransactionStatus,
+		Message:          resp.Message,
+		Status:           status,
+	}, nil
+}
+
+func (s *VnPayService) RespondCallback(c *gin.Context, code PaymentCallbackCode) {
+	switch code {
+	case PaymentCallbackSuccess:
+		responseVnPayIPN(c, VnPayRspCodeSuccess, "success")
+	case PaymentCallbackOrderNotFound:
+		responseVnPayIPN(c, VnPayRspCodeOrderNotFound, "order not found")
+	case PaymentCallbackAlreadyConfirmed:
+		responseVnPayIPN(c, VnPayRspCodeAlreadyConfirmed, "order already confirmed")
+	case PaymentCallbackInvalidAmount:
+		responseVnPayIPN(c, VnPayRspCodeInvalidAmount, "invalid amount")
+	case PaymentCallbackInvalidSignature:
+		responseVnPayIPN(c, VnPayRspCodeInvalidSignature, "invalid signature")
+	default:
+		responseVnPayIPN(c, VnPayRspCodeUnknownError, "unknown error")
+	}
+}
+
+func (s *VnPayService) sign(data string) string {
+	signer := hmac.New(sha512.New, []byte(s.cfg.HashSecret))
+	signer.Write([]byte(data))
+	return hex.EncodeToString(signer.Sum(nil))
+}
+
+const (
+	VnPayRspCodeSuccess          = "00"
+	VnPayRspCodeOrderNotFound    = "01"
+	VnPayRspCodeAlreadyConfirmed = "02"
+	VnPayRspCodeInvalidAmount    = "04"
+	VnPayRspCodeInvalidSignature = "97"
+	VnPayRspCodeUnknownError     = "99"
+
+	vnPayTransactionStatusPending          = "01"
+	vnPayTransactionStatusRefunding        = "05"
+	vnPayTransactionStatusRefundSentToBank = "06"
+
+	vnPayTransactionTypeFullRefund    = "02"
+	vnPayTransactionTypePartialRefund = "03"
+)
+
+func responseVnPayIPN(c *gin.Context, rspCode, message string) {
+	c.JSON(http.StatusOK, gin.H{"RspCode": rspCode, "Message": message})
+}
+
+// postJSON sends a JSON body to a gateway API and decodes its JSON answer into resp
+func postJSON(client *http.Client, url string, body interface{}, resp interface{}) error {
+	bz, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	httpResp, err := client.Post(url, "application/json", bytes.NewReader(bz))
+	if err != nil {
+		fmt.Printf("call payment gateway %s error %v\n", url, err)
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment gateway %s responded %d", url, httpResp.StatusCode)
+	}
+
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
+
+// recordPaymentTransaction stores the result in the ledger. The unique (gateway, transaction_no) of
+// successes and (gateway, txn_ref, response_code) of failures make a retried callback fail with
+// errPaymentAlreadyConfirmed.
+func (s *Server) recordPaymentTransaction(tx *gorm.DB, result *PaymentResult) error {
+	created, err := s.store.PaymentTransactionStore.CreateIfNotExistTx(tx, result.toPaymentTransaction())
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		return errPaymentAlreadyConfirmed
+	}
+
+	return nil
+}
+
+// isPaymentTransactionRecorded reports whether the successful transaction was already recorded. A
+// failed result doesn't carry a transaction number of its own, so it is never looked up here.
+func (s *Server) isPaymentTransactionRecorded(result *PaymentResult) bool {
+	if !result.Succeeded {
+		return false
+	}
+
+	t, err := s.store.PaymentTransactionStore.GetSucceededByTransactionNo(result.Gateway, result.TransactionNo)
+	return err == nil && t != nil
+}
+
+func newPaymentOrder(paymentIDs []int, amount int, txnRef, returnURL string) *PaymentOrder {
+	return &PaymentOrder{
+		PaymentIDs: paymentIDs,
+		Amount:     amount,
+		TxnRef:     txnRef,
+		ReturnURL:  returnURL,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// generateCustomerPaymentURL creates the gateway order of customer payments and remembers it
+// on them, so their status can be queried from the gateway later.
+func (s *Server) generateCustomerPaymentURL(
+	gateway model.PaymentGateway,
+	paymentIDs []int,
+	amount int,
+	returnURL string,
+) (string, error) {
+	paymentService, err := s.PaymentGateways.Get(gateway)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.checkCarsHeld(paymentIDs); err != nil {
+		return "", err
+	}
+
+	order := newPaymentOrder(paymentIDs, amount, time.Now().Format("02150405"), returnURL)
+	url, err := paymentService.GeneratePaymentURL(order)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.store.CustomerPaymentStore.UpdateMulti(paymentIDs, map[string]interface{}{
+		"gateway":        string(paymentService.Gateway()),
+		"txn_ref":        order.TxnRef,
+		"txn_created_at": order.CreatedAt,
+	}); err != nil {
+		return "", err
+	}
+
+	return url, nil
+}
+
+// checkCarsHeld rejects paying for a contract not ordered yet once its hold on the car lapsed, as
+// the car may be reserved by somebody else meanwhile
+func (s *Server) checkCarsHeld(paymentIDs []int) error {
+	for _, paymentID := range paymentIDs {
+		payment, err := s.store.CustomerPaymentStore.GetByID(paymentID)
+		if err != nil {
+			return err
+		}
+
+		contract := payment.CustomerContract
+		if contract == nil || contract.Status != model.CustomerContractStatusWaitingContractPayment {
+			continue
+		}
+
+		held, err := s.store.CarReservationStore.IsHeld(contract.ID, contract.CarID)
+		if err != nil {
+			return err
+		}
+
+		if !held {
+			return errCarHoldLapsed
+		}
+	}
+
+	return nil
 }
 
 func (s *Server) HandleVnPayIPN(c *gin.Context) {
-	req := VnPayIPNRequest{}
-	if err := c.Bind(&req); err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+	s.handlePaymentCallback(c, model.PaymentGatewayVNPay)
+}
+
+func (s *Server) HandleMoMoIPN(c *gin.Context) {
+	s.handlePaymentCallback(c, model.PaymentGatewayMoMo)
+}
+
+func (s *Server) HandleZaloPayCallback(c *gin.Context) {
+	s.handlePaymentCallback(c, model.PaymentGatewayZaloPay)
+}
+
+func (s *Server) handlePaymentCallback(c *gin.Context, gateway model.PaymentGateway) {
+	paymentService, err := s.PaymentGateways.Get(gateway)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
 
-	if req.ResponseCode != "00" {
-		c.JSON(http.StatusOK, gin.H{"RspCode": "00", "Message": "success"})
+	result, err := paymentService.VerifyCallback(c.Request)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPaymentSignature) {
+			paymentService.RespondCallback(c, PaymentCallbackInvalidSignature)
+			return
+		}
+		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
-	if strings.HasPrefix(req.TxnRef, PrefixPartnerPayment) {
-		s.handlePartnerPayments(c, req)
-		return
+	paymentService.RespondCallback(c, s.processPaymentResult(result))
+}
+
+// queryCustomerPaymentStatus asks the gateway about the order of pending payments, in case its
+// callback has not reached us yet. It returns true when the payments are paid after that.
+func (s *Server) queryCustomerPaymentStatus(payments []*model.CustomerPayment) bool {
+	if len(payments) == 0 || payments[0].TxnRef == "" {
+		return false
 	}
 
-	paymentIDs := decodeOrderInfo(req.OrderInfo)
+	paymentService, err := s.PaymentGateways.Get(payments[0].Gateway)
+	if err != nil {
+		return false
+	}
+
+	order := &PaymentOrder{TxnRef: payments[0].TxnRef, CreatedAt: payments[0].TxnCreatedAt}
+	for _, payment := range payments {
+		order.PaymentIDs = append(order.PaymentIDs, payment.ID)
+		order.Amount += payment.Amount
+	}
 
-	var (
-		commCustomerContractID int
-		licensePlate           string
-	)
+	result, err := paymentService.QueryStatus(order)
+	if err != nil {
+		if !errors.Is(err, errPaymentPending) {
+			fmt.Printf("query %s payment status error %v\n", paymentService.Gateway(), err)
+		}
+		return false
+	}
 
+	if !result.Succeeded {
+		return false
+	}
+
+	code := s.processPaymentResult(result)
+	return code == PaymentCallbackSuccess || code == PaymentCallbackAlreadyConfirmed
+}
+
+// processPaymentResult applies a verified gateway result to the payments of its order.
+// It is shared by the callbacks and by status queries, so it must stay idempotent.
+func (s *Server) processPaymentResult(result *PaymentResult) PaymentCallbackCode {
+	if strings.HasPrefix(result.TxnRef, PrefixPartnerPayment) {
+		return s.processPartnerPaymentResult(result)
+	}
+
+	paymentIDs := result.PaymentIDs()
+	payments := make([]*model.CustomerPayment, 0, len(paymentIDs))
+	totalAmount := 0
 	for _, paymentID := range paymentIDs {
-		// Update contract status to Ordered
 		payment, err := s.store.CustomerPaymentStore.GetByID(paymentID)
 		if err != nil {
-			c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-			return
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return PaymentCallbackOrderNotFound
+			}
+			return PaymentCallbackUnknownError
+		}
+
+		payments = append(payments, payment)
+		totalAmount += payment.Amount
+	}
+
+	if s.isPaymentTransactionRecorded(result) {
+		return PaymentCallbackAlreadyConfirmed
+	}
+
+	pendingIDs, canceledIDs := make([]int, 0), make([]int, 0)
+	for _, payment := range payments {
+		switch payment.Status {
+		case model.PaymentStatusPending:
+			pendingIDs = append(pendingIDs, payment.ID)
+		case model.PaymentStatusCanceled:
+			canceledIDs = append(canceledIDs, payment.ID)
+		default:
+			return PaymentCallbackAlreadyConfirmed
+		}
+	}
+
+	if totalAmount != result.Amount {
+		return PaymentCallbackInvalidAmount
+	}
+
+	if !result.Succeeded {
+		if err := s.recordPaymentTransaction(s.store.DB, result); err != nil && !errors.Is(err, errPaymentAlreadyConfirmed) {
+			return PaymentCallbackUnknownError
 		}
+		return PaymentCallbackSuccess
+	}
 
-		commCustomerContractID = payment.CustomerContractID
-		licensePlate = payment.CustomerContract.Car.LicensePlate
+	// the money is taken whatever happened to the contract meanwhile, so the payments are always
+	// committed as paid. Payments canceled meanwhile are refunded, and a contract whose car was
+	// reserved by somebody else after its hold lapsed is canceled with a full refund.
+	conflictedContractIDs := map[int]bool{}
+	if err := s.store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.recordPaymentTransaction(tx, result); err != nil {
+			return err
+		}
 
-		if payment.PaymentType == model.PaymentTypePrePay {
-			// check if this car is still available
-			good, err := s.checkIfContractStillAvailable(commCustomerContractID)
-			fmt.Println("good = ", good)
-			if err != nil || !good {
-				c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error or not available car for contract"})
-				return
+		paid, err := s.store.CustomerPaymentStore.MarkPaidTx(tx, pendingIDs, result.Gateway, result.TransactionNo)
+		if err != nil {
+			return err
+		}
+
+		latePaid, err := s.store.CustomerPaymentStore.MarkCanceledPaidTx(tx, canceledIDs, result.Gateway, result.TransactionNo)
+		if err != nil {
+			return err
+		}
+
+		if int(paid+latePaid) != len(paymentIDs) {
+			return errPaymentAlreadyConfirmed
+		}
+
+		for _, payment := range payments {
+			if err := s.ledger.PostCustomerPaymentTx(tx, payment); err != nil {
+				return err
 			}
 
-			if err := s.store.CustomerContractStore.Update(
-				payment.CustomerContractID,
-				map[string]interface{}{"status": string(model.CustomerContractStatusOrdered)},
-			); err != nil {
-				c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-				return
+			if payment.Status == model.PaymentStatusCanceled {
+				continue
 			}
 
-			partner, err := s.store.AccountStore.GetByID(payment.CustomerContract.Car.PartnerID)
-			if err != nil {
-				c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-				return
+			switch payment.PaymentType {
+			case model.PaymentTypePrePay:
+				// ordering books the car, it fails if the hold lapsed and somebody else reserved it.
+				// The savepoint keeps the payment when it does.
+				if err := tx.Transaction(func(tx *gorm.DB) error {
+					_, err := s.contractStateMachine.TransitTx(tx, &service.CustomerContractTransition{
+						CustomerContractID: payment.CustomerContractID,
+						From:               []model.CustomerContractStatus{model.CustomerContractStatusWaitingContractPayment},
+						To:                 model.CustomerContractStatusOrdered,
+						Actor:              service.SystemContractActor,
+						Reason:             fmt.Sprintf("prepay paid via %s, transaction %s", result.Gateway, result.TransactionNo),
+					})
+					return err
+				}); err != nil {
+					if !errors.Is(err, service.ErrCarReserved) {
+						return err
+					}
+					conflictedContractIDs[payment.CustomerContractID] = true
+				}
+			case model.PaymentTypeReturnCollateralCash:
+				if err := s.store.CustomerContractStore.UpdateTx(tx, payment.CustomerContractID, map[string]interface{}{
+					"is_return_collateral_asset": true,
+				}); err != nil {
+					return err
+				}
 			}
+		}
 
+		return nil
+	}); err != nil {
+		if errors.Is(err, errPaymentAlreadyConfirmed) {
+			return PaymentCallbackAlreadyConfirmed
+		}
+		return PaymentCallbackUnknownError
+	}
+
+	for _, payment := range payments {
+		switch {
+		case payment.Status == model.PaymentStatusCanceled:
+			if _, err := s.refundCustomerPayment(payment.ID, 0, "paid after the payment was canceled", nil); err != nil {
+				fmt.Printf("refund payment %d paid after cancel error %v\n", payment.ID, err)
+			}
+		case !conflictedContractIDs[payment.CustomerContractID]:
+			s.onCustomerPaymentPaid(payment)
+		}
+	}
+
+	for contractID := range conflictedContractIDs {
+		if _, err := s.cancellationEngine.Cancel(&service.CustomerContractTransition{
+			CustomerContractID: contractID,
+			From:               []model.CustomerContractStatus{model.CustomerContractStatusWaitingContractPayment},
+			Actor:              service.SystemContractActor,
+			Reason:             "car was reserved by another contract after the hold lapsed",
+		}); err != nil {
+			fmt.Printf("cancel contract %d of booking conflict error %v\n", contractID, err)
+		}
+	}
+
+	return PaymentCallbackSuccess
+}
+
+// onCustomerPaymentPaid runs the side effects of a payment once it is committed as paid
+func (s *Server) onCustomerPaymentPaid(payment *model.CustomerPayment) {
+	contractID := payment.CustomerContractID
+	licensePlate := payment.CustomerContract.Car.LicensePlate
+
+	switch payment.PaymentType {
+	case model.PaymentTypePrePay:
+		partner, err := s.store.AccountStore.GetByID(payment.CustomerContract.Car.PartnerID)
+		if err == nil {
 			msg := s.notificationPushService.NewRentingContract(
 				payment.CustomerContract.CarID,
-				payment.CustomerContractID,
+				contractID,
 				s.getExpoToken(partner.PhoneNumber),
 				partner.PhoneNumber,
 			)
 			_ = s.notificationPushService.Push(partner.ID, msg)
+		}
 
-			adminIds, err := s.store.AccountStore.GetAllAdminIDs()
-			if err == nil {
-				for _, id := range adminIds {
-					s.adminNotificationQueue <- s.NewCustomerContractNotificationMsg(id, commCustomerContractID, licensePlate)
-				}
-			}
-
-			techIds, err := s.store.AccountStore.GetAllIdsByRole(model.RoleIDTechnician)
-			if err == nil {
-				for _, id := range techIds {
-					s.technicianNotificationQueue <- s.NewAppraisingCarOfCusContract(id, commCustomerContractID)
-				}
-			}
-		} else if payment.PaymentType == model.PaymentTypeCollateralCash {
-			contract, err := s.store.CustomerContractStore.FindByID(payment.CustomerContractID)
-			if err != nil {
-				c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-				return
-			}
-
-			_, err = s.GenerateCustomerContractPaymentQRCode(
-				contract.ID,
-				payment.Amount,
-				model.PaymentTypeReturnCollateralCash,
-				s.feCfg.AdminReturnURL+strconv.Itoa(contract.ID), "",
-			)
-			if err != nil {
-				c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-				return
-			}
-		} else if payment.PaymentType == model.PaymentTypeReturnCollateralCash {
-			contract, err := s.store.CustomerContractStore.FindByID(payment.CustomerContractID)
-			if err != nil {
-				c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-				return
+		adminIds, err := s.store.AccountStore.GetAllAdminIDs()
+		if err == nil {
+			for _, id := range adminIds {
+				s.adminNotificationQueue <- s.NewCustomerContractNotificationMsg(id, contractID, licensePlate)
 			}
+		}
 
-			acct, err := s.store.AccountStore.GetByID(contract.CustomerID)
-			if err != nil {
-				c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-				return
+		techIds, err := s.store.AccountStore.GetAllIdsByRole(model.RoleIDTechnician)
+		if err == nil {
+			for _, id := range techIds {
+				s.technicianNotificationQueue <- s.NewAppraisingCarOfCusContract(id, contractID)
 			}
-
+		}
+	case model.PaymentTypeReturnCollateralCash:
+		acct, err := s.store.AccountStore.GetByID(payment.CustomerContract.CustomerID)
+		if err == nil {
 			_ = s.notificationPushService.Push(acct.ID, s.notificationPushService.NewReturnCollateralAssetMsg(
-				payment.CustomerContractID,
+				contractID,
 				s.getExpoToken(acct.PhoneNumber),
 				acct.PhoneNumber,
 			))
-			if err := s.store.CustomerContractStore.Update(payment.CustomerContractID, map[string]interface{}{
-				"is_return_collateral_asset": true,
-			}); err != nil {
-				c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-				return
-			}
 		}
 	}
 
-	if err := s.store.CustomerPaymentStore.UpdateMulti(
-		paymentIDs,
-		map[string]interface{}{"status": string(model.PaymentStatusPaid)},
-	); err != nil {
-		c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-		return
-	}
-
 	go func() {
 		adminIds, err := s.store.AccountStore.GetAllAdminIDs()
 		if err == nil {
 			for _, id := range adminIds {
-				s.adminNotificationQueue <- s.NewCustomerContractPaymentNotificationMsg(id, commCustomerContractID, licensePlate)
+				s.adminNotificationQueue <- s.NewCustomerContractPaymentNotificationMsg(id, contractID, licensePlate)
 			}
 		}
 	}()
 
-	c.JSON(http.StatusOK, gin.H{"RspCode": "00", "Message": "success"})
+	go func() {
+		if _, err := s.issueCustomerPaymentInvoice(payment.ID); err != nil && !errors.Is(err, service.ErrInvoiceNotIssuable) {
+			fmt.Printf("error when issuing invoice of customer payment %d %v\n", payment.ID, err)
+		}
+	}()
 }
 
-func (s *Server) handlePartnerPayments(c *gin.Context, req VnPayIPNRequest) {
-	paymentIDs := decodeOrderInfo(req.OrderInfo)
-	if err := s.store.PartnerPaymentHistoryStore.UpdateMulti(
-		paymentIDs,
-		map[string]interface{}{"status": string(model.PartnerPaymentHistoryStatusPaid)},
-	); err != nil {
-		c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-		return
-	}
-
+func (s *Server) processPartnerPaymentResult(result *PaymentResult) PaymentCallbackCode {
+	paymentIDs := result.PaymentIDs()
+	payments := make([]*model.PartnerPaymentHistory, 0, len(paymentIDs))
+	totalAmount := 0
 	for _, paymentID := range paymentIDs {
 		payment, err := s.store.PartnerPaymentHistoryStore.GetByID(paymentID)
 		if err != nil {
-			c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-			return
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return PaymentCallbackOrderNotFound
+			}
+			return PaymentCallbackUnknownError
+		}
+
+		payments = append(payments, payment)
+		totalAmount += payment.Amount
+	}
+
+	if s.isPaymentTransactionRecorded(result) {
+		return PaymentCallbackAlreadyConfirmed
+	}
+
+	for _, payment := range payments {
+		if payment.Status != model.PartnerPaymentHistoryStatusPending {
+			return PaymentCallbackAlreadyConfirmed
+		}
+	}
+
+	if totalAmount != result.Amount {
+		return PaymentCallbackInvalidAmount
+	}
+
+	if err := s.store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.recordPaymentTransaction(tx, result); err != nil {
+			return err
+		}
+
+		if !result.Succeeded {
+			return nil
+		}
+
+		affected, err := s.store.PartnerPaymentHistoryStore.MarkPaidTx(tx, paymentIDs)
+		if err != nil {
+			return err
 		}
 
+		if int(affected) != len(paymentIDs) {
+			return errPaymentAlreadyConfirmed
+		}
+
+		for _, payment := range payments {
+			if err := s.ledger.PostPartnerPaymentTx(tx, payment); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		if errors.Is(err, errPaymentAlreadyConfirmed) {
+			return PaymentCallbackAlreadyConfirmed
+		}
+		return PaymentCallbackUnknownError
+	}
+
+	if !result.Succeeded {
+		return PaymentCallbackSuccess
+	}
+
+	for _, payment := range payments {
+		payment.Status = model.PartnerPaymentHistoryStatusPaid
+	}
+	go s.issuePartnerPaymentReceipts(payments)
+
+	for _, payment := range payments {
 		acct, err := s.store.AccountStore.GetByID(payment.PartnerID)
 		if err != nil {
-			c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "internal server error"})
-			return
+			continue
 		}
 
 		msg := s.notificationPushService.NewReceivingPaymentMsg(
@@ -287,7 +839,7 @@ func (s *Server) handlePartnerPayments(c *gin.Context, req VnPayIPNRequest) {
 		_ = s.notificationPushService.Push(acct.ID, msg)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"RspCode": "00", "Message": "success"})
+	return PaymentCallbackSuccess
 }
 
 func (s *Server) HandleVnPayReturnURL(c *gin.Context) {
@@ -313,29 +865,3 @@ func decodeOrderInfo(s string) []int {
 
 	return res
 }
-
-func (s *Server) checkIfContractStillAvailable(contractID int) (bool, error) {
-	contract, err := s.store.CustomerContractStore.FindByID(contractID)
-	if err != nil {
-		return false, err
-	}
-
-	car := contract.Car
-	foundCars, err := s.store.CarStore.FindCars(contract.StartDate, contract.EndDate, map[string]interface{}{
-		"brands":          []string{car.CarModel.Brand},
-		"fuels":           []string{string(car.Fuel)},
-		"motions":         []string{string(car.Motion)},
-		"number_of_seats": []int{car.CarModel.NumberOfSeats},
-	})
-	if err != nil {
-		return false, err
-	}
-
-	for _, fCar := range foundCars {
-		if fCar.ID == car.ID {
-			return true, nil
-		}
-	}
-
-	return false, nil
-}
@@ -1,18 +1,470 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/paysim"
+	"github.com/godev111222333/capstone-backend/src/service"
 )
 
 func TestPaymentHandler_GeneratePaymentURL(t *testing.T) {
 	t.Parallel()
 
 	paymentService := NewVnPayService(TestConfig.VNPay)
-	url, err := paymentService.GeneratePaymentURL([]int{1}, 10_000, strconv.Itoa(rand.Int()%1_000_000), "return_url")
+	url, err := paymentService.GeneratePaymentURL(
+		newPaymentOrder([]int{1}, 10_000, strconv.Itoa(rand.Int()%1_000_000), "return_url"))
 	require.NoError(t, err)
 	require.NotEmpty(t, url)
 }
+
+func TestPaymentHandler_VerifySecureHash(t *testing.T) {
+	t.Parallel()
+
+	paymentService := NewVnPayService(TestConfig.VNPay)
+	paymentURL, err := paymentService.GeneratePaymentURL(
+		newPaymentOrder([]int{1, 2}, 10_000, strconv.Itoa(rand.Int()%1_000_000), "return_url"))
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(paymentURL)
+	require.NoError(t, err)
+	values := parsed.Query()
+	require.True(t, paymentService.VerifySecureHash(values))
+
+	values.Set("vnp_Amount", "1")
+	require.False(t, paymentService.VerifySecureHash(values))
+
+	values.Del("vnp_SecureHash")
+	require.False(t, paymentService.VerifySecureHash(values))
+}
+
+func TestPaymentHandler_VerifyMoMoCallback(t *testing.T) {
+	t.Parallel()
+
+	paymentService := NewMoMoService(&misc.MoMoConfig{PartnerCode: "MOMO", AccessKey: "access", SecretKey: "secret"})
+	ipn := moMoIPNRequest{
+		PartnerCode:  "MOMO",
+		OrderID:      "01020304",
+		RequestID:    "01020304",
+		Amount:       20_000,
+		OrderInfo:    "1.2",
+		OrderType:    "momo_wallet",
+		TransID:      4088878653,
+		ResultCode:   0,
+		Message:      "Successful.",
+		PayType:      "qr",
+		ResponseTime: 1721720663942,
+	}
+	ipn.Signature = paymentService.sign(fmt.Sprintf(
+		"accessKey=%s&amount=%d&extraData=%s&message=%s&orderId=%s&orderInfo=%s&orderType=%s&partnerCode=%s&payType=%s&requestId=%s&responseTime=%d&resultCode=%d&transId=%d",
+		"access", ipn.Amount, ipn.ExtraData, ipn.Message, ipn.OrderID, ipn.OrderInfo, ipn.OrderType,
+		ipn.PartnerCode, ipn.PayType, ipn.RequestID, ipn.ResponseTime, ipn.ResultCode, ipn.TransID,
+	))
+
+	result, err := paymentService.VerifyCallback(newJSONRequest(t, ipn))
+	require.NoError(t, err)
+	require.Equal(t, model.PaymentGatewayMoMo, result.Gateway)
+	require.Equal(t, "4088878653", result.TransactionNo)
+	require.Equal(t, []int{1, 2}, result.PaymentIDs())
+	require.Equal(t, 20_000, result.Amount)
+	require.True(t, result.Succeeded)
+
+	ipn.Amount = 1
+	_, err = paymentService.VerifyCallback(newJSONRequest(t, ipn))
+	require.ErrorIs(t, err, ErrInvalidPaymentSignature)
+}
+
+func TestPaymentHandler_MoMoQueryStatus(t *testing.T) {
+	t.Parallel()
+
+	secretKey := "secret"
+	tamper := false
+	momo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := moMoQueryRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		resp := moMoQueryResponse{
+			PartnerCode:  req.PartnerCode,
+			RequestID:    req.RequestID,
+			OrderID:      req.OrderID,
+			Amount:       20_000,
+			TransID:      4088878653,
+			ResultCode:   0,
+			Message:      "Successful.",
+			PayType:      "qr",
+			ResponseTime: 1721720663942,
+		}
+		resp.Signature = hmacSHA256(secretKey, fmt.Sprintf(
+			"accessKey=%s&amount=%d&extraData=%s&message=%s&orderId=%s&partnerCode=%s&payType=%s&requestId=%s&responseTime=%d&resultCode=%d&transId=%d",
+			"access", resp.Amount, resp.ExtraData, resp.Message, resp.OrderID, resp.PartnerCode,
+			resp.PayType, resp.RequestID, resp.ResponseTime, resp.ResultCode, resp.TransID,
+		))
+		if tamper {
+			resp.Amount = 1
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer momo.Close()
+
+	paymentService := NewMoMoService(&misc.MoMoConfig{Endpoint: momo.URL, PartnerCode: "MOMO", AccessKey: "access", SecretKey: secretKey})
+	order := newPaymentOrder([]int{1, 2}, 20_000, "01020304", "return_url")
+
+	result, err := paymentService.QueryStatus(order)
+	require.NoError(t, err)
+	require.Equal(t, 20_000, result.Amount)
+	require.True(t, result.Succeeded)
+
+	tamper = true
+	_, err = paymentService.QueryStatus(order)
+	require.ErrorIs(t, err, ErrInvalidPaymentSignature)
+}
+
+func TestPaymentHandler_VerifyZaloPayCallback(t *testing.T) {
+	t.Parallel()
+
+	paymentService := NewZaloPayService(&misc.ZaloPayConfig{AppID: 2553, Key1: "key1", Key2: "key2"})
+	order := newPaymentOrder([]int{3}, 15_000, "partner_payment__01020304", "return_url")
+
+	embedData, err := json.Marshal(zaloPayEmbedData{RedirectURL: order.ReturnURL, OrderInfo: "3"})
+	require.NoError(t, err)
+	data, err := json.Marshal(zaloPayCallbackData{
+		AppID:      2553,
+		AppTransID: paymentService.appTransID(order),
+		Amount:     15_000,
+		EmbedData:  string(embedData),
+		ZpTransID:  240723000000123,
+	})
+	require.NoError(t, err)
+
+	callback := zaloPayCallbackRequest{Data: string(data), Mac: hmacSHA256("key2", string(data)), Type: 1}
+	result, err := paymentService.VerifyCallback(newJSONRequest(t, callback))
+	require.NoError(t, err)
+	require.Equal(t, order.TxnRef, result.TxnRef)
+	require.Equal(t, "240723000000123", result.TransactionNo)
+	require.Equal(t, []int{3}, result.PaymentIDs())
+	require.Equal(t, 15_000, result.Amount)
+
+	callback.Mac = hmacSHA256("key1", string(data))
+	_, err = paymentService.VerifyCallback(newJSONRequest(t, callback))
+	require.ErrorIs(t, err, ErrInvalidPaymentSignature)
+}
+
+func TestPaymentGatewayRegistry(t *testing.T) {
+	t.Parallel()
+
+	vnPay := NewVnPayService(&misc.VNPayConfig{})
+	registry := NewPaymentGatewayRegistry(vnPay, NewMoMoService(&misc.MoMoConfig{}))
+
+	paymentService, err := registry.Get("")
+	require.NoError(t, err)
+	require.Equal(t, model.PaymentGatewayVNPay, paymentService.Gateway())
+
+	paymentService, err = registry.Get(model.PaymentGatewayMoMo)
+	require.NoError(t, err)
+	require.Equal(t, model.PaymentGatewayMoMo, paymentService.Gateway())
+
+	_, err = registry.Get(model.PaymentGatewayZaloPay)
+	require.ErrorIs(t, err, ErrUnsupportedPaymentGateway)
+}
+
+func TestPaymentHandler_PrepayWithPaySim(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockNotificationService := service.NewMockINotificationPushService(ctrl)
+	mockNotificationService.EXPECT().Push(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+	mockNotificationService.EXPECT().NewPartnerReceiveNewRentingRequest(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+	mockNotificationService.EXPECT().NewRentingContract(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+	previousNotificationService, previousPdfService := TestServer.notificationPushService, TestServer.pdfService
+	TestServer.notificationPushService, TestServer.pdfService = mockNotificationService, &MockPDFService{}
+	defer func() {
+		TestServer.notificationPushService, TestServer.pdfService = previousNotificationService, previousPdfService
+	}()
+
+	require.NoError(t, TestDb.CustomerContractRuleStore.Create(&model.CustomerContractRule{
+		InsurancePercent: 10, PrepayPercent: 30, CollateralCashAmount: 20_000_000,
+		CancellableStatuses:     model.JoinCustomerContractStatuses(model.DefaultCancellableStatuses),
+		CancellationRefundTiers: model.DefaultCancellationRefundTiers(),
+	}))
+	carModel := &model.CarModel{Brand: "PaySim", Model: "S1", NumberOfSeats: 4}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+	partner := &model.Account{RoleID: model.RoleIDPartner, PhoneNumber: "0988100000", Status: model.AccountStatusActive}
+	require.NoError(t, TestDb.AccountStore.Create(partner))
+	customer, loginResp := seedAccountAndLogin("0988100001", "password", model.RoleIDCustomer)
+	require.NoError(t, TestDb.AccountStore.Update(customer.ID, map[string]interface{}{
+		"bank_name": "VCB", "bank_number": "0123456789", "bank_owner": "PAYSIM",
+	}))
+	require.NoError(t, TestDb.DrivingLicenseImageStore.Create([]*model.DrivingLicenseImage{
+		{AccountID: customer.ID, URL: "front", Status: model.DrivingLicenseImageStatusActive},
+		{AccountID: customer.ID, URL: "back", Status: model.DrivingLicenseImageStatusActive},
+	}))
+
+	call := func(route RouteInfo, body interface{}) *httptest.ResponseRecorder {
+		bz, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(route.Method, route.Path, bytes.NewReader(bz))
+		require.NoError(t, err)
+		req.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+loginResp.AccessToken)
+		recorder := httptest.NewRecorder()
+		TestServer.route.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// rentAndAgree rents a new car from the nth week on and returns the contract and its prepay url
+	rentAndAgree := func(week int) (*model.CustomerContract, string) {
+		car := &model.Car{
+			PartnerID:             partner.ID,
+			CarModelID:            carModel.ID,
+			LicensePlate:          fmt.Sprintf("PAYSIM-%d", week),
+			ParkingLot:            model.ParkingLotGarage,
+			Status:                model.CarStatusActive,
+			Fuel:                  model.FuelGas,
+			Motion:                model.MotionAutomaticTransmission,
+			Price:                 500_000,
+			PartnerContractRuleID: 1,
+			EndDate:               time.Now().AddDate(1, 0, 0),
+		}
+		require.NoError(t, TestDb.CarStore.Create(car))
+
+		startDate := time.Now().AddDate(0, 0, 7*week)
+		recorder := call(TestServer.AllRoutes()[RouteCustomerRentCar], customerRentCarRequest{
+			CarID:          car.ID,
+			StartDate:      startDate,
+			EndDate:        startDate.AddDate(0, 0, 2),
+			CollateralType: model.CollateralTypeMotorbike,
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		contract := &model.CustomerContract{}
+		require.NoError(t, unmarshalFromCommResponse(recorder.Body.Bytes(), contract))
+		require.Equal(t, model.CustomerContractStatusWaitingContractAgreement, contract.Status)
+
+		recorder = call(TestServer.AllRoutes()[RouteCustomerAgreeContract], customerAgreeContractRequest{
+			CustomerContractID: contract.ID,
+			ReturnURL:          "http://localhost/return_url",
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		resp := struct {
+			PaymentURL string `json:"payment_url"`
+		}{}
+		require.NoError(t, unmarshalFromCommResponse(recorder.Body.Bytes(), &resp))
+		return contract, resp.PaymentURL
+	}
+
+	prepayOf := func(contractID int) *model.CustomerPayment {
+		payment, err := TestDb.CustomerPaymentStore.GetLastByPaymentType(contractID, model.PaymentTypePrePay)
+		require.NoError(t, err)
+		return payment
+	}
+
+	// a refund is posted to the ledger when it moves to succeeded, whatever path settled it
+	requireRefundPosted := func(refund *model.CustomerRefund) {
+		entry, err := TestDb.LedgerStore.GetEntryByReference(fmt.Sprintf("customer_refund:%d", refund.ID))
+		require.NoError(t, err)
+		cash := 0
+		for _, line := range entry.Lines {
+			if line.AccountCode == model.LedgerAccountCash {
+				cash += line.Credit
+			}
+		}
+		require.Equal(t, refund.Amount, cash)
+	}
+
+	t.Run("success moves the contract to ordered", func(t *testing.T) {
+		contract, paymentURL := rentAndAgree(1)
+
+		rsp, err := TestPaySim.Pay(paymentURL, paysim.OutcomeSuccess)
+		require.NoError(t, err)
+		require.Equal(t, VnPayRspCodeSuccess, rsp.RspCode)
+
+		contract, err = TestDb.CustomerContractStore.FindByID(contract.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CustomerContractStatusOrdered, contract.Status)
+		payment := prepayOf(contract.ID)
+		require.Equal(t, model.PaymentStatusPaid, payment.Status)
+		require.Equal(t, model.PaymentGatewayVNPay, payment.Gateway)
+		require.NotEmpty(t, payment.ExternalTransactionID)
+
+		// paying the same order again is acknowledged without changing anything
+		rsp, err = TestPaySim.Pay(paymentURL, paysim.OutcomeSuccess)
+		require.NoError(t, err)
+		require.Equal(t, VnPayRspCodeAlreadyConfirmed, rsp.RspCode)
+	})
+
+	t.Run("failure keeps the payment pending", func(t *testing.T) {
+		contract, paymentURL := rentAndAgree(2)
+
+		rsp, err := TestPaySim.Pay(paymentURL, paysim.OutcomeFailure)
+		require.NoError(t, err)
+		require.Equal(t, VnPayRspCodeSuccess, rsp.RspCode)
+
+		contract, err = TestDb.CustomerContractStore.FindByID(contract.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CustomerContractStatusWaitingContractPayment, contract.Status)
+		require.Equal(t, model.PaymentStatusPending, prepayOf(contract.ID).Status)
+	})
+
+	t.Run("failures of different orders share the transaction number 0", func(t *testing.T) {
+		first, firstPaymentURL := rentAndAgree(9)
+		second, secondPaymentURL := rentAndAgree(10)
+
+		for _, paymentURL := range []string{firstPaymentURL, secondPaymentURL} {
+			rsp, err := TestPaySim.Pay(paymentURL, paysim.OutcomeFailure)
+			require.NoError(t, err)
+			require.Equal(t, VnPayRspCodeSuccess, rsp.RspCode)
+		}
+		require.Equal(t, model.PaymentStatusPending, prepayOf(first.ID).Status)
+		require.Equal(t, model.PaymentStatusPending, prepayOf(second.ID).Status)
+
+		// the failures don't block a later success of the same order
+		rsp, err := TestPaySim.Pay(secondPaymentURL, paysim.OutcomeSuccess)
+		require.NoError(t, err)
+		require.Equal(t, VnPayRspCodeSuccess, rsp.RspCode)
+		require.Equal(t, model.PaymentStatusPaid, prepayOf(second.ID).Status)
+	})
+
+	t.Run("timeout sends no ipn", func(t *testing.T) {
+		contract, paymentURL := rentAndAgree(3)
+
+		rsp, err := TestPaySim.Pay(paymentURL, paysim.OutcomeTimeout)
+		require.NoError(t, err)
+		require.Nil(t, rsp)
+		require.Equal(t, model.PaymentStatusPending, prepayOf(contract.ID).Status)
+	})
+
+	t.Run("customer cancel refunds the prepay through the gateway", func(t *testing.T) {
+		contract, paymentURL := rentAndAgree(4)
+		_, err := TestPaySim.Pay(paymentURL, paysim.OutcomeSuccess)
+		require.NoError(t, err)
+
+		recorder := call(TestServer.AllRoutes()[RouteCustomerCancelContract], customerCancelContractRequest{
+			CustomerContractID: contract.ID,
+			Reason:             "change of plan",
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		cancellation := &service.CustomerContractCancellation{}
+		require.NoError(t, unmarshalFromCommResponse(recorder.Body.Bytes(), cancellation))
+		prepay := prepayOf(contract.ID)
+		require.Equal(t, 100.0, cancellation.RefundPercent)
+		require.Equal(t, prepay.Amount, cancellation.RefundAmount)
+
+		refundPayment, err := TestDb.CustomerPaymentStore.GetLastByPaymentType(contract.ID, model.PaymentTypeReturnPrepay)
+		require.NoError(t, err)
+		require.Equal(t, model.PaymentStatusPaid, refundPayment.Status)
+		refunds, err := TestDb.CustomerRefundStore.GetByCustomerPaymentID(prepay.ID)
+		require.NoError(t, err)
+		require.Len(t, refunds, 1)
+		require.Equal(t, model.CustomerRefundStatusSucceeded, refunds[0].Status)
+		require.Equal(t, prepay.Amount, refunds[0].Amount)
+		requireRefundPosted(refunds[0])
+	})
+
+	t.Run("customer cancel before paying cancels the pending prepay", func(t *testing.T) {
+		contract, _ := rentAndAgree(5)
+
+		recorder := call(TestServer.AllRoutes()[RouteCustomerCancelContract], customerCancelContractRequest{
+			CustomerContractID: contract.ID,
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		require.Equal(t, model.PaymentStatusCanceled, prepayOf(contract.ID).Status)
+
+		recorder = call(TestServer.AllRoutes()[RouteCustomerCancelContract], customerCancelContractRequest{
+			CustomerContractID: contract.ID,
+		})
+		require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	})
+
+	t.Run("renting held dates is rejected until the hold is released", func(t *testing.T) {
+		contract, _ := rentAndAgree(6)
+		rentAgain := func() *httptest.ResponseRecorder {
+			return call(TestServer.AllRoutes()[RouteCustomerRentCar], customerRentCarRequest{
+				CarID:          contract.CarID,
+				StartDate:      contract.StartDate.Add(time.Hour),
+				EndDate:        contract.EndDate.Add(time.Hour),
+				CollateralType: model.CollateralTypeMotorbike,
+			})
+		}
+
+		recorder := rentAgain()
+		require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		resp := CommResponse{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		require.Equal(t, ErrCodeCarReserved, resp.ErrorCode)
+
+		recorder = call(TestServer.AllRoutes()[RouteCustomerCancelContract], customerCancelContractRequest{
+			CustomerContractID: contract.ID,
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		require.Equal(t, http.StatusOK, rentAgain().Code)
+	})
+
+	refundsOf := func(payment *model.CustomerPayment) []*model.CustomerRefund {
+		refunds, err := TestDb.CustomerRefundStore.GetByCustomerPaymentID(payment.ID)
+		require.NoError(t, err)
+		return refunds
+	}
+
+	t.Run("paying after the lapsed hold was taken cancels and refunds the contract", func(t *testing.T) {
+		contract, paymentURL := rentAndAgree(7)
+		require.NoError(t, TestDb.DB.Model(&model.CarReservation{}).
+			Where("customer_contract_id = ?", contract.ID).
+			Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		recorder := call(TestServer.AllRoutes()[RouteCustomerRentCar], customerRentCarRequest{
+			CarID:          contract.CarID,
+			StartDate:      contract.StartDate,
+			EndDate:        contract.EndDate,
+			CollateralType: model.CollateralTypeMotorbike,
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		rsp, err := TestPaySim.Pay(paymentURL, paysim.OutcomeSuccess)
+		require.NoError(t, err)
+		require.Equal(t, VnPayRspCodeSuccess, rsp.RspCode)
+
+		contract, err = TestDb.CustomerContractStore.FindByID(contract.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CustomerContractStatusCancel, contract.Status)
+		prepay := prepayOf(contract.ID)
+		require.Equal(t, model.PaymentStatusPaid, prepay.Status)
+		refunds := refundsOf(prepay)
+		require.Len(t, refunds, 1)
+		require.Equal(t, model.CustomerRefundStatusSucceeded, refunds[0].Status)
+		require.Equal(t, prepay.Amount, refunds[0].Amount)
+	})
+
+	t.Run("paying a canceled prepay refunds it", func(t *testing.T) {
+		contract, paymentURL := rentAndAgree(8)
+		recorder := call(TestServer.AllRoutes()[RouteCustomerCancelContract], customerCancelContractRequest{
+			CustomerContractID: contract.ID,
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		rsp, err := TestPaySim.Pay(paymentURL, paysim.OutcomeSuccess)
+		require.NoError(t, err)
+		require.Equal(t, VnPayRspCodeSuccess, rsp.RspCode)
+
+		prepay := prepayOf(contract.ID)
+		require.Equal(t, model.PaymentStatusPaid, prepay.Status)
+		refunds := refundsOf(prepay)
+		require.Len(t, refunds, 1)
+		require.Equal(t, model.CustomerRefundStatusSucceeded, refunds[0].Status)
+		requireRefundPosted(refunds[0])
+	})
+}
+
+func newJSONRequest(t *testing.T, body interface{}) *http.Request {
+	bz, err := json.Marshal(body)
+	require.NoError(t, err)
+	return httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(bz))
+}
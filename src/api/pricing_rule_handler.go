@@ -0,0 +1,243 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/token"
+)
+
+type createPricingRuleRequest struct {
+	CarID           *int                  `json:"car_id"`
+	CarModelID      *int                  `json:"car_model_id"`
+	Type            model.PricingRuleType `json:"type" binding:"required"`
+	Name            string                `json:"name"`
+	PricePercent    float64               `json:"price_percent"`
+	DiscountPercent float64               `json:"discount_percent"`
+	MinDays         int                   `json:"min_days"`
+	StartDate       *time.Time            `json:"start_date"`
+	EndDate         *time.Time            `json:"end_date"`
+}
+
+func (r *createPricingRuleRequest) validate() error {
+	if (r.CarID == nil) == (r.CarModelID == nil) {
+		return errors.New("exactly one of car_id and car_model_id is required")
+	}
+
+	switch r.Type {
+	case model.PricingRuleTypeWeekday, model.PricingRuleTypeWeekend, model.PricingRuleTypeHoliday:
+	case model.PricingRuleTypeSeasonal:
+		if r.StartDate == nil || r.EndDate == nil || r.EndDate.Before(*r.StartDate) {
+			return errors.New("seasonal rule requires start_date before end_date")
+		}
+	case model.PricingRuleTypeLongStay:
+		if r.MinDays <= 0 || r.DiscountPercent <= 0 || r.DiscountPercent >= 100 {
+			return errors.New("long stay rule requires min_days and discount_percent between 0 and 100")
+		}
+		return nil
+	default:
+		return errors.New("invalid pricing rule type")
+	}
+
+	if r.PricePercent <= 0 {
+		return errors.New("price_percent must be positive")
+	}
+
+	return nil
+}
+
+// authorizePricingRuleCar checks that a partner only manages rules of their own cars. Admins
+// manage rules of every car and car model.
+func (s *Server) authorizePricingRuleCar(c *gin.Context, carID, carModelID *int) bool {
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.Role == model.RoleNameAdmin {
+		return true
+	}
+
+	if carModelID != nil || carID == nil {
+		responseCustomErr(c, ErrCodeInvalidOwnership, errors.New("partners can only manage pricing rules of their cars"))
+		return false
+	}
+
+	acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+	if err != nil {
+		responseGormErr(c, err)
+		return false
+	}
+
+	car, err := s.store.CarStore.GetByID(*carID)
+	if err != nil {
+		responseGormErr(c, err)
+		return false
+	}
+
+	if car.PartnerID != acct.ID {
+		responseCustomErr(c, ErrCodeInvalidOwnership, nil)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) HandleCreatePricingRule(c *gin.Context) {
+	req := createPricingRuleRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreatePricingRuleRequest, err)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreatePricingRuleRequest, err)
+		return
+	}
+
+	if !s.authorizePricingRuleCar(c, req.CarID, req.CarModelID) {
+		return
+	}
+
+	rule := &model.PricingRule{
+		CarID:           req.CarID,
+		CarModelID:      req.CarModelID,
+		Type:            req.Type,
+		Name:            req.Name,
+		PricePercent:    req.PricePercent,
+		DiscountPercent: req.DiscountPercent,
+		MinDays:         req.MinDays,
+		StartDate:       req.StartDate,
+		EndDate:         req.EndDate,
+	}
+	if rule.Type == model.PricingRuleTypeLongStay {
+		rule.PricePercent = 100
+	}
+
+	if err := s.store.PricingRuleStore.Create(rule); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, rule)
+}
+
+type deletePricingRuleRequest struct {
+	ID int `form:"id" binding:"required"`
+}
+
+func (s *Server) HandleDeletePricingRule(c *gin.Context) {
+	req := deletePricingRuleRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidDeletePricingRuleRequest, err)
+		return
+	}
+
+	rule, err := s.store.PricingRuleStore.GetByID(req.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if !s.authorizePricingRuleCar(c, rule.CarID, rule.CarModelID) {
+		return
+	}
+
+	if err := s.store.PricingRuleStore.Delete(rule.ID); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, gin.H{"status": "delete pricing rule successfully"})
+}
+
+type getPricingRulesRequest struct {
+	CarID int `form:"car_id" binding:"required"`
+}
+
+// HandleGetPricingRules returns the rules that apply to a car, its own and its car model's
+func (s *Server) HandleGetPricingRules(c *gin.Context) {
+	req := getPricingRulesRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetPricingRulesRequest, err)
+		return
+	}
+
+	car, err := s.store.CarStore.GetByID(req.CarID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	rules, err := s.store.PricingRuleStore.GetByCarOrCarModel(car.ID, car.CarModelID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, rules)
+}
+
+type adminCreateHolidayRequest struct {
+	Date time.Time `json:"date" binding:"required"`
+	Name string    `json:"name" binding:"required"`
+}
+
+func (s *Server) HandleAdminCreateHoliday(c *gin.Context) {
+	req := adminCreateHolidayRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidCreateHolidayRequest, err)
+		return
+	}
+
+	date := req.Date.In(rentalLocation)
+	holiday := &model.Holiday{
+		Date: time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+		Name: req.Name,
+	}
+	if err := s.store.HolidayStore.Create(holiday); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, holiday)
+}
+
+type adminDeleteHolidayRequest struct {
+	ID int `form:"id" binding:"required"`
+}
+
+func (s *Server) HandleAdminDeleteHoliday(c *gin.Context) {
+	req := adminDeleteHolidayRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidDeleteHolidayRequest, err)
+		return
+	}
+
+	if err := s.store.HolidayStore.Delete(req.ID); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, gin.H{"status": "delete holiday successfully"})
+}
+
+type getHolidaysRequest struct {
+	From time.Time `form:"from" binding:"required"`
+	To   time.Time `form:"to" binding:"required"`
+}
+
+func (s *Server) HandleGetHolidays(c *gin.Context) {
+	req := getHolidaysRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetHolidaysRequest, err)
+		return
+	}
+
+	holidays, err := s.store.HolidayStore.GetInRange(req.From.In(rentalLocation), req.To.In(rentalLocation))
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, holidays)
+}
@@ -0,0 +1,428 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+)
+
+const PrefixRefund = "refund"
+
+// DefaultReconcileRefundInterval is how often pending refunds are queried at their gateway.
+// refundReconcileDelay leaves a refund alone for a while after it was sent or last queried, so the
+// reconciler never races the request still waiting for the gateway.
+const (
+	DefaultReconcileRefundInterval = 10 * time.Minute
+	refundReconcileDelay           = 5 * time.Minute
+)
+
+var (
+	errPaymentNotRefundable   = errors.New("payment is not paid through a gateway, it can not be refunded")
+	errRefundExceedsPayment   = errors.New("refund amount exceeds the refundable amount of the payment")
+	errReturnPaymentRefunding = errors.New("return payment already has a refund that is not failed")
+	errRefundNotPending       = errors.New("refund is not pending")
+	errRefundNotFailed        = errors.New("only a failed refund can be retried")
+)
+
+func refundOrder(refund *model.CustomerRefund, payment *model.CustomerPayment) *RefundOrder {
+	return &RefundOrder{
+		RefundRef: fmt.Sprintf("%s__%d", PrefixRefund, refund.ID),
+		Payment:   payment,
+		Amount:    refund.Amount,
+		Reason:    refund.Reason,
+		CreatedAt: refund.CreatedAt,
+	}
+}
+
+// refundCustomerPayment refunds amount of a paid payment through the gateway it was paid with.
+// Amount 0 refunds everything not refunded yet. returnPaymentID is the return payment the refund
+// pays out, if any. The refund row is committed as pending before the gateway is called, so
+// concurrent refunds can never exceed the payment.
+func (s *Server) refundCustomerPayment(paymentID, amount int, reason string, returnPaymentID *int) (*model.CustomerRefund, error) {
+	var payment *model.CustomerPayment
+	refund := &model.CustomerRefund{}
+	if err := s.store.DB.Transaction(func(tx *gorm.DB) error {
+		p, err := s.store.CustomerPaymentStore.FindByIDForUpdate(tx, paymentID)
+		if err != nil {
+			return err
+		}
+
+		if p.Status != model.PaymentStatusPaid || p.ExternalTransactionID == "" {
+			return errPaymentNotRefundable
+		}
+
+		if returnPaymentID != nil {
+			_, err := s.store.CustomerRefundStore.GetActiveByReturnPaymentIDTx(tx, *returnPaymentID)
+			if err == nil {
+				return errReturnPaymentRefunding
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		refunded, err := s.store.CustomerRefundStore.GetRefundedAmountTx(tx, p.ID)
+		if err != nil {
+			return err
+		}
+
+		remaining := p.Amount - refunded
+		if amount == 0 {
+			amount = remaining
+		}
+
+		if amount <= 0 || amount > remaining {
+			return errRefundExceedsPayment
+		}
+
+		payment = p
+		refund = &model.CustomerRefund{
+			CustomerPaymentID: p.ID,
+			ReturnPaymentID:   returnPaymentID,
+			Gateway:           p.Gateway,
+			Amount:            amount,
+			Reason:            reason,
+			Status:            model.CustomerRefundStatusPending,
+		}
+		return s.store.CustomerRefundStore.CreateTx(tx, refund)
+	}); err != nil {
+		return nil, err
+	}
+
+	paymentService, err := s.PaymentGateways.Get(payment.Gateway)
+	if err != nil {
+		_ = s.store.CustomerRefundStore.Update(refund.ID, map[string]interface{}{
+			"status":  string(model.CustomerRefundStatusFailed),
+			"message": err.Error(),
+		})
+		return nil, err
+	}
+
+	result, err := paymentService.Refund(refundOrder(refund, payment))
+	if err != nil {
+		// the gateway may have refunded anyway, so keep it pending for the reconciler rather than
+		// allow refunding twice
+		_ = s.store.CustomerRefundStore.Update(refund.ID, map[string]interface{}{"message": err.Error()})
+		return nil, err
+	}
+
+	if err := s.settleRefund(refund, payment, result); err != nil {
+		return nil, err
+	}
+
+	return s.store.CustomerRefundStore.GetByID(refund.ID)
+}
+
+// settleRefund records what the gateway answered about a pending refund. A refund moving to
+// succeeded is posted to the ledger and pays out its return payment in the same transaction.
+// It is a no-op when the refund was settled meanwhile.
+func (s *Server) settleRefund(refund *model.CustomerRefund, payment *model.CustomerPayment, result *RefundResult) error {
+	return s.store.DB.Transaction(func(tx *gorm.DB) error {
+		updated, err := s.store.CustomerRefundStore.UpdateWhenPendingTx(tx, refund.ID, map[string]interface{}{
+			"status":             string(result.Status),
+			"external_refund_id": result.ExternalRefundID,
+			"response_code":      result.ResponseCode,
+			"message":            result.Message,
+		})
+		if err != nil {
+			return err
+		}
+
+		if updated == 0 || result.Status != model.CustomerRefundStatusSucceeded {
+			return nil
+		}
+
+		refund.Status = result.Status
+		refund.ExternalRefundID = result.ExternalRefundID
+		if err := s.ledger.PostCustomerRefundTx(tx, refund, payment); err != nil {
+			return err
+		}
+
+		if refund.ReturnPaymentID == nil {
+			return nil
+		}
+
+		return s.markReturnPaymentPaidTx(tx, *refund.ReturnPaymentID, refund)
+	})
+}
+
+func (s *Server) markReturnPaymentPaidTx(tx *gorm.DB, returnPaymentID int, refund *model.CustomerRefund) error {
+	returnPayment, err := s.store.CustomerPaymentStore.FindByIDForUpdate(tx, returnPaymentID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.store.CustomerPaymentStore.MarkPaidTx(
+		tx, []int{returnPayment.ID}, refund.Gateway, refund.ExternalRefundID,
+	); err != nil {
+		return err
+	}
+
+	if returnPayment.PaymentType == model.PaymentTypeReturnCollateralCash {
+		return s.store.CustomerContractStore.UpdateTx(tx, returnPayment.CustomerContractID, map[string]interface{}{
+			"is_return_collateral_asset": true,
+		})
+	}
+
+	return nil
+}
+
+// reconcileRefund asks the gateway of a pending refund what became of it
+func (s *Server) reconcileRefund(refund *model.CustomerRefund, payment *model.CustomerPayment) error {
+	paymentService, err := s.PaymentGateways.Get(refund.Gateway)
+	if err != nil {
+		return err
+	}
+
+	result, err := paymentService.QueryRefund(refundOrder(refund, payment))
+	if err != nil {
+		_ = s.store.CustomerRefundStore.Update(refund.ID, map[string]interface{}{"message": err.Error()})
+		return err
+	}
+
+	return s.settleRefund(refund, payment, result)
+}
+
+// RunRefundReconciler settles the refunds left pending by a gateway error or a refund the gateway
+// was still processing, moving them to succeeded or failed
+func (s *Server) RunRefundReconciler(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReconcileRefundInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		s.reconcilePendingRefunds(time.Now().Add(-refundReconcileDelay))
+	}
+}
+
+func (s *Server) reconcilePendingRefunds(before time.Time) {
+	refunds, err := s.store.CustomerRefundStore.GetPendingUpdatedBefore(before)
+	if err != nil {
+		return
+	}
+
+	for _, refund := range refunds {
+		if err := s.reconcileRefund(refund, refund.CustomerPayment); err != nil {
+			fmt.Printf("reconcile refund %d error %v\n", refund.ID, err)
+		}
+	}
+}
+
+// refundCanceledContract pays out the refund payments the cancellation engine created for a
+// canceled contract. A refund payment becomes paid once the gateway confirms its refund.
+func (s *Server) refundCanceledContract(contract *model.CustomerContract, t *service.CustomerContractTransition) {
+	payments, err := s.store.CustomerPaymentStore.GetByCustomerContractID(contract.ID, model.PaymentStatusPending, 0, 0)
+	if err != nil {
+		return
+	}
+
+	for _, payment := range payments {
+		if err := s.payOutRefundPayment(payment); err != nil {
+			fmt.Printf("refund payment %d of canceled contract %d error %v\n", payment.ID, contract.ID, err)
+		}
+	}
+}
+
+// refundSourcePaymentTypes maps a refund payment to the type of the payment it gives money back from
+var refundSourcePaymentTypes = map[model.PaymentType]model.PaymentType{
+	model.PaymentTypeReturnPrepay:         model.PaymentTypePrePay,
+	model.PaymentTypeReturnCollateralCash: model.PaymentTypeCollateralCash,
+	model.PaymentTypeReturnExtension:      model.PaymentTypeExtension,
+	model.PaymentTypeReturnRemainingPay:   model.PaymentTypeRemainingPay,
+}
+
+// payOutRefundPayment refunds a return payment from the payment it gives money back from. The
+// return payment becomes paid once the refund succeeds, which the reconciler may only learn later.
+func (s *Server) payOutRefundPayment(payment *model.CustomerPayment) error {
+	sourceType, ok := refundSourcePaymentTypes[payment.PaymentType]
+	if !ok {
+		return nil
+	}
+
+	source, err := s.store.CustomerPaymentStore.GetLastPaidByPaymentType(payment.CustomerContractID, sourceType)
+	if err != nil {
+		return err
+	}
+
+	refund, err := s.refundCustomerPayment(source.ID, payment.Amount, payment.Note, &payment.ID)
+	if err != nil {
+		if errors.Is(err, errReturnPaymentRefunding) {
+			return nil
+		}
+		return err
+	}
+
+	if refund.Status == model.CustomerRefundStatusFailed {
+		return fmt.Errorf("refund %d failed: %s", refund.ID, refund.Message)
+	}
+
+	return nil
+}
+
+// refundCollateralCash returns the cash collateral of a contract, less the charges deducted from
+// it. It is a no-op when the collateral is not cash, was already refunded or was used up by charges.
+func (s *Server) refundCollateralCash(contract *model.CustomerContract) error {
+	if contract.CollateralType != model.CollateralTypeCash {
+		return nil
+	}
+
+	payment, err := s.store.CustomerPaymentStore.GetLastByPaymentType(contract.ID, model.PaymentTypeCollateralCash)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if payment.Status != model.PaymentStatusPaid {
+		return nil
+	}
+
+	amount, err := s.contractStateMachine.CollateralCashLeftTx(s.store.DB, contract)
+	if err != nil {
+		return err
+	}
+
+	if amount <= 0 {
+		return nil
+	}
+
+	if _, err := s.refundCustomerPayment(payment.ID, amount, "return collateral cash", nil); err != nil &&
+		!errors.Is(err, errRefundExceedsPayment) {
+		return err
+	}
+
+	return nil
+}
+
+type adminRefundCustomerPaymentRequest struct {
+	CustomerPaymentID int    `json:"customer_payment_id" binding:"required"`
+	Amount            int    `json:"amount"`
+	Reason            string `json:"reason" binding:"required"`
+}
+
+func (s *Server) HandleAdminRefundCustomerPayment(c *gin.Context) {
+	req := adminRefundCustomerPaymentRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidRefundCustomerPaymentRequest, err)
+		return
+	}
+
+	if req.Amount < 0 {
+		responseCustomErr(c, ErrCodeInvalidRefundCustomerPaymentRequest, errors.New("amount must not be negative"))
+		return
+	}
+
+	refund, err := s.refundCustomerPayment(req.CustomerPaymentID, req.Amount, req.Reason, nil)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseGormErr(c, err)
+			return
+		}
+		responseCustomErr(c, ErrCodeRefundCustomerPayment, err)
+		return
+	}
+
+	responseSuccess(c, refund)
+}
+
+type adminGetCustomerRefundsRequest struct {
+	CustomerPaymentID int `form:"customer_payment_id" binding:"required"`
+}
+
+func (s *Server) HandleAdminGetCustomerRefunds(c *gin.Context) {
+	req := adminGetCustomerRefundsRequest{}
+	if err := c.Bind(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidGetCustomerRefundsRequest, err)
+		return
+	}
+
+	refunds, err := s.store.CustomerRefundStore.GetByCustomerPaymentID(req.CustomerPaymentID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, refunds)
+}
+
+type adminResolveCustomerRefundRequest struct {
+	CustomerRefundID int    `json:"customer_refund_id" binding:"required"`
+	Action           string `json:"action" binding:"required,oneof=query retry succeeded failed"`
+	ExternalRefundID string `json:"external_refund_id"`
+	Message          string `json:"message"`
+}
+
+// HandleAdminResolveCustomerRefund resolves a stuck refund. query asks its gateway again now,
+// succeeded and failed record the outcome an admin checked with the gateway for a pending refund,
+// and retry sends a failed refund again as a new refund.
+func (s *Server) HandleAdminResolveCustomerRefund(c *gin.Context) {
+	req := adminResolveCustomerRefundRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidResolveCustomerRefundRequest, err)
+		return
+	}
+
+	refund, err := s.store.CustomerRefundStore.GetByID(req.CustomerRefundID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	payment, err := s.store.CustomerPaymentStore.GetByID(refund.CustomerPaymentID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if req.Action == "retry" {
+		if refund.Status != model.CustomerRefundStatusFailed {
+			responseCustomErr(c, ErrCodeResolveCustomerRefund, errRefundNotFailed)
+			return
+		}
+
+		retried, err := s.refundCustomerPayment(payment.ID, refund.Amount, refund.Reason, refund.ReturnPaymentID)
+		if err != nil {
+			responseCustomErr(c, ErrCodeResolveCustomerRefund, err)
+			return
+		}
+
+		responseSuccess(c, retried)
+		return
+	}
+
+	if refund.Status != model.CustomerRefundStatusPending {
+		responseCustomErr(c, ErrCodeResolveCustomerRefund, errRefundNotPending)
+		return
+	}
+
+	if req.Action == "query" {
+		err = s.reconcileRefund(refund, payment)
+	} else {
+		err = s.settleRefund(refund, payment, &RefundResult{
+			ExternalRefundID: req.ExternalRefundID,
+			ResponseCode:     "manual",
+			Message:          req.Message,
+			Status:           model.CustomerRefundStatus(req.Action),
+		})
+	}
+	if err != nil {
+		responseCustomErr(c, ErrCodeResolveCustomerRefund, err)
+		return
+	}
+
+	refund, err = s.store.CustomerRefundStore.GetByID(refund.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	responseSuccess(c, refund)
+}
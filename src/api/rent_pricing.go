@@ -0,0 +1,242 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+// rentalLocation is the timezone rental days, weekends and holidays are counted in
+var rentalLocation = time.FixedZone("ICT", 7*60*60)
+
+type RentPricing struct {
+	RentPriceQuotation      int `json:"rent_price_quotation"`
+	InsurancePriceQuotation int `json:"insurance_price_quotation"`
+
+	// Days itemizes SubtotalRentPriceAmount, TotalRentPriceAmount is what is left after the long stay discount
+	Days                    []*RentPricingDay `json:"days"`
+	SubtotalRentPriceAmount int               `json:"subtotal_rent_price_amount"`
+	LongStayDiscountPercent float64           `json:"long_stay_discount_percent"`
+	LongStayDiscountAmount  int               `json:"long_stay_discount_amount"`
+
+	TotalRentPriceAmount int `json:"total_rent_price_amount"`
+	TotalInsuranceAmount int `json:"total_insurance_amount"`
+	// DeliveryFee and ReturnFee are prepaid in full on top of the prepay percent
+	DeliveryFee   int `json:"delivery_fee"`
+	ReturnFee     int `json:"return_fee"`
+	TotalAmount   int `json:"total_amount"`
+	PrepaidAmount int `json:"prepaid_amount"`
+}
+
+type RentPricingDay struct {
+	Date         string   `json:"date"`
+	BasePrice    int      `json:"base_price"`
+	Price        int      `json:"price"`
+	AppliedRules []string `json:"applied_rules"`
+}
+
+// PricingRules are the pricing rules of a car and the holidays of a rental period. The rules of
+// the car itself come before the rules of its car model.
+type PricingRules struct {
+	carRules      []*model.PricingRule
+	carModelRules []*model.PricingRule
+	holidays      map[string]*model.Holiday
+}
+
+func NewPricingRules(car *model.Car, rules []*model.PricingRule, holidays []*model.Holiday) *PricingRules {
+	res := &PricingRules{holidays: map[string]*model.Holiday{}}
+	for _, rule := range rules {
+		if rule.CarID != nil && *rule.CarID == car.ID {
+			res.carRules = append(res.carRules, rule)
+		} else {
+			res.carModelRules = append(res.carModelRules, rule)
+		}
+	}
+
+	for _, holiday := range holidays {
+		res.holidays[holiday.Date.Format(time.DateOnly)] = holiday
+	}
+
+	return res
+}
+
+func (s *Server) loadPricingRules(car *model.Car, startDate, endDate time.Time) (*PricingRules, error) {
+	rules, err := s.store.PricingRuleStore.GetByCarOrCarModel(car.ID, car.CarModelID)
+	if err != nil {
+		return nil, err
+	}
+
+	holidays, err := s.store.HolidayStore.GetInRange(startDate.In(rentalLocation), endDate.In(rentalLocation))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPricingRules(car, rules, holidays), nil
+}
+
+// rulesOfType returns the car's own rules of a type, falling back to the rules of its car model
+func (p *PricingRules) rulesOfType(typ model.PricingRuleType) []*model.PricingRule {
+	for _, rules := range [][]*model.PricingRule{p.carRules, p.carModelRules} {
+		res := make([]*model.PricingRule, 0)
+		for _, rule := range rules {
+			if rule.Type == typ {
+				res = append(res, rule)
+			}
+		}
+
+		if len(res) > 0 {
+			return res
+		}
+	}
+
+	return nil
+}
+
+// dayRules returns the rules that price a rental day: the holiday rule on holidays, the weekend
+// rule on weekends and the weekday rule otherwise, plus the latest seasonal rule covering the day
+func (p *PricingRules) dayRules(day time.Time) []*model.PricingRule {
+	date := day.Format(time.DateOnly)
+	res := make([]*model.PricingRule, 0, 2)
+
+	dayTypes := []model.PricingRuleType{model.PricingRuleTypeWeekday}
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		dayTypes = []model.PricingRuleType{model.PricingRuleTypeWeekend}
+	}
+	if _, ok := p.holidays[date]; ok {
+		dayTypes = append([]model.PricingRuleType{model.PricingRuleTypeHoliday}, dayTypes...)
+	}
+	for _, typ := range dayTypes {
+		if rules := p.rulesOfType(typ); len(rules) > 0 {
+			res = append(res, rules[len(rules)-1])
+			break
+		}
+	}
+
+	seasonal := p.rulesOfType(model.PricingRuleTypeSeasonal)
+	for i := len(seasonal) - 1; i >= 0; i-- {
+		rule := seasonal[i]
+		if rule.StartDate != nil && rule.EndDate != nil &&
+			rule.StartDate.Format(time.DateOnly) <= date && date <= rule.EndDate.Format(time.DateOnly) {
+			res = append(res, rule)
+			break
+		}
+	}
+
+	return res
+}
+
+// longStayDiscount returns the best discount a rental of days reaches
+func (p *PricingRules) longStayDiscount(days int) float64 {
+	rules := p.rulesOfType(model.PricingRuleTypeLongStay)
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].DiscountPercent > rules[j].DiscountPercent })
+	for _, rule := range rules {
+		if days >= rule.MinDays {
+			return rule.DiscountPercent
+		}
+	}
+
+	return 0
+}
+
+func pricingRuleName(rule *model.PricingRule) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+
+	if rule.Type == model.PricingRuleTypeLongStay {
+		return fmt.Sprintf("%s -%.1f%%", rule.Type, rule.DiscountPercent)
+	}
+
+	return fmt.Sprintf("%s %.1f%%", rule.Type, rule.PricePercent)
+}
+
+// calculateRentPrice prices a rental day by day. A started day is charged as a full day. Nil
+// pricing rules charge the base price every day. Each delivery is charged by the delivery fee tier
+// of its distance, which is also set as its Fee.
+func calculateRentPrice(
+	car *model.Car,
+	rule *model.CustomerContractRule,
+	pricingRules *PricingRules,
+	startDate, endDate time.Time,
+	deliveries []*model.CustomerContractDelivery,
+) *RentPricing {
+	if pricingRules == nil {
+		pricingRules = NewPricingRules(car, nil, nil)
+	}
+
+	numDays := int(((endDate.Sub(startDate)).Hours()) / 24.0)
+	if int(endDate.Sub(startDate).Seconds())%(24*60*60) != 0 {
+		numDays++
+	}
+
+	days := make([]*RentPricingDay, numDays)
+	subtotal := 0
+	for i := range days {
+		day := startDate.Add(time.Duration(i) * 24 * time.Hour).In(rentalLocation)
+		percent := 100.0
+		applied := make([]string, 0)
+		for _, dayRule := range pricingRules.dayRules(day) {
+			percent = percent * dayRule.PricePercent / 100.0
+			applied = append(applied, pricingRuleName(dayRule))
+		}
+
+		days[i] = &RentPricingDay{
+			Date:         day.Format(time.DateOnly),
+			BasePrice:    car.Price,
+			Price:        int(math.Round(float64(car.Price) * percent / 100.0)),
+			AppliedRules: applied,
+		}
+		subtotal += days[i].Price
+	}
+
+	discountPercent := pricingRules.longStayDiscount(numDays)
+	discount := int(float64(subtotal) * discountPercent / 100.0)
+	totalRentPriceAmount := subtotal - discount
+
+	deliveryFee, returnFee := 0, 0
+	for _, delivery := range deliveries {
+		if delivery.Status == model.DeliveryStatusCanceled {
+			continue
+		}
+
+		delivery.Fee, _ = rule.DeliveryFee(delivery.DistanceKm)
+		if delivery.Type == model.DeliveryTypeReturn {
+			returnFee += delivery.Fee
+		} else {
+			deliveryFee += delivery.Fee
+		}
+	}
+
+	totalInsuranceAmount := float64(totalRentPriceAmount) * rule.InsurancePercent / 100.0
+	return &RentPricing{
+		RentPriceQuotation:      car.Price,
+		InsurancePriceQuotation: int(float64(car.Price) * rule.InsurancePercent / 100.0),
+		Days:                    days,
+		SubtotalRentPriceAmount: subtotal,
+		LongStayDiscountPercent: discountPercent,
+		LongStayDiscountAmount:  discount,
+		TotalRentPriceAmount:    totalRentPriceAmount,
+		TotalInsuranceAmount:    int(totalInsuranceAmount),
+		DeliveryFee:             deliveryFee,
+		ReturnFee:               returnFee,
+		TotalAmount:             totalRentPriceAmount + int(totalInsuranceAmount) + deliveryFee + returnFee,
+		PrepaidAmount:           int((float64(totalRentPriceAmount)+totalInsuranceAmount)*rule.PrepayPercent/100.0) + deliveryFee + returnFee,
+	}
+}
+
+// contractPrepaidAmount is the prepay of a contract from the totals, delivery fees and rule stored
+// on it, so pricing or rule changes after booking don't change what the customer agreed to pay
+func contractPrepaidAmount(contract *model.CustomerContract) int {
+	fees := 0
+	for _, delivery := range contract.Deliveries {
+		if delivery.Status != model.DeliveryStatusCanceled {
+			fees += delivery.Fee
+		}
+	}
+
+	rentAndInsurance := float64(contract.RentPrice + contract.InsuranceAmount)
+	return int(rentAndInsurance*contract.CustomerContractRule.PrepayPercent/100.0) + fees
+}
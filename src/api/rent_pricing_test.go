@@ -0,0 +1,86 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestCalculateRentPrice_PricingRules(t *testing.T) {
+	t.Parallel()
+
+	carID, carModelID := 1, 2
+	car := &model.Car{ID: carID, CarModelID: carModelID, Price: 100_000}
+	rule := &model.CustomerContractRule{InsurancePercent: 10, PrepayPercent: 30}
+	date := func(day int) *time.Time {
+		res := time.Date(2024, 6, day, 0, 0, 0, 0, time.UTC)
+		return &res
+	}
+	pricingRules := NewPricingRules(car, []*model.PricingRule{
+		{CarModelID: &carModelID, Type: model.PricingRuleTypeWeekend, PricePercent: 150},
+		{CarID: &carID, Type: model.PricingRuleTypeWeekend, PricePercent: 120},
+		{CarModelID: &carModelID, Type: model.PricingRuleTypeHoliday, PricePercent: 200},
+		{CarID: &carID, Type: model.PricingRuleTypeSeasonal, Name: "summer", PricePercent: 110, StartDate: date(12), EndDate: date(13)},
+		{CarModelID: &carModelID, Type: model.PricingRuleTypeLongStay, DiscountPercent: 5, MinDays: 3},
+		{CarModelID: &carModelID, Type: model.PricingRuleTypeLongStay, DiscountPercent: 10, MinDays: 7},
+		{CarModelID: &carModelID, Type: model.PricingRuleTypeLongStay, DiscountPercent: 20, MinDays: 30},
+	}, []*model.Holiday{{Date: *date(10), Name: "holiday"}})
+
+	// from Friday 2024-06-07 09:00 to Saturday 2024-06-15 09:00
+	startDate := time.Date(2024, 6, 7, 9, 0, 0, 0, rentalLocation)
+	pricing := calculateRentPrice(car, rule, pricingRules, startDate, startDate.AddDate(0, 0, 8), nil)
+
+	prices := make([]int, len(pricing.Days))
+	for i, day := range pricing.Days {
+		prices[i] = day.Price
+	}
+	require.Equal(t, []int{100_000, 120_000, 120_000, 200_000, 100_000, 110_000, 110_000, 100_000}, prices)
+	require.Equal(t, "2024-06-10", pricing.Days[3].Date)
+	require.Equal(t, []string{"summer"}, pricing.Days[5].AppliedRules)
+	require.Equal(t, 960_000, pricing.SubtotalRentPriceAmount)
+	require.Equal(t, 10.0, pricing.LongStayDiscountPercent)
+	require.Equal(t, 96_000, pricing.LongStayDiscountAmount)
+	require.Equal(t, 864_000, pricing.TotalRentPriceAmount)
+	require.Equal(t, 86_400, pricing.TotalInsuranceAmount)
+	require.Equal(t, 950_400, pricing.TotalAmount)
+	require.Equal(t, 285_120, pricing.PrepaidAmount)
+
+	t.Run("no rules charge the base price", func(t *testing.T) {
+		pricing := calculateRentPrice(car, rule, nil, startDate, startDate.Add(50*time.Hour), nil)
+		require.Len(t, pricing.Days, 3)
+		require.Equal(t, 300_000, pricing.TotalRentPriceAmount)
+	})
+
+	t.Run("deliveries are charged by the tier of their distance", func(t *testing.T) {
+		rule := &model.CustomerContractRule{InsurancePercent: 10, PrepayPercent: 30, DeliveryFeeTiers: model.DefaultDeliveryFeeTiers()}
+		deliveries := []*model.CustomerContractDelivery{
+			{Type: model.DeliveryTypeDelivery, DistanceKm: 5},
+			{Type: model.DeliveryTypeReturn, DistanceKm: 12.5},
+			{Type: model.DeliveryTypeReturn, DistanceKm: 40, Status: model.DeliveryStatusCanceled},
+		}
+		pricing := calculateRentPrice(car, rule, nil, startDate, startDate.Add(48*time.Hour), deliveries)
+		require.Equal(t, 50_000, pricing.DeliveryFee)
+		require.Equal(t, 100_000, pricing.ReturnFee)
+		require.Equal(t, 50_000, deliveries[0].Fee)
+		require.Equal(t, 220_000+150_000, pricing.TotalAmount)
+		require.Equal(t, 66_000+150_000, pricing.PrepaidAmount)
+	})
+}
+
+func TestContractPrepaidAmount(t *testing.T) {
+	t.Parallel()
+
+	contract := &model.CustomerContract{
+		RentPrice:            864_000,
+		InsuranceAmount:      86_400,
+		CustomerContractRule: model.CustomerContractRule{PrepayPercent: 30},
+		Deliveries: []*model.CustomerContractDelivery{
+			{Type: model.DeliveryTypeDelivery, Fee: 50_000},
+			{Type: model.DeliveryTypeReturn, Fee: 100_000, Status: model.DeliveryStatusCanceled},
+		},
+	}
+	require.Equal(t, 285_120+50_000, contractPrepaidAmount(contract))
+}
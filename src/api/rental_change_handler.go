@@ -0,0 +1,329 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
+)
+
+func responseRentalChangeErr(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrCustomerContractNotChangeable) {
+		responseCustomErr(c, ErrCodeCustomerContractNotChangeable, err)
+		return
+	}
+
+	responseTransitErr(c, err)
+}
+
+// repriceRental prices the rental of a contract as if it ended at endDate, with the rule the
+// contract was signed with
+func (s *Server) repriceRental(contract *model.CustomerContract, endDate time.Time) (*RentPricing, error) {
+	rule, err := s.store.CustomerContractRuleStore.GetByIDTx(s.store.DB, contract.CustomerContractRuleID)
+	if err != nil {
+		return nil, err
+	}
+
+	pricingRules, err := s.loadPricingRules(&contract.Car, contract.StartDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return calculateRentPrice(&contract.Car, rule, pricingRules, contract.StartDate, endDate, contract.Deliveries), nil
+}
+
+type customerExtendContractRequest struct {
+	CustomerContractID int                  `json:"customer_contract_id" binding:"required"`
+	EndDate            time.Time            `json:"end_date" binding:"required"`
+	ReturnURL          string               `json:"return_url" binding:"required"`
+	Gateway            model.PaymentGateway `json:"gateway"`
+}
+
+type customerExtendContractResponse struct {
+	Contract        *model.CustomerContract `json:"contract"`
+	Pricing         *RentPricing            `json:"pricing"`
+	ExtensionAmount int                     `json:"extension_amount"`
+	PaymentURL      string                  `json:"payment_url"`
+}
+
+// HandleCustomerExtendContract moves the end of a renting contract later when the car is not
+// reserved after it. The whole rental is priced again and the extra rent and insurance are
+// charged in full with an extension payment.
+func (s *Server) HandleCustomerExtendContract(c *gin.Context) {
+	req := customerExtendContractRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidExtendCustomerContractRequest, err)
+		return
+	}
+
+	if _, err := s.PaymentGateways.Get(req.Gateway); err != nil {
+		responseCustomErr(c, ErrCodeUnsupportedPaymentGateway, err)
+		return
+	}
+
+	acct, contract, ok := s.getOwnCustomerContract(c, req.CustomerContractID)
+	if !ok {
+		return
+	}
+
+	if contract.Status != model.CustomerContractStatusRenting {
+		responseCustomErr(c, ErrCodeCustomerContractNotChangeable, errors.New("only renting contracts can be extended"))
+		return
+	}
+
+	if !req.EndDate.After(contract.EndDate) {
+		responseCustomErr(c, ErrCodeInvalidExtendCustomerContractRequest, errors.New("end_date must be after the current end date"))
+		return
+	}
+
+	// the handover buffer before the next rental of the car must fit too
+	ranges, err := s.store.CarStore.GetCalendar([]int{contract.CarID}, contract.EndDate, req.EndDate)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	for _, r := range ranges {
+		if r.CustomerContractID == nil || *r.CustomerContractID != contract.ID {
+			responseCustomErr(c, ErrCodeCarReserved, errors.New("car is reserved after the contract"))
+			return
+		}
+	}
+
+	current, err := s.repriceRental(contract, contract.EndDate)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	pricing, err := s.repriceRental(contract, req.EndDate)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	extraRent := max(0, pricing.TotalRentPriceAmount-current.TotalRentPriceAmount)
+	extraInsurance := max(0, pricing.TotalInsuranceAmount-current.TotalInsuranceAmount)
+	payments := make([]*model.CustomerPayment, 0, 1)
+	if extraRent+extraInsurance > 0 {
+		payments = append(payments, &model.CustomerPayment{
+			PaymentType: model.PaymentTypeExtension,
+			Amount:      extraRent + extraInsurance,
+			Status:      model.PaymentStatusPending,
+			Note:        fmt.Sprintf("extend contract to %s", req.EndDate.In(rentalLocation).Format(time.DateTime)),
+		})
+	}
+
+	if _, err := s.contractStateMachine.ChangeEndDate(&service.RentalChange{
+		CustomerContractID: contract.ID,
+		PrevEndDate:        contract.EndDate,
+		EndDate:            req.EndDate,
+		RentPrice:          contract.RentPrice + extraRent,
+		InsuranceAmount:    contract.InsuranceAmount + extraInsurance,
+		Payments:           payments,
+		Actor:              service.ContractActor{AccountID: acct.ID, Role: model.RoleNameCustomer},
+		Reason:             fmt.Sprintf("customer extended contract from %s", contract.EndDate.In(rentalLocation).Format(time.DateTime)),
+	}); err != nil {
+		responseRentalChangeErr(c, err)
+		return
+	}
+
+	contract, err = s.store.CustomerContractStore.FindByID(contract.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	resp := &customerExtendContractResponse{Contract: contract, Pricing: pricing}
+	for _, payment := range payments {
+		url, err := s.generateCustomerPaymentURL(req.Gateway, []int{payment.ID}, payment.Amount, req.ReturnURL)
+		if err != nil {
+			responseCustomErr(c, ErrCodeGenerateQRCode, err)
+			return
+		}
+
+		if err := s.store.CustomerPaymentStore.Update(payment.ID, map[string]interface{}{"payment_url": url}); err != nil {
+			responseGormErr(c, err)
+			return
+		}
+
+		resp.ExtensionAmount, resp.PaymentURL = payment.Amount, url
+	}
+
+	s.notifyAdminsOfCustomerContract(contract)
+	responseSuccess(c, resp)
+}
+
+type customerEarlyReturnRequest struct {
+	CustomerContractID int `json:"customer_contract_id" binding:"required"`
+	// ReturnAt is when the car is brought back, now by default
+	ReturnAt *time.Time `json:"return_at"`
+}
+
+type customerEarlyReturnResponse struct {
+	Contract       *model.CustomerContract  `json:"contract"`
+	Pricing        *RentPricing             `json:"pricing"`
+	RefundAmount   int                      `json:"refund_amount"`
+	RefundPayments []*model.CustomerPayment `json:"refund_payments"`
+}
+
+// HandleCustomerEarlyReturn moves the end of a renting contract earlier. The rent and insurance
+// of the days given back are taken off the contract and whatever the customer paid beyond the
+// new total is refunded from the prepay, then from the latest extension and remaining payments.
+func (s *Server) HandleCustomerEarlyReturn(c *gin.Context) {
+	req := customerEarlyReturnRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidEarlyReturnRequest, err)
+		return
+	}
+
+	acct, contract, ok := s.getOwnCustomerContract(c, req.CustomerContractID)
+	if !ok {
+		return
+	}
+
+	if contract.Status != model.CustomerContractStatusRenting {
+		responseCustomErr(c, ErrCodeCustomerContractNotChangeable, errors.New("only renting contracts can be returned early"))
+		return
+	}
+
+	returnAt := time.Now()
+	if req.ReturnAt != nil {
+		if req.ReturnAt.Before(returnAt) {
+			responseCustomErr(c, ErrCodeInvalidEarlyReturnRequest, errors.New("return_at can not be in the past"))
+			return
+		}
+		returnAt = *req.ReturnAt
+	}
+
+	if !returnAt.Before(contract.EndDate) || !returnAt.After(contract.StartDate) {
+		responseCustomErr(c, ErrCodeInvalidEarlyReturnRequest, errors.New("return_at must be within the rental"))
+		return
+	}
+
+	current, err := s.repriceRental(contract, contract.EndDate)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	pricing, err := s.repriceRental(contract, returnAt)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	rentPrice := max(0, contract.RentPrice-max(0, current.TotalRentPriceAmount-pricing.TotalRentPriceAmount))
+	insuranceAmount := max(0, contract.InsuranceAmount-max(0, current.TotalInsuranceAmount-pricing.TotalInsuranceAmount))
+
+	refundPayments, err := s.earlyReturnRefundPayments(contract, rentPrice+insuranceAmount+pricing.DeliveryFee+pricing.ReturnFee)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if _, err := s.contractStateMachine.ChangeEndDate(&service.RentalChange{
+		CustomerContractID: contract.ID,
+		PrevEndDate:        contract.EndDate,
+		EndDate:            returnAt,
+		RentPrice:          rentPrice,
+		InsuranceAmount:    insuranceAmount,
+		Payments:           refundPayments,
+		Actor:              service.ContractActor{AccountID: acct.ID, Role: model.RoleNameCustomer},
+		Reason:             fmt.Sprintf("customer returns car early, contract ended at %s", contract.EndDate.In(rentalLocation).Format(time.DateTime)),
+	}); err != nil {
+		responseRentalChangeErr(c, err)
+		return
+	}
+
+	contract, err = s.store.CustomerContractStore.FindByID(contract.ID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	resp := &customerEarlyReturnResponse{Contract: contract, Pricing: pricing, RefundPayments: refundPayments}
+	for _, payment := range refundPayments {
+		resp.RefundAmount += payment.Amount
+		if err := s.payOutRefundPayment(payment); err != nil {
+			fmt.Printf("refund payment %d of early returned contract %d error %v\n", payment.ID, contract.ID, err)
+		}
+	}
+
+	s.notifyAdminsOfCustomerContract(contract)
+	responseSuccess(c, resp)
+}
+
+// earlyReturnRefundPayments builds the refund payments giving back what the customer paid for a
+// contract beyond owed. Refunds come from the prepay, then from the latest extension payment and
+// then from the latest remaining payment, up to what is left to refund of them.
+func (s *Server) earlyReturnRefundPayments(contract *model.CustomerContract, owed int) ([]*model.CustomerPayment, error) {
+	payments, err := s.store.CustomerPaymentStore.GetByCustomerContractID(contract.ID, model.PaymentStatusNoFilter, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	paid := 0
+	for _, payment := range payments {
+		switch payment.PaymentType {
+		case model.PaymentTypePrePay, model.PaymentTypeExtension, model.PaymentTypeRemainingPay:
+			if payment.Status == model.PaymentStatusPaid {
+				paid += payment.Amount
+			}
+		case model.PaymentTypeReturnPrepay, model.PaymentTypeReturnExtension, model.PaymentTypeReturnRemainingPay:
+			paid -= payment.Amount
+		}
+	}
+
+	refund := paid - owed
+	res := make([]*model.CustomerPayment, 0)
+	for _, refundType := range []model.PaymentType{
+		model.PaymentTypeReturnPrepay,
+		model.PaymentTypeReturnExtension,
+		model.PaymentTypeReturnRemainingPay,
+	} {
+		if refund <= 0 {
+			break
+		}
+
+		source, err := s.store.CustomerPaymentStore.GetLastPaidByPaymentType(contract.ID, refundSourcePaymentTypes[refundType])
+		if err != nil {
+			continue
+		}
+
+		refunded, err := s.store.CustomerRefundStore.GetRefundedAmountTx(s.store.DB, source.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		amount := min(refund, source.Amount-refunded)
+		if amount <= 0 {
+			continue
+		}
+
+		res = append(res, &model.CustomerPayment{
+			PaymentType: refundType,
+			Amount:      amount,
+			Status:      model.PaymentStatusPending,
+			Note:        "refund of early returned contract",
+		})
+		refund -= amount
+	}
+
+	return res, nil
+}
+
+func (s *Server) notifyAdminsOfCustomerContract(contract *model.CustomerContract) {
+	go func() {
+		adminIds, err := s.store.AccountStore.GetAllAdminIDs()
+		if err == nil {
+			for _, id := range adminIds {
+				s.adminNotificationQueue <- s.NewCustomerContractNotificationMsg(id, contract.ID, contract.Car.LicensePlate)
+			}
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestServer_EarlyReturnRefundPayments(t *testing.T) {
+	carModel := &model.CarModel{Brand: "EarlyReturn", Model: "E1", NumberOfSeats: 4}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+	partner := &model.Account{RoleID: model.RoleIDPartner, PhoneNumber: "0988400000", Status: model.AccountStatusActive}
+	require.NoError(t, TestDb.AccountStore.Create(partner))
+	customer := &model.Account{RoleID: model.RoleIDCustomer, PhoneNumber: "0988400001", Status: model.AccountStatusActive}
+	require.NoError(t, TestDb.AccountStore.Create(customer))
+	car := &model.Car{
+		PartnerID:             partner.ID,
+		CarModelID:            carModel.ID,
+		LicensePlate:          "EARLY-1",
+		ParkingLot:            model.ParkingLotGarage,
+		Status:                model.CarStatusActive,
+		Price:                 500_000,
+		PartnerContractRuleID: 1,
+		EndDate:               time.Now().AddDate(1, 0, 0),
+	}
+	require.NoError(t, TestDb.CarStore.Create(car))
+
+	now := time.Now()
+	contract := &model.CustomerContract{
+		CustomerID:             customer.ID,
+		CarID:                  car.ID,
+		StartDate:              now.AddDate(0, 0, -1),
+		EndDate:                now.AddDate(0, 0, 1),
+		Status:                 model.CustomerContractStatusRenting,
+		RentPrice:              900_000,
+		InsuranceAmount:        100_000,
+		CustomerContractRuleID: 1,
+	}
+	require.NoError(t, TestDb.CustomerContractStore.Create(contract))
+
+	// the rent was fully paid before the car is brought back
+	for _, payment := range []*model.CustomerPayment{
+		{PaymentType: model.PaymentTypePrePay, Amount: 300_000},
+		{PaymentType: model.PaymentTypeRemainingPay, Amount: 700_000},
+	} {
+		payment.CustomerContractID, payment.Status = contract.ID, model.PaymentStatusPaid
+		require.NoError(t, TestDb.CustomerPaymentStore.Create(payment))
+	}
+
+	refunds, err := TestServer.earlyReturnRefundPayments(contract, 600_000)
+	require.NoError(t, err)
+	require.Len(t, refunds, 2)
+	require.Equal(t, model.PaymentTypeReturnPrepay, refunds[0].PaymentType)
+	require.Equal(t, 300_000, refunds[0].Amount)
+	require.Equal(t, model.PaymentTypeReturnRemainingPay, refunds[1].PaymentType)
+	require.Equal(t, 100_000, refunds[1].Amount)
+
+	t.Run("refund payments are not refunded twice", func(t *testing.T) {
+		for _, refund := range refunds {
+			refund.CustomerContractID = contract.ID
+			require.NoError(t, TestDb.CustomerPaymentStore.Create(refund))
+		}
+
+		refunds, err := TestServer.earlyReturnRefundPayments(contract, 600_000)
+		require.NoError(t, err)
+		require.Empty(t, refunds)
+	})
+}
@@ -48,6 +48,9 @@ const (
 	RouteAdminGetFeedbacks                           = "admin_get_feedbacks"
 	RouteAdminUpdateFeedbackStatus                   = "admin_update_feedback_status"
 	RouteAdminCancelCustomerPayment                  = "admin_cancel_customer_payment"
+	RouteAdminRefundCustomerPayment                  = "admin_refund_customer_payment"
+	RouteAdminGetCustomerRefunds                     = "admin_get_customer_refunds"
+	RouteAdminResolveCustomerRefund                  = "admin_resolve_customer_refund"
 	RouteAdminGetConversations                       = "admin_get_conversations"
 	RouteAdminGetConversationMessage                 = "admin_get_conversation_message"
 	RouteAdminUpdateIsReturnCollateralAsset          = "admin_update_collateral_asset"
@@ -82,6 +85,8 @@ const (
 	RouteCustomerGetContracts                        = "customer_get_contracts"
 	RouteCustomerAdminGetContractDetail              = "customer_get_contract_detail"
 	RouteCustomerAgreeContract                       = "customer_agree_contract"
+	RouteCustomerCancelContract                      = "customer_cancel_contract"
+	RouteCustomerGetCancellationQuote                = "customer_get_cancellation_quote"
 	RouteCustomerGetLastPaymentDetail                = "customer_get_payment_document_detail"
 	RouteCustomerCalculateRentingPrice               = "customer_calculate_renting_price"
 	RouteCustomerGetActivities                       = "customer_get_activities"
@@ -93,9 +98,51 @@ const (
 	RouteChat                                        = "chat"
 	RouteVNPayIPNURL                                 = "vn_pay_ipn_url"
 	RouteVNPayReturnURL                              = "vn_pay_return_url"
+	RouteMoMoIPNURL                                  = "momo_ipn_url"
+	RouteZaloPayCallbackURL                          = "zalo_pay_callback_url"
 	RouteRegisterExpoPushToken                       = "register_expo_push_token"
 	RouteGetNotificationHistory                      = "get_notification_history"
 	RouteCheckPaymentStatus                          = "check_payment_status"
+	RouteRenewAccessToken                            = "renew_access_token"
+	RouteLogout                                      = "logout"
+	RouteLogoutAllDevices                            = "logout_all_devices"
+	RouteAdminTerminateAccountSessions               = "admin_terminate_account_sessions"
+	RouteGetCustomerContractEvents                   = "get_customer_contract_events"
+	RouteCreatePricingRule                           = "create_pricing_rule"
+	RouteDeletePricingRule                           = "delete_pricing_rule"
+	RouteGetPricingRules                             = "get_pricing_rules"
+	RouteAdminCreateHoliday                          = "admin_create_holiday"
+	RouteAdminDeleteHoliday                          = "admin_delete_holiday"
+	RouteGetHolidays                                 = "get_holidays"
+	RouteAdminCreateGarage                           = "admin_create_garage"
+	RouteAdminUpdateGarage                           = "admin_update_garage"
+	RouteGetGarages                                  = "get_garages"
+	RouteAdminAssignDelivery                         = "admin_assign_delivery"
+	RouteGetDeliverySchedule                         = "get_delivery_schedule"
+	RouteUpdateDeliveryStatus                        = "update_delivery_status"
+	RouteGetCarCalendar                              = "get_car_calendar"
+	RouteCreateCarBlackout                           = "create_car_blackout"
+	RouteDeleteCarBlackout                           = "delete_car_blackout"
+	RouteGetCarBlackouts                             = "get_car_blackouts"
+	RouteCustomerExtendContract                      = "customer_extend_contract"
+	RouteCustomerEarlyReturn                         = "customer_early_return"
+	RouteCreateCustomerContractCharges               = "create_customer_contract_charges"
+	RouteUploadCustomerContractChargeImages          = "upload_customer_contract_charge_images"
+	RouteGetInspectionTemplate                       = "get_inspection_template"
+	RouteAdminCreateInspectionTemplate               = "admin_create_inspection_template"
+	RouteGetCustomerContractInspections              = "get_customer_contract_inspections"
+	RouteUploadInspectionImages                      = "upload_inspection_images"
+	RouteAdminCreatePartnerPaymentAdjustment         = "admin_create_partner_payment_adjustment"
+	RouteGetPartnerPaymentStatement                  = "get_partner_payment_statement"
+	RouteAdminGetTrialBalance                        = "admin_get_trial_balance"
+	RouteAdminGetLedgerAccountStatement              = "admin_get_ledger_account_statement"
+	RouteGetCustomerContractInvoices                 = "get_customer_contract_invoices"
+	RouteGetPartnerPaymentReceipt                    = "get_partner_payment_receipt"
+	RouteAdminGetContractTemplates                   = "admin_get_contract_templates"
+	RouteAdminGetContractTemplateFields              = "admin_get_contract_template_fields"
+	RouteAdminCreateContractTemplate                 = "admin_create_contract_template"
+	RouteAdminPreviewContractTemplate                = "admin_preview_contract_template"
+	RouteAdminPublishContractTemplate                = "admin_publish_contract_template"
 )
 
 var (
@@ -106,6 +153,7 @@ var (
 	AuthRoleCustomerAdmin   = []string{model.RoleNameCustomer, model.RoleNameAdmin}
 	AuthRoleCustomerPartner = []string{model.RoleNameCustomer, model.RoleNamePartner}
 	AuthRoleAdminTechnician = []string{model.RoleNameAdmin, model.RoleNameTechnician}
+	AuthRoleAdminPartner    = []string{model.RoleNameAdmin, model.RoleNamePartner}
 	AuthRoleAll             = []string{model.RoleNameCustomer, model.RoleNamePartner, model.RoleNameAdmin, model.RoleNameTechnician}
 )
 
@@ -391,6 +439,27 @@ func (s *Server) AllRoutes() map[string]RouteInfo {
 			RequireAuth: true,
 			AuthRoles:   AuthRoleAdmin,
 		},
+		RouteAdminRefundCustomerPayment: {
+			Path:        "/admin/customer_payment/refund",
+			Method:      http.MethodPost,
+			Handler:     s.HandleAdminRefundCustomerPayment,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminGetCustomerRefunds: {
+			Path:        "/admin/customer_payment/refunds",
+			Method:      http.MethodGet,
+			Handler:     s.HandleAdminGetCustomerRefunds,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminResolveCustomerRefund: {
+			Path:        "/admin/customer_refund/resolve",
+			Method:      http.MethodPut,
+			Handler:     s.HandleAdminResolveCustomerRefund,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
 		RouteAdminUpdateIsReturnCollateralAsset: {
 			Path:        "/admin/update_is_return_collateral_asset",
 			Method:      http.MethodPut,
@@ -555,6 +624,13 @@ func (s *Server) AllRoutes() map[string]RouteInfo {
 			RequireAuth: true,
 			AuthRoles:   AuthRoleAll,
 		},
+		RouteGetCustomerContractEvents: {
+			Path:        "/contract/:customer_contract_id/events",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetCustomerContractEvents,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAll,
+		},
 		RouteCustomerCalculateRentingPrice: {
 			Path:        "/customer/calculate_rent_pricing",
 			Method:      http.MethodGet,
@@ -569,6 +645,153 @@ func (s *Server) AllRoutes() map[string]RouteInfo {
 			RequireAuth: true,
 			AuthRoles:   AuthRoleCustomer,
 		},
+		RouteCustomerCancelContract: {
+			Path:        "/customer/contract/cancel",
+			Method:      http.MethodPut,
+			Handler:     s.HandleCustomerCancelContract,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleCustomer,
+		},
+		RouteCustomerGetCancellationQuote: {
+			Path:        "/customer/contract/cancellation_quote",
+			Method:      http.MethodGet,
+			Handler:     s.HandleCustomerGetCancellationQuote,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleCustomer,
+		},
+		RouteCustomerExtendContract: {
+			Path:        "/customer/contract/extend",
+			Method:      http.MethodPut,
+			Handler:     s.HandleCustomerExtendContract,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleCustomer,
+		},
+		RouteCustomerEarlyReturn: {
+			Path:        "/customer/contract/early_return",
+			Method:      http.MethodPut,
+			Handler:     s.HandleCustomerEarlyReturn,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleCustomer,
+		},
+		RouteCreateCustomerContractCharges: {
+			Path:        "/customer_contract/charges",
+			Method:      http.MethodPost,
+			Handler:     s.HandleCreateCustomerContractCharges,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminTechnician,
+		},
+		RouteUploadCustomerContractChargeImages: {
+			Path:        "/customer_contract/charge_images",
+			Method:      http.MethodPost,
+			Handler:     s.HandleUploadCustomerContractChargeImages,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminTechnician,
+		},
+		RouteGetInspectionTemplate: {
+			Path:        "/inspection_template",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetInspectionTemplate,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminTechnician,
+		},
+		RouteAdminCreateInspectionTemplate: {
+			Path:        "/admin/inspection_template",
+			Method:      http.MethodPost,
+			Handler:     s.HandleAdminCreateInspectionTemplate,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteGetCustomerContractInspections: {
+			Path:        "/customer_contract/inspections",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetCustomerContractInspections,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAll,
+		},
+		RouteUploadInspectionImages: {
+			Path:        "/customer_contract/inspection_images",
+			Method:      http.MethodPost,
+			Handler:     s.HandleUploadInspectionImages,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminTechnician,
+		},
+		RouteAdminCreatePartnerPaymentAdjustment: {
+			Path:        "/admin/monthly_partner_payment/adjustment",
+			Method:      http.MethodPost,
+			Handler:     s.HandleAdminCreatePartnerPaymentAdjustment,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteGetPartnerPaymentStatement: {
+			Path:        "/monthly_partner_payment/statement",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetPartnerPaymentStatement,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminPartner,
+		},
+		RouteAdminGetTrialBalance: {
+			Path:        "/admin/ledger/trial_balance",
+			Method:      http.MethodGet,
+			Handler:     s.HandleAdminGetTrialBalance,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminGetLedgerAccountStatement: {
+			Path:        "/admin/ledger/account_statement",
+			Method:      http.MethodGet,
+			Handler:     s.HandleAdminGetLedgerAccountStatement,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteGetCustomerContractInvoices: {
+			Path:        "/customer_contract/invoices",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetCustomerContractInvoices,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleCustomerAdmin,
+		},
+		RouteGetPartnerPaymentReceipt: {
+			Path:        "/monthly_partner_payment/receipt",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetPartnerPaymentReceipt,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminPartner,
+		},
+		RouteAdminGetContractTemplates: {
+			Path:        "/admin/contract_templates",
+			Method:      http.MethodGet,
+			Handler:     s.HandleAdminGetContractTemplates,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminGetContractTemplateFields: {
+			Path:        "/admin/contract_template/fields",
+			Method:      http.MethodGet,
+			Handler:     s.HandleAdminGetContractTemplateFields,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminCreateContractTemplate: {
+			Path:        "/admin/contract_template",
+			Method:      http.MethodPost,
+			Handler:     s.HandleAdminCreateContractTemplate,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminPreviewContractTemplate: {
+			Path:        "/admin/contract_template/preview",
+			Method:      http.MethodPost,
+			Handler:     s.HandleAdminPreviewContractTemplate,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminPublishContractTemplate: {
+			Path:        "/admin/contract_template/publish",
+			Method:      http.MethodPut,
+			Handler:     s.HandleAdminPublishContractTemplate,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
 		RouteCustomerGetLastPaymentDetail: {
 			Path:        "/customer/last_payment_detail",
 			Method:      http.MethodGet,
@@ -622,6 +845,18 @@ func (s *Server) AllRoutes() map[string]RouteInfo {
 			Handler:     s.HandleVnPayReturnURL,
 			RequireAuth: false,
 		},
+		RouteMoMoIPNURL: {
+			Path:        "/momo/ipn",
+			Method:      http.MethodPost,
+			Handler:     s.HandleMoMoIPN,
+			RequireAuth: false,
+		},
+		RouteZaloPayCallbackURL: {
+			Path:        "/zalopay/callback",
+			Method:      http.MethodPost,
+			Handler:     s.HandleZaloPayCallback,
+			RequireAuth: false,
+		},
 		RouteRegisterExpoPushToken: {
 			Path:        "/expo_push_token",
 			Method:      http.MethodPost,
@@ -629,6 +864,118 @@ func (s *Server) AllRoutes() map[string]RouteInfo {
 			RequireAuth: true,
 			AuthRoles:   AuthRoleCustomerPartner,
 		},
+		RouteCreatePricingRule: {
+			Path:        "/pricing_rule",
+			Method:      http.MethodPost,
+			Handler:     s.HandleCreatePricingRule,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminPartner,
+		},
+		RouteDeletePricingRule: {
+			Path:        "/pricing_rule",
+			Method:      http.MethodDelete,
+			Handler:     s.HandleDeletePricingRule,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminPartner,
+		},
+		RouteGetPricingRules: {
+			Path:        "/pricing_rules",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetPricingRules,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAll,
+		},
+		RouteAdminCreateHoliday: {
+			Path:        "/admin/holiday",
+			Method:      http.MethodPost,
+			Handler:     s.HandleAdminCreateHoliday,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminDeleteHoliday: {
+			Path:        "/admin/holiday",
+			Method:      http.MethodDelete,
+			Handler:     s.HandleAdminDeleteHoliday,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteGetHolidays: {
+			Path:        "/holidays",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetHolidays,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAll,
+		},
+		RouteAdminCreateGarage: {
+			Path:        "/admin/garage",
+			Method:      http.MethodPost,
+			Handler:     s.HandleAdminCreateGarage,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteAdminUpdateGarage: {
+			Path:        "/admin/garage",
+			Method:      http.MethodPut,
+			Handler:     s.HandleAdminUpdateGarage,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteGetGarages: {
+			Path:        "/garages",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetGarages,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAll,
+		},
+		RouteAdminAssignDelivery: {
+			Path:        "/admin/delivery/assign",
+			Method:      http.MethodPut,
+			Handler:     s.HandleAdminAssignDelivery,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
+		RouteGetDeliverySchedule: {
+			Path:        "/deliveries",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetDeliverySchedule,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminTechnician,
+		},
+		RouteUpdateDeliveryStatus: {
+			Path:        "/delivery/status",
+			Method:      http.MethodPut,
+			Handler:     s.HandleUpdateDeliveryStatus,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminTechnician,
+		},
+		RouteGetCarCalendar: {
+			Path:        "/car/calendar",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetCarCalendar,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAll,
+		},
+		RouteCreateCarBlackout: {
+			Path:        "/car/blackout",
+			Method:      http.MethodPost,
+			Handler:     s.HandleCreateCarBlackout,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminPartner,
+		},
+		RouteDeleteCarBlackout: {
+			Path:        "/car/blackout",
+			Method:      http.MethodDelete,
+			Handler:     s.HandleDeleteCarBlackout,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminPartner,
+		},
+		RouteGetCarBlackouts: {
+			Path:        "/car/blackouts",
+			Method:      http.MethodGet,
+			Handler:     s.HandleGetCarBlackouts,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdminPartner,
+		},
 		RouteGetNotificationHistory: {
 			Path:        "/notifications",
 			Method:      http.MethodGet,
@@ -719,6 +1066,31 @@ func (s *Server) AllRoutes() map[string]RouteInfo {
 			Handler:     s.HandleCheckPaymentStatus,
 			RequireAuth: false,
 		},
+		RouteRenewAccessToken: {
+			Path:        "/renew_access_token",
+			Method:      http.MethodPost,
+			Handler:     s.HandleRenewAccessToken,
+			RequireAuth: false,
+		},
+		RouteLogout: {
+			Path:        "/logout",
+			Method:      http.MethodPost,
+			Handler:     s.HandleLogout,
+			RequireAuth: true,
+		},
+		RouteLogoutAllDevices: {
+			Path:        "/logout_all_devices",
+			Method:      http.MethodPost,
+			Handler:     s.HandleLogoutAllDevices,
+			RequireAuth: true,
+		},
+		RouteAdminTerminateAccountSessions: {
+			Path:        "/admin/account/terminate_sessions",
+			Method:      http.MethodPut,
+			Handler:     s.HandleAdminTerminateAccountSessions,
+			RequireAuth: true,
+			AuthRoles:   AuthRoleAdmin,
+		},
 
 		// Temporary API
 		"set_admin_return_url": {
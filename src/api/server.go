@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
 
@@ -34,7 +36,7 @@ type Server struct {
 	hashVerifier            *misc.HashVerifier
 	otpService              *service.OTPService
 	pdfService              service.IPDFService
-	PaymentService          IPaymentService
+	PaymentGateways         *PaymentGatewayRegistry
 	notificationPushService service.INotificationPushService
 
 	redisClient *redis.Client
@@ -43,11 +45,20 @@ type Server struct {
 	chatRooms    sync.Map
 
 	wsConnections sync.Map
+	wsSubsMu      sync.Mutex
 
 	adminNotificationQueue      chan NotificationMsg
 	technicianNotificationQueue chan NotificationMsg
 	adminNewConversationQueue   chan ConversationMsg
 	partnerApprovalQueue        chan int
+	overtimeChargeQueue         chan *service.OvertimeCharge
+
+	contractStateMachine    *service.CustomerContractStateMachine
+	cancellationEngine      *service.CancellationEngine
+	partnerSettlement       *service.PartnerSettlementService
+	ledger                  *service.Ledger
+	invoiceService          *service.InvoiceService
+	contractTemplateService *service.ContractTemplateService
 }
 
 func NewServer(
@@ -58,13 +69,14 @@ func NewServer(
 	otpService *service.OTPService,
 	bankMetadata []string,
 	pdfService service.IPDFService,
-	paymentService IPaymentService,
+	paymentGateways *PaymentGatewayRegistry,
 	notificationPushService service.INotificationPushService,
 	redisClient *redis.Client,
 	partnerApprovalQueue chan int,
+	overtimeChargeQueue chan *service.OvertimeCharge,
 ) *Server {
 	route := gin.New()
-	tokenMaker, err := token.NewJWTMaker("12345678901234567890123456789012")
+	tokenMaker, err := newTokenMaker(cfg.Token)
 	if err != nil {
 		panic(err)
 	}
@@ -77,6 +89,7 @@ func NewServer(
 		}
 	}
 
+	contractStateMachine := service.NewCustomerContractStateMachine(store)
 	server := &Server{
 		cfg,
 		feCfg,
@@ -87,24 +100,84 @@ func NewServer(
 		misc.NewHashVerifier(),
 		otpService,
 		pdfService,
-		paymentService,
+		paymentGateways,
 		notificationPushService,
 		redisClient,
 		bankMetadata,
 		sync.Map{},
 		sync.Map{},
+		sync.Mutex{},
 		make(chan NotificationMsg, ChanBufferSize),
 		make(chan NotificationMsg, ChanBufferSize),
 		make(chan ConversationMsg, ChanBufferSize),
 		partnerApprovalQueue,
+		overtimeChargeQueue,
+		contractStateMachine,
+		service.NewCancellationEngine(store, contractStateMachine),
+		service.NewPartnerSettlementService(store),
+		service.NewLedger(store),
+		service.NewInvoiceService(cfg.Invoice, store),
+		service.NewContractTemplateService(store),
 	}
+	server.contractStateMachine.OnEnter(model.CustomerContractStatusCancel, server.refundCanceledContract)
+	server.contractStateMachine.OnEnter(model.CustomerContractStatusCancel, server.notifyCanceledDeliveries)
 	server.setUp()
 	return server
 }
 
+func newTokenMaker(cfg *misc.TokenConfig) (token.Maker, error) {
+	if cfg == nil || len(cfg.Keys) == 0 {
+		return nil, errors.New("missing api_server.token keys config")
+	}
+
+	keys := make([]*token.Key, 0, len(cfg.Keys))
+	for _, keyCfg := range cfg.Keys {
+		if keyCfg.Algorithm == token.AlgorithmHS256 {
+			key, err := token.NewHMACKey(keyCfg.ID, keyCfg.Secret)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			continue
+		}
+
+		var privatePEM, publicPEM []byte
+		var err error
+		if keyCfg.PrivateKeyPath != "" {
+			if privatePEM, err = os.ReadFile(keyCfg.PrivateKeyPath); err != nil {
+				return nil, err
+			}
+		}
+		if keyCfg.PublicKeyPath != "" {
+			if publicPEM, err = os.ReadFile(keyCfg.PublicKeyPath); err != nil {
+				return nil, err
+			}
+		}
+
+		key, err := token.NewAsymmetricKey(keyCfg.ID, keyCfg.Algorithm, privatePEM, publicPEM)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return token.NewJWTMakerWithKeys(cfg.SigningKeyID, keys)
+}
+
+// ContractStateMachine returns the state machine with the hooks of the server registered, background
+// jobs transit contracts through it
+func (s *Server) ContractStateMachine() *service.CustomerContractStateMachine {
+	return s.contractStateMachine
+}
+
+func (s *Server) CancellationEngine() *service.CancellationEngine {
+	return s.cancellationEngine
+}
+
 func (s *Server) Run() error {
 	fmt.Printf("API server running at port: %s\n", s.cfg.ApiPort)
 	s.startAdminAndTechSub()
+	s.startOvertimeChargeSub()
 
 	return s.route.Run(fmt.Sprintf("%s:%s", DefaultHost, s.cfg.ApiPort))
 }
@@ -119,11 +192,11 @@ func (s *Server) registerMiddleware() {
 }
 
 func (s *Server) registerHandlers() {
-	authGroup := s.route.Group("/").Use(authMiddleware(s.tokenMaker), s.activeAccountMiddleware())
-	adminGroup := s.route.Group("/admin").Use(authMiddleware(s.tokenMaker), s.activeAccountMiddleware(), s.authRole(model.RoleNameAdmin))
-	partnerGroup := s.route.Group("/partner").Use(authMiddleware(s.tokenMaker), s.activeAccountMiddleware(), s.authRole(model.RoleNamePartner))
-	customerGroup := s.route.Group("/customer").Use(authMiddleware(s.tokenMaker), s.activeAccountMiddleware(), s.authRole(model.RoleNameCustomer))
-	technicianGroup := s.route.Group("/technician").Use(authMiddleware(s.tokenMaker), s.activeAccountMiddleware(), s.authRole(model.RoleNameTechnician))
+	authGroup := s.route.Group("/").Use(s.authMiddleware(), s.activeAccountMiddleware())
+	adminGroup := s.route.Group("/admin").Use(s.authMiddleware(), s.activeAccountMiddleware(), s.authRole(model.RoleNameAdmin))
+	partnerGroup := s.route.Group("/partner").Use(s.authMiddleware(), s.activeAccountMiddleware(), s.authRole(model.RoleNamePartner))
+	customerGroup := s.route.Group("/customer").Use(s.authMiddleware(), s.activeAccountMiddleware(), s.authRole(model.RoleNameCustomer))
+	technicianGroup := s.route.Group("/technician").Use(s.authMiddleware(), s.activeAccountMiddleware(), s.authRole(model.RoleNameTechnician))
 	for _, r := range s.AllRoutes() {
 		if !r.RequireAuth {
 			s.route.Handle(r.Method, r.Path, r.Handler)
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/store"
+	"github.com/godev111222333/capstone-backend/src/token"
+)
+
+const RevokedTokenCacheKey = "revoked_token"
+
+type tokenPairResponse struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// revokeAccessToken puts the token ID into the revocation list until the token expires by itself
+func (s *Server) revokeAccessToken(tokenID uuid.UUID, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if statusCmd := s.redisClient.Set(
+		context.Background(),
+		fmt.Sprintf("%s__%s", RevokedTokenCacheKey, tokenID.String()),
+		"1",
+		ttl,
+	); statusCmd.Err() != nil {
+		fmt.Printf("revokeAccessToken %v\n", statusCmd.Err())
+		return statusCmd.Err()
+	}
+
+	return nil
+}
+
+func (s *Server) isTokenRevoked(tokenID uuid.UUID) (bool, error) {
+	_, err := s.redisClient.Get(
+		context.Background(),
+		fmt.Sprintf("%s__%s", RevokedTokenCacheKey, tokenID.String()),
+	).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *Server) revokeSessions(sessions []*model.Session) error {
+	for _, session := range sessions {
+		if err := s.revokeAccessToken(session.AccessTokenID, session.AccessTokenExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newSession issues an access and refresh token pair and records the refresh token as a session.
+// familyID is uuid.Nil for a fresh login.
+func (s *Server) newSession(c *gin.Context, acct *model.Account, familyID uuid.UUID) (*tokenPairResponse, *model.Session, error) {
+	accessToken, accessPayload, err := s.tokenMaker.CreateToken(acct.PhoneNumber, acct.Role.RoleName, s.cfg.AccessTokenDuration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, refreshPayload, err := s.tokenMaker.CreateRefreshToken(acct.PhoneNumber, acct.Role.RoleName, s.cfg.RefreshTokenDuration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if familyID == uuid.Nil {
+		familyID = refreshPayload.ID
+	}
+
+	session := &model.Session{
+		ID:                   refreshPayload.ID,
+		FamilyID:             familyID,
+		AccountID:            acct.ID,
+		AccessTokenID:        accessPayload.ID,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+		UserAgent:            c.Request.UserAgent(),
+		ClientIP:             c.ClientIP(),
+		Status:               model.SessionStatusActive,
+		ExpiresAt:            refreshPayload.ExpiredAt,
+	}
+
+	return &tokenPairResponse{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiredAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
+	}, session, nil
+}
+
+type renewAccessTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func (s *Server) HandleRenewAccessToken(c *gin.Context) {
+	req := renewAccessTokenRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidRenewAccessTokenRequest, err)
+		return
+	}
+
+	payload, err := s.tokenMaker.VerifyToken(req.RefreshToken)
+	if err != nil {
+		responseCustomErr(c, ErrCodeInvalidRefreshToken, err)
+		return
+	}
+
+	if !payload.IsRefreshToken() {
+		responseCustomErr(c, ErrCodeInvalidRefreshToken, nil)
+		return
+	}
+
+	session, err := s.store.SessionStore.GetByID(payload.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseCustomErr(c, ErrCodeInvalidRefreshToken, nil)
+			return
+		}
+		responseGormErr(c, err)
+		return
+	}
+
+	if session.Status == model.SessionStatusRevoked {
+		responseCustomErr(c, ErrCodeInvalidRefreshToken, nil)
+		return
+	}
+
+	if session.Status == model.SessionStatusRotated {
+		s.terminateSessionFamily(c, session.FamilyID)
+		return
+	}
+
+	acct, err := s.store.AccountStore.GetByID(session.AccountID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if acct.Status != model.AccountStatusActive || acct.PhoneNumber != payload.PhoneNumber {
+		responseCustomErr(c, ErrCodeAccountNotActive, nil)
+		return
+	}
+
+	resp, nextSession, err := s.newSession(c, acct, session.FamilyID)
+	if err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	if err := s.store.SessionStore.Rotate(session.ID, nextSession); err != nil {
+		if errors.Is(err, store.ErrSessionAlreadyRotated) {
+			// Lost the race against another renewal with the same refresh token
+			s.terminateSessionFamily(c, session.FamilyID)
+			return
+		}
+		responseGormErr(c, err)
+		return
+	}
+
+	if err := s.revokeAccessToken(session.AccessTokenID, session.AccessTokenExpiresAt); err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	responseSuccess(c, resp)
+}
+
+// terminateSessionFamily is called when a rotated refresh token is presented again. The token
+// was stolen or replayed, so every session rotated from the same login is revoked.
+func (s *Server) terminateSessionFamily(c *gin.Context, familyID uuid.UUID) {
+	sessions, err := s.store.SessionStore.GetActiveByFamilyID(familyID)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if err := s.store.SessionStore.RevokeFamily(familyID); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if err := s.revokeSessions(sessions); err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	responseCustomErr(c, ErrCodeRefreshTokenReused, nil)
+}
+
+func (s *Server) HandleLogout(c *gin.Context) {
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	if err := s.revokeAccessToken(authPayload.ID, authPayload.ExpiredAt); err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	session, err := s.store.SessionStore.GetByAccessTokenID(authPayload.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		responseGormErr(c, err)
+		return
+	}
+
+	if session != nil {
+		if err := s.store.SessionStore.Revoke(session.ID); err != nil {
+			responseGormErr(c, err)
+			return
+		}
+	}
+
+	responseSuccess(c, gin.H{"status": "logout successfully"})
+}
+
+func (s *Server) HandleLogoutAllDevices(c *gin.Context) {
+	authPayload := c.MustGet(authorizationPayloadKey).(*token.Payload)
+	acct, err := s.store.AccountStore.GetByPhoneNumber(authPayload.PhoneNumber)
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if err := s.terminateAccountSessions(acct.ID); err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	// The current token may come from before sessions were tracked
+	if err := s.revokeAccessToken(authPayload.ID, authPayload.ExpiredAt); err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	responseSuccess(c, gin.H{"status": "logout all devices successfully"})
+}
+
+type adminTerminateAccountSessionsRequest struct {
+	AccountID int `json:"account_id" binding:"required"`
+}
+
+func (s *Server) HandleAdminTerminateAccountSessions(c *gin.Context) {
+	req := adminTerminateAccountSessionsRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		responseCustomErr(c, ErrCodeInvalidTerminateAccountSessionsRequest, err)
+		return
+	}
+
+	if _, err := s.store.AccountStore.GetByID(req.AccountID); err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
+	if err := s.terminateAccountSessions(req.AccountID); err != nil {
+		responseInternalServerError(c, err)
+		return
+	}
+
+	responseSuccess(c, gin.H{"status": "terminate account sessions successfully"})
+}
+
+func (s *Server) terminateAccountSessions(acctID int) error {
+	sessions, err := s.store.SessionStore.GetActiveByAccountID(acctID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.SessionStore.RevokeByAccountID(acctID); err != nil {
+		return err
+	}
+
+	return s.revokeSessions(sessions)
+}
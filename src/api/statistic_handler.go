@@ -28,12 +28,13 @@ type RevenueResponse struct {
 }
 
 type StatisticResponse struct {
-	TotalCustomerContracts int                      `json:"total_customer_contracts"`
-	TotalActivePartners    int                      `json:"total_active_partners"`
-	TotalActiveCustomers   int                      `json:"total_active_customers"`
-	Revenue                RevenueResponse          `json:"revenue"`
-	RentedCars             []*store.RentedCar       `json:"rented_cars,omitempty"`
-	ParkingLot             map[model.ParkingLot]int `json:"parking_lot"`
+	TotalCustomerContracts int                        `json:"total_customer_contracts"`
+	TotalActivePartners    int                        `json:"total_active_partners"`
+	TotalActiveCustomers   int                        `json:"total_active_customers"`
+	Revenue                RevenueResponse            `json:"revenue"`
+	RentedCars             []*store.RentedCar         `json:"rented_cars,omitempty"`
+	ParkingLot             map[model.ParkingLot]int   `json:"parking_lot"`
+	Garages                []*getGarageConfigResponse `json:"garages"`
 }
 
 func (s *Server) HandleAdminGetStatistic(c *gin.Context) {
@@ -110,6 +111,12 @@ func (s *Server) HandleAdminGetStatistic(c *gin.Context) {
 	}
 	parkingLots[model.ParkingLotHome] = homeCounter
 
+	garages, err := s.garageOccupancies()
+	if err != nil {
+		responseGormErr(c, err)
+		return
+	}
+
 	responseSuccess(c, StatisticResponse{
 		TotalCustomerContracts: totalCustomerContracts,
 		TotalActivePartners:    totalActivePartners,
@@ -117,6 +124,7 @@ func (s *Server) HandleAdminGetStatistic(c *gin.Context) {
 		Revenue:                RevenueResponse{Records: revenueRecords, TotalRevenue: totalRevenue},
 		RentedCars:             rentedCars,
 		ParkingLot:             parkingLots,
+		Garages:                garages,
 	})
 }
 
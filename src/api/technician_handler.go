@@ -4,7 +4,10 @@ import (
 	"fmt"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
 	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/service"
 )
 
 type AppraisingCarAction string
@@ -17,6 +20,10 @@ const (
 type techAppraisingCar struct {
 	CustomerContractID int                 `json:"customer_contract_id"`
 	Action             AppraisingCarAction `json:"action"`
+	// FuelPercent is the fuel or battery level and Odometer the km reading of the car at pickup
+	FuelPercent *int               `json:"fuel_percent" binding:"omitempty,min=0,max=100"`
+	Odometer    *int               `json:"odometer" binding:"omitempty,min=0"`
+	Inspection  *inspectionRequest `json:"inspection"`
 }
 
 func (s *Server) HandleTechnicianAppraisingCarOfCusContract(c *gin.Context) {
@@ -32,33 +39,60 @@ func (s *Server) HandleTechnicianAppraisingCarOfCusContract(c *gin.Context) {
 		return
 	}
 
-	if contract.Status != model.CustomerContractStatusOrdered {
-		responseCustomErr(c,
-			ErrCodeInvalidCustomerContractStatus,
-			fmt.Errorf("customer contract status require %s, found %s", model.CustomerContractStatusOrdered, contract.Status))
-		return
-	}
-
 	nextStatus := model.CustomerContractStatusAppraisingCarApproved
 	if req.Action == AppraisingCarActionReject {
 		nextStatus = model.CustomerContractStatusAppraisingCarRejected
 	}
 
-	if err := s.store.CustomerContractStore.Update(req.CustomerContractID, map[string]interface{}{
-		"status": string(nextStatus),
+	values := map[string]interface{}{}
+	if req.FuelPercent != nil {
+		values["pickup_fuel_percent"] = *req.FuelPercent
+	}
+	if req.Odometer != nil {
+		values["pickup_odometer"] = *req.Odometer
+	}
+
+	actor := s.contractActor(c)
+	transition := &service.CustomerContractTransition{
+		CustomerContractID: contract.ID,
+		From:               []model.CustomerContractStatus{model.CustomerContractStatusOrdered},
+		To:                 nextStatus,
+		Actor:              actor,
+		Reason:             fmt.Sprintf("technician appraising car %s", req.Action),
+		Values:             values,
+	}
+	var appraised *model.CustomerContract
+	if err := s.store.DB.Transaction(func(tx *gorm.DB) error {
+		appraised, err = s.contractStateMachine.TransitTx(tx, transition)
+		if err != nil || req.Inspection == nil {
+			return err
+		}
+
+		return s.contractStateMachine.InspectTx(
+			tx,
+			newCustomerContractInspection(req.Inspection, contract.ID, model.InspectionStagePickup, actor.AccountID),
+		)
 	}); err != nil {
-		responseGormErr(c, err)
+		responseInspectionErr(c, err)
 		return
 	}
 
+	s.contractStateMachine.AfterCommit(appraised, transition)
 	responseSuccess(c, gin.H{"status": "appraising car successfully"})
 }
 
 type techAppraisingReturnCar struct {
 	CustomerContractID int    `json:"customer_contract_id"`
 	Note               string `json:"note"`
+	// FuelPercent is the fuel or battery level and Odometer the km reading of the car at return
+	FuelPercent *int                            `json:"fuel_percent" binding:"omitempty,min=0,max=100"`
+	Odometer    *int                            `json:"odometer" binding:"omitempty,min=0"`
+	Inspection  *inspectionRequest              `json:"inspection"`
+	Charges     []customerContractChargeRequest `json:"charges" binding:"dive"`
 }
 
+// HandleTechnicianAppraisingReturnCar records the state of a returned car. Every finding, like a
+// damage or missing fuel, becomes a charge taken from the cash collateral or paid by the customer.
 func (s *Server) HandleTechnicianAppraisingReturnCar(c *gin.Context) {
 	req := techAppraisingReturnCar{}
 	if err := c.BindJSON(&req); err != nil {
@@ -72,18 +106,47 @@ func (s *Server) HandleTechnicianAppraisingReturnCar(c *gin.Context) {
 		return
 	}
 
-	if contract.Status != model.CustomerContractStatusReturnedCar {
-		responseCustomErr(c, ErrCodeInvalidCustomerContractStatus, fmt.Errorf("customer contract status required %s, found %s", model.CustomerContractStatusReturnedCar, contract.Status))
-		return
+	values := map[string]interface{}{"technician_appraising_note": req.Note}
+	if req.FuelPercent != nil {
+		values["return_fuel_percent"] = *req.FuelPercent
+	}
+	if req.Odometer != nil {
+		values["return_odometer"] = *req.Odometer
 	}
 
-	if err := s.store.CustomerContractStore.Update(contract.ID, map[string]interface{}{
-		"technician_appraising_note": req.Note,
-		"status":                     string(model.CustomerContractStatusAppraisedReturnCar),
+	actor := s.contractActor(c)
+	transition := &service.CustomerContractTransition{
+		CustomerContractID: contract.ID,
+		From:               []model.CustomerContractStatus{model.CustomerContractStatusReturnedCar},
+		To:                 model.CustomerContractStatusAppraisedReturnCar,
+		Actor:              actor,
+		Reason:             req.Note,
+		Values:             values,
+	}
+	charges := newCustomerContractCharges(req.Charges, actor.AccountID)
+	var appraised *model.CustomerContract
+	if err := s.store.DB.Transaction(func(tx *gorm.DB) error {
+		appraised, err = s.contractStateMachine.TransitTx(tx, transition)
+		if err != nil {
+			return err
+		}
+
+		if req.Inspection != nil {
+			if err := s.contractStateMachine.InspectTx(
+				tx,
+				newCustomerContractInspection(req.Inspection, contract.ID, model.InspectionStageReturn, actor.AccountID),
+			); err != nil {
+				return err
+			}
+		}
+
+		return s.contractStateMachine.ChargeTx(tx, contract.ID, charges)
 	}); err != nil {
-		responseGormErr(c, err)
+		responseInspectionErr(c, err)
 		return
 	}
 
-	responseSuccess(c, gin.H{"status": "appraise return car successfully"})
+	s.contractStateMachine.AfterCommit(appraised, transition)
+	s.notifyCustomerOfCharges(contract.ID, charges)
+	responseSuccess(c, gin.H{"status": "appraise return car successfully", "charges": charges})
 }
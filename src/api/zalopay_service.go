@@ -0,0 +1,313 @@
+package api
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+var _ IPaymentService = (*ZaloPayService)(nil)
+
+const (
+	zaloPayReturnCodeSuccess    = 1
+	zaloPayReturnCodeProcessing = 3
+)
+
+// zaloPayLocation is the timezone of the yymmdd prefix ZaloPay requires in app_trans_id
+var zaloPayLocation = time.FixedZone("ICT", 7*60*60)
+
+type ZaloPayService struct {
+	cfg    *misc.ZaloPayConfig
+	client *http.Client
+}
+
+func NewZaloPayService(cfg *misc.ZaloPayConfig) *ZaloPayService {
+	return &ZaloPayService{cfg: cfg, client: &http.Client{Timeout: paymentGatewayTimeout}}
+}
+
+func (s *ZaloPayService) Gateway() model.PaymentGateway {
+	return model.PaymentGatewayZaloPay
+}
+
+// appTransID prefixes TxnRef with the order date, as ZaloPay requires
+func (s *ZaloPayService) appTransID(order *PaymentOrder) string {
+	return fmt.Sprintf("%s_%s", order.CreatedAt.In(zaloPayLocation).Format("060102"), order.TxnRef)
+}
+
+func txnRefFromAppTransID(appTransID string) string {
+	_, txnRef, found := strings.Cut(appTransID, "_")
+	if !found {
+		return appTransID
+	}
+
+	return txnRef
+}
+
+type zaloPayEmbedData struct {
+	RedirectURL string `json:"redirecturl"`
+	OrderInfo   string `json:"order_info"`
+}
+
+type zaloPayCreateRequest struct {
+	AppID       int    `json:"app_id"`
+	AppUser     string `json:"app_user"`
+	AppTransID  string `json:"app_trans_id"`
+	AppTime     int64  `json:"app_time"`
+	Amount      int64  `json:"amount"`
+	Item        string `json:"item"`
+	EmbedData   string `json:"embed_data"`
+	Description string `json:"description"`
+	BankCode    string `json:"bank_code"`
+	CallbackURL string `json:"callback_url"`
+	Mac         string `json:"mac"`
+}
+
+type zaloPayCreateResponse struct {
+	ReturnCode    int    `json:"return_code"`
+	ReturnMessage string `json:"return_message"`
+	OrderURL      string `json:"order_url"`
+}
+
+func (s *ZaloPayService) GeneratePaymentURL(order *PaymentOrder) (string, error) {
+	orderInfo := encodeOrderInfo(order.PaymentIDs)
+	embedData, err := json.Marshal(zaloPayEmbedData{RedirectURL: order.ReturnURL, OrderInfo: orderInfo})
+	if err != nil {
+		return "", err
+	}
+
+	req := zaloPayCreateRequest{
+		AppID:       s.cfg.AppID,
+		AppUser:     "mrent",
+		AppTransID:  s.appTransID(order),
+		AppTime:     order.CreatedAt.UnixMilli(),
+		Amount:      int64(order.Amount),
+		Item:        "[]",
+		EmbedData:   string(embedData),
+		Description: fmt.Sprintf("MRent - payment %s", orderInfo),
+		CallbackURL: s.cfg.CallbackURL,
+	}
+	req.Mac = hmacSHA256(s.cfg.Key1, fmt.Sprintf("%d|%s|%s|%d|%d|%s|%s",
+		req.AppID, req.AppTransID, req.AppUser, req.Amount, req.AppTime, req.EmbedData, req.Item))
+
+	resp := zaloPayCreateResponse{}
+	if err := postJSON(s.client, s.cfg.Endpoint+"/v2/create", req, &resp); err != nil {
+		return "", err
+	}
+
+	if resp.ReturnCode != zaloPayReturnCodeSuccess {
+		return "", fmt.Errorf("zalopay create order return code %d: %s", resp.ReturnCode, resp.ReturnMessage)
+	}
+
+	return resp.OrderURL, nil
+}
+
+type zaloPayCallbackRequest struct {
+	Data string `json:"data"`
+	Mac  string `json:"mac"`
+	Type int    `json:"type"`
+}
+
+type zaloPayCallbackData struct {
+	AppID      int    `json:"app_id"`
+	AppTransID string `json:"app_trans_id"`
+	Amount     int64  `json:"amount"`
+	EmbedData  string `json:"embed_data"`
+	ZpTransID  int64  `json:"zp_trans_id"`
+	ServerTime int64  `json:"server_time"`
+	Channel    int    `json:"channel"`
+}
+
+// VerifyCallback checks the mac of the callback data with key2. ZaloPay only calls back
+// for successful payments.
+func (s *ZaloPayService) VerifyCallback(r *http.Request) (*PaymentResult, error) {
+	req := zaloPayCallbackRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(strings.ToLower(req.Mac)), []byte(hmacSHA256(s.cfg.Key2, req.Data))) {
+		return nil, ErrInvalidPaymentSignature
+	}
+
+	data := zaloPayCallbackData{}
+	if err := json.Unmarshal([]byte(req.Data), &data); err != nil {
+		return nil, err
+	}
+
+	embedData := zaloPayEmbedData{}
+	if err := json.Unmarshal([]byte(data.EmbedData), &embedData); err != nil {
+		return nil, err
+	}
+
+	return &PaymentResult{
+		Gateway:       model.PaymentGatewayZaloPay,
+		TransactionNo: strconv.FormatInt(data.ZpTransID, 10),
+		TxnRef:        txnRefFromAppTransID(data.AppTransID),
+		OrderInfo:     embedData.OrderInfo,
+		Amount:        int(data.Amount),
+		ResponseCode:  strconv.Itoa(zaloPayReturnCodeSuccess),
+		BankCode:      strconv.Itoa(data.Channel),
+		PayDate:       time.UnixMilli(data.ServerTime).Format(layoutyyyyMMddHHmmss),
+		Succeeded:     true,
+	}, nil
+}
+
+type zaloPayQueryRequest struct {
+	AppID      int    `json:"app_id"`
+	AppTransID string `json:"app_trans_id"`
+	Mac        string `json:"mac"`
+}
+
+type zaloPayQueryResponse struct {
+	ReturnCode    int    `json:"return_code"`
+	ReturnMessage string `json:"return_message"`
+	IsProcessing  bool   `json:"is_processing"`
+	Amount        int64  `json:"amount"`
+	ZpTransID     int64  `json:"zp_trans_id"`
+	ServerTime    int64  `json:"server_time"`
+}
+
+func (s *ZaloPayService) QueryStatus(order *PaymentOrder) (*PaymentResult, error) {
+	req := zaloPayQueryRequest{
+		AppID:      s.cfg.AppID,
+		AppTransID: s.appTransID(order),
+	}
+	req.Mac = hmacSHA256(s.cfg.Key1, fmt.Sprintf("%d|%s|%s", req.AppID, req.AppTransID, s.cfg.Key1))
+
+	resp := zaloPayQueryResponse{}
+	if err := postJSON(s.client, s.cfg.Endpoint+"/v2/query", req, &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.ReturnCode == zaloPayReturnCodeProcessing || resp.IsProcessing {
+		return nil, errPaymentPending
+	}
+
+	return &PaymentResult{
+		Gateway:       model.PaymentGatewayZaloPay,
+		TransactionNo: strconv.FormatInt(resp.ZpTransID, 10),
+		TxnRef:        order.TxnRef,
+		OrderInfo:     encodeOrderInfo(order.PaymentIDs),
+		Amount:        int(resp.Amount),
+		ResponseCode:  strconv.Itoa(resp.ReturnCode),
+		PayDate:       time.UnixMilli(resp.ServerTime).Format(layoutyyyyMMddHHmmss),
+		Succeeded:     resp.ReturnCode == zaloPayReturnCodeSuccess,
+	}, nil
+}
+
+type zaloPayRefundRequest struct {
+	AppID       int    `json:"app_id"`
+	MRefundID   string `json:"m_refund_id"`
+	ZpTransID   string `json:"zp_trans_id"`
+	Amount      int64  `json:"amount"`
+	Timestamp   int64  `json:"timestamp"`
+	Description string `json:"description"`
+	Mac         string `json:"mac"`
+}
+
+type zaloPayRefundResponse struct {
+	ReturnCode    int    `json:"return_code"`
+	ReturnMessage string `json:"return_message"`
+	RefundID      int64  `json:"refund_id"`
+}
+
+// mRefundID prefixes RefundRef with the refund date and app id, as ZaloPay requires
+func (s *ZaloPayService) mRefundID(order *RefundOrder) string {
+	return fmt.Sprintf("%s_%d_%s", order.CreatedAt.In(zaloPayLocation).Format("060102"), s.cfg.AppID, order.RefundRef)
+}
+
+// Refund refunds a ZaloPay transaction. A refund still processing at ZaloPay stays pending.
+func (s *ZaloPayService) Refund(order *RefundOrder) (*RefundResult, error) {
+	req := zaloPayRefundRequest{
+		AppID:       s.cfg.AppID,
+		MRefundID:   s.mRefundID(order),
+		ZpTransID:   order.Payment.ExternalTransactionID,
+		Amount:      int64(order.Amount),
+		Timestamp:   order.CreatedAt.UnixMilli(),
+		Description: order.Reason,
+	}
+	req.Mac = hmacSHA256(s.cfg.Key1, fmt.Sprintf("%d|%s|%d|%s|%d",
+		req.AppID, req.ZpTransID, req.Amount, req.Description, req.Timestamp))
+
+	resp := zaloPayRefundResponse{}
+	if err := postJSON(s.client, s.cfg.Endpoint+"/v2/refund", req, &resp); err != nil {
+		return nil, err
+	}
+
+	status := model.CustomerRefundStatusFailed
+	switch resp.ReturnCode {
+	case zaloPayReturnCodeSuccess:
+		status = model.CustomerRefundStatusSucceeded
+	case zaloPayReturnCodeProcessing:
+		status = model.CustomerRefundStatusPending
+	}
+
+	return &RefundResult{
+		ExternalRefundID: strconv.FormatInt(resp.RefundID, 10),
+		ResponseCode:     strconv.Itoa(resp.ReturnCode),
+		Message:          resp.ReturnMessage,
+		Status:           status,
+	}, nil
+}
+
+type zaloPayRefundQueryRequest struct {
+	AppID     int    `json:"app_id"`
+	MRefundID string `json:"m_refund_id"`
+	Timestamp int64  `json:"timestamp"`
+	Mac       string `json:"mac"`
+}
+
+func (s *ZaloPayService) QueryRefund(order *RefundOrder) (*RefundResult, error) {
+	req := zaloPayRefundQueryRequest{
+		AppID:     s.cfg.AppID,
+		MRefundID: s.mRefundID(order),
+		Timestamp: time.Now().UnixMilli(),
+	}
+	req.Mac = hmacSHA256(s.cfg.Key1, fmt.Sprintf("%d|%s|%d", req.AppID, req.MRefundID, req.Timestamp))
+
+	resp := zaloPayRefundResponse{}
+	if err := postJSON(s.client, s.cfg.Endpoint+"/v2/query_refund", req, &resp); err != nil {
+		return nil, err
+	}
+
+	status := model.CustomerRefundStatusFailed
+	switch resp.ReturnCode {
+	case zaloPayReturnCodeSuccess:
+		status = model.CustomerRefundStatusSucceeded
+	case zaloPayReturnCodeProcessing:
+		status = model.CustomerRefundStatusPending
+	}
+
+	return &RefundResult{
+		ExternalRefundID: strconv.FormatInt(resp.RefundID, 10),
+		ResponseCode:     strconv.Itoa(resp.ReturnCode),
+		Message:          resp.ReturnMessage,
+		Status:           status,
+	}, nil
+}
+
+// RespondCallback answers a callback. return_code 0 makes ZaloPay retry it later.
+func (s *ZaloPayService) RespondCallback(c *gin.Context, code PaymentCallbackCode) {
+	returnCode, message := -1, "invalid callback"
+	switch code {
+	case PaymentCallbackSuccess:
+		returnCode, message = 1, "success"
+	case PaymentCallbackAlreadyConfirmed:
+		returnCode, message = 2, "order already confirmed"
+	case PaymentCallbackUnknownError:
+		returnCode, message = 0, "unknown error"
+	case PaymentCallbackInvalidSignature:
+		message = "mac not equal"
+	}
+
+	c.JSON(http.StatusOK, gin.H{"return_code": returnCode, "return_message": message})
+}
@@ -41,18 +41,21 @@ func main() {
 		panic(err)
 	}
 
-	pdfService := service.NewPDFService(cfg.PDFService)
-	paymentService := api.NewVnPayService(cfg.VNPay)
+	pdfService, err := service.NewPDFServiceFromConfig(cfg.PDFService, dbStore, s3Store)
+	if err != nil {
+		panic(err)
+	}
+
+	paymentGateways := api.NewPaymentGatewayRegistry(api.NewVnPayService(cfg.VNPay))
+	if cfg.MoMo != nil {
+		paymentGateways.Register(api.NewMoMoService(cfg.MoMo))
+	}
+	if cfg.ZaloPay != nil {
+		paymentGateways.Register(api.NewZaloPayService(cfg.ZaloPay))
+	}
 	notificationPushService := service.NewNotificationPushService("", dbStore)
 	newPartnerApprovalQueue := make(chan int, api.ChanBufferSize)
-	backgroundJob := service.NewBackgroundService(cfg.BackgroundJob, dbStore, redisClient, newPartnerApprovalQueue)
-
-	go func() {
-		if err := backgroundJob.RunPartnerApprovalChecker(); err != nil {
-			panic(err)
-		}
-	}()
-
+	overtimeChargeQueue := make(chan *service.OvertimeCharge, api.ChanBufferSize)
 	server := api.NewServer(
 		cfg.ApiServer,
 		feCfg,
@@ -61,11 +64,31 @@ func main() {
 		otpService,
 		bankMetadata,
 		pdfService,
-		paymentService,
+		paymentGateways,
 		notificationPushService,
 		redisClient,
 		newPartnerApprovalQueue,
+		overtimeChargeQueue,
+	)
+	backgroundJob := service.NewBackgroundService(
+		cfg.BackgroundJob,
+		dbStore,
+		redisClient,
+		newPartnerApprovalQueue,
+		overtimeChargeQueue,
+		server.ContractStateMachine(),
+		server.CancellationEngine(),
 	)
+
+	go func() {
+		if err := backgroundJob.RunPartnerApprovalChecker(); err != nil {
+			panic(err)
+		}
+	}()
+	go backgroundJob.RunReservationExpiryChecker()
+	go backgroundJob.RunOverdueContractChecker()
+	go server.RunRefundReconciler(cfg.BackgroundJob.ReconcileRefundInterval)
+
 	go func() {
 		if err := server.Run(); err != nil {
 			panic(err)
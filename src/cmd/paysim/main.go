@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/godev111222333/capstone-backend/src/api"
+	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/paysim"
+)
+
+func main() {
+	cfg, err := misc.LoadConfig("config.yaml")
+	if err != nil {
+		panic(err)
+	}
+
+	port := flag.String("port", "8089", "port of the simulator")
+	ipnURL := flag.String(
+		"ipn_url",
+		fmt.Sprintf("http://localhost:%s/vnpay/ipn", cfg.ApiServer.ApiPort),
+		"IPN url of the API server",
+	)
+	flag.Parse()
+
+	simulator := paysim.NewSimulator(cfg.VNPay.HashSecret, *ipnURL)
+	fmt.Printf("VNPay simulator running at port: %s, sending IPN to %s\n", *port, *ipnURL)
+	fmt.Printf("set vn_pay.pay_url to http://localhost:%s%s to use it\n", *port, paysim.PayPath)
+
+	if err := http.ListenAndServe(fmt.Sprintf("%s:%s", api.DefaultHost, *port), simulator.Handler()); err != nil {
+		panic(err)
+	}
+}
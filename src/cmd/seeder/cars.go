@@ -75,9 +75,17 @@ func SeedCars(server *api.Server, dbStore *store.DbStore) error {
 		return err
 	}
 
+	garages, err := dbStore.GarageStore.GetAll()
+	if err != nil {
+		return err
+	}
+
 	dbCars := make([]*model.Car, len(cars))
 	for i, a := range cars {
 		dbCars[i] = a.ToDbCar()
+		if dbCars[i].ParkingLot == model.ParkingLotGarage && len(garages) > 0 {
+			dbCars[i].PickUpAt(garages[0])
+		}
 	}
 
 	if err := dbStore.CarStore.CreateBatch(dbCars); err != nil {
@@ -40,8 +40,12 @@ func main() {
 		panic(err)
 	}
 
-	pdfService := service.NewPDFService(cfg.PDFService)
-	paymentService := api.NewVnPayService(cfg.VNPay)
+	pdfService, err := service.NewPDFServiceFromConfig(cfg.PDFService, dbStore, s3Store)
+	if err != nil {
+		panic(err)
+	}
+
+	paymentGateways := api.NewPaymentGatewayRegistry(api.NewVnPayService(cfg.VNPay))
 	notificationPushService := service.NewNotificationPushService("", dbStore)
 
 	server := api.NewServer(
@@ -52,10 +56,11 @@ func main() {
 		otpService,
 		bankMetadata,
 		pdfService,
-		paymentService,
+		paymentGateways,
 		notificationPushService,
 		redisClient,
 		nil,
+		nil,
 	)
 
 	if err := seeder.SeedAccounts(dbStore); err != nil {
@@ -20,12 +20,19 @@ type CustomerContractRule struct {
 
 func (ccr *CustomerContractRule) ToCustomerContractRuleDB() *model.CustomerContractRule {
 	return &model.CustomerContractRule{
-		ID:                   ccr.ID,
-		InsurancePercent:     ccr.InsurancePercent,
-		PrepayPercent:        ccr.PrepayPercent,
-		CollateralCashAmount: ccr.CollateralCashAmount,
-		CreatedAt:            ccr.CreatedAt.Time,
-		UpdatedAt:            ccr.UpdatedAt.Time,
+		ID:                          ccr.ID,
+		InsurancePercent:            ccr.InsurancePercent,
+		PrepayPercent:               ccr.PrepayPercent,
+		CollateralCashAmount:        ccr.CollateralCashAmount,
+		CancellableStatuses:         model.JoinCustomerContractStatuses(model.DefaultCancellableStatuses),
+		PartnerCancelWarningPenalty: model.DefaultPartnerCancelWarningPenalty,
+		CancellationRefundTiers:     model.DefaultCancellationRefundTiers(),
+		DeliveryFeeTiers:            model.DefaultDeliveryFeeTiers(),
+		OvertimeFeeUnit:             model.DefaultOvertimeFeeUnit,
+		OvertimeFeePercent:          model.DefaultOvertimeFeePercent,
+		OvertimeGraceMinutes:        model.DefaultOvertimeGraceMinutes,
+		CreatedAt:                   ccr.CreatedAt.Time,
+		UpdatedAt:                   ccr.UpdatedAt.Time,
 	}
 }
 
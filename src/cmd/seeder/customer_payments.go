@@ -60,13 +60,25 @@ func SeedCustomerPayments(server *api.Server, dbStore *store.DbStore) error {
 	}
 
 	for i, payment := range cusPayments {
-		url, err := server.PaymentService.GeneratePaymentURL(
-			[]int{payment.ID}, payment.Amount, time.Now().Format("02150405"), payments[i].ReturnURL)
+		paymentService := server.PaymentGateways.Default()
+		order := &api.PaymentOrder{
+			PaymentIDs: []int{payment.ID},
+			Amount:     payment.Amount,
+			TxnRef:     time.Now().Format("02150405"),
+			ReturnURL:  payments[i].ReturnURL,
+			CreatedAt:  time.Now(),
+		}
+		url, err := paymentService.GeneratePaymentURL(order)
 		if err != nil {
 			return err
 		}
 
-		if err := dbStore.CustomerPaymentStore.Update(payment.ID, map[string]interface{}{"payment_url": url}); err != nil {
+		if err := dbStore.CustomerPaymentStore.Update(payment.ID, map[string]interface{}{
+			"payment_url":    url,
+			"gateway":        string(paymentService.Gateway()),
+			"txn_ref":        order.TxnRef,
+			"txn_created_at": order.CreatedAt,
+		}); err != nil {
 			return err
 		}
 	}
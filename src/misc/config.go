@@ -8,9 +8,38 @@ import (
 )
 
 type ApiServerConfig struct {
-	ApiPort              string        `yaml:"api_port"`
-	AccessTokenDuration  time.Duration `yaml:"access_token_duration"`
-	RefreshTokenDuration time.Duration `yaml:"refresh_token_duration"`
+	ApiPort              string         `yaml:"api_port"`
+	AccessTokenDuration  time.Duration  `yaml:"access_token_duration"`
+	RefreshTokenDuration time.Duration  `yaml:"refresh_token_duration"`
+	Token                *TokenConfig   `yaml:"token"`
+	ReservationHoldTTL   time.Duration  `yaml:"reservation_hold_ttl"`
+	Invoice              *InvoiceConfig `yaml:"invoice"`
+}
+
+// InvoiceConfig holds the company details printed on invoices and receipts and the VAT
+// percent included in the invoiced amounts
+type InvoiceConfig struct {
+	CompanyName string  `yaml:"company_name"`
+	TaxCode     string  `yaml:"tax_code"`
+	Address     string  `yaml:"address"`
+	Phone       string  `yaml:"phone"`
+	Email       string  `yaml:"email"`
+	VATPercent  float64 `yaml:"vat_percent"`
+}
+
+// TokenConfig lists the JWT keys. Only SigningKeyID signs new tokens, the others stay live for
+// verification during a key rotation.
+type TokenConfig struct {
+	SigningKeyID string            `yaml:"signing_key_id"`
+	Keys         []*TokenKeyConfig `yaml:"keys"`
+}
+
+type TokenKeyConfig struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"`
+	Secret         string `yaml:"secret"`
+	PrivateKeyPath string `yaml:"private_key_path"`
+	PublicKeyPath  string `yaml:"public_key_path"`
 }
 
 type DatabaseConfig struct {
@@ -42,14 +71,25 @@ type RedisConfig struct {
 	Password string `yaml:"password"`
 }
 
+const (
+	PDFRendererExternal = "external"
+	PDFRendererLocal    = "local"
+)
+
+// PDFServiceConfig selects how contracts are rendered. The external renderer posts them to Url,
+// the local one renders them in process from the contract templates admins publish.
 type PDFServiceConfig struct {
-	Url     string        `yaml:"url"`
-	Timeout time.Duration `yaml:"timeout"`
+	Url      string        `yaml:"url"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Renderer string        `yaml:"renderer"`
 }
 
 type BackgroundJobConfig struct {
 	MaxPartnerWaitingApprovalTime       time.Duration `yaml:"max_partner_waiting_approval_time"`
 	CheckWaitingPartnerApprovalInterval time.Duration `yaml:"check_waiting_partner_approval_interval"`
+	CheckExpiredReservationInterval     time.Duration `yaml:"check_expired_reservation_interval"`
+	CheckOverdueContractInterval        time.Duration `yaml:"check_overdue_contract_interval"`
+	ReconcileRefundInterval             time.Duration `yaml:"reconcile_refund_interval"`
 }
 
 type VNPayConfig struct {
@@ -61,6 +101,25 @@ type VNPayConfig struct {
 	Locale     string `yaml:"locale"`
 	IpnURL     string `yaml:"ipn_url"`
 	BankCode   string `yaml:"bank_code"`
+	ApiURL     string `yaml:"api_url"`
+}
+
+type MoMoConfig struct {
+	Endpoint    string `yaml:"endpoint"`
+	PartnerCode string `yaml:"partner_code"`
+	AccessKey   string `yaml:"access_key"`
+	SecretKey   string `yaml:"secret_key"`
+	IpnURL      string `yaml:"ipn_url"`
+	RequestType string `yaml:"request_type"`
+	Lang        string `yaml:"lang"`
+}
+
+type ZaloPayConfig struct {
+	Endpoint    string `yaml:"endpoint"`
+	AppID       int    `yaml:"app_id"`
+	Key1        string `yaml:"key1"`
+	Key2        string `yaml:"key2"`
+	CallbackURL string `yaml:"callback_url"`
 }
 
 type GlobalConfig struct {
@@ -70,6 +129,8 @@ type GlobalConfig struct {
 	OTP           *OTPConfig           `yaml:"otp"`
 	PDFService    *PDFServiceConfig    `yaml:"pdf_service"`
 	VNPay         *VNPayConfig         `yaml:"vn_pay"`
+	MoMo          *MoMoConfig          `yaml:"momo"`
+	ZaloPay       *ZaloPayConfig       `yaml:"zalo_pay"`
 	BackgroundJob *BackgroundJobConfig `yaml:"background_job"`
 	Redis         *RedisConfig         `yaml:"redis"`
 }
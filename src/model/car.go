@@ -42,31 +42,45 @@ const (
 )
 
 type Car struct {
-	ID                    int                   `json:"id"`
-	PartnerID             int                   `json:"partner_id"`
-	Account               *Account              `json:"account,omitempty" gorm:"foreignKey:PartnerID"`
-	CarModelID            int                   `json:"car_model_id"`
-	CarModel              CarModel              `json:"car_model,omitempty"`
-	LicensePlate          string                `json:"license_plate"`
-	ParkingLot            ParkingLot            `json:"parking_lot"`
-	Description           string                `json:"description"`
-	Fuel                  Fuel                  `json:"fuel"`
-	Motion                Motion                `json:"motion"`
-	Price                 int                   `json:"price"`
-	Status                CarStatus             `json:"status"`
-	PartnerContractRuleID int                   `json:"partner_contract_rule_id"`
-	PartnerContractRule   PartnerContractRule   `json:"partner_contract_rule" gorm:"foreignKey:PartnerContractRuleID"`
-	BankName              string                `json:"bank_name"`
-	BankNumber            string                `json:"bank_number"`
-	BankOwner             string                `json:"bank_owner"`
-	StartDate             time.Time             `json:"start_date"`
-	EndDate               time.Time             `json:"end_date"`
-	Period                int                   `json:"period"`
-	PartnerContractUrl    string                `json:"partner_contract_url"`
-	PartnerContractStatus PartnerContractStatus `json:"partner_contract_status"`
-	WarningCount          int                   `json:"warning_count"`
-	CreatedAt             time.Time             `json:"created_at"`
-	UpdatedAt             time.Time             `json:"updated_at"`
+	ID                             int                   `json:"id"`
+	PartnerID                      int                   `json:"partner_id"`
+	Account                        *Account              `json:"account,omitempty" gorm:"foreignKey:PartnerID"`
+	CarModelID                     int                   `json:"car_model_id"`
+	CarModel                       CarModel              `json:"car_model,omitempty"`
+	LicensePlate                   string                `json:"license_plate"`
+	ParkingLot                     ParkingLot            `json:"parking_lot"`
+	GarageID                       *int                  `json:"garage_id"`
+	Garage                         *Garage               `json:"garage,omitempty"`
+	PickupAddress                  string                `json:"pickup_address"`
+	Latitude                       *float64              `json:"latitude"`
+	Longitude                      *float64              `json:"longitude"`
+	Description                    string                `json:"description"`
+	Fuel                           Fuel                  `json:"fuel"`
+	Motion                         Motion                `json:"motion"`
+	Price                          int                   `json:"price"`
+	Status                         CarStatus             `json:"status"`
+	PartnerContractRuleID          int                   `json:"partner_contract_rule_id"`
+	PartnerContractRule            PartnerContractRule   `json:"partner_contract_rule" gorm:"foreignKey:PartnerContractRuleID"`
+	BankName                       string                `json:"bank_name"`
+	BankNumber                     string                `json:"bank_number"`
+	BankOwner                      string                `json:"bank_owner"`
+	StartDate                      time.Time             `json:"start_date"`
+	EndDate                        time.Time             `json:"end_date"`
+	Period                         int                   `json:"period"`
+	PartnerContractUrl             string                `json:"partner_contract_url"`
+	PartnerContractStatus          PartnerContractStatus `json:"partner_contract_status"`
+	PartnerContractTemplateVersion int                   `json:"partner_contract_template_version"`
+	WarningCount                   int                   `json:"warning_count"`
+	CreatedAt                      time.Time             `json:"created_at"`
+	UpdatedAt                      time.Time             `json:"updated_at"`
+}
+
+// PickUpAt moves the pickup point of the car to a garage
+func (c *Car) PickUpAt(g *Garage) {
+	c.GarageID = &g.ID
+	c.PickupAddress = g.Address
+	c.Latitude = g.Latitude
+	c.Longitude = g.Longitude
 }
 
 type PartnerContract struct {
@@ -79,6 +93,7 @@ type PartnerContract struct {
 	StartDate             time.Time             `json:"start_date"`
 	EndDate               time.Time             `json:"end_date"`
 	Url                   string                `json:"url"`
+	TemplateVersion       int                   `json:"template_version"`
 	Status                PartnerContractStatus `json:"status"`
 	CreatedAt             time.Time             `json:"created_at"`
 	UpdatedAt             time.Time             `json:"updated_at"`
@@ -95,6 +110,7 @@ func (c *Car) ToPartnerContract() *PartnerContract {
 		StartDate:             c.StartDate,
 		EndDate:               c.EndDate,
 		Url:                   c.PartnerContractUrl,
+		TemplateVersion:       c.PartnerContractTemplateVersion,
 		Status:                c.PartnerContractStatus,
 		CreatedAt:             c.CreatedAt,
 		UpdatedAt:             c.UpdatedAt,
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+type CarReservationStatus string
+
+const (
+	CarReservationStatusHold     CarReservationStatus = "hold"
+	CarReservationStatusBooked   CarReservationStatus = "booked"
+	CarReservationStatusBlocked  CarReservationStatus = "blocked"
+	CarReservationStatusReleased CarReservationStatus = "released"
+)
+
+// CarReservation blocks a car from StartDate to EndDate for a customer contract, or for the
+// partner when it is a blackout without a contract. Holds, bookings and blackouts of a car never
+// overlap, the database rejects them with an exclusion constraint. A hold lapses at ExpiresAt
+// unless it is turned into a booking first.
+type CarReservation struct {
+	ID                 int                  `json:"id"`
+	CarID              int                  `json:"car_id"`
+	CustomerContractID *int                 `json:"customer_contract_id"`
+	StartDate          time.Time            `json:"start_date"`
+	EndDate            time.Time            `json:"end_date"`
+	Status             CarReservationStatus `json:"status"`
+	ExpiresAt          *time.Time           `json:"expires_at"`
+	Note               string               `json:"note"`
+	CreatedAt          time.Time            `json:"created_at"`
+	UpdatedAt          time.Time            `json:"updated_at"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+type (
+	ContractTemplateType   string
+	ContractTemplateStatus string
+)
+
+const (
+	ContractTemplateTypeCustomer ContractTemplateType = "customer"
+	ContractTemplateTypePartner  ContractTemplateType = "partner"
+
+	ContractTemplateStatusDraft     ContractTemplateStatus = "draft"
+	ContractTemplateStatusPublished ContractTemplateStatus = "published"
+	ContractTemplateStatusRetired   ContractTemplateStatus = "retired"
+)
+
+// ContractTemplate is a version of the wording of a contract type. Body is a text/template over
+// the payload fields of the contract, a line starting with "# " is a heading. New contracts are
+// rendered with the published version of their type.
+type ContractTemplate struct {
+	ID          int                    `json:"id"`
+	Type        ContractTemplateType   `json:"type"`
+	Version     int                    `json:"version"`
+	Body        string                 `json:"body"`
+	Note        string                 `json:"note"`
+	Status      ContractTemplateStatus `json:"status"`
+	CreatedBy   *int                   `json:"created_by"`
+	PublishedAt *time.Time             `json:"published_at"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
@@ -32,29 +32,91 @@ const (
 )
 
 type CustomerContract struct {
-	ID                       int                    `json:"id"`
-	CustomerID               int                    `json:"customer_id"`
-	Customer                 *Account               `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
-	CarID                    int                    `json:"car_id"`
-	Car                      Car                    `json:"car"`
-	StartDate                time.Time              `json:"start_date"`
-	EndDate                  time.Time              `json:"end_date"`
-	Status                   CustomerContractStatus `json:"status"`
-	Reason                   string                 `json:"reason"`
-	RentPrice                int                    `json:"rent_price"`
-	InsuranceAmount          int                    `json:"insurance_amount"`
-	CollateralType           CollateralType         `json:"collateral_type"`
-	IsReturnCollateralAsset  bool                   `json:"is_return_collateral_asset"`
-	Url                      string                 `json:"url"`
-	BankName                 string                 `json:"bank_name"`
-	BankNumber               string                 `json:"bank_number"`
-	BankOwner                string                 `json:"bank_owner"`
-	CustomerContractRuleID   int                    `json:"customer_contract_rule_id"`
-	CustomerContractRule     CustomerContractRule   `gorm:"foreignKey:CustomerContractRuleID" json:"customer_contract_rule,omitempty"`
-	FeedbackContent          string                 `json:"feedback_content"`
-	FeedbackRating           int                    `json:"feedback_rating"`
-	FeedbackStatus           FeedBackStatus         `json:"feedback_status"`
-	TechnicianAppraisingNote string                 `json:"technician_appraising_note"`
-	CreatedAt                time.Time              `json:"created_at"`
-	UpdatedAt                time.Time              `json:"updated_at"`
+	ID                       int                         `json:"id"`
+	CustomerID               int                         `json:"customer_id"`
+	Customer                 *Account                    `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	CarID                    int                         `json:"car_id"`
+	Car                      Car                         `json:"car"`
+	StartDate                time.Time                   `json:"start_date"`
+	EndDate                  time.Time                   `json:"end_date"`
+	Status                   CustomerContractStatus      `json:"status"`
+	Reason                   string                      `json:"reason"`
+	RentPrice                int                         `json:"rent_price"`
+	InsuranceAmount          int                         `json:"insurance_amount"`
+	OvertimeFee              int                         `json:"overtime_fee"`
+	CollateralType           CollateralType              `json:"collateral_type"`
+	IsReturnCollateralAsset  bool                        `json:"is_return_collateral_asset"`
+	Url                      string                      `json:"url"`
+	TemplateVersion          int                         `json:"template_version"`
+	BankName                 string                      `json:"bank_name"`
+	BankNumber               string                      `json:"bank_number"`
+	BankOwner                string                      `json:"bank_owner"`
+	CustomerContractRuleID   int                         `json:"customer_contract_rule_id"`
+	CustomerContractRule     CustomerContractRule        `gorm:"foreignKey:CustomerContractRuleID" json:"customer_contract_rule,omitempty"`
+	FeedbackContent          string                      `json:"feedback_content"`
+	FeedbackRating           int                         `json:"feedback_rating"`
+	FeedbackStatus           FeedBackStatus              `json:"feedback_status"`
+	TechnicianAppraisingNote string                      `json:"technician_appraising_note"`
+	PickupFuelPercent        *int                        `json:"pickup_fuel_percent"`
+	PickupOdometer           *int                        `json:"pickup_odometer"`
+	ReturnFuelPercent        *int                        `json:"return_fuel_percent"`
+	ReturnOdometer           *int                        `json:"return_odometer"`
+	Deliveries               []*CustomerContractDelivery `gorm:"foreignKey:CustomerContractID" json:"deliveries,omitempty"`
+	Charges                  []*CustomerContractCharge   `gorm:"foreignKey:CustomerContractID" json:"charges,omitempty"`
+	CreatedAt                time.Time                   `json:"created_at"`
+	UpdatedAt                time.Time                   `json:"updated_at"`
+}
+
+// CustomerContractTransitions lists every legal status change of a customer contract
+var CustomerContractTransitions = map[CustomerContractStatus][]CustomerContractStatus{
+	CustomerContractStatusWaitingPartnerApproval: {
+		CustomerContractStatusWaitingContractAgreement,
+		CustomerContractStatusCancel,
+	},
+	CustomerContractStatusWaitingContractAgreement: {
+		CustomerContractStatusWaitingContractPayment,
+		CustomerContractStatusCancel,
+	},
+	CustomerContractStatusWaitingContractPayment: {
+		CustomerContractStatusOrdered,
+		CustomerContractStatusCancel,
+	},
+	CustomerContractStatusOrdered: {
+		// ordered -> ordered happens when admin changes the car
+		CustomerContractStatusOrdered,
+		CustomerContractStatusAppraisingCarApproved,
+		CustomerContractStatusAppraisingCarRejected,
+		CustomerContractStatusCancel,
+	},
+	CustomerContractStatusAppraisingCarApproved: {
+		CustomerContractStatusRenting,
+		CustomerContractStatusCancel,
+	},
+	CustomerContractStatusAppraisingCarRejected: {
+		CustomerContractStatusOrdered,
+		CustomerContractStatusCancel,
+	},
+	CustomerContractStatusRenting: {
+		CustomerContractStatusReturnedCar,
+		CustomerContractStatusPendingResolve,
+	},
+	CustomerContractStatusPendingResolve: {
+		CustomerContractStatusResolved,
+	},
+	CustomerContractStatusReturnedCar: {
+		CustomerContractStatusAppraisedReturnCar,
+	},
+	CustomerContractStatusAppraisedReturnCar: {
+		CustomerContractStatusCompleted,
+	},
+}
+
+func CanTransitCustomerContract(from, to CustomerContractStatus) bool {
+	for _, next := range CustomerContractTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+type CustomerContractChargeCategory string
+
+const (
+	CustomerContractChargeCategoryDamage      CustomerContractChargeCategory = "damage"
+	CustomerContractChargeCategoryFuel        CustomerContractChargeCategory = "fuel"
+	CustomerContractChargeCategoryMileage     CustomerContractChargeCategory = "mileage"
+	CustomerContractChargeCategoryTrafficFine CustomerContractChargeCategory = "traffic_fine"
+	CustomerContractChargeCategoryOther       CustomerContractChargeCategory = "other"
+)
+
+// CustomerContractCharge is a finding on a returned car charged to the customer, like a damage or a
+// traffic fine found later. CollateralAmount of it is deducted from the cash collateral and the
+// rest is charged with the CustomerPayment.
+type CustomerContractCharge struct {
+	ID                 int                            `json:"id"`
+	CustomerContractID int                            `json:"customer_contract_id"`
+	Category           CustomerContractChargeCategory `json:"category"`
+	Description        string                         `json:"description"`
+	Amount             int                            `json:"amount"`
+	ImageURLs          []string                       `json:"image_urls" gorm:"column:image_urls;serializer:json"`
+	CollateralAmount   int                            `json:"collateral_amount"`
+	CustomerPaymentID  *int                           `json:"customer_payment_id"`
+	CreatedBy          int                            `json:"created_by"`
+	CreatedAt          time.Time                      `json:"created_at"`
+	UpdatedAt          time.Time                      `json:"updated_at"`
+}
@@ -0,0 +1,68 @@
+package model
+
+import "time"
+
+type (
+	DeliveryType   string
+	DeliveryStatus string
+)
+
+const (
+	// DeliveryTypeDelivery brings the car to the customer when the contract starts
+	DeliveryTypeDelivery DeliveryType = "delivery"
+	// DeliveryTypeReturn collects the car from the customer when the contract ends
+	DeliveryTypeReturn DeliveryType = "return"
+
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusAssigned  DeliveryStatus = "assigned"
+	DeliveryStatusOnTheWay  DeliveryStatus = "on_the_way"
+	DeliveryStatusCompleted DeliveryStatus = "completed"
+	DeliveryStatusCanceled  DeliveryStatus = "canceled"
+)
+
+// CustomerContractDelivery is a delivery or return slot of a contract, driven by a technician
+// between the car's pickup point and the customer's address
+type CustomerContractDelivery struct {
+	ID                 int               `json:"id"`
+	CustomerContractID int               `json:"customer_contract_id"`
+	CustomerContract   *CustomerContract `json:"customer_contract,omitempty"`
+	Type               DeliveryType      `json:"type"`
+	Address            string            `json:"address"`
+	Latitude           float64           `json:"latitude"`
+	Longitude          float64           `json:"longitude"`
+	DistanceKm         float64           `json:"distance_km"`
+	Fee                int               `json:"fee"`
+	ScheduledAt        time.Time         `json:"scheduled_at"`
+	TechnicianID       *int              `json:"technician_id"`
+	Technician         *Account          `gorm:"foreignKey:TechnicianID" json:"technician,omitempty"`
+	Status             DeliveryStatus    `json:"status"`
+	CreatedAt          time.Time         `json:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+}
+
+// DeliveryTransitions lists every legal status change of a delivery
+var DeliveryTransitions = map[DeliveryStatus][]DeliveryStatus{
+	DeliveryStatusPending: {
+		DeliveryStatusAssigned,
+		DeliveryStatusCanceled,
+	},
+	DeliveryStatusAssigned: {
+		// assigned -> assigned happens when admin hands the slot to another technician
+		DeliveryStatusAssigned,
+		DeliveryStatusOnTheWay,
+		DeliveryStatusCanceled,
+	},
+	DeliveryStatusOnTheWay: {
+		DeliveryStatusCompleted,
+	},
+}
+
+func CanTransitDelivery(from, to DeliveryStatus) bool {
+	for _, next := range DeliveryTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+const CustomerContractEventActorSystem = "system"
+
+// CustomerContractEvent is one status transition of a customer contract
+type CustomerContractEvent struct {
+	ID                 int                    `json:"id"`
+	CustomerContractID int                    `json:"customer_contract_id"`
+	FromStatus         CustomerContractStatus `json:"from_status"`
+	ToStatus           CustomerContractStatus `json:"to_status"`
+	ActorID            *int                   `json:"actor_id"`
+	Actor              *Account               `gorm:"foreignKey:ActorID" json:"actor,omitempty"`
+	ActorRole          string                 `json:"actor_role"`
+	Reason             string                 `json:"reason"`
+	CreatedAt          time.Time              `json:"created_at"`
+}
@@ -1,12 +1,147 @@
 package model
 
-import "time"
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// DefaultCancellableStatuses are the statuses a customer can cancel a contract in, until the car
+// is handed over
+var DefaultCancellableStatuses = []CustomerContractStatus{
+	CustomerContractStatusWaitingPartnerApproval,
+	CustomerContractStatusWaitingContractAgreement,
+	CustomerContractStatusWaitingContractPayment,
+	CustomerContractStatusOrdered,
+}
+
+const DefaultPartnerCancelWarningPenalty = 1
+
+type OvertimeFeeUnit string
+
+const (
+	OvertimeFeeUnitHour OvertimeFeeUnit = "hour"
+	OvertimeFeeUnitDay  OvertimeFeeUnit = "day"
+
+	DefaultOvertimeFeeUnit      = OvertimeFeeUnitHour
+	DefaultOvertimeFeePercent   = 10.0
+	DefaultOvertimeGraceMinutes = 30
+)
 
 type CustomerContractRule struct {
-	ID                   int       `json:"id"`
-	InsurancePercent     float64   `json:"insurance_percent"`
-	PrepayPercent        float64   `json:"prepay_percent"`
-	CollateralCashAmount int       `json:"collateral_cash_amount"`
-	CreatedAt            time.Time `json:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
+	ID                   int     `json:"id"`
+	InsurancePercent     float64 `json:"insurance_percent"`
+	PrepayPercent        float64 `json:"prepay_percent"`
+	CollateralCashAmount int     `json:"collateral_cash_amount"`
+	// CancellableStatuses is a comma separated list of the statuses a customer can cancel in
+	CancellableStatuses string `json:"cancellable_statuses"`
+	// PartnerCancelWarningPenalty is added to the car's WarningCount when its partner cancels
+	PartnerCancelWarningPenalty int                       `json:"partner_cancel_warning_penalty"`
+	CancellationRefundTiers     []*CancellationRefundTier `json:"cancellation_refund_tiers" gorm:"foreignKey:CustomerContractRuleID"`
+	DeliveryFeeTiers            []*DeliveryFeeTier        `json:"delivery_fee_tiers" gorm:"foreignKey:CustomerContractRuleID"`
+	OvertimeFeeUnit             OvertimeFeeUnit           `json:"overtime_fee_unit"`
+	OvertimeFeePercent          float64                   `json:"overtime_fee_percent"`
+	OvertimeGraceMinutes        int                       `json:"overtime_grace_minutes"`
+	CreatedAt                   time.Time                 `json:"created_at"`
+	UpdatedAt                   time.Time                 `json:"updated_at"`
+}
+
+// CancellationRefundTier refunds RefundPercent of the prepay to a customer canceling at least
+// MinHoursBeforeStart hours before the contract starts
+type CancellationRefundTier struct {
+	ID                     int       `json:"id"`
+	CustomerContractRuleID int       `json:"customer_contract_rule_id"`
+	MinHoursBeforeStart    int       `json:"min_hours_before_start"`
+	RefundPercent          float64   `json:"refund_percent"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+// DeliveryFeeTier charges Fee for a delivery or return to an address at most MaxDistanceKm away
+// from the car's pickup point
+type DeliveryFeeTier struct {
+	ID                     int       `json:"id"`
+	CustomerContractRuleID int       `json:"customer_contract_rule_id"`
+	MaxDistanceKm          float64   `json:"max_distance_km"`
+	Fee                    int       `json:"fee"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+func DefaultDeliveryFeeTiers() []*DeliveryFeeTier {
+	return []*DeliveryFeeTier{
+		{MaxDistanceKm: 5, Fee: 50_000},
+		{MaxDistanceKm: 15, Fee: 100_000},
+		{MaxDistanceKm: 30, Fee: 200_000},
+	}
+}
+
+func DefaultCancellationRefundTiers() []*CancellationRefundTier {
+	return []*CancellationRefundTier{
+		{MinHoursBeforeStart: 72, RefundPercent: 100},
+		{MinHoursBeforeStart: 24, RefundPercent: 50},
+	}
+}
+
+func JoinCustomerContractStatuses(statuses []CustomerContractStatus) string {
+	res := make([]string, len(statuses))
+	for i, status := range statuses {
+		res[i] = string(status)
+	}
+
+	return strings.Join(res, ",")
+}
+
+func (r *CustomerContractRule) IsCancellableByCustomer(status CustomerContractStatus) bool {
+	for _, s := range strings.Split(r.CancellableStatuses, ",") {
+		if CustomerContractStatus(strings.TrimSpace(s)) == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CancellationRefundPercent returns the percent of the tier with the most hours that cancelling
+// hoursBeforeStart hours ahead still reaches, or 0 when it is too late for any tier
+func (r *CustomerContractRule) CancellationRefundPercent(hoursBeforeStart float64) float64 {
+	best := -1
+	percent := 0.0
+	for _, tier := range r.CancellationRefundTiers {
+		if hoursBeforeStart >= float64(tier.MinHoursBeforeStart) && tier.MinHoursBeforeStart > best {
+			best, percent = tier.MinHoursBeforeStart, tier.RefundPercent
+		}
+	}
+
+	return percent
+}
+
+// DeliveryFee returns the fee of the shortest tier reaching distanceKm, ok is false when the
+// address is farther than every tier
+func (r *CustomerContractRule) DeliveryFee(distanceKm float64) (fee int, ok bool) {
+	best := -1.0
+	for _, tier := range r.DeliveryFeeTiers {
+		if distanceKm <= tier.MaxDistanceKm && (best < 0 || tier.MaxDistanceKm < best) {
+			best, fee = tier.MaxDistanceKm, tier.Fee
+		}
+	}
+
+	return fee, best >= 0
+}
+
+// OvertimeFee returns what a car returned late by lateness costs. Nothing is charged within
+// OvertimeGraceMinutes, after that every started hour or day, counted from the end of the
+// contract, costs OvertimeFeePercent of the daily price of the car.
+func (r *CustomerContractRule) OvertimeFee(dailyPrice int, lateness time.Duration) int {
+	if lateness <= time.Duration(r.OvertimeGraceMinutes)*time.Minute {
+		return 0
+	}
+
+	unit := time.Hour
+	if r.OvertimeFeeUnit == OvertimeFeeUnitDay {
+		unit = 24 * time.Hour
+	}
+
+	units := int((lateness + unit - 1) / unit)
+	return int(math.Round(float64(units*dailyPrice) * r.OvertimeFeePercent / 100.0))
 }
@@ -11,8 +11,11 @@ const (
 	PaymentTypePrePay               PaymentType   = "pre_pay"
 	PaymentTypeReturnPrepay         PaymentType   = "refund_pre_pay"
 	PaymentTypeRemainingPay         PaymentType   = "remaining_pay"
+	PaymentTypeReturnRemainingPay   PaymentType   = "refund_remaining_pay"
 	PaymentTypeCollateralCash       PaymentType   = "collateral_cash"
 	PaymentTypeReturnCollateralCash PaymentType   = "return_collateral_cash"
+	PaymentTypeExtension            PaymentType   = "extension"
+	PaymentTypeReturnExtension      PaymentType   = "refund_extension"
 	PaymentTypeOther                PaymentType   = "other"
 	PaymentStatusPending            PaymentStatus = "pending"
 	PaymentStatusPaid               PaymentStatus = "paid"
@@ -20,15 +23,21 @@ const (
 	PaymentStatusNoFilter           PaymentStatus = "no_filter"
 )
 
+// CustomerPayment records the gateway order it was sent with (Gateway, TxnRef, TxnCreatedAt)
+// and, once paid, the gateway's own transaction id in ExternalTransactionID.
 type CustomerPayment struct {
-	ID                 int               `json:"id"`
-	CustomerContractID int               `json:"customer_contract_id"`
-	CustomerContract   *CustomerContract `json:"customer_contract,omitempty" gorm:"foreignKey:CustomerContractID"`
-	PaymentType        PaymentType       `json:"payment_type"`
-	Amount             int               `json:"amount"`
-	Note               string            `json:"note"`
-	Status             PaymentStatus     `json:"status"`
-	PaymentURL         string            `json:"payment_url"`
-	CreatedAt          time.Time         `json:"created_at"`
-	UpdatedAt          time.Time         `json:"updated_at"`
+	ID                    int               `json:"id"`
+	CustomerContractID    int               `json:"customer_contract_id"`
+	CustomerContract      *CustomerContract `json:"customer_contract,omitempty" gorm:"foreignKey:CustomerContractID"`
+	PaymentType           PaymentType       `json:"payment_type"`
+	Amount                int               `json:"amount"`
+	Note                  string            `json:"note"`
+	Status                PaymentStatus     `json:"status"`
+	PaymentURL            string            `json:"payment_url"`
+	Gateway               PaymentGateway    `json:"gateway"`
+	TxnRef                string            `json:"txn_ref"`
+	TxnCreatedAt          time.Time         `json:"txn_created_at"`
+	ExternalTransactionID string            `json:"external_transaction_id"`
+	CreatedAt             time.Time         `json:"created_at"`
+	UpdatedAt             time.Time         `json:"updated_at"`
 }
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+type CustomerRefundStatus string
+
+const (
+	CustomerRefundStatusPending   CustomerRefundStatus = "pending"
+	CustomerRefundStatusSucceeded CustomerRefundStatus = "succeeded"
+	CustomerRefundStatusFailed    CustomerRefundStatus = "failed"
+)
+
+// CustomerRefund returns all or part of a paid CustomerPayment through the gateway it was paid
+// with. A payment may have several refunds as long as they don't exceed its amount. ReturnPaymentID
+// is the return payment the refund pays out, if any.
+type CustomerRefund struct {
+	ID                int                  `json:"id"`
+	CustomerPaymentID int                  `json:"customer_payment_id"`
+	CustomerPayment   *CustomerPayment     `json:"customer_payment,omitempty" gorm:"foreignKey:CustomerPaymentID"`
+	ReturnPaymentID   *int                 `json:"return_payment_id"`
+	Gateway           PaymentGateway       `json:"gateway"`
+	Amount            int                  `json:"amount"`
+	Reason            string               `json:"reason"`
+	Status            CustomerRefundStatus `json:"status"`
+	ExternalRefundID  string               `json:"external_refund_id"`
+	ResponseCode      string               `json:"response_code"`
+	Message           string               `json:"message"`
+	CreatedAt         time.Time            `json:"created_at"`
+	UpdatedAt         time.Time            `json:"updated_at"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Garage is a lot run by the company where partners park their cars. Cars at a garage are picked
+// up at its address. Latitude and Longitude are nil for a garage whose location was never set.
+type Garage struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Address    string    `json:"address"`
+	Latitude   *float64  `json:"latitude"`
+	Longitude  *float64  `json:"longitude"`
+	Max4Seats  int       `json:"max_4_seats"`
+	Max7Seats  int       `json:"max_7_seats"`
+	Max15Seats int       `json:"max_15_seats"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// MaxSeats is the number of slots the garage has for cars with the given number of seats
+func (g *Garage) MaxSeats(numberOfSeats int) int {
+	switch numberOfSeats {
+	case 7:
+		return g.Max7Seats
+	case 15:
+		return g.Max15Seats
+	default:
+		return g.Max4Seats
+	}
+}
+
+// GarageSlotStatuses are the statuses of the cars taking a slot at their garage
+var GarageSlotStatuses = []CarStatus{CarStatusActive, CarStatusWaitingDelivery}
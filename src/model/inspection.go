@@ -0,0 +1,77 @@
+package model
+
+import "time"
+
+type (
+	InspectionSection       string
+	InspectionItemKind      string
+	InspectionStage         string
+	InspectionItemCondition string
+)
+
+const (
+	InspectionSectionExterior  InspectionSection = "exterior"
+	InspectionSectionTires     InspectionSection = "tires"
+	InspectionSectionInterior  InspectionSection = "interior"
+	InspectionSectionDocuments InspectionSection = "documents"
+	InspectionSectionOdometer  InspectionSection = "odometer"
+	InspectionSectionFuel      InspectionSection = "fuel"
+
+	InspectionItemKindCondition InspectionItemKind = "condition"
+	InspectionItemKindReading   InspectionItemKind = "reading"
+
+	InspectionStagePickup InspectionStage = "pickup"
+	InspectionStageReturn InspectionStage = "return"
+
+	InspectionItemConditionGood    InspectionItemCondition = "good"
+	InspectionItemConditionDamaged InspectionItemCondition = "damaged"
+	InspectionItemConditionMissing InspectionItemCondition = "missing"
+)
+
+// InspectionTemplate is the checklist technicians fill in when a car is picked up and returned,
+// the latest one is in use
+type InspectionTemplate struct {
+	ID        int                       `json:"id"`
+	Name      string                    `json:"name"`
+	Items     []*InspectionTemplateItem `json:"items" gorm:"foreignKey:InspectionTemplateID"`
+	CreatedAt time.Time                 `json:"created_at"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+}
+
+type InspectionTemplateItem struct {
+	ID                   int                `json:"id"`
+	InspectionTemplateID int                `json:"inspection_template_id"`
+	Section              InspectionSection  `json:"section"`
+	Name                 string             `json:"name"`
+	Kind                 InspectionItemKind `json:"kind"`
+	Position             int                `json:"position"`
+	CreatedAt            time.Time          `json:"created_at"`
+	UpdatedAt            time.Time          `json:"updated_at"`
+}
+
+// CustomerContractInspection is a filled in checklist of a contract at pickup or at return
+type CustomerContractInspection struct {
+	ID                   int                               `json:"id"`
+	CustomerContractID   int                               `json:"customer_contract_id"`
+	InspectionTemplateID int                               `json:"inspection_template_id"`
+	Stage                InspectionStage                   `json:"stage"`
+	TechnicianID         int                               `json:"technician_id"`
+	Note                 string                            `json:"note"`
+	Items                []*CustomerContractInspectionItem `json:"items" gorm:"foreignKey:CustomerContractInspectionID"`
+	CreatedAt            time.Time                         `json:"created_at"`
+	UpdatedAt            time.Time                         `json:"updated_at"`
+}
+
+// CustomerContractInspectionItem rates a condition item or holds the Value of a reading item
+type CustomerContractInspectionItem struct {
+	ID                           int                     `json:"id"`
+	CustomerContractInspectionID int                     `json:"customer_contract_inspection_id"`
+	InspectionTemplateItemID     int                     `json:"inspection_template_item_id"`
+	InspectionTemplateItem       *InspectionTemplateItem `json:"inspection_template_item,omitempty"`
+	Condition                    InspectionItemCondition `json:"condition"`
+	Value                        *int                    `json:"value"`
+	Note                         string                  `json:"note"`
+	ImageURLs                    []string                `json:"image_urls" gorm:"column:image_urls;serializer:json"`
+	CreatedAt                    time.Time               `json:"created_at"`
+	UpdatedAt                    time.Time               `json:"updated_at"`
+}
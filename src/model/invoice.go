@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+type InvoiceKind string
+
+const (
+	// InvoiceKindInvoice bills the rent and charges a customer paid, with their VAT
+	InvoiceKindInvoice InvoiceKind = "invoice"
+	// InvoiceKindReceipt acknowledges money without VAT, like a cash collateral or a partner payout
+	InvoiceKindReceipt InvoiceKind = "receipt"
+)
+
+type Invoice struct {
+	ID                      int         `json:"id"`
+	Number                  string      `json:"number"`
+	Kind                    InvoiceKind `json:"kind"`
+	CustomerPaymentID       *int        `json:"customer_payment_id"`
+	PartnerPaymentHistoryID *int        `json:"partner_payment_history_id"`
+	CustomerContractID      *int        `json:"customer_contract_id"`
+	AccountID               int         `json:"account_id"`
+	Description             string      `json:"description"`
+	SellerName              string      `json:"seller_name"`
+	SellerTaxCode           string      `json:"seller_tax_code"`
+	SellerAddress           string      `json:"seller_address"`
+	SellerPhone             string      `json:"seller_phone"`
+	SellerEmail             string      `json:"seller_email"`
+	BuyerName               string      `json:"buyer_name"`
+	BuyerPhone              string      `json:"buyer_phone"`
+	Subtotal                int         `json:"subtotal"`
+	VATPercent              float64     `json:"vat_percent" gorm:"column:vat_percent"`
+	VATAmount               int         `json:"vat_amount" gorm:"column:vat_amount"`
+	Total                   int         `json:"total"`
+	URL                     string      `json:"url"`
+	IssuedAt                time.Time   `json:"issued_at"`
+	CreatedAt               time.Time   `json:"created_at"`
+	UpdatedAt               time.Time   `json:"updated_at"`
+}
@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+type (
+	LedgerAccountCode string
+	LedgerAccountType string
+)
+
+const (
+	LedgerAccountCash                LedgerAccountCode = "cash"
+	LedgerAccountCustomerReceivable  LedgerAccountCode = "customer_receivable"
+	LedgerAccountCollateralLiability LedgerAccountCode = "collateral_liability"
+	LedgerAccountPartnerPayable      LedgerAccountCode = "partner_payable"
+	LedgerAccountInsurancePool       LedgerAccountCode = "insurance_pool"
+	LedgerAccountPlatformRevenue     LedgerAccountCode = "platform_revenue"
+
+	LedgerAccountTypeAsset     LedgerAccountType = "asset"
+	LedgerAccountTypeLiability LedgerAccountType = "liability"
+	LedgerAccountTypeRevenue   LedgerAccountType = "revenue"
+)
+
+type LedgerAccount struct {
+	ID        int               `json:"id"`
+	Code      LedgerAccountCode `json:"code"`
+	Name      string            `json:"name"`
+	Type      LedgerAccountType `json:"type"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Balance returns the balance of the account on its normal side, debit for assets and credit for
+// liabilities and revenue
+func (a *LedgerAccount) Balance(debit, credit int) int {
+	if a.Type == LedgerAccountTypeAsset {
+		return debit - credit
+	}
+	return credit - debit
+}
+
+// LedgerEntry is a balanced set of ledger lines, posted once per Reference
+type LedgerEntry struct {
+	ID                 int           `json:"id"`
+	Reference          string        `json:"reference"`
+	Description        string        `json:"description"`
+	CustomerContractID *int          `json:"customer_contract_id"`
+	PartnerID          *int          `json:"partner_id"`
+	PostedAt           time.Time     `json:"posted_at"`
+	Lines              []*LedgerLine `json:"lines,omitempty" gorm:"foreignKey:LedgerEntryID"`
+	CreatedAt          time.Time     `json:"created_at"`
+	UpdatedAt          time.Time     `json:"updated_at"`
+}
+
+type LedgerLine struct {
+	ID            int               `json:"id"`
+	LedgerEntryID int               `json:"ledger_entry_id"`
+	LedgerEntry   *LedgerEntry      `json:"ledger_entry,omitempty"`
+	AccountCode   LedgerAccountCode `json:"account_code"`
+	Debit         int               `json:"debit"`
+	Credit        int               `json:"credit"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
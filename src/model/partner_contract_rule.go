@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 type PartnerContractRule struct {
 	ID                    int       `json:"id"`
@@ -9,3 +12,10 @@ type PartnerContractRule struct {
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
 }
+
+// SplitRevenue splits the gross of a contract into the platform share, rounded to the nearest
+// unit, and the net the partner receives
+func (r *PartnerContractRule) SplitRevenue(gross int) (platform, net int) {
+	platform = int(math.Round(float64(gross) * r.RevenueSharingPercent / 100))
+	return platform, gross - platform
+}
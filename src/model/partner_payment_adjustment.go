@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+type PartnerPaymentAdjustmentCategory string
+
+const (
+	PartnerPaymentAdjustmentCategoryPenalty             PartnerPaymentAdjustmentCategory = "penalty"
+	PartnerPaymentAdjustmentCategoryBonus               PartnerPaymentAdjustmentCategory = "bonus"
+	PartnerPaymentAdjustmentCategoryDamageReimbursement PartnerPaymentAdjustmentCategory = "damage_reimbursement"
+	PartnerPaymentAdjustmentCategoryOther               PartnerPaymentAdjustmentCategory = "other"
+)
+
+// SignedAmount gives an amount the sign of its category: penalties are deducted, bonuses and
+// damage reimbursements are paid, other adjustments keep the sign they were given
+func (c PartnerPaymentAdjustmentCategory) SignedAmount(amount int) int {
+	switch c {
+	case PartnerPaymentAdjustmentCategoryPenalty:
+		return -abs(amount)
+	case PartnerPaymentAdjustmentCategoryBonus, PartnerPaymentAdjustmentCategoryDamageReimbursement:
+		return abs(amount)
+	default:
+		return amount
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// PartnerPaymentAdjustment is a manual line item of a partner payment, a positive Amount is paid
+// to the partner and a negative one is deducted
+type PartnerPaymentAdjustment struct {
+	ID                      int                              `json:"id"`
+	PartnerPaymentHistoryID int                              `json:"partner_payment_history_id"`
+	Category                PartnerPaymentAdjustmentCategory `json:"category"`
+	Description             string                           `json:"description"`
+	Amount                  int                              `json:"amount"`
+	CreatedBy               int                              `json:"created_by"`
+	CreatedAt               time.Time                        `json:"created_at"`
+	UpdatedAt               time.Time                        `json:"updated_at"`
+}
@@ -2,12 +2,18 @@ package model
 
 import "time"
 
+// PartnerPaymentCustomerContract is a settled contract of a partner payment, with the revenue
+// split it was settled with
 type PartnerPaymentCustomerContract struct {
 	ID                      int                    `json:"id"`
 	PartnerPaymentHistoryID int                    `json:"partner_payment_history_id,omitempty"`
-	PartnerPaymentHistory   *PartnerPaymentHistory `json:"partner_payment_history"`
+	PartnerPaymentHistory   *PartnerPaymentHistory `json:"partner_payment_history,omitempty"`
 	CustomerContractID      int                    `json:"customer_contract_id"`
 	CustomerContract        *CustomerContract      `json:"customer_contract,omitempty"`
+	RevenueSharingPercent   float64                `json:"revenue_sharing_percent"`
+	GrossAmount             int                    `json:"gross_amount"`
+	PlatformAmount          int                    `json:"platform_amount"`
+	NetAmount               int                    `json:"net_amount"`
 	CreatedAt               time.Time              `json:"created_at"`
 	UpdatedAt               time.Time              `json:"updated_at"`
 }
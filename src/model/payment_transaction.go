@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+type (
+	PaymentGateway           string
+	PaymentTransactionStatus string
+)
+
+const (
+	PaymentGatewayVNPay   PaymentGateway = "vnpay"
+	PaymentGatewayMoMo    PaymentGateway = "momo"
+	PaymentGatewayZaloPay PaymentGateway = "zalopay"
+
+	PaymentTransactionStatusSucceeded PaymentTransactionStatus = "succeeded"
+	PaymentTransactionStatusFailed    PaymentTransactionStatus = "failed"
+)
+
+// PaymentTransaction is one callback received from a payment gateway. TransactionNo of a succeeded
+// transaction is unique per gateway, while gateways reuse it for failures (VNPay sends 0), so a
+// failure is recorded once per TxnRef and ResponseCode. Either way a retried callback is recorded only once.
+type PaymentTransaction struct {
+	ID            int                      `json:"id"`
+	Gateway       PaymentGateway           `json:"gateway"`
+	TransactionNo string                   `json:"transaction_no"`
+	TxnRef        string                   `json:"txn_ref"`
+	OrderInfo     string                   `json:"order_info"`
+	Amount        int                      `json:"amount"`
+	ResponseCode  string                   `json:"response_code"`
+	BankCode      string                   `json:"bank_code"`
+	PayDate       string                   `json:"pay_date"`
+	Status        PaymentTransactionStatus `json:"status"`
+	CreatedAt     time.Time                `json:"created_at"`
+	UpdatedAt     time.Time                `json:"updated_at"`
+}
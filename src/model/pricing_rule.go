@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+type PricingRuleType string
+
+const (
+	PricingRuleTypeWeekday  PricingRuleType = "weekday"
+	PricingRuleTypeWeekend  PricingRuleType = "weekend"
+	PricingRuleTypeHoliday  PricingRuleType = "holiday"
+	PricingRuleTypeSeasonal PricingRuleType = "seasonal"
+	PricingRuleTypeLongStay PricingRuleType = "long_stay"
+)
+
+// PricingRule adjusts the base price of a car. It belongs to either a car or a car model, a car's
+// own rule wins over the rule of the same type of its model.
+//
+// Weekday, weekend, holiday and seasonal rules price a rental day at PricePercent of the base
+// price; seasonal rules only apply between StartDate and EndDate and stack on top of the others.
+// Long stay rules take DiscountPercent off the whole rental when it lasts at least MinDays.
+type PricingRule struct {
+	ID              int             `json:"id"`
+	CarID           *int            `json:"car_id"`
+	CarModelID      *int            `json:"car_model_id"`
+	Type            PricingRuleType `json:"type"`
+	Name            string          `json:"name"`
+	PricePercent    float64         `json:"price_percent"`
+	DiscountPercent float64         `json:"discount_percent"`
+	MinDays         int             `json:"min_days"`
+	StartDate       *time.Time      `json:"start_date"`
+	EndDate         *time.Time      `json:"end_date"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+func (r *PricingRule) IsDayRule() bool {
+	return r.Type == PricingRuleTypeWeekday || r.Type == PricingRuleTypeWeekend ||
+		r.Type == PricingRuleTypeHoliday || r.Type == PricingRuleTypeSeasonal
+}
+
+type Holiday struct {
+	ID        int       `json:"id"`
+	Date      time.Time `json:"date"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SessionStatus string
+
+const (
+	SessionStatusActive  SessionStatus = "active"
+	SessionStatusRotated SessionStatus = "rotated"
+	SessionStatusRevoked SessionStatus = "revoked"
+)
+
+// Session is a refresh token issued to one device. ID is the refresh token payload ID,
+// FamilyID is shared by every session rotated from the same login.
+type Session struct {
+	ID                   uuid.UUID     `json:"id"`
+	FamilyID             uuid.UUID     `json:"family_id"`
+	AccountID            int           `json:"account_id"`
+	Account              *Account      `json:"account,omitempty"`
+	AccessTokenID        uuid.UUID     `json:"access_token_id"`
+	AccessTokenExpiresAt time.Time     `json:"access_token_expires_at"`
+	UserAgent            string        `json:"user_agent"`
+	ClientIP             string        `json:"client_ip"`
+	Status               SessionStatus `json:"status"`
+	ExpiresAt            time.Time     `json:"expires_at"`
+	CreatedAt            time.Time     `json:"created_at"`
+	UpdatedAt            time.Time     `json:"updated_at"`
+}
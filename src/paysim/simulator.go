@@ -0,0 +1,351 @@
+// Package paysim is a fake VNPay gateway. It serves the payment page of urls generated by
+// api.VnPayService and fires a signed IPN back to the API, so the payment flow can be tested
+// end-to-end without the VNPay sandbox.
+package paysim
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	OutcomeTimeout Outcome = "timeout"
+)
+
+const (
+	// PayPath is the path of the payment page. Point vn_pay.pay_url at it.
+	PayPath = "/paymentv2/vpcpay.html"
+	// payActionPath receives the outcome chosen on the payment page
+	payActionPath = "/paymentv2/pay"
+	// APIPath is the path of the merchant API. Point vn_pay.api_url at it.
+	APIPath = "/merchant_webapi/api/transaction"
+
+	layoutyyyyMMddHHmmss = "20060102150405"
+)
+
+// outcomeResponseCodes are the vnp_ResponseCode VNPay sends for each outcome:
+// 24 is a payment canceled by the customer, 11 is a payment that expired before it was paid.
+var outcomeResponseCodes = map[Outcome]string{
+	OutcomeSuccess: "00",
+	OutcomeFailure: "24",
+	OutcomeTimeout: "11",
+}
+
+var (
+	ErrInvalidSignature = errors.New("invalid vnp_SecureHash")
+	ErrUnknownOutcome   = errors.New("unknown outcome")
+)
+
+type IPNResponse struct {
+	RspCode string `json:"RspCode"`
+	Message string `json:"Message"`
+}
+
+type Simulator struct {
+	HashSecret string
+	IPNURL     string
+
+	client        *http.Client
+	transactionNo atomic.Int64
+
+	mu sync.Mutex
+	// paid is the amount, in VND x 100, of each successful transaction not refunded yet
+	paid map[string]int64
+}
+
+func NewSimulator(hashSecret, ipnURL string) *Simulator {
+	s := &Simulator{
+		HashSecret: hashSecret,
+		IPNURL:     ipnURL,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		paid:       map[string]int64{},
+	}
+	s.transactionNo.Store(time.Now().Unix() % 10_000_000)
+	return s
+}
+
+func (s *Simulator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PayPath, s.handlePaymentPage)
+	mux.HandleFunc(payActionPath, s.handlePay)
+	mux.HandleFunc(APIPath, s.handleAPI)
+	return mux
+}
+
+// Pay settles the order of a payment url with the given outcome, like a customer would on the
+// payment page. A timed out payment never reaches the IPN, so it returns a nil response.
+func (s *Simulator) Pay(paymentURL string, outcome Outcome) (*IPNResponse, error) {
+	parsed, err := url.Parse(paymentURL)
+	if err != nil {
+		return nil, err
+	}
+
+	_, rsp, err := s.pay(parsed.Query(), outcome)
+	return rsp, err
+}
+
+// pay verifies the order, then builds and sends the IPN. It returns the signed IPN params,
+// which VNPay also appends to the return url.
+func (s *Simulator) pay(order url.Values, outcome Outcome) (url.Values, *IPNResponse, error) {
+	if !s.verify(order) {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	if expireDate, err := time.ParseInLocation(layoutyyyyMMddHHmmss, order.Get("vnp_ExpireDate"), time.Local); err == nil &&
+		time.Now().After(expireDate) {
+		outcome = OutcomeTimeout
+	}
+
+	rspCode, ok := outcomeResponseCodes[outcome]
+	if !ok {
+		return nil, nil, ErrUnknownOutcome
+	}
+
+	ipn := url.Values{}
+	ipn.Set("vnp_Amount", order.Get("vnp_Amount"))
+	ipn.Set("vnp_BankCode", "NCB")
+	ipn.Set("vnp_CardType", "ATM")
+	ipn.Set("vnp_OrderInfo", order.Get("vnp_OrderInfo"))
+	ipn.Set("vnp_PayDate", time.Now().Format(layoutyyyyMMddHHmmss))
+	ipn.Set("vnp_ResponseCode", rspCode)
+	ipn.Set("vnp_TmnCode", order.Get("vnp_TmnCode"))
+	ipn.Set("vnp_TransactionStatus", rspCode)
+	ipn.Set("vnp_TxnRef", order.Get("vnp_TxnRef"))
+	// like VNPay, only a successful payment gets a transaction number
+	ipn.Set("vnp_TransactionNo", "0")
+	if outcome == OutcomeSuccess {
+		ipn.Set("vnp_TransactionNo", fmt.Sprintf("%d", s.transactionNo.Add(1)))
+		ipn.Set("vnp_BankTranNo", "VNP"+ipn.Get("vnp_TransactionNo"))
+		amount, _ := strconv.ParseInt(order.Get("vnp_Amount"), 10, 64)
+		s.mu.Lock()
+		s.paid[ipn.Get("vnp_TransactionNo")] = amount
+		s.mu.Unlock()
+	}
+	ipn.Set("vnp_SecureHash", s.sign(ipn.Encode()))
+
+	if outcome == OutcomeTimeout {
+		return ipn, nil, nil
+	}
+
+	rsp, err := s.sendIPN(ipn)
+	return ipn, rsp, err
+}
+
+func (s *Simulator) sendIPN(ipn url.Values) (*IPNResponse, error) {
+	resp, err := s.client.Get(s.IPNURL + "?" + ipn.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ipn responded %d", resp.StatusCode)
+	}
+
+	rsp := &IPNResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(rsp); err != nil {
+		return nil, err
+	}
+
+	return rsp, nil
+}
+
+func (s *Simulator) verify(values url.Values) bool {
+	secureHash := values.Get("vnp_SecureHash")
+	signValues := url.Values{}
+	for k, v := range values {
+		if strings.HasPrefix(k, "vnp_") && k != "vnp_SecureHash" && k != "vnp_SecureHashType" {
+			signValues[k] = v
+		}
+	}
+
+	return secureHash != "" && hmac.Equal([]byte(strings.ToLower(secureHash)), []byte(s.sign(signValues.Encode())))
+}
+
+func (s *Simulator) sign(data string) string {
+	signer := hmac.New(sha512.New, []byte(s.HashSecret))
+	signer.Write([]byte(data))
+	return hex.EncodeToString(signer.Sum(nil))
+}
+
+var paymentPage = template.Must(template.New("payment").Parse(`<!DOCTYPE html>
+<html>
+<head><title>VNPay simulator</title></head>
+<body>
+<h2>VNPay simulator</h2>
+<p>Order {{.TxnRef}} - {{.OrderInfo}}</p>
+<p>Amount: {{.Amount}} VND</p>
+<form method="post" action="{{.Action}}">
+	<input type="hidden" name="order" value="{{.Order}}">
+	<button name="outcome" value="success">Pay</button>
+	<button name="outcome" value="failure">Cancel</button>
+	<button name="outcome" value="timeout">Let it expire</button>
+</form>
+</body>
+</html>`))
+
+func (s *Simulator) handlePaymentPage(w http.ResponseWriter, r *http.Request) {
+	order := r.URL.Query()
+	if !s.verify(order) {
+		http.Error(w, ErrInvalidSignature.Error(), http.StatusBadRequest)
+		return
+	}
+
+	amount := order.Get("vnp_Amount")
+	if len(amount) > 2 {
+		amount = amount[:len(amount)-2]
+	}
+
+	if err := paymentPage.Execute(w, map[string]string{
+		"TxnRef":    order.Get("vnp_TxnRef"),
+		"OrderInfo": order.Get("vnp_OrderInfo"),
+		"Amount":    amount,
+		"Action":    payActionPath,
+		"Order":     r.URL.RawQuery,
+	}); err != nil {
+		fmt.Printf("paysim: render payment page %v\n", err)
+	}
+}
+
+func (s *Simulator) handlePay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	order, err := url.ParseQuery(r.PostFormValue("order"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ipn, rsp, err := s.pay(order, Outcome(r.PostFormValue("outcome")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rsp != nil {
+		fmt.Printf("paysim: ipn of %s answered %s %s\n", order.Get("vnp_TxnRef"), rsp.RspCode, rsp.Message)
+	}
+
+	returnURL := order.Get("vnp_ReturnUrl")
+	if returnURL == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	separator := "?"
+	if strings.Contains(returnURL, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, returnURL+separator+ipn.Encode(), http.StatusFound)
+}
+
+// APIResponse is the answer of the merchant API, signed like VNPay signs its refund responses
+type APIResponse struct {
+	ResponseID        string `json:"vnp_ResponseId"`
+	Command           string `json:"vnp_Command"`
+	ResponseCode      string `json:"vnp_ResponseCode"`
+	Message           string `json:"vnp_Message"`
+	TmnCode           string `json:"vnp_TmnCode"`
+	TxnRef            string `json:"vnp_TxnRef"`
+	Amount            string `json:"vnp_Amount"`
+	BankCode          string `json:"vnp_BankCode"`
+	PayDate           string `json:"vnp_PayDate"`
+	TransactionNo     string `json:"vnp_TransactionNo"`
+	TransactionType   string `json:"vnp_TransactionType"`
+	TransactionStatus string `json:"vnp_TransactionStatus"`
+	OrderInfo         string `json:"vnp_OrderInfo"`
+	SecureHash        string `json:"vnp_SecureHash"`
+}
+
+// handleAPI serves the refund command of the merchant API. A refund succeeds while the
+// transaction still has enough money left; responses use VNPay codes 91 (transaction not found),
+// 94 (amount exceeds what is left) and 97 (invalid signature).
+func (s *Simulator) handleAPI(w http.ResponseWriter, r *http.Request) {
+	req := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req["vnp_Command"] != "refund" {
+		http.Error(w, "unsupported command", http.StatusBadRequest)
+		return
+	}
+
+	rsp := &APIResponse{
+		ResponseID:        fmt.Sprintf("%d", time.Now().UnixNano()),
+		Command:           req["vnp_Command"],
+		TmnCode:           req["vnp_TmnCode"],
+		TxnRef:            req["vnp_TxnRef"],
+		Amount:            req["vnp_Amount"],
+		BankCode:          "NCB",
+		PayDate:           time.Now().Format(layoutyyyyMMddHHmmss),
+		TransactionType:   req["vnp_TransactionType"],
+		TransactionStatus: "05",
+		OrderInfo:         req["vnp_OrderInfo"],
+	}
+	rsp.ResponseCode, rsp.Message = s.refund(req)
+	if rsp.ResponseCode == "00" {
+		rsp.TransactionNo = fmt.Sprintf("%d", s.transactionNo.Add(1))
+	}
+	rsp.SecureHash = s.sign(strings.Join([]string{
+		rsp.ResponseID, rsp.Command, rsp.ResponseCode, rsp.Message, rsp.TmnCode, rsp.TxnRef,
+		rsp.Amount, rsp.BankCode, rsp.PayDate, rsp.TransactionNo, rsp.TransactionType,
+		rsp.TransactionStatus, rsp.OrderInfo,
+	}, "|"))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rsp); err != nil {
+		fmt.Printf("paysim: write api response %v\n", err)
+	}
+}
+
+func (s *Simulator) refund(req map[string]string) (string, string) {
+	secureHash := s.sign(strings.Join([]string{
+		req["vnp_RequestId"], req["vnp_Version"], req["vnp_Command"], req["vnp_TmnCode"],
+		req["vnp_TransactionType"], req["vnp_TxnRef"], req["vnp_Amount"], req["vnp_TransactionNo"],
+		req["vnp_TransactionDate"], req["vnp_CreateBy"], req["vnp_CreateDate"], req["vnp_IpAddr"],
+		req["vnp_OrderInfo"],
+	}, "|"))
+	if !hmac.Equal([]byte(strings.ToLower(req["vnp_SecureHash"])), []byte(secureHash)) {
+		return "97", "invalid signature"
+	}
+
+	amount, err := strconv.ParseInt(req["vnp_Amount"], 10, 64)
+	if err != nil || amount <= 0 {
+		return "03", "invalid amount"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	left, ok := s.paid[req["vnp_TransactionNo"]]
+	if !ok {
+		return "91", "transaction not found"
+	}
+
+	if amount > left {
+		return "94", "refund amount exceeds the transaction"
+	}
+
+	s.paid[req["vnp_TransactionNo"]] = left - amount
+	return "00", "refund successfully"
+}
@@ -0,0 +1,151 @@
+package paysim_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/api"
+	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/paysim"
+)
+
+func TestSimulator_Pay(t *testing.T) {
+	cfg := &misc.VNPayConfig{
+		PayURL:     "http://localhost" + paysim.PayPath,
+		HashSecret: "secret",
+		Version:    "2.1.0",
+		Command:    "pay",
+		TMNCode:    "TMN",
+	}
+	vnPay := api.NewVnPayService(cfg)
+
+	ipns := make(chan url.Values, 1)
+	ipnServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ipns <- r.URL.Query()
+		if _, err := vnPay.VerifyCallback(r); err != nil {
+			w.Write([]byte(`{"RspCode":"97","Message":"invalid signature"}`))
+			return
+		}
+		w.Write([]byte(`{"RspCode":"00","Message":"success"}`))
+	}))
+	defer ipnServer.Close()
+
+	simulator := paysim.NewSimulator(cfg.HashSecret, ipnServer.URL)
+	order := &api.PaymentOrder{PaymentIDs: []int{1, 2}, Amount: 50_000, TxnRef: "01020304", CreatedAt: time.Now()}
+	paymentURL, err := vnPay.GeneratePaymentURL(order)
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		rsp, err := simulator.Pay(paymentURL, paysim.OutcomeSuccess)
+		require.NoError(t, err)
+		require.Equal(t, "00", rsp.RspCode)
+
+		ipn := <-ipns
+		require.Equal(t, "00", ipn.Get("vnp_ResponseCode"))
+		require.Equal(t, "5000000", ipn.Get("vnp_Amount"))
+		require.Equal(t, "1.2", ipn.Get("vnp_OrderInfo"))
+		require.Equal(t, order.TxnRef, ipn.Get("vnp_TxnRef"))
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		rsp, err := simulator.Pay(paymentURL, paysim.OutcomeFailure)
+		require.NoError(t, err)
+		require.Equal(t, "00", rsp.RspCode)
+		ipn := <-ipns
+		require.Equal(t, "24", ipn.Get("vnp_ResponseCode"))
+		require.Equal(t, "0", ipn.Get("vnp_TransactionNo"))
+	})
+
+	t.Run("timeout does not send ipn", func(t *testing.T) {
+		rsp, err := simulator.Pay(paymentURL, paysim.OutcomeTimeout)
+		require.NoError(t, err)
+		require.Nil(t, rsp)
+		require.Len(t, ipns, 0)
+	})
+
+	t.Run("tampered payment url", func(t *testing.T) {
+		parsed, err := url.Parse(paymentURL)
+		require.NoError(t, err)
+		query := parsed.Query()
+		query.Set("vnp_Amount", "100")
+		parsed.RawQuery = query.Encode()
+
+		_, err = simulator.Pay(parsed.String(), paysim.OutcomeSuccess)
+		require.ErrorIs(t, err, paysim.ErrInvalidSignature)
+	})
+
+	t.Run("payment page", func(t *testing.T) {
+		parsed, err := url.Parse(paymentURL)
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		simulator.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, parsed.RequestURI(), nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Contains(t, recorder.Body.String(), "50000 VND")
+	})
+}
+
+func TestSimulator_Refund(t *testing.T) {
+	cfg := &misc.VNPayConfig{
+		PayURL:     "http://localhost" + paysim.PayPath,
+		HashSecret: "secret",
+		Version:    "2.1.0",
+		Command:    "pay",
+		TMNCode:    "TMN",
+	}
+
+	ipns := make(chan url.Values, 1)
+	ipnServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ipns <- r.URL.Query()
+		w.Write([]byte(`{"RspCode":"00","Message":"success"}`))
+	}))
+	defer ipnServer.Close()
+
+	simulator := paysim.NewSimulator(cfg.HashSecret, ipnServer.URL)
+	simServer := httptest.NewServer(simulator.Handler())
+	defer simServer.Close()
+	cfg.ApiURL = simServer.URL + paysim.APIPath
+	vnPay := api.NewVnPayService(cfg)
+
+	createdAt := time.Now()
+	paymentURL, err := vnPay.GeneratePaymentURL(&api.PaymentOrder{
+		PaymentIDs: []int{1}, Amount: 100_000, TxnRef: "05060708", CreatedAt: createdAt,
+	})
+	require.NoError(t, err)
+	_, err = simulator.Pay(paymentURL, paysim.OutcomeSuccess)
+	require.NoError(t, err)
+
+	payment := &model.CustomerPayment{
+		Amount:                100_000,
+		Gateway:               model.PaymentGatewayVNPay,
+		TxnRef:                "05060708",
+		TxnCreatedAt:          createdAt,
+		ExternalTransactionID: (<-ipns).Get("vnp_TransactionNo"),
+	}
+	refund := func(ref string, amount int) *api.RefundResult {
+		result, err := vnPay.Refund(&api.RefundOrder{
+			RefundRef: ref, Payment: payment, Amount: amount, Reason: "test", CreatedAt: time.Now(),
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	result := refund("refund__1", 30_000)
+	require.Equal(t, model.CustomerRefundStatusSucceeded, result.Status)
+	require.NotEmpty(t, result.ExternalRefundID)
+
+	result = refund("refund__2", 80_000)
+	require.Equal(t, model.CustomerRefundStatusFailed, result.Status)
+	require.Equal(t, "94", result.ResponseCode)
+
+	require.Equal(t, model.CustomerRefundStatusSucceeded, refund("refund__3", 70_000).Status)
+
+	payment.ExternalTransactionID = "0"
+	require.Equal(t, "91", refund("refund__4", 1_000).ResponseCode)
+}
@@ -0,0 +1,398 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/go-fonts/liberation/liberationmonoregular"
+	"github.com/go-fonts/liberation/liberationsansbold"
+	"golang.org/x/image/font/sfnt"
+)
+
+var (
+	bodyFont    = mustParseFont("LiberationMono", liberationmonoregular.TTF, true)
+	headingFont = mustParseFont("LiberationSans-Bold", liberationsansbold.TTF, false)
+)
+
+// subsetTables are the TrueType tables a PDF needs to draw the glyphs of an embedded font
+var subsetTables = []string{"cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "prep"}
+
+// font is a TrueType font embedded as a Type0 font with Identity-H encoding, so text is written
+// as glyph ids. Only the glyphs a document uses are embedded.
+type font struct {
+	name       string
+	fixedPitch bool
+	sfnt       *sfnt.Font
+	tables     map[string][]byte
+
+	unitsPerEm  int
+	numGlyphs   int
+	numHMetrics int
+	longLoca    bool
+	bbox        [4]int
+	ascent      int
+	descent     int
+}
+
+func mustParseFont(name string, data []byte, fixedPitch bool) *font {
+	f, err := parseFont(name, data, fixedPitch)
+	if err != nil {
+		panic(fmt.Sprintf("pdf: parse font %s: %v", name, err))
+	}
+	return f
+}
+
+func parseFont(name string, data []byte, fixedPitch bool) (*font, error) {
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 {
+		return nil, errors.New("font is truncated")
+	}
+
+	f := &font{name: name, fixedPitch: fixedPitch, sfnt: parsed, tables: make(map[string][]byte)}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		record := 12 + 16*i
+		if record+16 > len(data) {
+			return nil, errors.New("table directory is truncated")
+		}
+
+		tag := string(data[record : record+4])
+		offset := int(binary.BigEndian.Uint32(data[record+8:]))
+		length := int(binary.BigEndian.Uint32(data[record+12:]))
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("table %q is truncated", tag)
+		}
+		f.tables[tag] = data[offset : offset+length]
+	}
+
+	head, hhea, maxp := f.tables["head"], f.tables["hhea"], f.tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 || f.tables["glyf"] == nil || f.tables["loca"] == nil {
+		return nil, errors.New("font is not a TrueType font")
+	}
+
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	for i := range f.bbox {
+		f.bbox[i] = f.scale(int(int16(binary.BigEndian.Uint16(head[36+2*i:]))))
+	}
+	f.longLoca = binary.BigEndian.Uint16(head[50:]) == 1
+	f.ascent = f.scale(int(int16(binary.BigEndian.Uint16(hhea[4:]))))
+	f.descent = f.scale(int(int16(binary.BigEndian.Uint16(hhea[6:]))))
+	f.numHMetrics = int(binary.BigEndian.Uint16(hhea[34:]))
+	f.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:]))
+	if len(f.tables["hmtx"]) < 4*f.numHMetrics {
+		return nil, errors.New("hmtx table is truncated")
+	}
+
+	return f, nil
+}
+
+// scale converts font units to the thousandths of an em PDF measures glyphs in
+func (f *font) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
+
+// glyph returns the glyph id of r, 0 when the font has no glyph for it
+func (f *font) glyph(r rune) uint16 {
+	id, err := f.sfnt.GlyphIndex(nil, r)
+	if err != nil {
+		return 0
+	}
+	return uint16(id)
+}
+
+func (f *font) has(r rune) bool {
+	return f.glyph(r) != 0
+}
+
+// width returns the advance of a glyph in thousandths of an em
+func (f *font) width(id uint16) int {
+	i := int(id)
+	if i >= f.numHMetrics {
+		i = f.numHMetrics - 1
+	}
+	return f.scale(int(binary.BigEndian.Uint16(f.tables["hmtx"][4*i:])))
+}
+
+// hex returns text as the hex string of its glyph ids
+func (f *font) hex(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		fmt.Fprintf(&b, "%04X", f.glyph(r))
+	}
+	return b.String()
+}
+
+// glyphRange returns where a glyph is in the glyf table
+func (f *font) glyphRange(id int) (start, end int) {
+	loca := f.tables["loca"]
+	if f.longLoca {
+		return int(binary.BigEndian.Uint32(loca[4*id:])), int(binary.BigEndian.Uint32(loca[4*id+4:]))
+	}
+	return 2 * int(binary.BigEndian.Uint16(loca[2*id:])), 2 * int(binary.BigEndian.Uint16(loca[2*id+2:]))
+}
+
+// components returns the glyphs a composite glyph is built from
+func components(glyph []byte) []int {
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil
+	}
+
+	const (
+		argsAreWords    = 0x0001
+		haveScale       = 0x0008
+		moreComponents  = 0x0020
+		haveXYScale     = 0x0040
+		haveTwoByTwo    = 0x0080
+		componentHeader = 4
+	)
+
+	res := make([]int, 0)
+	for i := 10; i+componentHeader <= len(glyph); {
+		flags := binary.BigEndian.Uint16(glyph[i:])
+		res = append(res, int(binary.BigEndian.Uint16(glyph[i+2:])))
+		i += componentHeader
+
+		if flags&argsAreWords != 0 {
+			i += 4
+		} else {
+			i += 2
+		}
+
+		switch {
+		case flags&haveScale != 0:
+			i += 2
+		case flags&haveXYScale != 0:
+			i += 4
+		case flags&haveTwoByTwo != 0:
+			i += 8
+		}
+
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+
+	return res
+}
+
+// subset returns the font file with only the outlines of the given glyphs and of .notdef. Glyph
+// ids are kept, the other glyphs are left empty.
+func (f *font) subset(glyphs map[uint16]rune) []byte {
+	keep := map[int]bool{0: true}
+	queue := []int{0}
+	for id := range glyphs {
+		queue = append(queue, int(id))
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id >= f.numGlyphs {
+			continue
+		}
+		keep[id] = true
+
+		start, end := f.glyphRange(id)
+		for _, component := range components(f.tables["glyf"][start:end]) {
+			if !keep[component] {
+				queue = append(queue, component)
+			}
+		}
+	}
+
+	var glyf bytes.Buffer
+	offsets := make([]int, f.numGlyphs+1)
+	for id := 0; id < f.numGlyphs; id++ {
+		offsets[id] = glyf.Len()
+		if !keep[id] {
+			continue
+		}
+
+		start, end := f.glyphRange(id)
+		glyf.Write(f.tables["glyf"][start:end])
+		if glyf.Len()%2 != 0 {
+			glyf.WriteByte(0)
+		}
+	}
+	offsets[f.numGlyphs] = glyf.Len()
+
+	var loca bytes.Buffer
+	for _, offset := range offsets {
+		if f.longLoca {
+			_ = binary.Write(&loca, binary.BigEndian, uint32(offset))
+		} else {
+			_ = binary.Write(&loca, binary.BigEndian, uint16(offset/2))
+		}
+	}
+
+	tables := make(map[string][]byte, len(subsetTables))
+	for _, tag := range subsetTables {
+		if table, ok := f.tables[tag]; ok {
+			tables[tag] = table
+		}
+	}
+	tables["glyf"], tables["loca"] = glyf.Bytes(), loca.Bytes()
+	head := append([]byte(nil), tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0)
+	tables["head"] = head
+
+	return writeFont(tables)
+}
+
+// writeFont lays out TrueType tables with their directory and checksums
+func writeFont(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= len(tags) {
+		searchRange *= 2
+		entrySelector++
+	}
+
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, []uint16{
+		1, 0, uint16(len(tags)), uint16(16 * searchRange), uint16(entrySelector), uint16(16 * (len(tags) - searchRange)),
+	})
+
+	offset := 12 + 16*len(tags)
+	for _, tag := range tags {
+		table := tables[tag]
+		b.WriteString(tag)
+		_ = binary.Write(&b, binary.BigEndian, []uint32{checksum(table), uint32(offset), uint32(len(table))})
+		offset += (len(table) + 3) &^ 3
+	}
+
+	headOffset := 0
+	for _, tag := range tags {
+		if tag == "head" {
+			headOffset = b.Len()
+		}
+		b.Write(tables[tag])
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+
+	res := b.Bytes()
+	binary.BigEndian.PutUint32(res[headOffset+8:], 0xB1B0AFBA-checksum(res))
+	return res
+}
+
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// subsetName prefixes the font name with the tag PDF requires of a subset, six capital letters
+// derived from the glyphs in it
+func (f *font) subsetName(ids []uint16) string {
+	h := fnv.New32a()
+	for _, id := range ids {
+		_ = binary.Write(h, binary.BigEndian, id)
+	}
+
+	sum := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(sum%26)
+		sum /= 26
+	}
+
+	return string(tag) + "+" + f.name
+}
+
+// writeObjects writes the Type0 font with its descendant font, descriptor, font file and
+// ToUnicode map, five objects of which the first is the font to refer to
+func (f *font) writeObjects(w *writer, glyphs map[uint16]rune) {
+	ids := make([]uint16, 0, len(glyphs))
+	for id := range glyphs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	first := len(w.offsets) + 1
+	name := f.subsetName(ids)
+
+	w.object(fmt.Sprintf(
+		"<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, first+1, first+4,
+	))
+
+	widths := make([]string, len(ids))
+	for i, id := range ids {
+		widths[i] = fmt.Sprintf("%d [%d]", id, f.width(id))
+	}
+	w.object(fmt.Sprintf(
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW %d /W [%s] >>",
+		name, first+2, f.width(0), strings.Join(widths, " "),
+	))
+
+	// nonsymbolic, and fixed pitch for the body font
+	flags := 32
+	if f.fixedPitch {
+		flags |= 1
+	}
+	w.object(fmt.Sprintf(
+		"<< /Type /FontDescriptor /FontName /%s /Flags %d /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, flags, f.bbox[0], f.bbox[1], f.bbox[2], f.bbox[3], f.ascent, f.descent, f.ascent, first+3,
+	))
+
+	file := f.subset(glyphs)
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, _ = zw.Write(file)
+	_ = zw.Close()
+	w.stream(fmt.Sprintf("/Length1 %d /Filter /FlateDecode", len(file)), compressed.Bytes())
+
+	w.stream("", []byte(toUnicode(ids, glyphs)))
+}
+
+// toUnicode returns the CMap mapping glyph ids back to the characters they were drawn for, so
+// text can be copied and searched
+func toUnicode(ids []uint16, glyphs map[uint16]rune) string {
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	// a bfchar block holds at most 100 mappings
+	for start := 0; start < len(ids); start += 100 {
+		end := start + 100
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		fmt.Fprintf(&b, "%d beginbfchar\n", end-start)
+		for _, id := range ids[start:end] {
+			var text strings.Builder
+			for _, unit := range utf16.Encode([]rune{glyphs[id]}) {
+				fmt.Fprintf(&text, "%04X", unit)
+			}
+			fmt.Fprintf(&b, "<%04X> <%s>\n", id, text.String())
+		}
+		b.WriteString("endbfchar\n")
+	}
+
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend")
+	return b.String()
+}
@@ -0,0 +1,237 @@
+// Package pdf writes plain text documents as PDF files without any external renderer. Pages are
+// A4, headings are set in Liberation Sans Bold and the body in Liberation Mono so templates can
+// align columns with spaces. Both fonts are embedded with only the glyphs a document uses and
+// cover Vietnamese, characters they lack are folded to their base letter or replaced by '?'.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 50.0
+
+	bodyFontSize    = 10.0
+	bodyLeading     = 13.0
+	headingFontSize = 14.0
+	headingLeading  = 22.0
+
+	// Liberation Mono is 0.6 em wide, so 82 characters fit between the margins
+	BodyLineWidth    = 82
+	headingLineWidth = 60
+)
+
+type line struct {
+	text    string
+	heading bool
+}
+
+// Document is a text document laid out in pages
+type Document struct {
+	pages [][]line
+	y     float64
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// WriteText adds every line of text, a line starting with "# " is a heading. Long lines are
+// wrapped at spaces.
+func (d *Document) WriteText(text string) {
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if heading, ok := strings.CutPrefix(raw, "# "); ok {
+			d.Heading(heading)
+		} else {
+			d.Text(raw)
+		}
+	}
+}
+
+func (d *Document) Heading(text string) {
+	for _, l := range wrap(encode(headingFont, text), headingLineWidth) {
+		d.add(line{l, true}, headingLeading)
+	}
+}
+
+func (d *Document) Text(text string) {
+	for _, l := range wrap(encode(bodyFont, text), BodyLineWidth) {
+		d.add(line{l, false}, bodyLeading)
+	}
+}
+
+func (d *Document) add(l line, leading float64) {
+	if len(d.pages) == 0 || d.y-leading < margin {
+		d.pages = append(d.pages, nil)
+		d.y = pageHeight - margin
+	}
+
+	d.y -= leading
+	d.pages[len(d.pages)-1] = append(d.pages[len(d.pages)-1], l)
+}
+
+// Bytes returns the PDF file of the document, an empty document has one blank page
+func (d *Document) Bytes() []byte {
+	pages := d.pages
+	if len(pages) == 0 {
+		pages = [][]line{nil}
+	}
+
+	w := &writer{}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 pages, 3 to 7 body font, 8 to 12 heading font, then a page and its content per
+	// page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 13+2*i)
+	}
+
+	bodyGlyphs, headingGlyphs := make(map[uint16]rune), make(map[uint16]rune)
+	for _, page := range pages {
+		for _, l := range page {
+			f, glyphs := bodyFont, bodyGlyphs
+			if l.heading {
+				f, glyphs = headingFont, headingGlyphs
+			}
+			for _, r := range l.text {
+				glyphs[f.glyph(r)] = r
+			}
+		}
+	}
+
+	w.object("<< /Type /Catalog /Pages 2 0 R >>")
+	w.object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	bodyFont.writeObjects(w, bodyGlyphs)
+	headingFont.writeObjects(w, headingGlyphs)
+
+	for i, page := range pages {
+		w.object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 8 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 14+2*i,
+		))
+		w.stream("", []byte(pageContent(page)))
+	}
+
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, offset := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, xref)
+
+	return w.buf.Bytes()
+}
+
+// FromText lays out text with WriteText and returns the PDF file
+func FromText(text string) []byte {
+	d := New()
+	d.WriteText(text)
+	return d.Bytes()
+}
+
+// ContainsText reports whether a PDF file written by this package draws text within one of its
+// lines, in the body or the heading font
+func ContainsText(file []byte, text string) bool {
+	for _, f := range []*font{bodyFont, headingFont} {
+		if bytes.Contains(file, []byte(f.hex(encode(f, text)))) {
+			return true
+		}
+	}
+	return false
+}
+
+type writer struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func (w *writer) object(body string) {
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", len(w.offsets), body)
+}
+
+// stream writes a stream object, dict holds the entries besides its length
+func (w *writer) stream(dict string, data []byte) {
+	if dict != "" {
+		dict += " "
+	}
+
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n<< %s/Length %d >>\nstream\n", len(w.offsets), dict, len(data))
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+func pageContent(page []line) string {
+	var b strings.Builder
+	y := pageHeight - margin
+	for _, l := range page {
+		f, name, size, leading := bodyFont, "F1", bodyFontSize, bodyLeading
+		if l.heading {
+			f, name, size, leading = headingFont, "F2", headingFontSize, headingLeading
+		}
+
+		y -= leading
+		if l.text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "BT /%s %.0f Tf %.0f %.0f Td <%s> Tj ET\n", name, size, margin, y, f.hex(l.text))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// encode composes text to the characters the font draws, tabs become four spaces and characters
+// the font lacks are folded to their base letter or replaced by '?'
+func encode(f *font, text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFC.String(text) {
+		switch {
+		case r == '\t':
+			b.WriteString("    ")
+		case unicode.IsControl(r):
+		case f.has(r):
+			b.WriteRune(r)
+		default:
+			if base := []rune(norm.NFD.String(string(r)))[0]; f.has(base) {
+				b.WriteRune(base)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// wrap splits an encoded line into lines of at most width characters, at spaces when it can
+func wrap(s string, width int) []string {
+	runes := []rune(strings.TrimRight(s, " "))
+	if len(runes) <= width {
+		return []string{string(runes)}
+	}
+
+	res := make([]string, 0, len(runes)/width+1)
+	for len(runes) > width {
+		cut := width
+		for i := width; i > 0; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+
+		res = append(res, strings.TrimRight(string(runes[:cut]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+
+	return append(res, string(runes))
+}
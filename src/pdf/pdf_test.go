@@ -0,0 +1,102 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-fonts/liberation/liberationmonoregular"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	require.Equal(t, "Nguyễn Văn Đức", encode(bodyFont, "Nguyễn Văn Đức"))
+	require.Equal(t, "Nguyễn", encode(bodyFont, "Nguye\u0302\u0303n"), "decomposed marks are composed")
+	require.Equal(t, "café € 1.000 ₫ ?", encode(bodyFont, "café € 1.000 ₫ 漢"))
+	require.Equal(t, "a    b", encode(headingFont, "a\tb\x00"))
+}
+
+func TestWrap(t *testing.T) {
+	require.Equal(t, []string{"aaa bbb", "ccc"}, wrap("aaa bbb ccc", 8))
+	require.Equal(t, []string{"aaaaa", "aaa"}, wrap("aaaaaaaa", 5))
+	require.Equal(t, []string{""}, wrap("   ", 5))
+	require.Equal(t, []string{"Đức đã", "trả"}, wrap("Đức đã trả", 6))
+}
+
+func TestFont_Subset(t *testing.T) {
+	glyphs := make(map[uint16]rune)
+	for _, r := range "Thuê xe ệ ữ" {
+		glyphs[bodyFont.glyph(r)] = r
+	}
+	sub := bodyFont.subset(glyphs)
+	require.Less(t, len(sub), len(liberationmonoregular.TTF)/4)
+
+	// the tables are kept apart by their directory and the whole file sums to the magic number
+	require.Equal(t, uint32(0xB1B0AFBA), checksum(sub))
+
+	// the glyphs drawn keep their outlines, others are left empty
+	parsed := &font{tables: make(map[string][]byte)}
+	for i := 0; i < int(binary.BigEndian.Uint16(sub[4:])); i++ {
+		record := sub[12+16*i:]
+		offset, length := binary.BigEndian.Uint32(record[8:]), binary.BigEndian.Uint32(record[12:])
+		parsed.tables[string(record[:4])] = sub[offset : offset+length]
+	}
+	require.Len(t, parsed.tables, len(subsetTables))
+	parsed.longLoca, parsed.numGlyphs = bodyFont.longLoca, bodyFont.numGlyphs
+
+	for id := range glyphs {
+		start, end := parsed.glyphRange(int(id))
+		origStart, origEnd := bodyFont.glyphRange(int(id))
+		require.Equal(t, bodyFont.tables["glyf"][origStart:origEnd], parsed.tables["glyf"][start:end])
+	}
+	start, end := parsed.glyphRange(int(bodyFont.glyph('z')))
+	require.Equal(t, start, end)
+}
+
+func TestDocument_Bytes(t *testing.T) {
+	d := New()
+	d.WriteText("# Hóa đơn (copy)\nTổng cộng: 1.000.000 VND")
+	for i := 0; i < 100; i++ {
+		d.Text(fmt.Sprintf("line %d", i))
+	}
+	bz := d.Bytes()
+
+	require.True(t, bytes.HasPrefix(bz, []byte("%PDF-1.4\n")))
+	require.True(t, bytes.HasSuffix(bz, []byte("%%EOF\n")))
+	require.Contains(t, string(bz), fmt.Sprintf("<%s> Tj", headingFont.hex("Hóa đơn (copy)")))
+	require.Contains(t, string(bz), fmt.Sprintf("<%s> Tj", bodyFont.hex("Tổng cộng: 1.000.000 VND")))
+	require.True(t, ContainsText(bz, "Hóa đơn"))
+	require.True(t, ContainsText(bz, "1.000.000 VND"))
+	require.False(t, ContainsText(bz, "Hoa don"))
+	require.Contains(t, string(bz), "/Count 2")
+	require.Contains(t, string(bz), "/Subtype /Type0")
+	require.Contains(t, string(bz), "/Encoding /Identity-H")
+	require.Contains(t, string(bz), "/FontFile2 ")
+
+	// the ToUnicode map gives back the characters drawn
+	require.Contains(t, string(bz), fmt.Sprintf("<%s> <1ED5>", bodyFont.hex("ổ")))
+	require.Contains(t, string(bz), fmt.Sprintf("<%s> <0111>", headingFont.hex("đ")))
+
+	// every xref offset points at its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(bz)
+	require.NotNil(t, startxref)
+	xref, err := strconv.Atoi(string(startxref[1]))
+	require.NoError(t, err)
+
+	entries := strings.Split(string(bz[xref:]), "\n")[3:]
+	for i := 1; ; i++ {
+		entry := entries[i-1]
+		if strings.HasPrefix(entry, "trailer") {
+			require.Equal(t, 16, i-1, "catalog, pages, 2 fonts of 5 objects and 2 pages with their content")
+			break
+		}
+
+		offset, err := strconv.Atoi(entry[:10])
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(bz[offset:], []byte(fmt.Sprintf("%d 0 obj", i))))
+	}
+}
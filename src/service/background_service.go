@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,20 +16,33 @@ import (
 
 const PendingPartnerApprovalKey = "Pending_Partner_Approval"
 
+const (
+	DefaultCheckExpiredReservationInterval = time.Minute
+	DefaultCheckOverdueContractInterval    = 10 * time.Minute
+)
+
 type BackgroundService struct {
 	cfg                  *misc.BackgroundJobConfig
 	db                   *store.DbStore
 	cache                *redis.Client
 	newPartnerApprovalCh chan int
+	overtimeChargeCh     chan *OvertimeCharge
+	contractStateMachine *CustomerContractStateMachine
+	cancellationEngine   *CancellationEngine
 }
 
+// NewBackgroundService takes the state machine and cancellation engine of the api server, so the
+// hooks registered on them also run for the transitions of background jobs
 func NewBackgroundService(
 	cfg *misc.BackgroundJobConfig,
 	db *store.DbStore,
 	cache *redis.Client,
 	newPartnerApprovalCh chan int,
+	overtimeChargeCh chan *OvertimeCharge,
+	contractStateMachine *CustomerContractStateMachine,
+	cancellationEngine *CancellationEngine,
 ) *BackgroundService {
-	return &BackgroundService{cfg, db, cache, newPartnerApprovalCh}
+	return &BackgroundService{cfg, db, cache, newPartnerApprovalCh, overtimeChargeCh, contractStateMachine, cancellationEngine}
 }
 
 func (s *BackgroundService) RunPartnerApprovalChecker() error {
@@ -47,6 +61,87 @@ func (s *BackgroundService) RunPartnerApprovalChecker() error {
 	}
 }
 
+// RunReservationExpiryChecker cancels the contracts whose hold on the car lapsed before they were
+// paid, refunding whatever they paid, and releases the lapsed holds
+func (s *BackgroundService) RunReservationExpiryChecker() {
+	interval := s.cfg.CheckExpiredReservationInterval
+	if interval <= 0 {
+		interval = DefaultCheckExpiredReservationInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		s.processExpiredReservations()
+	}
+}
+
+func (s *BackgroundService) processExpiredReservations() {
+	contractIDs, err := s.db.CarReservationStore.GetLapsedHoldContractIDs()
+	if err != nil {
+		return
+	}
+
+	for _, contractID := range contractIDs {
+		if _, err := s.cancellationEngine.Cancel(&CustomerContractTransition{
+			CustomerContractID: contractID,
+			From: []model.CustomerContractStatus{
+				model.CustomerContractStatusWaitingPartnerApproval,
+				model.CustomerContractStatusWaitingContractAgreement,
+				model.CustomerContractStatusWaitingContractPayment,
+			},
+			Actor:  SystemContractActor,
+			Reason: "car reservation hold expired",
+		}); err != nil &&
+			!errors.Is(err, ErrInvalidCustomerContractTransition) &&
+			!errors.Is(err, ErrCustomerContractNotCancellable) {
+			fmt.Printf("BackgroundService: cancel contract %d of expired hold %v\n", contractID, err)
+		}
+	}
+
+	if released, err := s.db.CarReservationStore.ReleaseExpired(); err == nil && released > 0 {
+		fmt.Printf("BackgroundService: released %d expired car reservations\n", released)
+	}
+}
+
+// RunOverdueContractChecker charges the overtime of renting contracts past their end date and
+// hands every new charge to overtimeChargeCh, so the parties of the contract get notified
+func (s *BackgroundService) RunOverdueContractChecker() {
+	interval := s.cfg.CheckOverdueContractInterval
+	if interval <= 0 {
+		interval = DefaultCheckOverdueContractInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		s.processOverdueContracts(time.Now())
+	}
+}
+
+func (s *BackgroundService) processOverdueContracts(now time.Time) {
+	contracts, err := s.db.CustomerContractStore.GetByStatusEndTimeInRange(time.Time{}, now, model.CustomerContractStatusRenting)
+	if err != nil {
+		return
+	}
+
+	for _, c := range contracts {
+		charge, err := s.contractStateMachine.ChargeOvertime(c.ID, now)
+		if err != nil {
+			fmt.Printf("BackgroundService: charge overtime of contract %d %v\n", c.ID, err)
+			continue
+		}
+
+		if charge == nil {
+			continue
+		}
+
+		select {
+		case s.overtimeChargeCh <- charge:
+		default:
+			fmt.Printf("BackgroundService: drop overtime notification of contract %d\n", c.ID)
+		}
+	}
+}
+
 func (s *BackgroundService) appendNewPendingPartnerApproval(contractID int) error {
 	old, err := s.loadMap(PendingPartnerApprovalKey)
 	if err != nil {
@@ -100,14 +195,25 @@ func (s *BackgroundService) processWaitingPartnerApproval() error {
 
 	delIds := make([]int, 0)
 	for _, c := range contracts {
-		if time.Now().After(c.CreatedAt.Add(s.cfg.MaxPartnerWaitingApprovalTime)) {
+		if c.Status != model.CustomerContractStatusWaitingPartnerApproval {
 			delIds = append(delIds, c.ID)
+			continue
 		}
-	}
 
-	if err := s.db.CustomerContractStore.UpdateBatchWhenCurStatus(
-		delIds, map[string]interface{}{"status": model.CustomerContractStatusCancel}, model.CustomerContractStatusWaitingPartnerApproval); err != nil {
-		return err
+		if time.Now().After(c.CreatedAt.Add(s.cfg.MaxPartnerWaitingApprovalTime)) {
+			if _, err := s.cancellationEngine.Cancel(&CustomerContractTransition{
+				CustomerContractID: c.ID,
+				From:               []model.CustomerContractStatus{model.CustomerContractStatusWaitingPartnerApproval},
+				Actor:              SystemContractActor,
+				Reason:             "partner approval timeout",
+			}); err != nil &&
+				!errors.Is(err, ErrInvalidCustomerContractTransition) &&
+				!errors.Is(err, ErrCustomerContractNotCancellable) {
+				fmt.Printf("BackgroundService: cancel contract %d %v\n", c.ID, err)
+				continue
+			}
+			delIds = append(delIds, c.ID)
+		}
 	}
 
 	return s.delElements(PendingPartnerApprovalKey, delIds)
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/pdf"
+	"github.com/godev111222333/capstone-backend/src/store"
+)
+
+var (
+	ErrInvalidContractTemplate  = errors.New("invalid contract template")
+	ErrContractTemplateNotDraft = errors.New("contract template is not a draft")
+)
+
+// ContractTemplateField is a placeholder contract templates can use, Sample is its value in
+// previews
+type ContractTemplateField struct {
+	Name   string `json:"name"`
+	Sample string `json:"sample"`
+}
+
+// ContractTemplateFields lists the payload fields of each contract type, they match the payloads
+// built by the api server
+var ContractTemplateFields = map[model.ContractTemplateType][]ContractTemplateField{
+	model.ContractTemplateTypeCustomer: {
+		{"now_date", "18"},
+		{"now_month", "10"},
+		{"now_year", "2026"},
+		{"customer_fullname", "Nguyễn Văn An"},
+		{"customer_date_of_birth", "01/02/1990"},
+		{"customer_id_card", "079090000001"},
+		{"brand_model", "Toyota Vios"},
+		{"license_plate", "51A-123.45"},
+		{"number_of_seats", "5"},
+		{"car_year", "2022"},
+		{"price", "1500000"},
+		{"prepay_percent", "30.00"},
+		{"insurance_percent", "10.00"},
+		{"start_hour", "8"},
+		{"start_date", "20"},
+		{"start_month", "10"},
+		{"start_year", "2026"},
+		{"end_hour", "8"},
+		{"end_date", "22"},
+		{"end_month", "10"},
+		{"end_year", "2026"},
+		{"bank_number", "0123456789"},
+		{"bank_name", "Vietcombank"},
+		{"bank_owner", "NGUYEN VAN AN"},
+		{"collateral_amount_1", "15000000"},
+		{"collateral_amount_2", "15000000"},
+	},
+	model.ContractTemplateTypePartner: {
+		{"now_date", "18"},
+		{"now_month", "10"},
+		{"now_year", "2026"},
+		{"partner_fullname", "Trần Thị Bình"},
+		{"partner_date_of_birth", "01/02/1985"},
+		{"partner_id_card", "079085000001"},
+		{"brand_model", "Toyota Vios"},
+		{"license_plate", "51A-123.45"},
+		{"number_of_seats", "5"},
+		{"car_year", "2022"},
+		{"period", "6"},
+		{"period_start_date", "1"},
+		{"period_start_month", "11"},
+		{"period_start_year", "2026"},
+		{"period_end_date", "1"},
+		{"period_end_month", "5"},
+		{"period_end_year", "2027"},
+		{"partner_revenue_percent", "70"},
+		{"partner_bank_number", "0123456789"},
+		{"partner_bank_owner", "TRAN THI BINH"},
+		{"partner_bank_name", "Vietcombank"},
+	},
+}
+
+// SampleContractPayload returns the sample payload of a contract type
+func SampleContractPayload(templateType model.ContractTemplateType) map[string]string {
+	res := make(map[string]string)
+	for _, field := range ContractTemplateFields[templateType] {
+		res[field.Name] = field.Sample
+	}
+
+	return res
+}
+
+var contractTemplateFuncs = template.FuncMap{
+	"money": func(amount string) (string, error) {
+		n, err := strconv.Atoi(amount)
+		if err != nil {
+			return "", err
+		}
+		return formatMoney(n), nil
+	},
+}
+
+func parseContractTemplate(t *model.ContractTemplate) (*template.Template, error) {
+	return template.New(fmt.Sprintf("%s_v%d", t.Type, t.Version)).
+		Option("missingkey=error").
+		Funcs(contractTemplateFuncs).
+		Parse(t.Body)
+}
+
+// ExecuteContractTemplate fills in a template, a placeholder missing from the payload is an error
+func ExecuteContractTemplate(t *model.ContractTemplate, payload map[string]string) (string, error) {
+	tmpl, err := parseContractTemplate(t)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, payload); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// RenderContractTemplate returns the PDF file of a contract rendered with a template
+func RenderContractTemplate(t *model.ContractTemplate, payload map[string]string) ([]byte, error) {
+	text, err := ExecuteContractTemplate(t, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return pdf.FromText(text), nil
+}
+
+// ValidateContractTemplate checks that a template parses, only uses the payload fields of its type
+// and renders with the sample payload
+func ValidateContractTemplate(t *model.ContractTemplate) error {
+	fields, ok := ContractTemplateFields[t.Type]
+	if !ok {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidContractTemplate, t.Type)
+	}
+
+	if strings.TrimSpace(t.Body) == "" {
+		return fmt.Errorf("%w: body is empty", ErrInvalidContractTemplate)
+	}
+
+	tmpl, err := parseContractTemplate(t)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidContractTemplate, err)
+	}
+
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field.Name] = true
+	}
+
+	used := make(map[string]bool)
+	for _, tree := range tmpl.Templates() {
+		if tree.Tree != nil {
+			collectTemplateFields(tree.Tree.Root, used)
+		}
+	}
+
+	unknown := make([]string, 0)
+	for name := range used {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: unknown placeholders %s", ErrInvalidContractTemplate, strings.Join(unknown, ", "))
+	}
+
+	if _, err := ExecuteContractTemplate(t, SampleContractPayload(t.Type)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidContractTemplate, err)
+	}
+
+	return nil
+}
+
+// collectTemplateFields adds the payload fields a template node reads, like price for {{.price}}
+func collectTemplateFields(node parse.Node, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateFields(child, fields)
+		}
+	case *parse.ActionNode:
+		collectTemplateFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectTemplateFields(cmd, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectTemplateFields(arg, fields)
+		}
+	case *parse.ChainNode:
+		collectTemplateFields(n.Node, fields)
+	case *parse.FieldNode:
+		fields[n.Ident[0]] = true
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			fields[n.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		collectBranchFields(&n.BranchNode, fields)
+	case *parse.RangeNode:
+		collectBranchFields(&n.BranchNode, fields)
+	case *parse.WithNode:
+		collectBranchFields(&n.BranchNode, fields)
+	case *parse.TemplateNode:
+		collectTemplateFields(n.Pipe, fields)
+	}
+}
+
+func collectBranchFields(n *parse.BranchNode, fields map[string]bool) {
+	collectTemplateFields(n.Pipe, fields)
+	collectTemplateFields(n.List, fields)
+	collectTemplateFields(n.ElseList, fields)
+}
+
+// ContractTemplateService manages the template versions admins write. A version never changes
+// once created, so a contract pinned to it renders the same wording later.
+type ContractTemplateService struct {
+	db  *store.DbStore
+	now func() time.Time
+}
+
+func NewContractTemplateService(db *store.DbStore) *ContractTemplateService {
+	return &ContractTemplateService{db, time.Now}
+}
+
+// Create validates a template and stores it as a draft with the next version of its type
+func (s *ContractTemplateService) Create(t *model.ContractTemplate) error {
+	if err := ValidateContractTemplate(t); err != nil {
+		return err
+	}
+
+	t.Status = model.ContractTemplateStatusDraft
+	return s.db.ContractTemplateStore.Create(t)
+}
+
+// Preview renders a template with the sample payload of its type, overridden by payload
+func (s *ContractTemplateService) Preview(t *model.ContractTemplate, payload map[string]string) ([]byte, error) {
+	if err := ValidateContractTemplate(t); err != nil {
+		return nil, err
+	}
+
+	sample := SampleContractPayload(t.Type)
+	for k, v := range payload {
+		sample[k] = v
+	}
+
+	bz, err := RenderContractTemplate(t, sample)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidContractTemplate, err)
+	}
+
+	return bz, nil
+}
+
+// Publish makes a draft the version new contracts of its type are rendered with
+func (s *ContractTemplateService) Publish(id int) (*model.ContractTemplate, error) {
+	t := &model.ContractTemplate{ID: id}
+	if err := s.db.DB.Transaction(func(tx *gorm.DB) error {
+		published, err := s.db.ContractTemplateStore.PublishTx(tx, t, s.now())
+		if err != nil {
+			return err
+		}
+
+		if !published {
+			return fmt.Errorf("%w: version %d is %s", ErrContractTemplateNotDraft, t.Version, t.Status)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
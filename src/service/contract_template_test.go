@@ -0,0 +1,109 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/pdf"
+)
+
+func TestValidateContractTemplate(t *testing.T) {
+	builtins, err := BuiltinContractTemplates()
+	require.NoError(t, err)
+	require.Len(t, builtins, 2)
+	for _, builtin := range builtins {
+		require.NoError(t, ValidateContractTemplate(builtin), builtin.Type)
+	}
+
+	for name, body := range map[string]string{
+		"empty":               " \n",
+		"syntax error":        "Giá thuê: {{.price",
+		"unknown placeholder": "Biển số: {{.license_plate}} {{if .discount}}{{.discount}}{{end}}",
+		"other type field":    "Đối tác: {{.partner_fullname}}",
+		"unknown function":    "{{upper .customer_fullname}}",
+		"money of text":       "{{money .customer_fullname}}",
+	} {
+		err := ValidateContractTemplate(&model.ContractTemplate{Type: model.ContractTemplateTypeCustomer, Body: body})
+		require.ErrorIs(t, err, ErrInvalidContractTemplate, name)
+	}
+
+	err = ValidateContractTemplate(&model.ContractTemplate{Type: model.ContractTemplateTypeCustomer, Body: "{{.discount}}"})
+	require.ErrorContains(t, err, "discount")
+
+	require.NoError(t, ValidateContractTemplate(&model.ContractTemplate{
+		Type: model.ContractTemplateTypeCustomer,
+		Body: "# HỢP ĐỒNG\n{{with .customer_fullname}}Bên B: {{.}}{{end}}\nGiá thuê: {{money $.price}}",
+	}))
+}
+
+func TestContractTemplateService(t *testing.T) {
+	pdfService, err := NewLocalPDFService(TestDb, TestS3Store)
+	require.NoError(t, err)
+	s := NewContractTemplateService(TestDb)
+
+	published, err := TestDb.ContractTemplateStore.GetPublished(model.ContractTemplateTypeCustomer)
+	require.NoError(t, err)
+
+	payload := SampleContractPayload(model.ContractTemplateTypeCustomer)
+	payload["customer_fullname"] = "Lê Văn Cường"
+
+	draft := &model.ContractTemplate{
+		Type: model.ContractTemplateTypeCustomer,
+		Body: "# HỢP ĐỒNG THUÊ XE (MẪU MỚI)\nBên thuê: {{.customer_fullname}}\nGiá thuê: {{money .price}}",
+		Note: "New wording",
+	}
+	require.NoError(t, s.Create(draft))
+	require.Equal(t, model.ContractTemplateStatusDraft, draft.Status)
+	require.Greater(t, draft.Version, published.Version)
+
+	t.Run("drafts are previewed but not used for contracts", func(t *testing.T) {
+		bz, err := s.Preview(draft, map[string]string{"price": "2000000"})
+		require.NoError(t, err)
+		require.True(t, pdf.ContainsText(bz, "MẪU MỚI"))
+		require.True(t, pdf.ContainsText(bz, "2.000.000 VND"))
+
+		_, version, err := pdfService.RenderPDF(RenderTypeCustomer, 0, payload)
+		require.NoError(t, err)
+		require.Equal(t, published.Version, version)
+
+		_, _, err = pdfService.RenderPDF(RenderTypeCustomer, draft.Version, payload)
+		require.ErrorIs(t, err, ErrContractTemplateNotPublished)
+	})
+
+	t.Run("publishing retires the previous version", func(t *testing.T) {
+		res, err := s.Publish(draft.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.ContractTemplateStatusPublished, res.Status)
+		require.NotNil(t, res.PublishedAt)
+
+		_, err = s.Publish(draft.ID)
+		require.ErrorIs(t, err, ErrContractTemplateNotDraft)
+
+		previous, err := TestDb.ContractTemplateStore.GetByID(published.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.ContractTemplateStatusRetired, previous.Status)
+
+		bz, version, err := pdfService.RenderPDF(RenderTypeCustomer, 0, payload)
+		require.NoError(t, err)
+		require.Equal(t, draft.Version, version)
+		require.True(t, pdf.ContainsText(bz, "MẪU MỚI"))
+	})
+
+	t.Run("pinned contracts render with their version", func(t *testing.T) {
+		first, version, err := pdfService.RenderPDF(RenderTypeCustomer, published.Version, payload)
+		require.NoError(t, err)
+		require.Equal(t, published.Version, version)
+		require.False(t, pdf.ContainsText(first, "MẪU MỚI"))
+
+		again, _, err := pdfService.RenderPDF(RenderTypeCustomer, published.Version, payload)
+		require.NoError(t, err)
+		require.Equal(t, first, again)
+	})
+
+	t.Run("placeholders are validated", func(t *testing.T) {
+		err := s.Create(&model.ContractTemplate{Type: model.ContractTemplateTypePartner, Body: "{{.customer_fullname}}"})
+		require.ErrorIs(t, err, ErrInvalidContractTemplate)
+	})
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/store"
+)
+
+var ErrCustomerContractNotCancellable = errors.New("customer contract can not be canceled in its current status")
+
+// CustomerContractCancellation is the outcome of canceling a contract. RefundPayments are the
+// pending refund_pre_pay and return_collateral_cash payments that the refund hooks pay out.
+type CustomerContractCancellation struct {
+	Contract       *model.CustomerContract  `json:"contract"`
+	RefundPercent  float64                  `json:"refund_percent"`
+	PaidPrepay     int                      `json:"paid_prepay"`
+	RefundAmount   int                      `json:"refund_amount"`
+	RefundPayments []*model.CustomerPayment `json:"refund_payments"`
+	WarningPenalty int                      `json:"warning_penalty"`
+}
+
+// CancellationEngine cancels contracts following the cancellation policy of the rule a contract
+// was signed with. Customers get the tiered refund of their prepay and only in cancellable
+// statuses; when anybody else cancels, the prepay is refunded in full and a canceling partner
+// gets the warning penalty. Cash collateral is always returned in full.
+type CancellationEngine struct {
+	db           *store.DbStore
+	stateMachine *CustomerContractStateMachine
+	now          func() time.Time
+}
+
+func NewCancellationEngine(db *store.DbStore, stateMachine *CustomerContractStateMachine) *CancellationEngine {
+	return &CancellationEngine{db, stateMachine, time.Now}
+}
+
+// Quote computes the cancellation without changing anything
+func (e *CancellationEngine) Quote(contractID int, actor ContractActor) (*CustomerContractCancellation, error) {
+	contract, err := e.db.CustomerContractStore.FindByID(contractID)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.compute(e.db.DB, contract, actor)
+}
+
+// Cancel computes the refund, creates the refund payments, cancels the pending payments, applies
+// the partner penalty and moves the contract to canceled in one transaction. t.To is always
+// canceled and t.Reason is also stored as the contract's reason.
+func (e *CancellationEngine) Cancel(t *CustomerContractTransition) (*CustomerContractCancellation, error) {
+	t.To = model.CustomerContractStatusCancel
+	if t.Values == nil {
+		t.Values = map[string]interface{}{}
+	}
+	t.Values["reason"] = t.Reason
+
+	contractID, actor := t.CustomerContractID, t.Actor
+	var res *CustomerContractCancellation
+	if err := e.db.DB.Transaction(func(tx *gorm.DB) error {
+		contract, err := e.db.CustomerContractStore.FindByIDForUpdate(tx, contractID)
+		if err != nil {
+			return err
+		}
+
+		res, err = e.compute(tx, contract, actor)
+		if err != nil {
+			return err
+		}
+
+		if res.Contract, err = e.stateMachine.TransitTx(tx, t); err != nil {
+			return err
+		}
+
+		if err := e.db.CustomerPaymentStore.CancelPendingTx(tx, contractID); err != nil {
+			return err
+		}
+
+		for _, payment := range res.RefundPayments {
+			if err := e.db.CustomerPaymentStore.CreateTx(tx, payment); err != nil {
+				return err
+			}
+		}
+
+		if res.WarningPenalty > 0 {
+			return e.db.CarStore.IncreaseWarningCountTx(tx, contract.CarID, res.WarningPenalty)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	e.stateMachine.AfterCommit(res.Contract, t)
+	return res, nil
+}
+
+func (e *CancellationEngine) compute(
+	tx *gorm.DB,
+	contract *model.CustomerContract,
+	actor ContractActor,
+) (*CustomerContractCancellation, error) {
+	if !model.CanTransitCustomerContract(contract.Status, model.CustomerContractStatusCancel) {
+		return nil, fmt.Errorf("%w: %s", ErrCustomerContractNotCancellable, contract.Status)
+	}
+
+	rule, err := e.db.CustomerContractRuleStore.GetByIDTx(tx, contract.CustomerContractRuleID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CustomerContractCancellation{Contract: contract, RefundPercent: 100}
+	switch actor.Role {
+	case model.RoleNameCustomer:
+		if !rule.IsCancellableByCustomer(contract.Status) {
+			return nil, fmt.Errorf("%w: %s", ErrCustomerContractNotCancellable, contract.Status)
+		}
+		res.RefundPercent = rule.CancellationRefundPercent(contract.StartDate.Sub(e.now()).Hours())
+	case model.RoleNamePartner:
+		res.WarningPenalty = rule.PartnerCancelWarningPenalty
+	}
+
+	paid, err := e.db.CustomerPaymentStore.GetByStatusTx(tx, contract.ID, model.PaymentStatusPaid)
+	if err != nil {
+		return nil, err
+	}
+
+	res.RefundPayments = make([]*model.CustomerPayment, 0)
+	for _, payment := range paid {
+		switch payment.PaymentType {
+		case model.PaymentTypePrePay:
+			res.PaidPrepay += payment.Amount
+		case model.PaymentTypeCollateralCash:
+			res.RefundPayments = append(res.RefundPayments, &model.CustomerPayment{
+				CustomerContractID: contract.ID,
+				PaymentType:        model.PaymentTypeReturnCollateralCash,
+				Amount:             payment.Amount,
+				Status:             model.PaymentStatusPending,
+				Note:               "return collateral cash of canceled contract",
+			})
+		}
+	}
+
+	res.RefundAmount = int(float64(res.PaidPrepay) * res.RefundPercent / 100)
+	if res.RefundAmount > 0 {
+		res.RefundPayments = append(res.RefundPayments, &model.CustomerPayment{
+			CustomerContractID: contract.ID,
+			PaymentType:        model.PaymentTypeReturnPrepay,
+			Amount:             res.RefundAmount,
+			Status:             model.PaymentStatusPending,
+			Note:               fmt.Sprintf("refund %.1f%% of prepay of canceled contract", res.RefundPercent),
+		})
+	}
+
+	return res, nil
+}
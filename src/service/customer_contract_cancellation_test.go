@@ -0,0 +1,128 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestCancellationEngine(t *testing.T) {
+	carModel := &model.CarModel{Brand: "Cancellation"}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+	partner := &model.Account{PhoneNumber: "0201", Status: model.AccountStatusActive, RoleID: model.RoleIDPartner}
+	require.NoError(t, TestDb.AccountStore.Create(partner))
+	customer := &model.Account{PhoneNumber: "0202", Status: model.AccountStatusActive, RoleID: model.RoleIDCustomer}
+	require.NoError(t, TestDb.AccountStore.Create(customer))
+	car := &model.Car{PartnerID: partner.ID, CarModelID: carModel.ID, LicensePlate: "cc-01", Status: model.CarStatusActive, PartnerContractRuleID: 1}
+	require.NoError(t, TestDb.CarStore.Create(car))
+	rule := &model.CustomerContractRule{
+		PrepayPercent:               30,
+		CancellableStatuses:         model.JoinCustomerContractStatuses(model.DefaultCancellableStatuses),
+		PartnerCancelWarningPenalty: 2,
+		CancellationRefundTiers: []*model.CancellationRefundTier{
+			{MinHoursBeforeStart: 72, RefundPercent: 100},
+			{MinHoursBeforeStart: 24, RefundPercent: 50},
+		},
+	}
+	require.NoError(t, TestDb.CustomerContractRuleStore.Create(rule))
+
+	m := NewCustomerContractStateMachine(TestDb)
+	engine := NewCancellationEngine(TestDb, m)
+	customerActor := ContractActor{AccountID: customer.ID, Role: model.RoleNameCustomer}
+
+	newContract := func(status model.CustomerContractStatus, hoursBeforeStart int, payments ...*model.CustomerPayment) *model.CustomerContract {
+		startDate := time.Now().Add(time.Duration(hoursBeforeStart) * time.Hour)
+		contract := &model.CustomerContract{
+			CustomerID:             customer.ID,
+			CarID:                  car.ID,
+			StartDate:              startDate,
+			EndDate:                startDate.Add(48 * time.Hour),
+			Status:                 status,
+			CollateralType:         model.CollateralTypeCash,
+			CustomerContractRuleID: rule.ID,
+		}
+		require.NoError(t, m.Create(contract, customerActor))
+		for _, payment := range payments {
+			payment.CustomerContractID = contract.ID
+			require.NoError(t, TestDb.CustomerPaymentStore.Create(payment))
+		}
+		return contract
+	}
+
+	t.Run("customer gets the refund of the tier reached", func(t *testing.T) {
+		contract := newContract(model.CustomerContractStatusOrdered, 30,
+			&model.CustomerPayment{PaymentType: model.PaymentTypePrePay, Amount: 1_000_000, Status: model.PaymentStatusPaid},
+			&model.CustomerPayment{PaymentType: model.PaymentTypeCollateralCash, Amount: 5_000_000, Status: model.PaymentStatusPaid},
+			&model.CustomerPayment{PaymentType: model.PaymentTypeRemainingPay, Amount: 2_000_000, Status: model.PaymentStatusPending},
+		)
+
+		quote, err := engine.Quote(contract.ID, customerActor)
+		require.NoError(t, err)
+		require.Equal(t, 50.0, quote.RefundPercent)
+		require.Equal(t, 500_000, quote.RefundAmount)
+
+		res, err := engine.Cancel(&CustomerContractTransition{CustomerContractID: contract.ID, Actor: customerActor, Reason: "busy"})
+		require.NoError(t, err)
+		require.Equal(t, model.CustomerContractStatusCancel, res.Contract.Status)
+		require.Equal(t, 500_000, res.RefundAmount)
+
+		pending, err := TestDb.CustomerPaymentStore.GetByCustomerContractID(contract.ID, model.PaymentStatusPending, 0, 0)
+		require.NoError(t, err)
+		amounts := map[model.PaymentType]int{}
+		for _, payment := range pending {
+			amounts[payment.PaymentType] = payment.Amount
+		}
+		require.Equal(t, map[model.PaymentType]int{
+			model.PaymentTypeReturnPrepay:         500_000,
+			model.PaymentTypeReturnCollateralCash: 5_000_000,
+		}, amounts)
+
+		canceled, err := TestDb.CustomerPaymentStore.GetByCustomerContractID(contract.ID, model.PaymentStatusCanceled, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, canceled, 1)
+		require.Equal(t, model.PaymentTypeRemainingPay, canceled[0].PaymentType)
+	})
+
+	t.Run("customer gets nothing past the last tier", func(t *testing.T) {
+		contract := newContract(model.CustomerContractStatusOrdered, 2,
+			&model.CustomerPayment{PaymentType: model.PaymentTypePrePay, Amount: 1_000_000, Status: model.PaymentStatusPaid},
+		)
+
+		res, err := engine.Cancel(&CustomerContractTransition{CustomerContractID: contract.ID, Actor: customerActor})
+		require.NoError(t, err)
+		require.Equal(t, 0, res.RefundAmount)
+		require.Empty(t, res.RefundPayments)
+	})
+
+	t.Run("customer can not cancel outside cancellable statuses", func(t *testing.T) {
+		contract := newContract(model.CustomerContractStatusAppraisingCarApproved, 100)
+
+		_, err := engine.Cancel(&CustomerContractTransition{CustomerContractID: contract.ID, Actor: customerActor})
+		require.ErrorIs(t, err, ErrCustomerContractNotCancellable)
+
+		contract, err = TestDb.CustomerContractStore.FindByID(contract.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CustomerContractStatusAppraisingCarApproved, contract.Status)
+	})
+
+	t.Run("partner cancel refunds in full and adds the warning penalty", func(t *testing.T) {
+		contract := newContract(model.CustomerContractStatusOrdered, 2,
+			&model.CustomerPayment{PaymentType: model.PaymentTypePrePay, Amount: 1_000_000, Status: model.PaymentStatusPaid},
+		)
+
+		res, err := engine.Cancel(&CustomerContractTransition{
+			CustomerContractID: contract.ID,
+			Actor:              ContractActor{AccountID: partner.ID, Role: model.RoleNamePartner},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1_000_000, res.RefundAmount)
+		require.Equal(t, 2, res.WarningPenalty)
+
+		updatedCar, err := TestDb.CarStore.GetByID(car.ID)
+		require.NoError(t, err)
+		require.Equal(t, car.WarningCount+2, updatedCar.WarningCount)
+	})
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+var ErrCustomerContractNotChargeable = errors.New("customer contract can not be charged")
+
+// ChargeableStatuses are the statuses a contract can get charges for damages, fuel or fines in,
+// from the return of the car on
+var ChargeableStatuses = []model.CustomerContractStatus{
+	model.CustomerContractStatusReturnedCar,
+	model.CustomerContractStatusAppraisedReturnCar,
+	model.CustomerContractStatusCompleted,
+}
+
+func (m *CustomerContractStateMachine) Charge(customerContractID int, charges []*model.CustomerContractCharge) error {
+	return m.db.DB.Transaction(func(tx *gorm.DB) error {
+		return m.ChargeTx(tx, customerContractID, charges)
+	})
+}
+
+// ChargeTx settles the charges of a returned car. Charges are deducted from what is left of the
+// cash collateral as long as it is not returned, anything beyond is charged with a pending other
+// payment so the contract can not be completed before it is paid.
+func (m *CustomerContractStateMachine) ChargeTx(tx *gorm.DB, customerContractID int, charges []*model.CustomerContractCharge) error {
+	contract, err := m.db.CustomerContractStore.FindByIDForUpdate(tx, customerContractID)
+	if err != nil {
+		return err
+	}
+
+	chargeable := false
+	for _, status := range ChargeableStatuses {
+		chargeable = chargeable || contract.Status == status
+	}
+
+	if !chargeable {
+		return fmt.Errorf("%w: found %s", ErrCustomerContractNotChargeable, contract.Status)
+	}
+
+	collateralLeft, err := m.CollateralCashLeftTx(tx, contract)
+	if err != nil {
+		return err
+	}
+
+	for _, charge := range charges {
+		charge.CustomerContractID = contract.ID
+		charge.CollateralAmount = min(collateralLeft, charge.Amount)
+		collateralLeft -= charge.CollateralAmount
+
+		if rest := charge.Amount - charge.CollateralAmount; rest > 0 {
+			payment := &model.CustomerPayment{
+				CustomerContractID: contract.ID,
+				PaymentType:        model.PaymentTypeOther,
+				Amount:             rest,
+				Status:             model.PaymentStatusPending,
+				Note:               fmt.Sprintf("%s charge: %s", charge.Category, charge.Description),
+			}
+			if err := m.db.CustomerPaymentStore.CreateTx(tx, payment); err != nil {
+				return err
+			}
+			charge.CustomerPaymentID = &payment.ID
+		}
+
+		if err := m.db.CustomerContractChargeStore.CreateTx(tx, charge); err != nil {
+			return err
+		}
+
+		if err := m.ledger.PostCustomerContractChargeTx(tx, charge); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CollateralCashLeftTx returns what is left of the paid cash collateral of a contract once the
+// refunds and the charges deducted from it are taken off
+func (m *CustomerContractStateMachine) CollateralCashLeftTx(tx *gorm.DB, contract *model.CustomerContract) (int, error) {
+	if contract.CollateralType != model.CollateralTypeCash || contract.IsReturnCollateralAsset {
+		return 0, nil
+	}
+
+	payment, err := m.db.CustomerPaymentStore.GetLastPaidByPaymentType(contract.ID, model.PaymentTypeCollateralCash)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	refunded, err := m.db.CustomerRefundStore.GetRefundedAmountTx(tx, payment.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	deducted, err := m.db.CustomerContractChargeStore.SumCollateralAmountTx(tx, contract.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(0, payment.Amount-refunded-deducted), nil
+}
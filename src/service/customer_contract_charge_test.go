@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestCustomerContractStateMachine_Charge(t *testing.T) {
+	m := NewCustomerContractStateMachine(TestDb)
+	now := time.Now().Truncate(time.Second)
+	contract := newRentingContract(t, &model.CustomerContract{
+		StartDate:      now.Add(-48 * time.Hour),
+		EndDate:        now.Add(-time.Hour),
+		RentPrice:      2_000_000,
+		CollateralType: model.CollateralTypeCash,
+	})
+	require.NoError(t, TestDb.CustomerPaymentStore.Create(&model.CustomerPayment{
+		CustomerContractID: contract.ID,
+		PaymentType:        model.PaymentTypeCollateralCash,
+		Amount:             500_000,
+		Status:             model.PaymentStatusPaid,
+	}))
+
+	t.Run("cars are charged once returned", func(t *testing.T) {
+		err := m.Charge(contract.ID, []*model.CustomerContractCharge{{Category: model.CustomerContractChargeCategoryDamage, Amount: 1}})
+		require.ErrorIs(t, err, ErrCustomerContractNotChargeable)
+	})
+
+	_, err := m.Transit(&CustomerContractTransition{CustomerContractID: contract.ID, To: model.CustomerContractStatusReturnedCar, Actor: SystemContractActor})
+	require.NoError(t, err)
+
+	t.Run("charges are taken from the collateral first", func(t *testing.T) {
+		charges := []*model.CustomerContractCharge{
+			{Category: model.CustomerContractChargeCategoryDamage, Description: "scratched door", Amount: 300_000, ImageURLs: []string{"door.jpg"}},
+			{Category: model.CustomerContractChargeCategoryFuel, Description: "half a tank", Amount: 400_000, ImageURLs: []string{}},
+		}
+		require.NoError(t, m.Charge(contract.ID, charges))
+		require.Equal(t, 300_000, charges[0].CollateralAmount)
+		require.Nil(t, charges[0].CustomerPaymentID)
+		require.Equal(t, 200_000, charges[1].CollateralAmount)
+		require.NotNil(t, charges[1].CustomerPaymentID)
+
+		payment, err := TestDb.CustomerPaymentStore.GetByID(*charges[1].CustomerPaymentID)
+		require.NoError(t, err)
+		require.Equal(t, model.PaymentTypeOther, payment.PaymentType)
+		require.Equal(t, model.PaymentStatusPending, payment.Status)
+		require.Equal(t, 200_000, payment.Amount)
+
+		left, err := m.CollateralCashLeftTx(TestDb.DB, contract)
+		require.NoError(t, err)
+		require.Zero(t, left)
+	})
+
+	t.Run("fines found later are paid by the customer", func(t *testing.T) {
+		charges := []*model.CustomerContractCharge{
+			{Category: model.CustomerContractChargeCategoryTrafficFine, Description: "speeding", Amount: 100_000, ImageURLs: []string{}},
+		}
+		require.NoError(t, m.Charge(contract.ID, charges))
+		require.Zero(t, charges[0].CollateralAmount)
+		require.NotNil(t, charges[0].CustomerPaymentID)
+
+		found, err := TestDb.CustomerContractChargeStore.GetByCustomerContractID(contract.ID)
+		require.NoError(t, err)
+		require.Len(t, found, 3)
+		require.Equal(t, []string{"door.jpg"}, found[0].ImageURLs)
+	})
+}
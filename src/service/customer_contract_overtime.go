@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+// overtimeFeeNote starts the note of overtime payments, telling them from other remaining payments
+const overtimeFeeNote = "overtime fee"
+
+// OvertimeCharge is an overtime fee newly charged on a renting contract past its end date
+type OvertimeCharge struct {
+	CustomerContractID int
+	// Payment is the pending overtime payment of the contract, holding all of the overtime not paid yet
+	Payment *model.CustomerPayment
+	// FirstCharge is true when the contract was not charged any overtime before
+	FirstCharge bool
+}
+
+// ChargeOvertime charges a renting contract for keeping its car until at, with the overtime fee of
+// the rule the contract was signed with. What is due on top of the overtime already charged is
+// added to the pending overtime payment, a remaining payment, so the contract can not be completed
+// before it is paid. A new one is created only once the previous one is paid; a gateway order made
+// for the previous amount is then rejected on its amount. It returns nil when nothing new is due.
+func (m *CustomerContractStateMachine) ChargeOvertime(customerContractID int, at time.Time) (*OvertimeCharge, error) {
+	var res *OvertimeCharge
+	if err := m.db.DB.Transaction(func(tx *gorm.DB) error {
+		contract, err := m.db.CustomerContractStore.FindByIDForUpdate(tx, customerContractID)
+		if err != nil {
+			return err
+		}
+
+		if contract.Status != model.CustomerContractStatusRenting || !at.After(contract.EndDate) {
+			return nil
+		}
+
+		rule, err := m.db.CustomerContractRuleStore.GetByIDTx(tx, contract.CustomerContractRuleID)
+		if err != nil {
+			return err
+		}
+
+		car, err := m.db.CarStore.GetByID(contract.CarID)
+		if err != nil {
+			return err
+		}
+
+		lateness := at.Sub(contract.EndDate)
+		fee := rule.OvertimeFee(car.Price, lateness)
+		if fee <= contract.OvertimeFee {
+			return nil
+		}
+
+		note := fmt.Sprintf("%s, car returned %s late", overtimeFeeNote, lateness.Truncate(time.Minute))
+		payment, err := m.db.CustomerPaymentStore.GetLastPendingByNoteTx(
+			tx, contract.ID, model.PaymentTypeRemainingPay, overtimeFeeNote)
+		if err != nil {
+			return err
+		}
+
+		if payment != nil {
+			amount := payment.Amount + fee - contract.OvertimeFee
+			affected, err := m.db.CustomerPaymentStore.UpdateWhenCurStatusTx(tx, payment.ID, model.PaymentStatusPending,
+				map[string]interface{}{"amount": amount, "note": note})
+			if err != nil {
+				return err
+			}
+
+			// paid meanwhile, the rest goes to a new payment
+			if affected == 0 {
+				payment = nil
+			} else {
+				payment.Amount, payment.Note = amount, note
+			}
+		}
+
+		if payment == nil {
+			payment = &model.CustomerPayment{
+				CustomerContractID: contract.ID,
+				PaymentType:        model.PaymentTypeRemainingPay,
+				Amount:             fee - contract.OvertimeFee,
+				Status:             model.PaymentStatusPending,
+				Note:               note,
+			}
+			if err := m.db.CustomerPaymentStore.CreateTx(tx, payment); err != nil {
+				return err
+			}
+		}
+
+		if err := m.db.CustomerContractStore.UpdateTx(tx, contract.ID, map[string]interface{}{
+			"overtime_fee": fee,
+			"updated_at":   time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		res = &OvertimeCharge{
+			CustomerContractID: contract.ID,
+			Payment:            payment,
+			FirstCharge:        contract.OvertimeFee == 0,
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestCustomerContractStateMachine_ChargeOvertime(t *testing.T) {
+	// rule 1 charges 10% of the daily price per started hour after 30 minutes of grace
+	m := NewCustomerContractStateMachine(TestDb)
+	now := time.Now().Truncate(time.Second)
+	contract := newReservedContract(t, &model.CustomerContract{
+		CarID:     newTestCar(t, &model.Car{Price: 1_000_000}).ID,
+		StartDate: now.Add(-48 * time.Hour),
+		EndDate:   now.Add(-150 * time.Minute),
+		RentPrice: 2_000_000,
+	})
+
+	charge, err := m.ChargeOvertime(contract.ID, now)
+	require.NoError(t, err)
+	require.Nil(t, charge, "only renting contracts are charged")
+
+	newRentingContract(t, contract)
+
+	t.Run("nothing is charged within the grace period", func(t *testing.T) {
+		charge, err := m.ChargeOvertime(contract.ID, contract.EndDate.Add(20*time.Minute))
+		require.NoError(t, err)
+		require.Nil(t, charge)
+	})
+
+	t.Run("every started hour is charged once", func(t *testing.T) {
+		charge, err := m.ChargeOvertime(contract.ID, now)
+		require.NoError(t, err)
+		require.NotNil(t, charge)
+		require.True(t, charge.FirstCharge)
+		require.Equal(t, model.PaymentTypeRemainingPay, charge.Payment.PaymentType)
+		require.Equal(t, model.PaymentStatusPending, charge.Payment.Status)
+		require.Equal(t, 300_000, charge.Payment.Amount)
+
+		charge, err = m.ChargeOvertime(contract.ID, now.Add(10*time.Minute))
+		require.NoError(t, err)
+		require.Nil(t, charge, "the third hour is already charged")
+
+		first := charge.Payment
+		charge, err = m.ChargeOvertime(contract.ID, now.Add(time.Hour))
+		require.NoError(t, err)
+		require.NotNil(t, charge)
+		require.False(t, charge.FirstCharge)
+		require.Equal(t, first.ID, charge.Payment.ID, "the pending payment grows")
+		require.Equal(t, 400_000, charge.Payment.Amount)
+
+		updated, err := TestDb.CustomerContractStore.FindByID(contract.ID)
+		require.NoError(t, err)
+		require.Equal(t, 400_000, updated.OvertimeFee)
+
+		pending, err := TestDb.CustomerPaymentStore.GetByCustomerContractID(contract.ID, model.PaymentStatusPending, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		require.Equal(t, 400_000, pending[0].Amount)
+	})
+
+	t.Run("overtime after a paid charge gets a payment of its own", func(t *testing.T) {
+		pending, err := TestDb.CustomerPaymentStore.GetByCustomerContractID(contract.ID, model.PaymentStatusPending, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		require.NoError(t, TestDb.CustomerPaymentStore.Update(pending[0].ID, map[string]interface{}{
+			"status": string(model.PaymentStatusPaid),
+		}))
+
+		charge, err := m.ChargeOvertime(contract.ID, now.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.NotNil(t, charge)
+		require.NotEqual(t, pending[0].ID, charge.Payment.ID)
+		require.Equal(t, 100_000, charge.Payment.Amount)
+	})
+}
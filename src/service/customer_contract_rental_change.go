@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+var ErrCustomerContractNotChangeable = errors.New("end date of customer contract can not be changed")
+
+// RentalChange moves the end of a renting contract, to extend it or to return the car early.
+// RentPrice and InsuranceAmount are the new totals of the contract and Payments are created
+// together with the change, like the extension payment or the early return refunds.
+type RentalChange struct {
+	CustomerContractID int
+	// PrevEndDate is the end date the change was priced against, the change fails when the
+	// contract was changed meanwhile
+	PrevEndDate     time.Time
+	EndDate         time.Time
+	RentPrice       int
+	InsuranceAmount int
+	Payments        []*model.CustomerPayment
+	Actor           ContractActor
+	Reason          string
+}
+
+// ChangeEndDate moves the end of a renting contract together with its booking and its return
+// slots in one transaction and writes a renting -> renting audit event. A longer rental fails with
+// ErrCarReserved when the car is reserved after the contract. Pending extension payments are
+// canceled when the rental gets shorter, the new prices already cover what is left of them.
+func (m *CustomerContractStateMachine) ChangeEndDate(c *RentalChange) (*model.CustomerContract, error) {
+	var res *model.CustomerContract
+	if err := m.db.DB.Transaction(func(tx *gorm.DB) error {
+		contract, err := m.db.CustomerContractStore.FindByIDForUpdate(tx, c.CustomerContractID)
+		if err != nil {
+			return err
+		}
+
+		if contract.Status != model.CustomerContractStatusRenting {
+			return fmt.Errorf("%w: require %s, found %s", ErrCustomerContractNotChangeable, model.CustomerContractStatusRenting, contract.Status)
+		}
+
+		if !contract.EndDate.Equal(c.PrevEndDate) {
+			return fmt.Errorf("%w: contract %d was changed concurrently", ErrCustomerContractNotChangeable, contract.ID)
+		}
+
+		if !c.EndDate.After(contract.StartDate) {
+			return fmt.Errorf("%w: end date must be after the start date", ErrCustomerContractNotChangeable)
+		}
+
+		moved, err := m.db.CarReservationStore.MoveEndTx(tx, contract, c.EndDate)
+		if err != nil {
+			return err
+		}
+
+		if !moved {
+			return fmt.Errorf("%w: car %d after contract %d", ErrCarReserved, contract.CarID, contract.ID)
+		}
+
+		if err := m.db.CustomerContractStore.UpdateTx(tx, contract.ID, map[string]interface{}{
+			"end_date":         c.EndDate,
+			"rent_price":       c.RentPrice,
+			"insurance_amount": c.InsuranceAmount,
+			"updated_at":       time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		if err := m.db.CustomerContractDeliveryStore.RescheduleReturnTx(tx, contract.ID, c.EndDate); err != nil {
+			return err
+		}
+
+		if c.EndDate.Before(contract.EndDate) {
+			if err := m.db.CustomerPaymentStore.CancelPendingByTypeTx(tx, contract.ID, model.PaymentTypeExtension); err != nil {
+				return err
+			}
+		}
+
+		for _, payment := range c.Payments {
+			payment.CustomerContractID = contract.ID
+			if err := m.db.CustomerPaymentStore.CreateTx(tx, payment); err != nil {
+				return err
+			}
+		}
+
+		if err := m.db.CustomerContractEventStore.CreateTx(
+			tx,
+			newCustomerContractEvent(contract.ID, contract.Status, contract.Status, c.Actor, c.Reason),
+		); err != nil {
+			return err
+		}
+
+		contract.EndDate, contract.RentPrice, contract.InsuranceAmount = c.EndDate, c.RentPrice, c.InsuranceAmount
+		res = contract
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
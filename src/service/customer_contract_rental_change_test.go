@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestCustomerContractStateMachine_ChangeEndDate(t *testing.T) {
+	m := NewCustomerContractStateMachine(TestDb)
+	now := time.Now().Truncate(time.Second)
+	renting := newRentingContract(t, &model.CustomerContract{
+		StartDate: now.Add(-24 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+		RentPrice: 1_000_000,
+	})
+	customerActor := ContractActor{AccountID: renting.CustomerID, Role: model.RoleNameCustomer}
+
+	next := newReservedContract(t, &model.CustomerContract{
+		CustomerID: renting.CustomerID,
+		CarID:      renting.CarID,
+		StartDate:  now.Add(48 * time.Hour),
+		EndDate:    now.Add(72 * time.Hour),
+		RentPrice:  1_000_000,
+	})
+
+	t.Run("extending over the next reservation fails", func(t *testing.T) {
+		_, err := m.ChangeEndDate(&RentalChange{
+			CustomerContractID: renting.ID,
+			PrevEndDate:        renting.EndDate,
+			EndDate:            now.Add(50 * time.Hour),
+			RentPrice:          2_000_000,
+			Actor:              customerActor,
+		})
+		require.ErrorIs(t, err, ErrCarReserved)
+	})
+
+	t.Run("extending moves the booking and creates the payment", func(t *testing.T) {
+		endDate := now.Add(36 * time.Hour)
+		contract, err := m.ChangeEndDate(&RentalChange{
+			CustomerContractID: renting.ID,
+			PrevEndDate:        renting.EndDate,
+			EndDate:            endDate,
+			RentPrice:          1_500_000,
+			Payments: []*model.CustomerPayment{{
+				PaymentType: model.PaymentTypeExtension,
+				Amount:      500_000,
+				Status:      model.PaymentStatusPending,
+			}},
+			Actor: customerActor,
+		})
+		require.NoError(t, err)
+		require.True(t, endDate.Equal(contract.EndDate))
+		require.Equal(t, 1_500_000, contract.RentPrice)
+
+		reservations, err := TestDb.CarReservationStore.GetByCustomerContractID(renting.ID)
+		require.NoError(t, err)
+		require.Len(t, reservations, 1)
+		require.True(t, endDate.Equal(reservations[0].EndDate))
+
+		_, err = m.ChangeEndDate(&RentalChange{
+			CustomerContractID: renting.ID,
+			PrevEndDate:        renting.EndDate,
+			EndDate:            now.Add(40 * time.Hour),
+			Actor:              customerActor,
+		})
+		require.ErrorIs(t, err, ErrCustomerContractNotChangeable, "priced against a stale end date")
+		renting.EndDate = endDate
+	})
+
+	t.Run("returning early cancels the pending extension", func(t *testing.T) {
+		contract, err := m.ChangeEndDate(&RentalChange{
+			CustomerContractID: renting.ID,
+			PrevEndDate:        renting.EndDate,
+			EndDate:            now.Add(time.Hour),
+			RentPrice:          500_000,
+			Actor:              customerActor,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 500_000, contract.RentPrice)
+
+		pending, err := TestDb.CustomerPaymentStore.GetByCustomerContractID(renting.ID, model.PaymentStatusPending, 0, 0)
+		require.NoError(t, err)
+		require.Empty(t, pending)
+
+		events, err := TestDb.CustomerContractEventStore.GetByCustomerContractID(renting.ID)
+		require.NoError(t, err)
+		last := events[len(events)-1]
+		require.Equal(t, model.CustomerContractStatusRenting, last.FromStatus)
+		require.Equal(t, model.CustomerContractStatusRenting, last.ToStatus)
+	})
+
+	t.Run("only renting contracts change", func(t *testing.T) {
+		_, err := m.ChangeEndDate(&RentalChange{
+			CustomerContractID: next.ID,
+			PrevEndDate:        next.EndDate,
+			EndDate:            next.EndDate.Add(time.Hour),
+			Actor:              customerActor,
+		})
+		require.ErrorIs(t, err, ErrCustomerContractNotChangeable)
+	})
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/store"
+)
+
+var (
+	ErrInvalidCustomerContractTransition = errors.New("invalid customer contract status transition")
+	ErrCarReserved                       = errors.New("car is already reserved for the requested period")
+)
+
+// ContractActor is who triggers a transition. AccountID is 0 for system jobs and payment callbacks.
+type ContractActor struct {
+	AccountID int
+	Role      string
+}
+
+var SystemContractActor = ContractActor{Role: model.CustomerContractEventActorSystem}
+
+type CustomerContractTransition struct {
+	CustomerContractID int
+	// From lists the statuses the contract must currently be in, in addition to the transition
+	// being legal. Empty means any legal source status.
+	From   []model.CustomerContractStatus
+	To     model.CustomerContractStatus
+	Actor  ContractActor
+	Reason string
+	// Values are extra columns updated together with the status
+	Values map[string]interface{}
+	// HoldTTL, when set, extends the hold on the car to HoldTTL from now, holding the car again
+	// if the hold lapsed and nobody reserved it meanwhile
+	HoldTTL time.Duration
+}
+
+// CustomerContractHook runs after a transition into the status it is registered for is committed
+type CustomerContractHook func(contract *model.CustomerContract, t *CustomerContractTransition)
+
+// CustomerContractStateMachine is the only place customer contract statuses are changed. Each
+// transition locks the contract, compares and swaps the status and writes an audit event in one
+// DB transaction. It also keeps the car reservation of a contract in step: ordering turns the
+// hold into a booking and canceling releases it, together with the deliveries not started yet.
+type CustomerContractStateMachine struct {
+	db     *store.DbStore
+	ledger *Ledger
+	hooks  map[model.CustomerContractStatus][]CustomerContractHook
+}
+
+func NewCustomerContractStateMachine(db *store.DbStore) *CustomerContractStateMachine {
+	return &CustomerContractStateMachine{db, NewLedger(db), map[model.CustomerContractStatus][]CustomerContractHook{}}
+}
+
+// OnEnter registers a hook for transitions into status. Hooks must be registered before the
+// state machine is used; they run for Transit, callers of TransitTx own the commit and call
+// AfterCommit themselves.
+func (m *CustomerContractStateMachine) OnEnter(status model.CustomerContractStatus, hook CustomerContractHook) {
+	m.hooks[status] = append(m.hooks[status], hook)
+}
+
+// Create inserts a new contract together with its initial event
+func (m *CustomerContractStateMachine) Create(contract *model.CustomerContract, actor ContractActor) error {
+	return m.db.DB.Transaction(func(tx *gorm.DB) error {
+		return m.createTx(tx, contract, actor)
+	})
+}
+
+// Reserve inserts a new contract like Create and holds its car for the rental period until ttl
+// passes. It fails with ErrCarReserved when the period overlaps a hold or booking of the car.
+func (m *CustomerContractStateMachine) Reserve(contract *model.CustomerContract, actor ContractActor, ttl time.Duration) error {
+	return m.db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := m.createTx(tx, contract, actor); err != nil {
+			return err
+		}
+
+		expiresAt := time.Now().Add(ttl)
+		held, err := m.db.CarReservationStore.CreateIfAvailableTx(tx, &model.CarReservation{
+			CarID:              contract.CarID,
+			CustomerContractID: &contract.ID,
+			StartDate:          contract.StartDate,
+			EndDate:            contract.EndDate,
+			Status:             model.CarReservationStatusHold,
+			ExpiresAt:          &expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !held {
+			return ErrCarReserved
+		}
+
+		return nil
+	})
+}
+
+func (m *CustomerContractStateMachine) createTx(tx *gorm.DB, contract *model.CustomerContract, actor ContractActor) error {
+	if err := m.db.CustomerContractStore.CreateTx(tx, contract); err != nil {
+		return err
+	}
+
+	return m.db.CustomerContractEventStore.CreateTx(tx, newCustomerContractEvent(contract.ID, "", contract.Status, actor, ""))
+}
+
+func (m *CustomerContractStateMachine) Transit(t *CustomerContractTransition) (*model.CustomerContract, error) {
+	var res *model.CustomerContract
+	err := m.db.DB.Transaction(func(tx *gorm.DB) error {
+		contract, err := m.TransitTx(tx, t)
+		res = contract
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.AfterCommit(res, t)
+	return res, nil
+}
+
+// AfterCommit runs the hooks of a transition made with TransitTx once its transaction is committed
+func (m *CustomerContractStateMachine) AfterCommit(contract *model.CustomerContract, t *CustomerContractTransition) {
+	for _, hook := range m.hooks[t.To] {
+		hook(contract, t)
+	}
+}
+
+// TransitTx runs the transition inside an existing transaction so it can be committed atomically
+// with other writes
+func (m *CustomerContractStateMachine) TransitTx(tx *gorm.DB, t *CustomerContractTransition) (*model.CustomerContract, error) {
+	contract, err := m.db.CustomerContractStore.FindByIDForUpdate(tx, t.CustomerContractID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCustomerContractTransition(contract.Status, t); err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for k, v := range t.Values {
+		values[k] = v
+	}
+	values["status"] = string(t.To)
+	values["updated_at"] = time.Now()
+
+	affected, err := m.db.CustomerContractStore.UpdateWhenCurStatusTx(tx, contract.ID, contract.Status, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected == 0 {
+		return nil, fmt.Errorf("%w: status of contract %d changed concurrently", ErrInvalidCustomerContractTransition, contract.ID)
+	}
+
+	if err := m.db.CustomerContractEventStore.CreateTx(
+		tx,
+		newCustomerContractEvent(contract.ID, contract.Status, t.To, t.Actor, t.Reason),
+	); err != nil {
+		return nil, err
+	}
+
+	if t.HoldTTL > 0 {
+		if err := m.holdCarTx(tx, contract, t.HoldTTL); err != nil {
+			return nil, err
+		}
+	}
+
+	switch t.To {
+	case model.CustomerContractStatusOrdered:
+		if err := m.bookCarTx(tx, contract.ID); err != nil {
+			return nil, err
+		}
+	case model.CustomerContractStatusCancel:
+		if err := m.db.CarReservationStore.ReleaseByCustomerContractTx(tx, contract.ID, 0); err != nil {
+			return nil, err
+		}
+
+		if err := m.db.CustomerContractDeliveryStore.CancelByCustomerContractTx(tx, contract.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	contract.Status = t.To
+	return contract, nil
+}
+
+// bookCarTx makes the reservation of an ordered contract firm. When the hold lapsed or the
+// contract was moved to another car, the car is booked again if nobody else reserved it meanwhile.
+func (m *CustomerContractStateMachine) bookCarTx(tx *gorm.DB, contractID int) error {
+	// reload, the transition may have changed the car
+	contract, err := m.db.CustomerContractStore.FindByIDForUpdate(tx, contractID)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.CarReservationStore.ReleaseByCustomerContractTx(tx, contract.ID, contract.CarID); err != nil {
+		return err
+	}
+
+	booked, err := m.db.CarReservationStore.BookTx(tx, contract.ID, contract.CarID)
+	if err != nil {
+		return err
+	}
+
+	if booked {
+		return nil
+	}
+
+	created, err := m.db.CarReservationStore.CreateIfAvailableTx(tx, &model.CarReservation{
+		CarID:              contract.CarID,
+		CustomerContractID: &contract.ID,
+		StartDate:          contract.StartDate,
+		EndDate:            contract.EndDate,
+		Status:             model.CarReservationStatusBooked,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		return fmt.Errorf("%w: car %d of contract %d", ErrCarReserved, contract.CarID, contract.ID)
+	}
+
+	return nil
+}
+
+// holdCarTx extends the live hold of a contract on its car until ttl from now. A contract whose
+// hold lapsed holds the car again, unless somebody else reserved it meanwhile.
+func (m *CustomerContractStateMachine) holdCarTx(tx *gorm.DB, contract *model.CustomerContract, ttl time.Duration) error {
+	expiresAt := time.Now().Add(ttl)
+	extended, err := m.db.CarReservationStore.ExtendHoldTx(tx, contract.ID, contract.CarID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if extended {
+		return nil
+	}
+
+	held, err := m.db.CarReservationStore.CreateIfAvailableTx(tx, &model.CarReservation{
+		CarID:              contract.CarID,
+		CustomerContractID: &contract.ID,
+		StartDate:          contract.StartDate,
+		EndDate:            contract.EndDate,
+		Status:             model.CarReservationStatusHold,
+		ExpiresAt:          &expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !held {
+		return fmt.Errorf("%w: car %d of contract %d", ErrCarReserved, contract.CarID, contract.ID)
+	}
+
+	return nil
+}
+
+func checkCustomerContractTransition(cur model.CustomerContractStatus, t *CustomerContractTransition) error {
+	if len(t.From) > 0 {
+		isExpected := false
+		for _, from := range t.From {
+			if cur == from {
+				isExpected = true
+				break
+			}
+		}
+
+		if !isExpected {
+			return fmt.Errorf("%w: require %v, found %s", ErrInvalidCustomerContractTransition, t.From, cur)
+		}
+	}
+
+	if !model.CanTransitCustomerContract(cur, t.To) {
+		return fmt.Errorf("%w: can not move from %s to %s", ErrInvalidCustomerContractTransition, cur, t.To)
+	}
+
+	return nil
+}
+
+func newCustomerContractEvent(
+	contractID int,
+	from, to model.CustomerContractStatus,
+	actor ContractActor,
+	reason string,
+) *model.CustomerContractEvent {
+	event := &model.CustomerContractEvent{
+		CustomerContractID: contractID,
+		FromStatus:         from,
+		ToStatus:           to,
+		ActorRole:          actor.Role,
+		Reason:             reason,
+	}
+	if actor.AccountID != 0 {
+		actorID := actor.AccountID
+		event.ActorID = &actorID
+	}
+
+	return event
+}
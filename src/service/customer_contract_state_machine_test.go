@@ -0,0 +1,225 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestCustomerContractStateMachine(t *testing.T) {
+	carModel := &model.CarModel{Brand: "StateMachine"}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+	partner := &model.Account{PhoneNumber: "0101", Status: model.AccountStatusActive, RoleID: model.RoleIDPartner}
+	require.NoError(t, TestDb.AccountStore.Create(partner))
+	customer := &model.Account{PhoneNumber: "0102", Status: model.AccountStatusActive, RoleID: model.RoleIDCustomer}
+	require.NoError(t, TestDb.AccountStore.Create(customer))
+	car := &model.Car{PartnerID: partner.ID, CarModelID: carModel.ID, LicensePlate: "sm-01", Status: model.CarStatusActive, PartnerContractRuleID: 1}
+	require.NoError(t, TestDb.CarStore.Create(car))
+
+	m := NewCustomerContractStateMachine(TestDb)
+	contract := &model.CustomerContract{
+		CustomerID:             customer.ID,
+		CarID:                  car.ID,
+		StartDate:              time.Now().Add(10 * time.Hour),
+		EndDate:                time.Now().Add(20 * time.Hour),
+		Status:                 model.CustomerContractStatusWaitingPartnerApproval,
+		CustomerContractRuleID: 1,
+	}
+	require.NoError(t, m.Create(contract, ContractActor{AccountID: customer.ID, Role: model.RoleNameCustomer}))
+
+	t.Run("reject illegal transition", func(t *testing.T) {
+		_, err := m.Transit(&CustomerContractTransition{
+			CustomerContractID: contract.ID,
+			To:                 model.CustomerContractStatusRenting,
+			Actor:              SystemContractActor,
+		})
+		require.ErrorIs(t, err, ErrInvalidCustomerContractTransition)
+	})
+
+	t.Run("only one of concurrent transitions wins", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		errs := make(chan error, 2)
+		for _, to := range []model.CustomerContractStatus{
+			model.CustomerContractStatusWaitingContractAgreement,
+			model.CustomerContractStatusCancel,
+		} {
+			wg.Add(1)
+			go func(to model.CustomerContractStatus) {
+				defer wg.Done()
+				_, err := m.Transit(&CustomerContractTransition{
+					CustomerContractID: contract.ID,
+					From:               []model.CustomerContractStatus{model.CustomerContractStatusWaitingPartnerApproval},
+					To:                 to,
+					Actor:              ContractActor{AccountID: partner.ID, Role: model.RoleNamePartner},
+				})
+				errs <- err
+			}(to)
+		}
+		wg.Wait()
+		close(errs)
+
+		failed := 0
+		for err := range errs {
+			if err != nil {
+				require.True(t, errors.Is(err, ErrInvalidCustomerContractTransition))
+				failed++
+			}
+		}
+		require.Equal(t, 1, failed)
+
+		events, err := TestDb.CustomerContractEventStore.GetByCustomerContractID(contract.ID)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, model.CustomerContractStatusWaitingPartnerApproval, events[0].ToStatus)
+		require.Equal(t, model.CustomerContractStatusWaitingPartnerApproval, events[1].FromStatus)
+		require.Equal(t, partner.ID, *events[1].ActorID)
+	})
+}
+
+func TestCustomerContractStateMachine_Reserve(t *testing.T) {
+	carModel := &model.CarModel{Brand: "Reservation"}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+	partner := &model.Account{PhoneNumber: "0301", Status: model.AccountStatusActive, RoleID: model.RoleIDPartner}
+	require.NoError(t, TestDb.AccountStore.Create(partner))
+	customer := &model.Account{PhoneNumber: "0302", Status: model.AccountStatusActive, RoleID: model.RoleIDCustomer}
+	require.NoError(t, TestDb.AccountStore.Create(customer))
+	car := &model.Car{PartnerID: partner.ID, CarModelID: carModel.ID, LicensePlate: "rs-01", Status: model.CarStatusActive, PartnerContractRuleID: 1}
+	require.NoError(t, TestDb.CarStore.Create(car))
+
+	m := NewCustomerContractStateMachine(TestDb)
+	customerActor := ContractActor{AccountID: customer.ID, Role: model.RoleNameCustomer}
+	newContract := func(startHours int) *model.CustomerContract {
+		return &model.CustomerContract{
+			CustomerID:             customer.ID,
+			CarID:                  car.ID,
+			StartDate:              time.Now().Add(time.Duration(startHours) * time.Hour),
+			EndDate:                time.Now().Add(time.Duration(startHours+24) * time.Hour),
+			Status:                 model.CustomerContractStatusWaitingContractAgreement,
+			CustomerContractRuleID: 1,
+		}
+	}
+	order := func(contractID int) error {
+		for _, to := range []model.CustomerContractStatus{
+			model.CustomerContractStatusWaitingContractPayment,
+			model.CustomerContractStatusOrdered,
+		} {
+			if _, err := m.Transit(&CustomerContractTransition{CustomerContractID: contractID, To: to, Actor: SystemContractActor}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	reservationStatus := func(contractID int) model.CarReservationStatus {
+		reservations, err := TestDb.CarReservationStore.GetByCustomerContractID(contractID)
+		require.NoError(t, err)
+		require.Len(t, reservations, 1)
+		return reservations[0].Status
+	}
+
+	t.Run("only one of concurrent reservations wins", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(startHours int) {
+				defer wg.Done()
+				errs <- m.Reserve(newContract(startHours), customerActor, time.Hour)
+			}(100 + i)
+		}
+		wg.Wait()
+		close(errs)
+
+		failed := 0
+		for err := range errs {
+			if err != nil {
+				require.ErrorIs(t, err, ErrCarReserved)
+				failed++
+			}
+		}
+		require.Equal(t, 1, failed)
+	})
+
+	t.Run("cancel releases the hold", func(t *testing.T) {
+		first := newContract(200)
+		require.NoError(t, m.Reserve(first, customerActor, time.Hour))
+		require.ErrorIs(t, m.Reserve(newContract(210), customerActor, time.Hour), ErrCarReserved)
+
+		_, err := m.Transit(&CustomerContractTransition{
+			CustomerContractID: first.ID,
+			To:                 model.CustomerContractStatusCancel,
+			Actor:              customerActor,
+		})
+		require.NoError(t, err)
+		require.Equal(t, model.CarReservationStatusReleased, reservationStatus(first.ID))
+		require.NoError(t, m.Reserve(newContract(210), customerActor, time.Hour))
+	})
+
+	t.Run("ordering books the hold", func(t *testing.T) {
+		contract := newContract(300)
+		require.NoError(t, m.Reserve(contract, customerActor, time.Hour))
+		require.NoError(t, order(contract.ID))
+		require.Equal(t, model.CarReservationStatusBooked, reservationStatus(contract.ID))
+	})
+
+	t.Run("lapsed hold is taken over and ordering it fails", func(t *testing.T) {
+		lapsed := newContract(400)
+		require.NoError(t, m.Reserve(lapsed, customerActor, -time.Minute))
+
+		other := newContract(410)
+		require.NoError(t, m.Reserve(other, customerActor, time.Hour))
+		require.Equal(t, model.CarReservationStatusReleased, reservationStatus(lapsed.ID))
+
+		require.ErrorIs(t, order(lapsed.ID), ErrCarReserved)
+		contract, err := TestDb.CustomerContractStore.FindByID(lapsed.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CustomerContractStatusWaitingContractPayment, contract.Status)
+	})
+
+	t.Run("a transition with hold ttl extends the hold", func(t *testing.T) {
+		contract := newContract(500)
+		require.NoError(t, m.Reserve(contract, customerActor, time.Minute))
+		_, err := m.Transit(&CustomerContractTransition{
+			CustomerContractID: contract.ID,
+			To:                 model.CustomerContractStatusWaitingContractPayment,
+			Actor:              customerActor,
+			HoldTTL:            time.Hour,
+		})
+		require.NoError(t, err)
+
+		reservations, err := TestDb.CarReservationStore.GetByCustomerContractID(contract.ID)
+		require.NoError(t, err)
+		require.Len(t, reservations, 1)
+		require.True(t, reservations[0].ExpiresAt.After(time.Now().Add(50*time.Minute)))
+	})
+
+	t.Run("a transition with hold ttl holds a lapsed hold again unless it was taken", func(t *testing.T) {
+		lapsed := newContract(600)
+		require.NoError(t, m.Reserve(lapsed, customerActor, -time.Minute))
+		_, err := m.Transit(&CustomerContractTransition{
+			CustomerContractID: lapsed.ID,
+			To:                 model.CustomerContractStatusWaitingContractPayment,
+			Actor:              customerActor,
+			HoldTTL:            time.Hour,
+		})
+		require.NoError(t, err)
+		held, err := TestDb.CarReservationStore.IsHeld(lapsed.ID, car.ID)
+		require.NoError(t, err)
+		require.True(t, held)
+
+		taken := newContract(700)
+		require.NoError(t, m.Reserve(taken, customerActor, -time.Minute))
+		require.NoError(t, m.Reserve(newContract(710), customerActor, time.Hour))
+		_, err = m.Transit(&CustomerContractTransition{
+			CustomerContractID: taken.ID,
+			To:                 model.CustomerContractStatusWaitingContractPayment,
+			Actor:              customerActor,
+			HoldTTL:            time.Hour,
+		})
+		require.ErrorIs(t, err, ErrCarReserved)
+	})
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+var ErrInvalidInspection = errors.New("invalid inspection")
+
+// InspectTx checks an inspection against its template and saves it with its items. Every item of
+// the template is filled in exactly once, condition items with a condition and reading items with
+// a value.
+func (m *CustomerContractStateMachine) InspectTx(tx *gorm.DB, inspection *model.CustomerContractInspection) error {
+	template, err := m.db.InspectionStore.GetTemplateByIDTx(tx, inspection.InspectionTemplateID)
+	if err != nil {
+		return err
+	}
+
+	templateItems := make(map[int]*model.InspectionTemplateItem, len(template.Items))
+	for _, item := range template.Items {
+		templateItems[item.ID] = item
+	}
+
+	for _, item := range inspection.Items {
+		templateItem, ok := templateItems[item.InspectionTemplateItemID]
+		if !ok {
+			return fmt.Errorf("%w: item %d is not in template %d or filled in twice", ErrInvalidInspection, item.InspectionTemplateItemID, template.ID)
+		}
+		delete(templateItems, templateItem.ID)
+
+		switch templateItem.Kind {
+		case model.InspectionItemKindReading:
+			if item.Value == nil {
+				return fmt.Errorf("%w: %s needs a value", ErrInvalidInspection, templateItem.Name)
+			}
+		default:
+			if item.Condition == "" {
+				return fmt.Errorf("%w: %s needs a condition", ErrInvalidInspection, templateItem.Name)
+			}
+		}
+
+		if item.ImageURLs == nil {
+			item.ImageURLs = []string{}
+		}
+	}
+
+	if len(templateItems) > 0 {
+		missing := make([]string, 0, len(templateItems))
+		for _, templateItem := range templateItems {
+			missing = append(missing, templateItem.Name)
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %s not filled in", ErrInvalidInspection, strings.Join(missing, ", "))
+	}
+
+	return m.db.InspectionStore.CreateTx(tx, inspection)
+}
+
+// InspectionItemDiff puts the pickup and return state of an inspected item side by side, one of
+// them is nil when the item was only inspected once
+type InspectionItemDiff struct {
+	InspectionTemplateItemID int                                   `json:"inspection_template_item_id"`
+	Section                  model.InspectionSection               `json:"section"`
+	Name                     string                                `json:"name"`
+	Kind                     model.InspectionItemKind              `json:"kind"`
+	Pickup                   *model.CustomerContractInspectionItem `json:"pickup"`
+	Return                   *model.CustomerContractInspectionItem `json:"return"`
+	Changed                  bool                                  `json:"changed"`
+	ValueDelta               *int                                  `json:"value_delta"`
+}
+
+// DiffInspections compares the pickup and the return inspection of a contract item by item, in
+// the order of the checklist. ValueDelta of a reading is its return value minus its pickup value,
+// like the km driven.
+func DiffInspections(pickup, ret *model.CustomerContractInspection) []*InspectionItemDiff {
+	res := make([]*InspectionItemDiff, 0)
+	byItemID := make(map[int]*InspectionItemDiff)
+	add := func(inspection *model.CustomerContractInspection, isReturn bool) {
+		if inspection == nil {
+			return
+		}
+
+		for _, item := range inspection.Items {
+			diff, ok := byItemID[item.InspectionTemplateItemID]
+			if !ok {
+				diff = &InspectionItemDiff{InspectionTemplateItemID: item.InspectionTemplateItemID}
+				if templateItem := item.InspectionTemplateItem; templateItem != nil {
+					diff.Section, diff.Name, diff.Kind = templateItem.Section, templateItem.Name, templateItem.Kind
+				}
+				byItemID[item.InspectionTemplateItemID] = diff
+				res = append(res, diff)
+			}
+
+			if isReturn {
+				diff.Return = item
+			} else {
+				diff.Pickup = item
+			}
+		}
+	}
+	add(pickup, false)
+	add(ret, true)
+
+	position := func(diff *InspectionItemDiff) int {
+		for _, item := range []*model.CustomerContractInspectionItem{diff.Pickup, diff.Return} {
+			if item != nil && item.InspectionTemplateItem != nil {
+				return item.InspectionTemplateItem.Position
+			}
+		}
+		return 0
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return position(res[i]) < position(res[j])
+	})
+
+	for _, diff := range res {
+		if diff.Pickup == nil || diff.Return == nil {
+			diff.Changed = true
+			continue
+		}
+
+		diff.Changed = diff.Pickup.Condition != diff.Return.Condition
+		if diff.Pickup.Value != nil && diff.Return.Value != nil {
+			delta := *diff.Return.Value - *diff.Pickup.Value
+			diff.ValueDelta = &delta
+			diff.Changed = diff.Changed || delta != 0
+		} else if (diff.Pickup.Value == nil) != (diff.Return.Value == nil) {
+			diff.Changed = true
+		}
+	}
+
+	return res
+}
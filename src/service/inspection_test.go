@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestCustomerContractStateMachine_InspectTx(t *testing.T) {
+	m := NewCustomerContractStateMachine(TestDb)
+	now := time.Now().Truncate(time.Second)
+	contract := newReservedContract(t, &model.CustomerContract{
+		StartDate: now.Add(24 * time.Hour),
+		EndDate:   now.Add(48 * time.Hour),
+	})
+
+	template := &model.InspectionTemplate{
+		Name: "Inspection test",
+		Items: []*model.InspectionTemplateItem{
+			{Section: model.InspectionSectionExterior, Name: "Front bumper", Kind: model.InspectionItemKindCondition, Position: 1},
+			{Section: model.InspectionSectionOdometer, Name: "Odometer", Kind: model.InspectionItemKindReading, Position: 2},
+		},
+	}
+	require.NoError(t, TestDb.InspectionStore.CreateTemplate(template))
+	bumper, odometer := template.Items[0].ID, template.Items[1].ID
+
+	inspect := func(stage model.InspectionStage, items ...*model.CustomerContractInspectionItem) error {
+		return TestDb.DB.Transaction(func(tx *gorm.DB) error {
+			return m.InspectTx(tx, &model.CustomerContractInspection{
+				CustomerContractID:   contract.ID,
+				InspectionTemplateID: template.ID,
+				Stage:                stage,
+				Items:                items,
+			})
+		})
+	}
+	value := func(v int) *int {
+		return &v
+	}
+
+	t.Run("every item is filled in once", func(t *testing.T) {
+		err := inspect(model.InspectionStagePickup,
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: bumper, Condition: model.InspectionItemConditionGood},
+		)
+		require.ErrorIs(t, err, ErrInvalidInspection)
+
+		err = inspect(model.InspectionStagePickup,
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: bumper, Condition: model.InspectionItemConditionGood},
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: bumper, Condition: model.InspectionItemConditionGood},
+		)
+		require.ErrorIs(t, err, ErrInvalidInspection)
+
+		err = inspect(model.InspectionStagePickup,
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: bumper, Condition: model.InspectionItemConditionGood},
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: odometer},
+		)
+		require.ErrorIs(t, err, ErrInvalidInspection, "readings need a value")
+	})
+
+	t.Run("pickup and return are compared item by item", func(t *testing.T) {
+		require.NoError(t, inspect(model.InspectionStagePickup,
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: odometer, Value: value(12_000)},
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: bumper, Condition: model.InspectionItemConditionGood},
+		))
+		require.NoError(t, inspect(model.InspectionStageReturn,
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: bumper, Condition: model.InspectionItemConditionDamaged, ImageURLs: []string{"bumper.jpg"}},
+			&model.CustomerContractInspectionItem{InspectionTemplateItemID: odometer, Value: value(12_350)},
+		))
+
+		inspections, err := TestDb.InspectionStore.GetByCustomerContractID(contract.ID)
+		require.NoError(t, err)
+		require.Len(t, inspections, 2)
+
+		diff := DiffInspections(inspections[0], inspections[1])
+		require.Len(t, diff, 2)
+		require.Equal(t, bumper, diff[0].InspectionTemplateItemID)
+		require.True(t, diff[0].Changed)
+		require.Equal(t, []string{"bumper.jpg"}, diff[0].Return.ImageURLs)
+		require.Equal(t, odometer, diff[1].InspectionTemplateItemID)
+		require.Equal(t, 350, *diff[1].ValueDelta)
+	})
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/pdf"
+	"github.com/godev111222333/capstone-backend/src/store"
+)
+
+var ErrInvoiceNotIssuable = errors.New("payment can not be invoiced")
+
+const (
+	invoiceSeriesInvoice = "INV"
+	invoiceSeriesReceipt = "RCT"
+)
+
+var defaultInvoiceConfig = &misc.InvoiceConfig{
+	CompanyName: "MinhHungCar",
+	VATPercent:  10,
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": formatMoney,
+	"row": func(label string, amount int) string {
+		return fmt.Sprintf("%-*s%*s", pdf.BodyLineWidth-24, label, 24, formatMoney(amount))
+	},
+	"date": func(t time.Time) string {
+		return t.Format("02/01/2006 15:04")
+	},
+	"rule": func() string {
+		return strings.Repeat("-", pdf.BodyLineWidth)
+	},
+}).Parse(`# {{if eq .Kind "invoice"}}VAT INVOICE{{else}}RECEIPT{{end}}
+Number: {{.Number}}
+Issued at: {{date .IssuedAt}}
+
+Issued by: {{.SellerName}}
+{{- if .SellerTaxCode}}
+Tax code: {{.SellerTaxCode}}{{end}}
+{{- if .SellerAddress}}
+Address: {{.SellerAddress}}{{end}}
+{{- if .SellerPhone}}
+Phone: {{.SellerPhone}}{{end}}
+{{- if .SellerEmail}}
+Email: {{.SellerEmail}}{{end}}
+
+Issued to: {{.BuyerName}}
+Phone: {{.BuyerPhone}}
+
+{{rule}}
+{{.Description}}
+{{rule}}
+{{- if eq .Kind "invoice"}}
+{{row "Subtotal" .Subtotal}}
+{{row (printf "VAT (%g%%)" .VATPercent) .VATAmount}}{{end}}
+{{row "Total" .Total}}
+`))
+
+// InvoiceService numbers and renders the invoices of paid customer payments and the receipts of
+// partner payouts. A payment gets at most one document, numbers follow each other per series and
+// year without gaps.
+type InvoiceService struct {
+	cfg *misc.InvoiceConfig
+	db  *store.DbStore
+	now func() time.Time
+}
+
+func NewInvoiceService(cfg *misc.InvoiceConfig, db *store.DbStore) *InvoiceService {
+	if cfg == nil {
+		cfg = defaultInvoiceConfig
+	}
+
+	return &InvoiceService{cfg, db, time.Now}
+}
+
+// IssueForCustomerPayment returns the invoice of a paid customer payment, issuing it the first
+// time. Rent, extensions and other charges get an invoice with the VAT included in the amount, a
+// cash collateral only gets a receipt as it is given back. Refunds are not invoiced.
+func (s *InvoiceService) IssueForCustomerPayment(paymentID int) (*model.Invoice, error) {
+	var invoice *model.Invoice
+	if err := s.db.DB.Transaction(func(tx *gorm.DB) error {
+		payment, err := s.db.CustomerPaymentStore.FindByIDForUpdate(tx, paymentID)
+		if err != nil {
+			return err
+		}
+
+		if payment.Status != model.PaymentStatusPaid {
+			return fmt.Errorf("%w: payment %d is %s", ErrInvoiceNotIssuable, payment.ID, payment.Status)
+		}
+
+		kind, description := model.InvoiceKindInvoice, ""
+		switch payment.PaymentType {
+		case model.PaymentTypePrePay:
+			description = "Rent prepayment"
+		case model.PaymentTypeRemainingPay:
+			description = "Remaining rent"
+		case model.PaymentTypeExtension:
+			description = "Rent extension"
+		case model.PaymentTypeOther:
+			description = "Other charges"
+		case model.PaymentTypeCollateralCash:
+			kind, description = model.InvoiceKindReceipt, "Cash collateral"
+		default:
+			return fmt.Errorf("%w: %s payment %d", ErrInvoiceNotIssuable, payment.PaymentType, payment.ID)
+		}
+
+		invoice, err = s.db.InvoiceStore.GetByCustomerPaymentIDTx(tx, payment.ID)
+		if err != nil || invoice != nil {
+			return err
+		}
+
+		contract, err := s.db.CustomerContractStore.FindByID(payment.CustomerContractID)
+		if err != nil {
+			return err
+		}
+
+		description = fmt.Sprintf("%s for contract #%d, car %s, from %s to %s",
+			description, contract.ID, contract.Car.LicensePlate,
+			contract.StartDate.Format("02/01/2006"), contract.EndDate.Format("02/01/2006"))
+		if payment.Note != "" {
+			description += ": " + payment.Note
+		}
+
+		invoice = s.newInvoice(kind, contract.Customer, description, payment.Amount)
+		invoice.CustomerPaymentID = &payment.ID
+		invoice.CustomerContractID = &contract.ID
+		return s.createTx(tx, invoice)
+	}); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// IssueForPartnerPayment returns the receipt of a paid partner payout, issuing it the first time
+func (s *InvoiceService) IssueForPartnerPayment(historyID int) (*model.Invoice, error) {
+	var invoice *model.Invoice
+	if err := s.db.DB.Transaction(func(tx *gorm.DB) error {
+		history, err := s.db.PartnerPaymentHistoryStore.GetByIDForUpdate(tx, historyID)
+		if err != nil {
+			return err
+		}
+
+		if history.Status != model.PartnerPaymentHistoryStatusPaid {
+			return fmt.Errorf("%w: partner payment %d is %s", ErrInvoiceNotIssuable, history.ID, history.Status)
+		}
+
+		invoice, err = s.db.InvoiceStore.GetByPartnerPaymentHistoryIDTx(tx, history.ID)
+		if err != nil || invoice != nil {
+			return err
+		}
+
+		partner, err := s.db.AccountStore.GetByID(history.PartnerID)
+		if err != nil {
+			return err
+		}
+
+		description := fmt.Sprintf("Partner payout #%d for the rentals from %s to %s",
+			history.ID, history.StartDate.Format("02/01/2006"), history.EndDate.Format("02/01/2006"))
+		invoice = s.newInvoice(model.InvoiceKindReceipt, partner, description, history.Amount)
+		invoice.PartnerPaymentHistoryID = &history.ID
+		return s.createTx(tx, invoice)
+	}); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+func (s *InvoiceService) newInvoice(kind model.InvoiceKind, buyer *model.Account, description string, total int) *model.Invoice {
+	invoice := &model.Invoice{
+		Kind:          kind,
+		Description:   description,
+		SellerName:    s.cfg.CompanyName,
+		SellerTaxCode: s.cfg.TaxCode,
+		SellerAddress: s.cfg.Address,
+		SellerPhone:   s.cfg.Phone,
+		SellerEmail:   s.cfg.Email,
+		Subtotal:      total,
+		Total:         total,
+		IssuedAt:      s.now(),
+	}
+
+	if buyer != nil {
+		invoice.AccountID = buyer.ID
+		invoice.BuyerName = strings.TrimSpace(buyer.LastName + " " + buyer.FirstName)
+		invoice.BuyerPhone = buyer.PhoneNumber
+	}
+
+	if kind == model.InvoiceKindInvoice {
+		invoice.VATPercent = s.cfg.VATPercent
+		invoice.Subtotal, invoice.VATAmount = SplitVAT(total, s.cfg.VATPercent)
+	}
+
+	return invoice
+}
+
+func (s *InvoiceService) createTx(tx *gorm.DB, invoice *model.Invoice) error {
+	series := invoiceSeriesInvoice
+	if invoice.Kind == model.InvoiceKindReceipt {
+		series = invoiceSeriesReceipt
+	}
+
+	year := invoice.IssuedAt.Year()
+	number, err := s.db.InvoiceStore.NextNumberTx(tx, series, year)
+	if err != nil {
+		return err
+	}
+
+	invoice.Number = fmt.Sprintf("%s%d-%06d", series, year, number)
+	return s.db.InvoiceStore.CreateTx(tx, invoice)
+}
+
+// Render returns the PDF file of an invoice
+func (s *InvoiceService) Render(invoice *model.Invoice) ([]byte, error) {
+	var text bytes.Buffer
+	if err := invoiceTemplate.Execute(&text, invoice); err != nil {
+		return nil, err
+	}
+
+	return pdf.FromText(text.String()), nil
+}
+
+// SplitVAT splits a total including VAT into its subtotal and VAT, rounded so they add up to the
+// total
+func SplitVAT(total int, vatPercent float64) (subtotal int, vat int) {
+	subtotal = int(math.Round(float64(total) * 100 / (100 + vatPercent)))
+	return subtotal, total - subtotal
+}
+
+// formatMoney formats an amount in VND with dots between thousands, like 1.250.000 VND
+func formatMoney(amount int) string {
+	digits := strconv.Itoa(amount)
+	sign := ""
+	if amount < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(d)
+	}
+
+	return sign + b.String() + " VND"
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/pdf"
+)
+
+func TestSplitVAT(t *testing.T) {
+	subtotal, vat := SplitVAT(1_250_000, 10)
+	require.Equal(t, 1_136_364, subtotal)
+	require.Equal(t, 113_636, vat)
+
+	subtotal, vat = SplitVAT(500_000, 0)
+	require.Equal(t, 500_000, subtotal)
+	require.Zero(t, vat)
+}
+
+func TestInvoiceService(t *testing.T) {
+	carModel := &model.CarModel{Brand: "Invoice"}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+	partner := &model.Account{PhoneNumber: "1001", Status: model.AccountStatusActive, RoleID: model.RoleIDPartner}
+	require.NoError(t, TestDb.AccountStore.Create(partner))
+	customer := &model.Account{FirstName: "Duc", LastName: "Nguyen", PhoneNumber: "1002", Status: model.AccountStatusActive, RoleID: model.RoleIDCustomer}
+	require.NoError(t, TestDb.AccountStore.Create(customer))
+	car := &model.Car{PartnerID: partner.ID, CarModelID: carModel.ID, LicensePlate: "iv-01", Status: model.CarStatusActive, PartnerContractRuleID: 1}
+	require.NoError(t, TestDb.CarStore.Create(car))
+
+	now := time.Now().Truncate(time.Second)
+	contract := &model.CustomerContract{
+		CustomerID:             customer.ID,
+		CarID:                  car.ID,
+		StartDate:              now.Add(-48 * time.Hour),
+		EndDate:                now.Add(-time.Hour),
+		Status:                 model.CustomerContractStatusCompleted,
+		RentPrice:              1_100_000,
+		CustomerContractRuleID: 1,
+	}
+	require.NoError(t, TestDb.CustomerContractStore.Create(contract))
+
+	s := NewInvoiceService(&misc.InvoiceConfig{CompanyName: "MinhHungCar", TaxCode: "0312345678", VATPercent: 10}, TestDb)
+	pay := func(paymentType model.PaymentType, amount int) *model.CustomerPayment {
+		payment := &model.CustomerPayment{
+			CustomerContractID: contract.ID,
+			PaymentType:        paymentType,
+			Amount:             amount,
+			Status:             model.PaymentStatusPaid,
+		}
+		require.NoError(t, TestDb.CustomerPaymentStore.Create(payment))
+		return payment
+	}
+
+	t.Run("rent is invoiced once with VAT", func(t *testing.T) {
+		payment := pay(model.PaymentTypePrePay, 330_000)
+
+		invoice, err := s.IssueForCustomerPayment(payment.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.InvoiceKindInvoice, invoice.Kind)
+		require.Equal(t, 300_000, invoice.Subtotal)
+		require.Equal(t, 30_000, invoice.VATAmount)
+		require.Equal(t, 330_000, invoice.Total)
+		require.Equal(t, "Nguyen Duc", invoice.BuyerName)
+		require.Equal(t, "0312345678", invoice.SellerTaxCode)
+
+		again, err := s.IssueForCustomerPayment(payment.ID)
+		require.NoError(t, err)
+		require.Equal(t, invoice.ID, again.ID)
+
+		next, err := s.IssueForCustomerPayment(pay(model.PaymentTypeRemainingPay, 770_000).ID)
+		require.NoError(t, err)
+
+		var number, nextNumber int
+		_, err = fmt.Sscanf(invoice.Number, fmt.Sprintf("INV%d-%%d", now.Year()), &number)
+		require.NoError(t, err)
+		_, err = fmt.Sscanf(next.Number, fmt.Sprintf("INV%d-%%d", now.Year()), &nextNumber)
+		require.NoError(t, err)
+		require.Equal(t, number+1, nextNumber)
+
+		bz, err := s.Render(invoice)
+		require.NoError(t, err)
+		require.True(t, pdf.ContainsText(bz, invoice.Number))
+		require.True(t, pdf.ContainsText(bz, "330.000 VND"))
+	})
+
+	t.Run("cash collateral gets a receipt", func(t *testing.T) {
+		receipt, err := s.IssueForCustomerPayment(pay(model.PaymentTypeCollateralCash, 5_000_000).ID)
+		require.NoError(t, err)
+		require.Equal(t, model.InvoiceKindReceipt, receipt.Kind)
+		require.Zero(t, receipt.VATAmount)
+		require.Equal(t, 5_000_000, receipt.Subtotal)
+	})
+
+	t.Run("refunds and unpaid payments are not invoiced", func(t *testing.T) {
+		_, err := s.IssueForCustomerPayment(pay(model.PaymentTypeReturnCollateralCash, 5_000_000).ID)
+		require.ErrorIs(t, err, ErrInvoiceNotIssuable)
+
+		pending := &model.CustomerPayment{
+			CustomerContractID: contract.ID,
+			PaymentType:        model.PaymentTypeExtension,
+			Amount:             100_000,
+			Status:             model.PaymentStatusPending,
+		}
+		require.NoError(t, TestDb.CustomerPaymentStore.Create(pending))
+		_, err = s.IssueForCustomerPayment(pending.ID)
+		require.ErrorIs(t, err, ErrInvoiceNotIssuable)
+
+		invoices, err := TestDb.InvoiceStore.GetByCustomerContractID(contract.ID)
+		require.NoError(t, err)
+		require.Len(t, invoices, 3)
+	})
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/store"
+)
+
+var ErrUnbalancedLedgerEntry = errors.New("ledger entry does not balance")
+
+// Ledger posts the money movements of the platform as balanced double-entry entries:
+//   - customer payments are collected into cash, rent goes to the insurance pool and the platform
+//     revenue, cash collateral to the collateral liability and other payments clear the customer
+//     receivable their charges built up
+//   - charges are taken from the collateral liability or built up as customer receivable
+//   - settling a partner moves its net share from the platform revenue to the partner payable,
+//     adjustments move between them too, and paying a partner clears its payable
+//   - refunds reverse the posting of the payment they give money back from
+//
+// Every entry is posted once per reference, so posting again is a no-op.
+type Ledger struct {
+	db *store.DbStore
+}
+
+func NewLedger(db *store.DbStore) *Ledger {
+	return &Ledger{db}
+}
+
+func debit(account model.LedgerAccountCode, amount int) *model.LedgerLine {
+	return &model.LedgerLine{AccountCode: account, Debit: amount}
+}
+
+func credit(account model.LedgerAccountCode, amount int) *model.LedgerLine {
+	return &model.LedgerLine{AccountCode: account, Credit: amount}
+}
+
+// PostTx posts a balanced entry unless an entry with its reference was posted before. Zero lines
+// are dropped and an entry left without lines is not posted.
+func (l *Ledger) PostTx(tx *gorm.DB, entry *model.LedgerEntry) error {
+	lines := make([]*model.LedgerLine, 0, len(entry.Lines))
+	debits, credits := 0, 0
+	for _, line := range entry.Lines {
+		if line.Debit < 0 || line.Credit < 0 {
+			return fmt.Errorf("%w: %s has a negative line", ErrUnbalancedLedgerEntry, entry.Reference)
+		}
+
+		if line.Debit == 0 && line.Credit == 0 {
+			continue
+		}
+
+		debits += line.Debit
+		credits += line.Credit
+		lines = append(lines, line)
+	}
+
+	if debits != credits {
+		return fmt.Errorf("%w: %s debits %d and credits %d", ErrUnbalancedLedgerEntry, entry.Reference, debits, credits)
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	entry.Lines = lines
+	if entry.PostedAt.IsZero() {
+		entry.PostedAt = time.Now()
+	}
+
+	_, err := l.db.LedgerStore.CreateEntryTx(tx, entry)
+	return err
+}
+
+// rentShares splits an amount paid for the rent of a contract into its insurance part, in the
+// ratio of the contract's insurance amount to its total, and its rent part
+func rentShares(contract *model.CustomerContract, amount int) (insurance, rent int) {
+	total := contract.RentPrice + contract.InsuranceAmount
+	if total <= 0 {
+		return 0, amount
+	}
+
+	insurance = int(float64(amount) * float64(contract.InsuranceAmount) / float64(total))
+	return insurance, amount - insurance
+}
+
+func (l *Ledger) paymentContract(payment *model.CustomerPayment) (*model.CustomerContract, error) {
+	if payment.CustomerContract != nil {
+		return payment.CustomerContract, nil
+	}
+
+	return l.db.CustomerContractStore.FindByID(payment.CustomerContractID)
+}
+
+// PostCustomerPaymentTx posts a paid customer payment. Refund payments are posted with the refunds
+// paying them out.
+func (l *Ledger) PostCustomerPaymentTx(tx *gorm.DB, payment *model.CustomerPayment) error {
+	entry := &model.LedgerEntry{
+		Reference:          fmt.Sprintf("customer_payment:%d", payment.ID),
+		Description:        fmt.Sprintf("%s payment of contract %d", payment.PaymentType, payment.CustomerContractID),
+		CustomerContractID: &payment.CustomerContractID,
+		Lines:              []*model.LedgerLine{debit(model.LedgerAccountCash, payment.Amount)},
+	}
+
+	switch payment.PaymentType {
+	case model.PaymentTypeCollateralCash:
+		entry.Lines = append(entry.Lines, credit(model.LedgerAccountCollateralLiability, payment.Amount))
+	case model.PaymentTypePrePay, model.PaymentTypeRemainingPay, model.PaymentTypeExtension:
+		contract, err := l.paymentContract(payment)
+		if err != nil {
+			return err
+		}
+
+		insurance, rent := rentShares(contract, payment.Amount)
+		entry.Lines = append(entry.Lines,
+			credit(model.LedgerAccountInsurancePool, insurance),
+			credit(model.LedgerAccountPlatformRevenue, rent),
+		)
+	case model.PaymentTypeOther:
+		entry.Lines = append(entry.Lines, credit(model.LedgerAccountCustomerReceivable, payment.Amount))
+	default:
+		return nil
+	}
+
+	return l.PostTx(tx, entry)
+}
+
+// PostCustomerRefundTx posts a succeeded refund of a paid customer payment
+func (l *Ledger) PostCustomerRefundTx(tx *gorm.DB, refund *model.CustomerRefund, payment *model.CustomerPayment) error {
+	if refund.Status != model.CustomerRefundStatusSucceeded {
+		return nil
+	}
+
+	entry := &model.LedgerEntry{
+		Reference:          fmt.Sprintf("customer_refund:%d", refund.ID),
+		Description:        fmt.Sprintf("refund of %s payment %d: %s", payment.PaymentType, payment.ID, refund.Reason),
+		CustomerContractID: &payment.CustomerContractID,
+		Lines:              []*model.LedgerLine{credit(model.LedgerAccountCash, refund.Amount)},
+	}
+
+	switch payment.PaymentType {
+	case model.PaymentTypeCollateralCash:
+		entry.Lines = append(entry.Lines, debit(model.LedgerAccountCollateralLiability, refund.Amount))
+	case model.PaymentTypePrePay, model.PaymentTypeRemainingPay, model.PaymentTypeExtension:
+		contract, err := l.paymentContract(payment)
+		if err != nil {
+			return err
+		}
+
+		insurance, rent := rentShares(contract, refund.Amount)
+		entry.Lines = append(entry.Lines,
+			debit(model.LedgerAccountInsurancePool, insurance),
+			debit(model.LedgerAccountPlatformRevenue, rent),
+		)
+	default:
+		entry.Lines = append(entry.Lines, debit(model.LedgerAccountPlatformRevenue, refund.Amount))
+	}
+
+	return l.PostTx(tx, entry)
+}
+
+// PostCustomerContractChargeTx posts a charge as revenue, taken from the collateral as far as the
+// charge was deducted from it and owed by the customer for the rest
+func (l *Ledger) PostCustomerContractChargeTx(tx *gorm.DB, charge *model.CustomerContractCharge) error {
+	return l.PostTx(tx, &model.LedgerEntry{
+		Reference:          fmt.Sprintf("customer_contract_charge:%d", charge.ID),
+		Description:        fmt.Sprintf("%s charge of contract %d: %s", charge.Category, charge.CustomerContractID, charge.Description),
+		CustomerContractID: &charge.CustomerContractID,
+		Lines: []*model.LedgerLine{
+			debit(model.LedgerAccountCollateralLiability, charge.CollateralAmount),
+			debit(model.LedgerAccountCustomerReceivable, charge.Amount-charge.CollateralAmount),
+			credit(model.LedgerAccountPlatformRevenue, charge.Amount),
+		},
+	})
+}
+
+// PostPartnerSettlementTx moves the net of contracts settled into a partner payment to the partner
+// payable
+func (l *Ledger) PostPartnerSettlementTx(
+	tx *gorm.DB,
+	history *model.PartnerPaymentHistory,
+	items []*model.PartnerPaymentCustomerContract,
+) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	net := 0
+	for _, item := range items {
+		net += item.NetAmount
+	}
+
+	return l.PostTx(tx, &model.LedgerEntry{
+		Reference:   fmt.Sprintf("partner_payment_customer_contract:%d", items[0].ID),
+		Description: fmt.Sprintf("%d contracts settled into partner payment %d", len(items), history.ID),
+		PartnerID:   &history.PartnerID,
+		Lines: []*model.LedgerLine{
+			debit(model.LedgerAccountPlatformRevenue, net),
+			credit(model.LedgerAccountPartnerPayable, net),
+		},
+	})
+}
+
+// PostPartnerPaymentAdjustmentTx posts an adjustment of a partner payment, a positive one is owed
+// to the partner on top and a negative one is kept by the platform
+func (l *Ledger) PostPartnerPaymentAdjustmentTx(
+	tx *gorm.DB,
+	history *model.PartnerPaymentHistory,
+	adjustment *model.PartnerPaymentAdjustment,
+) error {
+	from, to := model.LedgerAccountPlatformRevenue, model.LedgerAccountPartnerPayable
+	amount := adjustment.Amount
+	if amount < 0 {
+		from, to, amount = to, from, -amount
+	}
+
+	return l.PostTx(tx, &model.LedgerEntry{
+		Reference:   fmt.Sprintf("partner_payment_adjustment:%d", adjustment.ID),
+		Description: fmt.Sprintf("%s of partner payment %d: %s", adjustment.Category, history.ID, adjustment.Description),
+		PartnerID:   &history.PartnerID,
+		Lines:       []*model.LedgerLine{debit(from, amount), credit(to, amount)},
+	})
+}
+
+// PostPartnerPaymentTx posts a paid partner payment
+func (l *Ledger) PostPartnerPaymentTx(tx *gorm.DB, history *model.PartnerPaymentHistory) error {
+	return l.PostTx(tx, &model.LedgerEntry{
+		Reference:   fmt.Sprintf("partner_payment:%d", history.ID),
+		Description: fmt.Sprintf("partner payment %d", history.ID),
+		PartnerID:   &history.PartnerID,
+		Lines: []*model.LedgerLine{
+			debit(model.LedgerAccountPartnerPayable, history.Amount),
+			credit(model.LedgerAccountCash, history.Amount),
+		},
+	})
+}
+
+type TrialBalanceAccount struct {
+	Account *model.LedgerAccount `json:"account"`
+	Debit   int                  `json:"debit"`
+	Credit  int                  `json:"credit"`
+	Balance int                  `json:"balance"`
+}
+
+// TrialBalance lists the totals of every account, its debits and credits are equal as long as
+// every entry balances
+type TrialBalance struct {
+	AsOf     time.Time              `json:"as_of"`
+	Accounts []*TrialBalanceAccount `json:"accounts"`
+	Debit    int                    `json:"debit"`
+	Credit   int                    `json:"credit"`
+	Balanced bool                   `json:"balanced"`
+}
+
+// TrialBalance sums the entries posted before asOf, or all of them when it is zero
+func (l *Ledger) TrialBalance(asOf time.Time) (*TrialBalance, error) {
+	accounts, err := l.db.LedgerStore.GetAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	sums, err := l.db.LedgerStore.SumByAccount(asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	byCode := make(map[model.LedgerAccountCode]*store.LedgerAccountSum, len(sums))
+	for _, sum := range sums {
+		byCode[sum.AccountCode] = sum
+	}
+
+	res := &TrialBalance{AsOf: asOf, Accounts: make([]*TrialBalanceAccount, len(accounts))}
+	for i, account := range accounts {
+		row := &TrialBalanceAccount{Account: account}
+		if sum, ok := byCode[account.Code]; ok {
+			row.Debit, row.Credit = sum.Debit, sum.Credit
+		}
+		row.Balance = account.Balance(row.Debit, row.Credit)
+
+		res.Accounts[i] = row
+		res.Debit += row.Debit
+		res.Credit += row.Credit
+	}
+	res.Balanced = res.Debit == res.Credit
+
+	return res, nil
+}
+
+type LedgerStatementLine struct {
+	*model.LedgerLine
+	Balance int `json:"balance"`
+}
+
+// LedgerAccountStatement lists the lines of an account in a period with the balance after each
+type LedgerAccountStatement struct {
+	Account        *model.LedgerAccount   `json:"account"`
+	PartnerID      int                    `json:"partner_id,omitempty"`
+	StartDate      time.Time              `json:"start_date"`
+	EndDate        time.Time              `json:"end_date"`
+	OpeningBalance int                    `json:"opening_balance"`
+	Debit          int                    `json:"debit"`
+	Credit         int                    `json:"credit"`
+	ClosingBalance int                    `json:"closing_balance"`
+	Lines          []*LedgerStatementLine `json:"lines"`
+}
+
+// AccountStatement returns the statement of an account in [startDate, endDate), of the entries of
+// partnerID only when it is not 0
+func (l *Ledger) AccountStatement(
+	code model.LedgerAccountCode,
+	partnerID int,
+	startDate, endDate time.Time,
+) (*LedgerAccountStatement, error) {
+	account, err := l.db.LedgerStore.GetAccountByCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	opening, err := l.db.LedgerStore.SumAccount(code, partnerID, startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := l.db.LedgerStore.GetLines(code, partnerID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &LedgerAccountStatement{
+		Account:        account,
+		PartnerID:      partnerID,
+		StartDate:      startDate,
+		EndDate:        endDate,
+		OpeningBalance: account.Balance(opening.Debit, opening.Credit),
+		Lines:          make([]*LedgerStatementLine, len(lines)),
+	}
+	balance := res.OpeningBalance
+	for i, line := range lines {
+		balance += account.Balance(line.Debit, line.Credit)
+		res.Debit += line.Debit
+		res.Credit += line.Credit
+		res.Lines[i] = &LedgerStatementLine{line, balance}
+	}
+	res.ClosingBalance = balance
+
+	return res, nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestLedger(t *testing.T) {
+	customer := newTestAccount(t, model.RoleIDCustomer)
+	car := newTestCar(t, &model.Car{})
+	partnerID := car.PartnerID
+
+	now := time.Now().Truncate(time.Second)
+	contract := &model.CustomerContract{
+		CustomerID:             customer.ID,
+		CarID:                  car.ID,
+		StartDate:              now.Add(-48 * time.Hour),
+		EndDate:                now.Add(-time.Hour),
+		Status:                 model.CustomerContractStatusCompleted,
+		RentPrice:              900_000,
+		InsuranceAmount:        100_000,
+		CustomerContractRuleID: 1,
+	}
+	require.NoError(t, TestDb.CustomerContractStore.Create(contract))
+
+	l := NewLedger(TestDb)
+	post := func(post func(tx *gorm.DB) error) error {
+		return TestDb.DB.Transaction(post)
+	}
+	lines := func(reference string) map[model.LedgerAccountCode]int {
+		entry, err := TestDb.LedgerStore.GetEntryByReference(reference)
+		require.NoError(t, err)
+
+		res := make(map[model.LedgerAccountCode]int)
+		for _, line := range entry.Lines {
+			res[line.AccountCode] += line.Debit - line.Credit
+		}
+		return res
+	}
+
+	t.Run("entries balance", func(t *testing.T) {
+		err := post(func(tx *gorm.DB) error {
+			return l.PostTx(tx, &model.LedgerEntry{
+				Reference: "ledger_test:unbalanced",
+				Lines:     []*model.LedgerLine{debit(model.LedgerAccountCash, 2), credit(model.LedgerAccountPlatformRevenue, 1)},
+			})
+		})
+		require.ErrorIs(t, err, ErrUnbalancedLedgerEntry)
+	})
+
+	prepay := &model.CustomerPayment{
+		CustomerContractID: contract.ID,
+		PaymentType:        model.PaymentTypePrePay,
+		Amount:             300_000,
+		Status:             model.PaymentStatusPaid,
+	}
+	require.NoError(t, TestDb.CustomerPaymentStore.Create(prepay))
+
+	t.Run("rent is split into insurance and revenue once", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			require.NoError(t, post(func(tx *gorm.DB) error {
+				return l.PostCustomerPaymentTx(tx, prepay)
+			}))
+		}
+
+		require.Equal(t, map[model.LedgerAccountCode]int{
+			model.LedgerAccountCash:            300_000,
+			model.LedgerAccountInsurancePool:   -30_000,
+			model.LedgerAccountPlatformRevenue: -270_000,
+		}, lines(fmt.Sprintf("customer_payment:%d", prepay.ID)))
+	})
+
+	t.Run("refunds reverse their payment", func(t *testing.T) {
+		refund := &model.CustomerRefund{
+			CustomerPaymentID: prepay.ID,
+			Amount:            100_000,
+			Status:            model.CustomerRefundStatusSucceeded,
+		}
+		require.NoError(t, post(func(tx *gorm.DB) error {
+			if err := TestDb.CustomerRefundStore.CreateTx(tx, refund); err != nil {
+				return err
+			}
+			return l.PostCustomerRefundTx(tx, refund, prepay)
+		}))
+
+		require.Equal(t, map[model.LedgerAccountCode]int{
+			model.LedgerAccountCash:            -100_000,
+			model.LedgerAccountInsurancePool:   10_000,
+			model.LedgerAccountPlatformRevenue: 90_000,
+		}, lines(fmt.Sprintf("customer_refund:%d", refund.ID)))
+	})
+
+	t.Run("partner payable follows settlements, adjustments and payouts", func(t *testing.T) {
+		startDate := now.Add(-time.Hour)
+		history := &model.PartnerPaymentHistory{PartnerID: partnerID, StartDate: startDate, EndDate: now, Amount: 200_000}
+		require.NoError(t, post(func(tx *gorm.DB) error {
+			if err := TestDb.PartnerPaymentHistoryStore.FirstOrCreateTx(tx, history); err != nil {
+				return err
+			}
+
+			items := []*model.PartnerPaymentCustomerContract{
+				{PartnerPaymentHistoryID: history.ID, CustomerContractID: contract.ID, NetAmount: 250_000},
+			}
+			if err := TestDb.PartnerPaymentHistoryStore.CreateCustomerContractsTx(tx, items); err != nil {
+				return err
+			}
+
+			if err := l.PostPartnerSettlementTx(tx, history, items); err != nil {
+				return err
+			}
+
+			adjustment := &model.PartnerPaymentAdjustment{
+				PartnerPaymentHistoryID: history.ID,
+				Category:                model.PartnerPaymentAdjustmentCategoryPenalty,
+				Amount:                  -50_000,
+			}
+			if err := TestDb.PartnerPaymentAdjustmentStore.CreateTx(tx, adjustment); err != nil {
+				return err
+			}
+
+			if err := l.PostPartnerPaymentAdjustmentTx(tx, history, adjustment); err != nil {
+				return err
+			}
+
+			return l.PostPartnerPaymentTx(tx, history)
+		}))
+
+		statement, err := l.AccountStatement(model.LedgerAccountPartnerPayable, partnerID, startDate, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, 0, statement.OpeningBalance)
+		require.Len(t, statement.Lines, 3)
+		require.Equal(t, []int{250_000, 200_000, 0}, []int{
+			statement.Lines[0].Balance, statement.Lines[1].Balance, statement.Lines[2].Balance,
+		})
+		require.Equal(t, 0, statement.ClosingBalance)
+	})
+
+	t.Run("trial balance", func(t *testing.T) {
+		trialBalance, err := l.TrialBalance(time.Time{})
+		require.NoError(t, err)
+		require.True(t, trialBalance.Balanced)
+		require.Len(t, trialBalance.Accounts, 6)
+	})
+}
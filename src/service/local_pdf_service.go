@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/store"
+)
+
+var _ IPDFService = (*LocalPDFService)(nil)
+
+var ErrContractTemplateNotPublished = errors.New("contract template is not published")
+
+// contractTemplateFiles holds a file per contract type and version, named like customer_v1.tmpl.
+// They seed the contract templates of a new database.
+//
+//go:embed contract_templates/*.tmpl
+var contractTemplateFiles embed.FS
+
+// BuiltinContractTemplates returns the latest contract template of each type shipped with the
+// server
+func BuiltinContractTemplates() ([]*model.ContractTemplate, error) {
+	entries, err := contractTemplateFiles.ReadDir("contract_templates")
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[model.ContractTemplateType]*model.ContractTemplate)
+	for _, entry := range entries {
+		name, _ := strings.CutSuffix(entry.Name(), ".tmpl")
+		templateType, version, ok := strings.Cut(name, "_v")
+		if !ok {
+			return nil, fmt.Errorf("contract template %s is not named <type>_v<version>.tmpl", entry.Name())
+		}
+
+		versionInt, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("contract template %s: %w", entry.Name(), err)
+		}
+
+		if t := latest[model.ContractTemplateType(templateType)]; t != nil && t.Version > versionInt {
+			continue
+		}
+
+		body, err := contractTemplateFiles.ReadFile(path.Join("contract_templates", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		latest[model.ContractTemplateType(templateType)] = &model.ContractTemplate{
+			Type:    model.ContractTemplateType(templateType),
+			Version: versionInt,
+			Body:    string(body),
+			Note:    "Built in",
+			Status:  model.ContractTemplateStatusPublished,
+		}
+	}
+
+	res := make([]*model.ContractTemplate, 0, len(latest))
+	for _, t := range latest {
+		res = append(res, t)
+	}
+
+	return res, nil
+}
+
+// LocalPDFService renders contracts in process from the contract templates and uploads them to S3.
+// New contracts get the published version of their type, a contract pinned to a version is
+// rendered with it again.
+type LocalPDFService struct {
+	db      *store.DbStore
+	s3store *store.S3Store
+	// templates caches the templates by type and version, a version never changes once created
+	templates sync.Map
+}
+
+// NewLocalPDFService seeds the built in templates for the contract types without any version yet
+func NewLocalPDFService(db *store.DbStore, s3Store *store.S3Store) (*LocalPDFService, error) {
+	templates, err := BuiltinContractTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range templates {
+		if err := ValidateContractTemplate(t); err != nil {
+			return nil, fmt.Errorf("built in %s contract template v%d: %w", t.Type, t.Version, err)
+		}
+
+		if err := db.ContractTemplateStore.Seed(t); err != nil {
+			return nil, err
+		}
+	}
+
+	return &LocalPDFService{db: db, s3store: s3Store}, nil
+}
+
+func (s *LocalPDFService) template(tz RenderType, version int) (*model.ContractTemplate, error) {
+	templateType := model.ContractTemplateType(tz)
+	if version == 0 {
+		return s.db.ContractTemplateStore.GetPublished(templateType)
+	}
+
+	key := fmt.Sprintf("%s_v%d", templateType, version)
+	if t, ok := s.templates.Load(key); ok {
+		return t.(*model.ContractTemplate), nil
+	}
+
+	t, err := s.db.ContractTemplateStore.GetByVersion(templateType, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Status == model.ContractTemplateStatusDraft {
+		return nil, fmt.Errorf("%w: %s version %d", ErrContractTemplateNotPublished, tz, version)
+	}
+
+	s.templates.Store(key, t)
+	return t, nil
+}
+
+// RenderPDF returns the PDF file of a contract and the template version it was rendered with
+func (s *LocalPDFService) RenderPDF(tz RenderType, version int, payload map[string]string) ([]byte, int, error) {
+	t, err := s.template(tz, version)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	bz, err := RenderContractTemplate(t, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return bz, t.Version, nil
+}
+
+func (s *LocalPDFService) Render(tz RenderType, version int, payload map[string]string) (*RenderedContract, error) {
+	bz, renderedVersion, err := s.RenderPDF(tz, version, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	docUUID := uuid.NewString()
+	if _, err := s.s3store.Client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(s.s3store.Config.Bucket),
+		Body:        bytes.NewReader(bz),
+		Key:         aws.String(docUUID + ".pdf"),
+		ACL:         types.ObjectCannedACLPublicRead,
+		ContentType: aws.String("application/pdf"),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &RenderedContract{UUID: docUUID, TemplateVersion: renderedVersion}, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/pdf"
+)
+
+func TestLocalPDFService_RenderPDF(t *testing.T) {
+	s, err := NewLocalPDFService(TestDb, TestS3Store)
+	require.NoError(t, err)
+
+	builtins, err := BuiltinContractTemplates()
+	require.NoError(t, err)
+	builtinVersions := make(map[RenderType]int)
+	for _, builtin := range builtins {
+		builtinVersions[RenderType(builtin.Type)] = builtin.Version
+	}
+
+	customer := map[string]string{
+		"now_date": "18", "now_month": "10", "now_year": "2026",
+		"customer_fullname": "Nguyễn Văn Đức", "customer_date_of_birth": "01/02/1990", "customer_id_card": "079090000001",
+		"brand_model": "Toyota Vios", "license_plate": "51A-123.45", "number_of_seats": "5", "car_year": "2022",
+		"price": "1500000", "prepay_percent": "30.00", "insurance_percent": "10.00",
+		"start_hour": "8", "start_date": "20", "start_month": "10", "start_year": "2026",
+		"end_hour": "8", "end_date": "22", "end_month": "10", "end_year": "2026",
+		"bank_number": "0123456789", "bank_name": "Vietcombank", "bank_owner": "NGUYEN VAN DUC",
+		"collateral_amount_1": "15000000", "collateral_amount_2": "15000000",
+	}
+
+	t.Run("customer contract keeps its diacritics and formats money", func(t *testing.T) {
+		bz, version, err := s.RenderPDF(RenderTypeCustomer, builtinVersions[RenderTypeCustomer], customer)
+		require.NoError(t, err)
+		require.Equal(t, builtinVersions[RenderTypeCustomer], version)
+		require.True(t, pdf.ContainsText(bz, "Nguyễn Văn Đức"))
+		require.True(t, pdf.ContainsText(bz, "1.500.000 VND"))
+		require.True(t, pdf.ContainsText(bz, "15.000.000 VND"))
+	})
+
+	t.Run("partner contract", func(t *testing.T) {
+		bz, version, err := s.RenderPDF(RenderTypePartner, builtinVersions[RenderTypePartner], map[string]string{
+			"now_date": "18", "now_month": "10", "now_year": "2026",
+			"partner_fullname": "Trần Thị Hà", "partner_date_of_birth": "01/02/1985", "partner_id_card": "079085000001",
+			"brand_model": "Toyota Vios", "license_plate": "51A-123.45", "number_of_seats": "5", "car_year": "2022",
+			"period": "6", "period_start_date": "1", "period_start_month": "11", "period_start_year": "2026",
+			"period_end_date": "1", "period_end_month": "5", "period_end_year": "2027",
+			"partner_revenue_percent": "70", "partner_bank_number": "0123456789", "partner_bank_owner": "TRAN THI HA",
+			"partner_bank_name": "Vietcombank",
+		})
+		require.NoError(t, err)
+		require.Equal(t, builtinVersions[RenderTypePartner], version)
+		require.True(t, pdf.ContainsText(bz, "Trần Thị Hà"))
+	})
+
+	t.Run("missing and invalid fields are errors", func(t *testing.T) {
+		payload := make(map[string]string)
+		for k, v := range customer {
+			payload[k] = v
+		}
+
+		delete(payload, "license_plate")
+		_, _, err := s.RenderPDF(RenderTypeCustomer, builtinVersions[RenderTypeCustomer], payload)
+		require.ErrorContains(t, err, "license_plate")
+
+		payload["license_plate"], payload["price"] = "51A-123.45", "a lot"
+		_, _, err = s.RenderPDF(RenderTypeCustomer, builtinVersions[RenderTypeCustomer], payload)
+		require.Error(t, err)
+	})
+
+	t.Run("unknown versions are errors", func(t *testing.T) {
+		_, _, err := s.RenderPDF(RenderTypeCustomer, 1_000, customer)
+		require.Error(t, err)
+	})
+}
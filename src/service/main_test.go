@@ -5,9 +5,14 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 
 	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/model"
 	"github.com/godev111222333/capstone-backend/src/store"
 )
 
@@ -20,6 +25,9 @@ var (
 	TestS3Store  *store.S3Store
 	TestConfig   *misc.GlobalConfig
 	TestFeConfig *misc.FEConfig
+
+	// testSeq makes the phone numbers and license plates of the fixtures unique
+	testSeq atomic.Int64
 )
 
 func TestMain(m *testing.M) {
@@ -94,3 +102,75 @@ func ResetDb(cfg *misc.DatabaseConfig) error {
 
 	return nil
 }
+
+// newTestAccount creates an active account of role with a unique phone number
+func newTestAccount(t *testing.T, roleID model.RoleID) *model.Account {
+	acct := &model.Account{
+		PhoneNumber: fmt.Sprintf("09%08d", testSeq.Add(1)),
+		Status:      model.AccountStatusActive,
+		RoleID:      roleID,
+	}
+	require.NoError(t, TestDb.AccountStore.Create(acct))
+	return acct
+}
+
+// newTestCar creates car with a car model and a partner of its own. It is active under partner
+// contract rule 1 and gets a unique license plate unless they are set.
+func newTestCar(t *testing.T, car *model.Car) *model.Car {
+	carModel := &model.CarModel{Brand: "Test"}
+	require.NoError(t, TestDb.CarModelStore.Create([]*model.CarModel{carModel}))
+
+	car.CarModelID, car.PartnerID = carModel.ID, newTestAccount(t, model.RoleIDPartner).ID
+	if car.LicensePlate == "" {
+		car.LicensePlate = fmt.Sprintf("TEST-%d", testSeq.Add(1))
+	}
+	if car.Status == "" {
+		car.Status = model.CarStatusActive
+	}
+	if car.PartnerContractRuleID == 0 {
+		car.PartnerContractRuleID = 1
+	}
+	require.NoError(t, TestDb.CarStore.Create(car))
+	return car
+}
+
+// newReservedContract reserves contract by its customer, creating a new car and customer unless
+// CarID and CustomerID are set. The contract is waiting for the agreement.
+func newReservedContract(t *testing.T, contract *model.CustomerContract) *model.CustomerContract {
+	if contract.CarID == 0 {
+		contract.CarID = newTestCar(t, &model.Car{}).ID
+	}
+	if contract.CustomerID == 0 {
+		contract.CustomerID = newTestAccount(t, model.RoleIDCustomer).ID
+	}
+	if contract.CustomerContractRuleID == 0 {
+		contract.CustomerContractRuleID = 1
+	}
+	contract.Status = model.CustomerContractStatusWaitingContractAgreement
+
+	actor := ContractActor{AccountID: contract.CustomerID, Role: model.RoleNameCustomer}
+	require.NoError(t, NewCustomerContractStateMachine(TestDb).Reserve(contract, actor, time.Hour))
+	return contract
+}
+
+// newRentingContract reserves contract like newReservedContract, unless it is already reserved,
+// and moves it on to renting
+func newRentingContract(t *testing.T, contract *model.CustomerContract) *model.CustomerContract {
+	if contract.ID == 0 {
+		newReservedContract(t, contract)
+	}
+
+	m := NewCustomerContractStateMachine(TestDb)
+	for _, to := range []model.CustomerContractStatus{
+		model.CustomerContractStatusWaitingContractPayment,
+		model.CustomerContractStatusOrdered,
+		model.CustomerContractStatusAppraisingCarApproved,
+		model.CustomerContractStatusRenting,
+	} {
+		_, err := m.Transit(&CustomerContractTransition{CustomerContractID: contract.ID, To: to, Actor: SystemContractActor})
+		require.NoError(t, err)
+	}
+
+	contract.Status = model.CustomerContractStatusRenting
+	return contract
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+	"github.com/godev111222333/capstone-backend/src/store"
+)
+
+var (
+	ErrPartnerPaymentNotAdjustable     = errors.New("partner payment is already paid")
+	ErrInvalidPartnerPaymentAdjustment = errors.New("invalid partner payment adjustment")
+)
+
+// PartnerStatement lists what a partner payment is made of: the settled contracts with their
+// gross, platform share and net, and the manual adjustments
+type PartnerStatement struct {
+	Payment          *model.PartnerPaymentHistory            `json:"payment"`
+	Contracts        []*model.PartnerPaymentCustomerContract `json:"contracts"`
+	Adjustments      []*model.PartnerPaymentAdjustment       `json:"adjustments"`
+	GrossAmount      int                                     `json:"gross_amount"`
+	PlatformAmount   int                                     `json:"platform_amount"`
+	NetAmount        int                                     `json:"net_amount"`
+	AdjustmentAmount int                                     `json:"adjustment_amount"`
+}
+
+// PartnerSettlementService settles the completed contracts of partners into one payment per
+// partner and period. Settling a period again only adds the contracts completed since, and a
+// contract is never settled twice.
+type PartnerSettlementService struct {
+	db     *store.DbStore
+	ledger *Ledger
+}
+
+func NewPartnerSettlementService(db *store.DbStore) *PartnerSettlementService {
+	return &PartnerSettlementService{db, NewLedger(db)}
+}
+
+// Settle settles the contracts ending in [startDate, endDate) and returns the pending payments
+// whose amount changed, they need a new payment url. Contracts completed after their own period
+// was settled are settled into this period's payment. Contracts of a partner whose
+// payment for this period is already paid stay unsettled until the next one.
+func (s *PartnerSettlementService) Settle(startDate, endDate time.Time) ([]*model.PartnerPaymentHistory, error) {
+	contracts, err := s.unsettledContractsTx(s.db.DB, 0, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	partnerIDs := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, contract := range contracts {
+		if partnerID := contract.Car.PartnerID; !seen[partnerID] {
+			seen[partnerID] = true
+			partnerIDs = append(partnerIDs, partnerID)
+		}
+	}
+
+	res := make([]*model.PartnerPaymentHistory, 0, len(partnerIDs))
+	for _, partnerID := range partnerIDs {
+		history, err := s.settlePartner(partnerID, startDate, endDate)
+		if err != nil {
+			return res, err
+		}
+
+		if history != nil {
+			res = append(res, history)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *PartnerSettlementService) settlePartner(partnerID int, startDate, endDate time.Time) (*model.PartnerPaymentHistory, error) {
+	history := &model.PartnerPaymentHistory{
+		PartnerID: partnerID,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Status:    model.PartnerPaymentHistoryStatusPending,
+	}
+
+	changed := false
+	if err := s.db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.db.PartnerPaymentHistoryStore.FirstOrCreateTx(tx, history); err != nil {
+			return err
+		}
+
+		if history.Status != model.PartnerPaymentHistoryStatusPending {
+			return nil
+		}
+
+		// read again under the lock, a concurrent settlement may have taken some of them
+		contracts, err := s.unsettledContractsTx(tx, partnerID, startDate, endDate)
+		if err != nil {
+			return err
+		}
+
+		if len(contracts) == 0 {
+			return nil
+		}
+
+		items := make([]*model.PartnerPaymentCustomerContract, len(contracts))
+		for i, contract := range contracts {
+			rule := contract.Car.PartnerContractRule
+			platform, net := rule.SplitRevenue(contract.RentPrice)
+			items[i] = &model.PartnerPaymentCustomerContract{
+				PartnerPaymentHistoryID: history.ID,
+				CustomerContractID:      contract.ID,
+				RevenueSharingPercent:   rule.RevenueSharingPercent,
+				GrossAmount:             contract.RentPrice,
+				PlatformAmount:          platform,
+				NetAmount:               net,
+			}
+		}
+
+		if err := s.db.PartnerPaymentHistoryStore.CreateCustomerContractsTx(tx, items); err != nil {
+			return err
+		}
+
+		if err := s.ledger.PostPartnerSettlementTx(tx, history, items); err != nil {
+			return err
+		}
+
+		changed = true
+		return s.updateAmountTx(tx, history)
+	}); err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return nil, nil
+	}
+
+	return history, nil
+}
+
+// unsettledContractsTx returns the unsettled contracts ending in [startDate, endDate) and the
+// ones that ended earlier but were completed after their period was settled
+func (s *PartnerSettlementService) unsettledContractsTx(
+	tx *gorm.DB,
+	partnerID int,
+	startDate, endDate time.Time,
+) ([]*model.CustomerContract, error) {
+	late, err := s.db.CustomerContractStore.GetLateCompletedTx(tx, partnerID, startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	contracts, err := s.db.CustomerContractStore.GetUnsettledCompletedTx(tx, partnerID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(late, contracts...), nil
+}
+
+// AddAdjustment adds a manual line item to a pending partner payment and returns the payment with
+// its new amount. The amount takes the sign of the category and the payment can not go negative.
+func (s *PartnerSettlementService) AddAdjustment(adjustment *model.PartnerPaymentAdjustment) (*model.PartnerPaymentHistory, error) {
+	adjustment.Amount = adjustment.Category.SignedAmount(adjustment.Amount)
+	if adjustment.Amount == 0 {
+		return nil, fmt.Errorf("%w: amount is zero", ErrInvalidPartnerPaymentAdjustment)
+	}
+
+	var history *model.PartnerPaymentHistory
+	if err := s.db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		history, err = s.db.PartnerPaymentHistoryStore.GetByIDForUpdate(tx, adjustment.PartnerPaymentHistoryID)
+		if err != nil {
+			return err
+		}
+
+		if history.Status != model.PartnerPaymentHistoryStatusPending {
+			return ErrPartnerPaymentNotAdjustable
+		}
+
+		if err := s.db.PartnerPaymentAdjustmentStore.CreateTx(tx, adjustment); err != nil {
+			return err
+		}
+
+		if err := s.updateAmountTx(tx, history); err != nil {
+			return err
+		}
+
+		return s.ledger.PostPartnerPaymentAdjustmentTx(tx, history, adjustment)
+	}); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// updateAmountTx sets the amount of a payment to the net of its contracts plus its adjustments
+func (s *PartnerSettlementService) updateAmountTx(tx *gorm.DB, history *model.PartnerPaymentHistory) error {
+	net, err := s.db.PartnerPaymentHistoryStore.SumNetAmountTx(tx, history.ID)
+	if err != nil {
+		return err
+	}
+
+	adjustments, err := s.db.PartnerPaymentAdjustmentStore.SumAmountTx(tx, history.ID)
+	if err != nil {
+		return err
+	}
+
+	amount := net + adjustments
+	if amount < 0 {
+		return fmt.Errorf("%w: payment %d would be %d", ErrInvalidPartnerPaymentAdjustment, history.ID, amount)
+	}
+
+	history.Amount = amount
+	return s.db.PartnerPaymentHistoryStore.UpdateTx(tx, history.ID, map[string]interface{}{"amount": amount})
+}
+
+// Statement returns the statement of a partner payment
+func (s *PartnerSettlementService) Statement(historyID int) (*PartnerStatement, error) {
+	history, err := s.db.PartnerPaymentHistoryStore.GetByID(historyID)
+	if err != nil {
+		return nil, err
+	}
+
+	contracts, err := s.db.PartnerPaymentHistoryStore.GetCustomerContracts(historyID)
+	if err != nil {
+		return nil, err
+	}
+
+	adjustments, err := s.db.PartnerPaymentAdjustmentStore.GetByPartnerPaymentHistoryID(historyID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &PartnerStatement{Payment: history, Contracts: contracts, Adjustments: adjustments}
+	for _, contract := range contracts {
+		res.GrossAmount += contract.GrossAmount
+		res.PlatformAmount += contract.PlatformAmount
+		res.NetAmount += contract.NetAmount
+	}
+	for _, adjustment := range adjustments {
+		res.AdjustmentAmount += adjustment.Amount
+	}
+
+	return res, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+func TestPartnerSettlementService(t *testing.T) {
+	customer := newTestAccount(t, model.RoleIDCustomer)
+	rule := &model.PartnerContractRule{RevenueSharingPercent: 12.5, MaxWarningCount: 3}
+	require.NoError(t, TestDb.PartnerContractRuleStore.Create(rule))
+	car := newTestCar(t, &model.Car{PartnerContractRuleID: rule.ID})
+	partnerID := car.PartnerID
+
+	// a period of its own, so contracts of other tests are not settled here
+	startDate := time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+	endDate := startDate.AddDate(0, 1, 0)
+	newContract := func(rentPrice int, endDate time.Time) *model.CustomerContract {
+		return &model.CustomerContract{
+			CustomerID:             customer.ID,
+			CarID:                  car.ID,
+			StartDate:              endDate.Add(-24 * time.Hour),
+			EndDate:                endDate,
+			Status:                 model.CustomerContractStatusCompleted,
+			RentPrice:              rentPrice,
+			CustomerContractRuleID: 1,
+		}
+	}
+	require.NoError(t, TestDb.CustomerContractStore.CreateBatch([]*model.CustomerContract{
+		newContract(1_000_001, startDate.Add(48*time.Hour)),
+		newContract(999, startDate.Add(96*time.Hour)),
+		newContract(5_000_000, endDate.Add(time.Hour)),
+	}))
+
+	s := NewPartnerSettlementService(TestDb)
+
+	t.Run("contracts are split with rounding and settled once", func(t *testing.T) {
+		payments, err := s.Settle(startDate, endDate)
+		require.NoError(t, err)
+		require.Len(t, payments, 1)
+		require.Equal(t, partnerID, payments[0].PartnerID)
+		require.Equal(t, 875_001+874, payments[0].Amount)
+
+		payments, err = s.Settle(startDate, endDate)
+		require.NoError(t, err)
+		require.Empty(t, payments)
+	})
+
+	history, err := TestDb.PartnerPaymentHistoryStore.GetRevenue(partnerID, startDate, endDate.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	t.Run("late contracts join the pending payment of their period", func(t *testing.T) {
+		require.NoError(t, TestDb.CustomerContractStore.Create(newContract(1_000, startDate.Add(120*time.Hour))))
+
+		payments, err := s.Settle(startDate, endDate)
+		require.NoError(t, err)
+		require.Len(t, payments, 1)
+		require.Equal(t, history[0].ID, payments[0].ID)
+		require.Equal(t, 875_001+874+875, payments[0].Amount)
+	})
+
+	t.Run("adjustments take the sign of their category", func(t *testing.T) {
+		payment, err := s.AddAdjustment(&model.PartnerPaymentAdjustment{
+			PartnerPaymentHistoryID: history[0].ID,
+			Category:                model.PartnerPaymentAdjustmentCategoryPenalty,
+			Description:             "late car delivery",
+			Amount:                  100_000,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 876_750-100_000, payment.Amount)
+
+		_, err = s.AddAdjustment(&model.PartnerPaymentAdjustment{
+			PartnerPaymentHistoryID: history[0].ID,
+			Category:                model.PartnerPaymentAdjustmentCategoryPenalty,
+			Amount:                  10_000_000,
+		})
+		require.ErrorIs(t, err, ErrInvalidPartnerPaymentAdjustment)
+
+		payment, err = s.AddAdjustment(&model.PartnerPaymentAdjustment{
+			PartnerPaymentHistoryID: history[0].ID,
+			Category:                model.PartnerPaymentAdjustmentCategoryDamageReimbursement,
+			Description:             "scratched door",
+			Amount:                  -50_000,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 876_750-100_000+50_000, payment.Amount)
+	})
+
+	t.Run("statement lists contracts and adjustments", func(t *testing.T) {
+		statement, err := s.Statement(history[0].ID)
+		require.NoError(t, err)
+		require.Len(t, statement.Contracts, 3)
+		require.Len(t, statement.Adjustments, 2)
+		require.Equal(t, 1_000_001+999+1_000, statement.GrossAmount)
+		require.Equal(t, 125_000+125+125, statement.PlatformAmount)
+		require.Equal(t, 876_750, statement.NetAmount)
+		require.Equal(t, -50_000, statement.AdjustmentAmount)
+		require.Equal(t, statement.NetAmount+statement.AdjustmentAmount, statement.Payment.Amount)
+	})
+
+	t.Run("paid payments are not adjusted", func(t *testing.T) {
+		require.NoError(t, TestDb.PartnerPaymentHistoryStore.Update(history[0].ID, map[string]interface{}{
+			"status": string(model.PartnerPaymentHistoryStatusPaid),
+		}))
+
+		_, err := s.AddAdjustment(&model.PartnerPaymentAdjustment{
+			PartnerPaymentHistoryID: history[0].ID,
+			Category:                model.PartnerPaymentAdjustmentCategoryBonus,
+			Amount:                  1,
+		})
+		require.ErrorIs(t, err, ErrPartnerPaymentNotAdjustable)
+	})
+
+	t.Run("contracts completed after their period was paid join the next payment", func(t *testing.T) {
+		require.NoError(t, TestDb.CustomerContractStore.Create(newContract(1_000, startDate.Add(144*time.Hour))))
+
+		payments, err := s.Settle(endDate, endDate.AddDate(0, 1, 0))
+		require.NoError(t, err)
+		require.Len(t, payments, 1)
+		require.NotEqual(t, history[0].ID, payments[0].ID)
+		require.Equal(t, 4_375_000+875, payments[0].Amount)
+	})
+}
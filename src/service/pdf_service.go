@@ -3,11 +3,13 @@ package service
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/godev111222333/capstone-backend/src/misc"
+	"github.com/godev111222333/capstone-backend/src/store"
 )
 
 var _ IPDFService = (*PDFService)(nil)
@@ -19,8 +21,29 @@ const (
 	RenderTypePartner  RenderType = "partner"
 )
 
+// RenderedContract is a contract uploaded as <UUID>.pdf, with the version of the template it was
+// rendered from. The external renderer has no versions, it keeps the version it was asked for so
+// a version pinned by the local renderer survives, and new contracts stay version 0.
+type RenderedContract struct {
+	UUID            string
+	TemplateVersion int
+}
+
+// IPDFService renders a contract with a template version, or with the current one when version is 0
 type IPDFService interface {
-	Render(tz RenderType, payload map[string]string) (string, error)
+	Render(tz RenderType, version int, payload map[string]string) (*RenderedContract, error)
+}
+
+// NewPDFServiceFromConfig returns the renderer selected by cfg.Renderer, the external one by default
+func NewPDFServiceFromConfig(cfg *misc.PDFServiceConfig, db *store.DbStore, s3Store *store.S3Store) (IPDFService, error) {
+	switch cfg.Renderer {
+	case "", misc.PDFRendererExternal:
+		return NewPDFService(cfg), nil
+	case misc.PDFRendererLocal:
+		return NewLocalPDFService(db, s3Store)
+	default:
+		return nil, fmt.Errorf("unknown pdf_service.renderer %q", cfg.Renderer)
+	}
 }
 
 type PDFService struct {
@@ -29,37 +52,46 @@ type PDFService struct {
 }
 
 func NewPDFService(cfg *misc.PDFServiceConfig) *PDFService {
-	client := http.DefaultClient
-	client.Timeout = cfg.Timeout
-	return &PDFService{cfg, client}
+	return &PDFService{cfg, &http.Client{Timeout: cfg.Timeout}}
 }
 
-func (s *PDFService) Render(tz RenderType, payload map[string]string) (string, error) {
+// Render renders with the external renderer's own wording whatever the version, and returns the
+// version unchanged
+func (s *PDFService) Render(tz RenderType, version int, payload map[string]string) (*RenderedContract, error) {
 	url := s.cfg.Url + "/render_customer_contract"
 	if tz == RenderTypePartner {
 		url = s.cfg.Url + "/render_partner_contract"
 	}
 	bz, err := json.Marshal(payload)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	resp, err := s.client.Post(url, "application/json", bytes.NewReader(bz))
-	if err != nil || resp.StatusCode != http.StatusOK {
-		fmt.Printf("render contract error :%v\n", err)
-		return "", nil
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("render %s contract: status %d", tz, resp.StatusCode)
 	}
 
 	bz, err = io.ReadAll(resp.Body)
-	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
 
 	respPayload := struct {
 		UUID string `json:"uuid"`
 	}{}
 	if err := json.Unmarshal(bz, &respPayload); err != nil {
-		fmt.Println(err)
-		return "", err
+		return nil, err
+	}
+
+	if respPayload.UUID == "" {
+		return nil, errors.New("render " + string(tz) + " contract: empty uuid")
 	}
 
-	return respPayload.UUID, nil
+	return &RenderedContract{UUID: respPayload.UUID, TemplateVersion: version}, nil
 }
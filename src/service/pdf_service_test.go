@@ -0,0 +1,38 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/godev111222333/capstone-backend/src/misc"
+)
+
+func TestPDFService_Render(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/render_customer_contract" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"uuid":"9b2f5c1e"}`))
+	}))
+	defer server.Close()
+
+	s := NewPDFService(&misc.PDFServiceConfig{Url: server.URL, Timeout: time.Second})
+
+	t.Run("a pinned version is kept", func(t *testing.T) {
+		rendered, err := s.Render(RenderTypeCustomer, 3, map[string]string{})
+		require.NoError(t, err)
+		require.Equal(t, "9b2f5c1e", rendered.UUID)
+		require.Equal(t, 3, rendered.TemplateVersion)
+	})
+
+	t.Run("new contracts stay version 0", func(t *testing.T) {
+		rendered, err := s.Render(RenderTypeCustomer, 0, map[string]string{})
+		require.NoError(t, err)
+		require.Equal(t, 0, rendered.TemplateVersion)
+	})
+}
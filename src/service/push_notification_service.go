@@ -38,6 +38,8 @@ type INotificationPushService interface {
 	NewCarResolved(carID, contractID int, expoToken, toPhone string) *PushMessage
 	NewCustomerCarPendingResolve(contractID int, expoToken, toPhone string) *PushMessage
 	NewCustomerCarResolved(contractID int, expoToken, toPhone string) *PushMessage
+	NewCustomerOvertimeFeeMsg(contractID, amount int, expoToken, toPhone string) *PushMessage
+	NewPartnerCarOverdueMsg(carID, contractID int, expoToken, toPhone string) *PushMessage
 }
 
 type PushMessage struct {
@@ -380,3 +382,27 @@ func (s *NotificationPushService) NewCustomerCarResolved(contractID int, expoTok
 		},
 	}
 }
+
+func (s *NotificationPushService) NewCustomerOvertimeFeeMsg(contractID, amount int, expoToken, toPhone string) *PushMessage {
+	return &PushMessage{
+		To:    []string{expoToken},
+		Title: "Chuyến xe đã quá hạn trả xe",
+		Body:  fmt.Sprintf("Bạn chưa trả xe đúng hạn. MinhHungCar vừa tính thêm phí quá giờ %d VNĐ cho chuyến xe của bạn", amount),
+		Data: map[string]interface{}{
+			"screen":       fmt.Sprintf("%s/detailTrip?contractID=%d", s.FrontendURL, contractID),
+			"phone_number": toPhone,
+		},
+	}
+}
+
+func (s *NotificationPushService) NewPartnerCarOverdueMsg(carID, contractID int, expoToken, toPhone string) *PushMessage {
+	return &PushMessage{
+		To:    []string{expoToken},
+		Title: "Xe của bạn chưa được trả đúng hạn",
+		Body:  "Khách hàng chưa trả xe của bạn đúng hạn. MinhHungCar đang liên hệ với khách hàng",
+		Data: map[string]interface{}{
+			"screen":       fmt.Sprintf("%s/activityDetail?carID=%d&activityID=%d", s.FrontendURL, carID, contractID),
+			"phone_number": toPhone,
+		},
+	}
+}
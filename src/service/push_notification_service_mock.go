@@ -178,6 +178,20 @@ func (mr *MockINotificationPushServiceMockRecorder) NewCustomerCarResolved(contr
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewCustomerCarResolved", reflect.TypeOf((*MockINotificationPushService)(nil).NewCustomerCarResolved), contractID, expoToken, toPhone)
 }
 
+// NewCustomerOvertimeFeeMsg mocks base method.
+func (m *MockINotificationPushService) NewCustomerOvertimeFeeMsg(contractID, amount int, expoToken, toPhone string) *PushMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewCustomerOvertimeFeeMsg", contractID, amount, expoToken, toPhone)
+	ret0, _ := ret[0].(*PushMessage)
+	return ret0
+}
+
+// NewCustomerOvertimeFeeMsg indicates an expected call of NewCustomerOvertimeFeeMsg.
+func (mr *MockINotificationPushServiceMockRecorder) NewCustomerOvertimeFeeMsg(contractID, amount, expoToken, toPhone any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewCustomerOvertimeFeeMsg", reflect.TypeOf((*MockINotificationPushService)(nil).NewCustomerOvertimeFeeMsg), contractID, amount, expoToken, toPhone)
+}
+
 // NewInactiveCarMsg mocks base method.
 func (m *MockINotificationPushService) NewInactiveCarMsg(carID int, expoToken, toPhone string) *PushMessage {
 	m.ctrl.T.Helper()
@@ -206,6 +220,20 @@ func (mr *MockINotificationPushServiceMockRecorder) NewPartnerApproveCustomerCon
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewPartnerApproveCustomerContractMsg", reflect.TypeOf((*MockINotificationPushService)(nil).NewPartnerApproveCustomerContractMsg), contractID, expoToken, toPhone)
 }
 
+// NewPartnerCarOverdueMsg mocks base method.
+func (m *MockINotificationPushService) NewPartnerCarOverdueMsg(carID, contractID int, expoToken, toPhone string) *PushMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewPartnerCarOverdueMsg", carID, contractID, expoToken, toPhone)
+	ret0, _ := ret[0].(*PushMessage)
+	return ret0
+}
+
+// NewPartnerCarOverdueMsg indicates an expected call of NewPartnerCarOverdueMsg.
+func (mr *MockINotificationPushServiceMockRecorder) NewPartnerCarOverdueMsg(carID, contractID, expoToken, toPhone any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewPartnerCarOverdueMsg", reflect.TypeOf((*MockINotificationPushService)(nil).NewPartnerCarOverdueMsg), carID, contractID, expoToken, toPhone)
+}
+
 // NewPartnerReceiveNewRentingRequest mocks base method.
 func (m *MockINotificationPushService) NewPartnerReceiveNewRentingRequest(carID, contractID int, expoToken, toPhone string) *PushMessage {
 	m.ctrl.T.Helper()
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type CarReservationStore struct {
+	db *gorm.DB
+}
+
+func NewCarReservationStore(db *gorm.DB) *CarReservationStore {
+	return &CarReservationStore{db: db}
+}
+
+// CreateIfAvailableTx inserts the reservation and reports false when its period overlaps a hold
+// or booking of the same car. Lapsed holds of the car are released first so they never block it.
+func (s *CarReservationStore) CreateIfAvailableTx(tx *gorm.DB, r *model.CarReservation) (bool, error) {
+	if err := tx.Model(&model.CarReservation{}).
+		Where("car_id = ? and status = ? and expires_at < ?", r.CarID, string(model.CarReservationStatusHold), time.Now()).
+		Updates(map[string]interface{}{
+			"status":     string(model.CarReservationStatusReleased),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		fmt.Printf("CarReservationStore: CreateIfAvailableTx release expired %v\n", err)
+		return false, err
+	}
+
+	row := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(r)
+	if err := row.Error; err != nil {
+		fmt.Printf("CarReservationStore: CreateIfAvailableTx %v\n", err)
+		return false, err
+	}
+
+	return row.RowsAffected > 0, nil
+}
+
+// BookTx turns the active reservation of a contract on carID into a booking and reports false when
+// there is none
+func (s *CarReservationStore) BookTx(tx *gorm.DB, contractID, carID int) (bool, error) {
+	row := tx.Model(&model.CarReservation{}).
+		Where("customer_contract_id = ? and car_id = ? and status in ?", contractID, carID, []string{
+			string(model.CarReservationStatusHold),
+			string(model.CarReservationStatusBooked),
+		}).
+		Where("expires_at is null or expires_at >= ?", time.Now()).
+		Updates(map[string]interface{}{
+			"status":     string(model.CarReservationStatusBooked),
+			"expires_at": nil,
+			"updated_at": time.Now(),
+		})
+	if err := row.Error; err != nil {
+		fmt.Printf("CarReservationStore: BookTx %v\n", err)
+		return false, err
+	}
+
+	return row.RowsAffected > 0, nil
+}
+
+// ExtendHoldTx moves the expiry of the live hold of a contract on carID to expiresAt and reports
+// false when there is none
+func (s *CarReservationStore) ExtendHoldTx(tx *gorm.DB, contractID, carID int, expiresAt time.Time) (bool, error) {
+	row := tx.Model(&model.CarReservation{}).
+		Where("customer_contract_id = ? and car_id = ? and status = ? and expires_at >= ?",
+			contractID, carID, string(model.CarReservationStatusHold), time.Now()).
+		Updates(map[string]interface{}{
+			"expires_at": expiresAt,
+			"updated_at": time.Now(),
+		})
+	if err := row.Error; err != nil {
+		fmt.Printf("CarReservationStore: ExtendHoldTx %v\n", err)
+		return false, err
+	}
+
+	return row.RowsAffected > 0, nil
+}
+
+// IsHeld reports whether a contract has a live hold or a booking of carID
+func (s *CarReservationStore) IsHeld(contractID, carID int) (bool, error) {
+	var count int64
+	if err := s.db.Model(&model.CarReservation{}).
+		Where("customer_contract_id = ? and car_id = ?", contractID, carID).
+		Where("status = ? or (status = ? and expires_at >= ?)",
+			string(model.CarReservationStatusBooked), string(model.CarReservationStatusHold), time.Now()).
+		Count(&count).Error; err != nil {
+		fmt.Printf("CarReservationStore: IsHeld %v\n", err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetLapsedHoldContractIDs returns the contracts whose hold lapsed and that hold or book no car
+// anymore
+func (s *CarReservationStore) GetLapsedHoldContractIDs() ([]int, error) {
+	res := make([]int, 0)
+	if err := s.db.Model(&model.CarReservation{}).
+		Distinct("customer_contract_id").
+		Where("customer_contract_id is not null and status = ? and expires_at < ?",
+			string(model.CarReservationStatusHold), time.Now()).
+		Where(`not exists (select 1 from car_reservations live where live.customer_contract_id = car_reservations.customer_contract_id
+			and (live.status = ? or (live.status = ? and live.expires_at >= ?)))`,
+			string(model.CarReservationStatusBooked), string(model.CarReservationStatusHold), time.Now()).
+		Pluck("customer_contract_id", &res).Error; err != nil {
+		fmt.Printf("CarReservationStore: GetLapsedHoldContractIDs %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ReleaseByCustomerContractTx releases the holds and bookings of a contract, except the ones on
+// keepCarID. Pass 0 to release all of them.
+func (s *CarReservationStore) ReleaseByCustomerContractTx(tx *gorm.DB, contractID, keepCarID int) error {
+	if err := tx.Model(&model.CarReservation{}).
+		Where("customer_contract_id = ? and car_id != ? and status in ?", contractID, keepCarID, []string{
+			string(model.CarReservationStatusHold),
+			string(model.CarReservationStatusBooked),
+		}).
+		Updates(map[string]interface{}{
+			"status":     string(model.CarReservationStatusReleased),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		fmt.Printf("CarReservationStore: ReleaseByCustomerContractTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseExpired releases every lapsed hold and returns how many there were
+func (s *CarReservationStore) ReleaseExpired() (int64, error) {
+	row := s.db.Model(&model.CarReservation{}).
+		Where("status = ? and expires_at < ?", string(model.CarReservationStatusHold), time.Now()).
+		Updates(map[string]interface{}{
+			"status":     string(model.CarReservationStatusReleased),
+			"updated_at": time.Now(),
+		})
+	if err := row.Error; err != nil {
+		fmt.Printf("CarReservationStore: ReleaseExpired %v\n", err)
+		return 0, err
+	}
+
+	return row.RowsAffected, nil
+}
+
+func (s *CarReservationStore) GetByCustomerContractID(contractID int) ([]*model.CarReservation, error) {
+	res := make([]*model.CarReservation, 0)
+	if err := s.db.Where("customer_contract_id = ?", contractID).Order("id").Find(&res).Error; err != nil {
+		fmt.Printf("CarReservationStore: GetByCustomerContractID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *CarReservationStore) GetByID(id int) (*model.CarReservation, error) {
+	res := &model.CarReservation{}
+	if err := s.db.Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("CarReservationStore: GetByID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CreateBlackout blocks the car for the partner and reports false when the period overlaps a
+// hold, booking or another blackout of the car
+func (s *CarReservationStore) CreateBlackout(r *model.CarReservation) (bool, error) {
+	r.Status = model.CarReservationStatusBlocked
+	r.CustomerContractID = nil
+	r.ExpiresAt = nil
+
+	created := false
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, err = s.CreateIfAvailableTx(tx, r)
+		return err
+	}); err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
+// GetBlackouts returns the blackouts of a car that end after from
+func (s *CarReservationStore) GetBlackouts(carID int, from time.Time) ([]*model.CarReservation, error) {
+	res := make([]*model.CarReservation, 0)
+	if err := s.db.
+		Where("car_id = ? and status = ? and end_date >= ?", carID, string(model.CarReservationStatusBlocked), from).
+		Order("start_date").Find(&res).Error; err != nil {
+		fmt.Printf("CarReservationStore: GetBlackouts %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ReleaseBlackout lifts a blackout and reports false when it is not blocking the car anymore
+func (s *CarReservationStore) ReleaseBlackout(id int) (bool, error) {
+	row := s.db.Model(&model.CarReservation{}).
+		Where("id = ? and status = ?", id, string(model.CarReservationStatusBlocked)).
+		Updates(map[string]interface{}{
+			"status":     string(model.CarReservationStatusReleased),
+			"updated_at": time.Now(),
+		})
+	if err := row.Error; err != nil {
+		fmt.Printf("CarReservationStore: ReleaseBlackout %v\n", err)
+		return false, err
+	}
+
+	return row.RowsAffected > 0, nil
+}
+
+// MoveEndTx moves the end of the booking of a contract to endDate and reports false when the
+// longer period overlaps a live hold, booking or blackout of the car. A contract without a
+// booking of its car is booked again.
+func (s *CarReservationStore) MoveEndTx(tx *gorm.DB, contract *model.CustomerContract, endDate time.Time) (bool, error) {
+	booking := &model.CarReservation{}
+	if err := tx.Where("customer_contract_id = ? and car_id = ? and status = ?",
+		contract.ID, contract.CarID, string(model.CarReservationStatusBooked)).
+		First(booking).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.CreateIfAvailableTx(tx, &model.CarReservation{
+				CarID:              contract.CarID,
+				CustomerContractID: &contract.ID,
+				StartDate:          contract.StartDate,
+				EndDate:            endDate,
+				Status:             model.CarReservationStatusBooked,
+			})
+		}
+
+		fmt.Printf("CarReservationStore: MoveEndTx %v\n", err)
+		return false, err
+	}
+
+	var conflicts int64
+	if err := tx.Model(&model.CarReservation{}).
+		Where("car_id = ? and id != ? and start_date <= ? and end_date >= ?", contract.CarID, booking.ID, endDate, booking.StartDate).
+		Where("status in ? or (status = ? and expires_at >= ?)", []string{
+			string(model.CarReservationStatusBooked),
+			string(model.CarReservationStatusBlocked),
+		}, string(model.CarReservationStatusHold), time.Now()).
+		Count(&conflicts).Error; err != nil {
+		fmt.Printf("CarReservationStore: MoveEndTx count conflicts %v\n", err)
+		return false, err
+	}
+
+	if conflicts > 0 {
+		return false, nil
+	}
+
+	if err := tx.Model(booking).Updates(map[string]interface{}{
+		"end_date":   endDate,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		fmt.Printf("CarReservationStore: MoveEndTx %v\n", err)
+		return false, err
+	}
+
+	return true, nil
+}
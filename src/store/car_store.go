@@ -1,12 +1,16 @@
 package store
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"gorm.io/gorm"
-	"strconv"
-	"strings"
+	"math"
 	"time"
 
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
 	"github.com/godev111222333/capstone-backend/src/model"
 )
 
@@ -154,6 +158,16 @@ func (s *CarStore) Update(id int, values map[string]interface{}) error {
 	return nil
 }
 
+func (s *CarStore) IncreaseWarningCountTx(tx *gorm.DB, id, delta int) error {
+	if err := tx.Model(&model.Car{}).Where("id = ?", id).
+		Update("warning_count", gorm.Expr("warning_count + ?", delta)).Error; err != nil {
+		fmt.Printf("CarStore: IncreaseWarningCountTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
 func (s *CarStore) UpdateByPartnerID(tx *gorm.DB, partnerID int, values map[string]interface{}) error {
 	if err := tx.Model(&model.Car{}).Where("partner_id = ?", partnerID).Updates(values).Error; err != nil {
 		fmt.Printf("CarStore: UpdateByPartnerID %v\n", err)
@@ -180,15 +194,15 @@ func (s *CarStore) CountByStatus(status model.CarStatus) (int, error) {
 	return int(count), nil
 }
 
-func (s *CarStore) CountBySeats(seatType int, parkingLot model.ParkingLot, statuses []model.CarStatus) (int, error) {
+func (s *CarStore) CountBySeats(seatType, garageID int, statuses []model.CarStatus) (int, error) {
 	res := struct {
 		Count int `json:"count"`
 	}{}
 	raw := `select count(*)
 				from cars inner join car_models cm on cars.car_model_id = cm.id
-				where cm.number_of_seats = ? and cars.status in ? and cars.parking_lot = ?`
+				where cm.number_of_seats = ? and cars.status in ? and cars.parking_lot = ? and cars.garage_id = ?`
 
-	if err := s.db.Raw(raw, seatType, statuses, string(parkingLot)).Scan(&res).Error; err != nil {
+	if err := s.db.Raw(raw, seatType, statuses, string(model.ParkingLotGarage), garageID).Scan(&res).Error; err != nil {
 		fmt.Printf("CarStore: CountBySeats %v\n", err)
 		return -1, err
 	}
@@ -196,6 +210,28 @@ func (s *CarStore) CountBySeats(seatType int, parkingLot model.ParkingLot, statu
 	return res.Count, nil
 }
 
+type GarageSeatCount struct {
+	GarageID      int `json:"garage_id"`
+	NumberOfSeats int `json:"number_of_seats"`
+	Count         int `json:"count"`
+}
+
+// CountSeatsByGarage counts the garage cars in the given statuses per garage and number of seats
+func (s *CarStore) CountSeatsByGarage(statuses []model.CarStatus) ([]*GarageSeatCount, error) {
+	res := make([]*GarageSeatCount, 0)
+	raw := `select cars.garage_id, cm.number_of_seats, count(*) as count
+				from cars inner join car_models cm on cars.car_model_id = cm.id
+				where cars.status in ? and cars.parking_lot = ? and cars.garage_id is not null
+				group by cars.garage_id, cm.number_of_seats`
+
+	if err := s.db.Raw(raw, statuses, string(model.ParkingLotGarage)).Scan(&res).Error; err != nil {
+		fmt.Printf("CarStore: CountSeatsByGarage %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (s *CarStore) CountByParkingLot(parkingLot model.ParkingLot, status model.CarStatus) (int, error) {
 	var count int64
 	if err := s.db.Model(model.Car{}).Where("parking_lot = ? and status = ?", string(parkingLot), string(status)).Count(&count).Error; err != nil {
@@ -206,138 +242,369 @@ func (s *CarStore) CountByParkingLot(parkingLot model.ParkingLot, status model.C
 	return int(count), nil
 }
 
-func (s *CarStore) FindCars(
-	startDate, endDate time.Time,
-	optionParams map[string]interface{},
-) ([]*model.Car, error) {
-	optionsSQL := make([]string, 0, len(optionParams))
-	if values, ok := optionParams["brands"].([]string); ok {
-		optionsSQL = append(optionsSQL, fmt.Sprintf("brand in %s", quoteString(values)))
+type CarSearchSort string
+
+const (
+	CarSearchSortDefault   CarSearchSort = ""
+	CarSearchSortPriceAsc  CarSearchSort = "price_asc"
+	CarSearchSortPriceDesc CarSearchSort = "price_desc"
+	CarSearchSortRating    CarSearchSort = "rating"
+	CarSearchSortTrips     CarSearchSort = "trips"
+	CarSearchSortDistance  CarSearchSort = "distance"
+)
+
+const EarthRadiusKm = 6371.0
+
+var (
+	ErrInvalidCarSearchCursor = errors.New("invalid car search cursor")
+	ErrMissingCarSearchCenter = errors.New("searching by distance requires a center point")
+)
+
+// carSearchOrders maps a sort to the column of the found cars it orders by. The car id breaks
+// ties so the order is total and cursors are stable.
+var carSearchOrders = map[CarSearchSort]struct {
+	column string
+	desc   bool
+}{
+	CarSearchSortDefault:   {"id", false},
+	CarSearchSortPriceAsc:  {"price", false},
+	CarSearchSortPriceDesc: {"price", true},
+	CarSearchSortRating:    {"rating", true},
+	CarSearchSortTrips:     {"trips", true},
+	CarSearchSortDistance:  {"distance", false},
+}
+
+func (s CarSearchSort) IsValid() bool {
+	_, ok := carSearchOrders[s]
+	return ok
+}
+
+// CarSearchParams filters the cars available from StartDate to EndDate. Empty lists and zero
+// values do not filter. With a Center only cars with a pickup point within RadiusKm of it are
+// found, all of them when RadiusKm is 0. Cursor is the NextCursor of the previous page.
+type CarSearchParams struct {
+	StartDate     time.Time
+	EndDate       time.Time
+	Brands        []string
+	Fuels         []string
+	Motions       []string
+	NumberOfSeats []int
+	ParkingLots   []string
+	MinPrice      int
+	MaxPrice      int
+	MinYear       int
+	MaxYear       int
+	MinRating     float64
+	Keyword       string
+	Center        *GeoPoint
+	RadiusKm      float64
+	Sort          CarSearchSort
+	Cursor        string
+	Limit         int
+}
+
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// DistanceKm is the great-circle distance to q, the same haversine distance car search uses
+func (p GeoPoint) DistanceKm(q GeoPoint) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLng := rad(q.Latitude-p.Latitude), rad(q.Longitude-p.Longitude)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(p.Latitude))*math.Cos(rad(q.Latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+type CarSearchResult struct {
+	Cars []*model.Car
+	// DistancesKm holds the distance from the center to each car by car id, it is empty
+	// without a center
+	DistancesKm map[int]float64
+	// NextCursor is empty on the last page
+	NextCursor string
+}
+
+type carSearchCursor struct {
+	Value float64 `json:"v"`
+	ID    int     `json:"id"`
+}
+
+func encodeCarSearchCursor(c carSearchCursor) string {
+	bz, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bz)
+}
+
+func decodeCarSearchCursor(cursor string) (*carSearchCursor, error) {
+	bz, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCarSearchCursor
 	}
-	if values, ok := optionParams["fuels"].([]string); ok {
-		optionsSQL = append(optionsSQL, fmt.Sprintf("fuel in %s", quoteString(values)))
+
+	res := &carSearchCursor{}
+	if err := json.Unmarshal(bz, res); err != nil {
+		return nil, ErrInvalidCarSearchCursor
 	}
-	if values, ok := optionParams["motions"].([]string); ok {
-		optionsSQL = append(optionsSQL, fmt.Sprintf("motion in %s", quoteString(values)))
+
+	return res, nil
+}
+
+// haversineKmSQL is the great-circle distance in km from (?, ?) to the pickup point of a car. It
+// only needs plain Postgres math functions.
+const haversineKmSQL = `2 * ? * asin(sqrt(
+	power(sin(radians(cars.latitude - ?) / 2), 2) +
+	cos(radians(?)) * cos(radians(cars.latitude)) * power(sin(radians(cars.longitude - ?) / 2), 2)
+))`
+
+// FindCars returns the active cars that can be rented from StartDate to EndDate: the partner
+// contract of the car lasts until EndDate and no contract, booking or live hold of the car overlaps
+// the period widened by the handover buffer of its parking lot. Blackouts of the partner block the
+// car like bookings.
+func (s *CarStore) FindCars(p *CarSearchParams) (*CarSearchResult, error) {
+	order, ok := carSearchOrders[p.Sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid car search sort %q", p.Sort)
 	}
-	if values, ok := optionParams["number_of_seats"].([]int); ok {
-		optionsSQL = append(optionsSQL, fmt.Sprintf("number_of_seats in %s", quoteInt(values)))
+
+	if p.Sort == CarSearchSortDistance && p.Center == nil {
+		return nil, ErrMissingCarSearchCenter
 	}
 
-	opt := strings.Join(optionsSQL, " and ")
-	if len(opt) > 0 {
-		opt = opt + ` and`
+	limit := p.Limit
+	if limit == 0 {
+		limit = 1000
 	}
 
-	searchByParkingLot := func(parkingLot model.ParkingLot, startDate, endDate time.Time) ([]*model.Car, error) {
-		cars := make([]*model.CarJoinCarModel, 0)
-		rawSql := `select cars.*, cars.id as car_id, cm.*
-				from cars inner join car_models cm on cars.car_model_id = cm.id 
-				where ` + opt + ` cars.parking_lot = ? and cars.status = ? and cars.id not in (select car_id from customer_contracts where (customer_contracts.start_date >= ? and ? >= customer_contracts.start_date and (customer_contracts.status in ?)) or cars.end_date < ?)`
-		if err := s.db.Raw(rawSql, string(parkingLot), string(model.CarStatusActive), startDate, endDate, NotAvailableForRentStatuses, endDate).Preload("CarModel").Find(&cars).Error; err != nil {
-			fmt.Printf("CarStore: FindCars %v\n", err)
-			return nil, err
+	distance := clause.Expr{SQL: "null::float8"}
+	if p.Center != nil {
+		distance = clause.Expr{
+			SQL:  haversineKmSQL,
+			Vars: []interface{}{EarthRadiusKm, p.Center.Latitude, p.Center.Latitude, p.Center.Longitude},
 		}
+	}
 
-		cars2 := make([]*model.CarJoinCarModel, 0)
-		rawSql = `select cars.*, cars.id as car_id, cm.*
-				from cars inner join car_models cm on cars.car_model_id = cm.id
-				where ` + opt + ` cars.parking_lot = ? and cars.status = ? and cars.id not in (select car_id from customer_contracts where (? >= customer_contracts.start_date and customer_contracts.end_date >= ? and (customer_contracts.status in ?)) or cars.end_date < ?)`
-		if err := s.db.Raw(rawSql, string(parkingLot), string(model.CarStatusActive), startDate, startDate, NotAvailableForRentStatuses, endDate).Preload("CarModel").Find(&cars2).Error; err != nil {
-			fmt.Printf("CarStore: FindCars %v\n", err)
+	available := s.db.Table("cars").
+		Select(`cars.id, cars.price, coalesce(stats.rating, 5)::float8 as rating,
+				coalesce(stats.trips, 0)::float8 as trips, ? as distance`, distance).
+		Joins("inner join car_models cm on cm.id = cars.car_model_id").
+		Joins(`left join (
+				select car_id, count(*) as trips, avg(feedback_rating) filter (where feedback_rating > 0) as rating
+				from customer_contracts where status = ? group by car_id
+			) stats on stats.car_id = cars.id`, string(model.CustomerContractStatusCompleted)).
+		Where("cars.status = ? and cars.end_date >= ?", string(model.CarStatusActive), p.EndDate).
+		Where(`not exists (
+				select 1 from customer_contracts cc
+				where cc.car_id = cars.id and cc.status in @statuses
+				  and cc.start_date <= case when cars.parking_lot = @home then @homeEnd else @garageEnd end
+				  and cc.end_date >= case when cars.parking_lot = @home then @homeStart else @garageStart end
+			) and not exists (
+				select 1 from car_reservations cr
+				where cr.car_id = cars.id
+				  and (cr.status in @firm or (cr.status = @hold and cr.expires_at >= @now))
+				  and cr.start_date <= case when cars.parking_lot = @home then @homeEnd else @garageEnd end
+				  and cr.end_date >= case when cars.parking_lot = @home then @homeStart else @garageStart end
+			)`, map[string]interface{}{
+			"statuses":    NotAvailableForRentStatuses,
+			"home":        string(model.ParkingLotHome),
+			"homeStart":   p.StartDate.Add(-BufferAtHomeTime),
+			"homeEnd":     p.EndDate.Add(BufferAtHomeTime),
+			"garageStart": p.StartDate.Add(-BufferAtGarage),
+			"garageEnd":   p.EndDate.Add(BufferAtGarage),
+			"firm":        []string{string(model.CarReservationStatusBooked), string(model.CarReservationStatusBlocked)},
+			"hold":        string(model.CarReservationStatusHold),
+			"now":         time.Now(),
+		})
+
+	if len(p.Brands) > 0 {
+		available = available.Where("cm.brand in ?", p.Brands)
+	}
+	if len(p.Fuels) > 0 {
+		available = available.Where("cars.fuel in ?", p.Fuels)
+	}
+	if len(p.Motions) > 0 {
+		available = available.Where("cars.motion in ?", p.Motions)
+	}
+	if len(p.NumberOfSeats) > 0 {
+		available = available.Where("cm.number_of_seats in ?", p.NumberOfSeats)
+	}
+	if len(p.ParkingLots) > 0 {
+		available = available.Where("cars.parking_lot in ?", p.ParkingLots)
+	}
+	if p.MinPrice > 0 {
+		available = available.Where("cars.price >= ?", p.MinPrice)
+	}
+	if p.MaxPrice > 0 {
+		available = available.Where("cars.price <= ?", p.MaxPrice)
+	}
+	if p.MinYear > 0 {
+		available = available.Where("cm.year >= ?", p.MinYear)
+	}
+	if p.MaxYear > 0 {
+		available = available.Where("cm.year <= ?", p.MaxYear)
+	}
+	if len(p.Keyword) > 0 {
+		available = available.Where("concat(cm.brand, ' ', cm.model) ilike ?", likeQuery(p.Keyword))
+	}
+	if p.Center != nil {
+		available = available.Where("cars.latitude is not null and cars.longitude is not null")
+	}
+
+	q := s.db.Table("(?) as found", available).Select("found.id, found." + order.column + " as sort_value, found.distance")
+	if p.MinRating > 0 {
+		q = q.Where("found.rating >= ?", p.MinRating)
+	}
+	if p.Center != nil && p.RadiusKm > 0 {
+		q = q.Where("found.distance <= ?", p.RadiusKm)
+	}
+
+	direction, cmp := "asc", ">"
+	if order.desc {
+		direction, cmp = "desc", "<"
+	}
+
+	if len(p.Cursor) > 0 {
+		cursor, err := decodeCarSearchCursor(p.Cursor)
+		if err != nil {
 			return nil, err
 		}
-
-		res := takeDuplicatedCars(cars, cars2)
-		resCars := make([]*model.Car, len(res))
-		for i, r := range res {
-			resCars[i] = r.ToCar()
-		}
-
-		return resCars, nil
+		q = q.Where(fmt.Sprintf("(found.%s, found.id) %s (?, ?)", order.column, cmp), cursor.Value, cursor.ID)
 	}
 
-	validCarsAtHome, err := searchByParkingLot(model.ParkingLotHome, startDate.Add(-BufferAtHomeTime), endDate.Add(BufferAtHomeTime))
-	if err != nil {
+	rows := make([]*struct {
+		ID        int
+		SortValue float64
+		Distance  *float64
+	}, 0)
+	if err := q.Order(fmt.Sprintf("found.%s %s, found.id %s", order.column, direction, direction)).
+		Limit(limit + 1).Scan(&rows).Error; err != nil {
+		fmt.Printf("CarStore: FindCars %v\n", err)
 		return nil, err
 	}
 
-	validCarsAtGarage, err := searchByParkingLot(model.ParkingLotGarage, startDate.Add(-BufferAtGarage), endDate.Add(BufferAtGarage))
-	if err != nil {
-		return nil, err
+	res := &CarSearchResult{Cars: make([]*model.Car, 0, len(rows)), DistancesKm: map[int]float64{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		res.NextCursor = encodeCarSearchCursor(carSearchCursor{Value: last.SortValue, ID: last.ID})
 	}
 
-	searchParkingLots, ok := optionParams["parking_lots"].([]string)
-	if !ok {
-		return append(validCarsAtGarage, validCarsAtHome...), nil
+	if len(rows) == 0 {
+		return res, nil
 	}
 
-	resCars := make([]*model.Car, 0)
-	for _, p := range searchParkingLots {
-		if p == string(model.ParkingLotGarage) {
-			resCars = append(resCars, validCarsAtGarage...)
+	ids := make([]int, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+		if r.Distance != nil {
+			res.DistancesKm[r.ID] = *r.Distance
 		}
+	}
+
+	cars := make([]*model.Car, 0, len(ids))
+	if err := s.db.Where("id in ?", ids).Preload("CarModel").Find(&cars).Error; err != nil {
+		fmt.Printf("CarStore: FindCars %v\n", err)
+		return nil, err
+	}
 
-		if p == string(model.ParkingLotHome) {
-			resCars = append(resCars, validCarsAtHome...)
+	byID := make(map[int]*model.Car, len(cars))
+	for _, car := range cars {
+		byID[car.ID] = car
+	}
+	for _, id := range ids {
+		if car, ok := byID[id]; ok {
+			res.Cars = append(res.Cars, car)
 		}
 	}
 
-	return resCars, nil
+	return res, nil
 }
 
-func takeDuplicatedCars(cars1, cars2 []*model.CarJoinCarModel) []*model.CarJoinCarModel {
-	m1, m2, checkedID := make(map[int]struct{}, 0), make(map[int]struct{}, 0), make(map[int]struct{}, 0)
-	for _, c := range cars1 {
-		m1[c.CarID] = struct{}{}
-	}
-	for _, c := range cars2 {
-		m2[c.CarID] = struct{}{}
-	}
+type CarCalendarRangeType string
 
-	res := []*model.CarJoinCarModel{}
-	cars := append(cars1, cars2...)
-	for _, c := range cars {
-		if _, ok := m1[c.CarID]; !ok {
-			continue
-		}
-		if _, ok := m2[c.CarID]; !ok {
-			continue
-		}
+const (
+	CarCalendarRangeBooked  CarCalendarRangeType = "booked"
+	CarCalendarRangeHeld    CarCalendarRangeType = "held"
+	CarCalendarRangeBlocked CarCalendarRangeType = "blocked"
+)
 
-		if _, ok := checkedID[c.CarID]; ok {
-			continue
-		}
-		res = append(res, c)
-		checkedID[c.CarID] = struct{}{}
+// CarCalendarRange is a period a car can not be rented in. BufferedStartDate and BufferedEndDate
+// widen it by the handover buffer of the parking lot of the car, the way FindCars does.
+// CustomerContractID is not exposed, customers see when a car is busy but not for whom.
+type CarCalendarRange struct {
+	CarID              int                  `json:"car_id"`
+	Type               CarCalendarRangeType `json:"type"`
+	StartDate          time.Time            `json:"start_date"`
+	EndDate            time.Time            `json:"end_date"`
+	BufferedStartDate  time.Time            `json:"buffered_start_date"`
+	BufferedEndDate    time.Time            `json:"buffered_end_date"`
+	CustomerContractID *int                 `json:"-"`
+}
+
+// HandoverBuffer is the time a car needs between two rentals at its parking lot
+func HandoverBuffer(parkingLot model.ParkingLot) time.Duration {
+	if parkingLot == model.ParkingLotHome {
+		return BufferAtHomeTime
 	}
 
-	return res
+	return BufferAtGarage
 }
 
-func quoteString(src []string) string {
-	if len(src) == 0 {
-		return ""
+// GetCalendar returns the booked, held and blocked ranges of the cars whose buffered period
+// overlaps from - to, ordered by car and start date. Booked ranges come from the contracts in
+// NotAvailableForRentStatuses, held ones from live holds and blocked ones from partner blackouts.
+func (s *CarStore) GetCalendar(carIDs []int, from, to time.Time) ([]*CarCalendarRange, error) {
+	res := make([]*CarCalendarRange, 0)
+	if len(carIDs) == 0 {
+		return res, nil
 	}
 
-	for i, s := range src {
-		src[i] = "'" + s + "'"
+	rows := make([]*struct {
+		CarCalendarRange
+		ParkingLot model.ParkingLot
+	}, 0)
+	if err := s.db.Raw(`
+		select cc.car_id, @booked::varchar as type, cc.start_date, cc.end_date, cc.id as customer_contract_id, cars.parking_lot
+		from customer_contracts cc
+		inner join cars on cars.id = cc.car_id
+		where cc.car_id in @cars and cc.status in @statuses
+		  and cc.start_date <= @to and cc.end_date >= @from
+		union all
+		select cr.car_id, case when cr.status = @blocked then @blockedType::varchar else @held::varchar end as type,
+		       cr.start_date, cr.end_date, cr.customer_contract_id, cars.parking_lot
+		from car_reservations cr
+		inner join cars on cars.id = cr.car_id
+		where cr.car_id in @cars
+		  and (cr.status = @blocked or (cr.status = @hold and cr.expires_at >= @now))
+		  and cr.start_date <= @to and cr.end_date >= @from
+		order by car_id, start_date`, map[string]interface{}{
+		"booked":      string(CarCalendarRangeBooked),
+		"held":        string(CarCalendarRangeHeld),
+		"blockedType": string(CarCalendarRangeBlocked),
+		"blocked":     string(model.CarReservationStatusBlocked),
+		"hold":        string(model.CarReservationStatusHold),
+		"cars":        carIDs,
+		"statuses":    NotAvailableForRentStatuses,
+		"from":        from.Add(-BufferAtHomeTime),
+		"to":          to.Add(BufferAtHomeTime),
+		"now":         time.Now(),
+	}).Scan(&rows).Error; err != nil {
+		fmt.Printf("CarStore: GetCalendar %v\n", err)
+		return nil, err
 	}
 
-	return "(" + strings.Join(src, ",") + ")"
-}
-
-func quoteInt(src []int) string {
-	if len(src) == 0 {
-		return ""
-	}
+	for _, row := range rows {
+		buffer := HandoverBuffer(row.ParkingLot)
+		r := row.CarCalendarRange
+		r.BufferedStartDate, r.BufferedEndDate = r.StartDate.Add(-buffer), r.EndDate.Add(buffer)
+		if r.BufferedStartDate.After(to) || r.BufferedEndDate.Before(from) {
+			continue
+		}
 
-	res := []string{}
-	for _, s := range src {
-		res = append(res, strconv.Itoa(s))
+		res = append(res, &r)
 	}
 
-	return "(" + strings.Join(res, ",") + ")"
+	return res, nil
 }
 
 func likeQuery(param string) string {
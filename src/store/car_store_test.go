@@ -243,18 +243,22 @@ func TestCarStore(t *testing.T) {
 		testCases := []struct {
 			StartDate      int
 			EndDate        int
-			OptionParams   map[string]interface{}
+			Params         CarSearchParams
 			ExpectedLenCar int
 		}{
-			{StartDate: 0, EndDate: 2, OptionParams: map[string]interface{}{}, ExpectedLenCar: 2},
-			{StartDate: 2, EndDate: 4, OptionParams: map[string]interface{}{}, ExpectedLenCar: 2},
-			{StartDate: 10, EndDate: 12, OptionParams: map[string]interface{}{}, ExpectedLenCar: 3},
-			{StartDate: 0, EndDate: 2, OptionParams: map[string]interface{}{"fuels": []string{string(model.FuelElectricity)}}, ExpectedLenCar: 1},
-			{StartDate: 2, EndDate: 4, OptionParams: map[string]interface{}{"motions": []string{string(model.MotionAutomaticTransmission)}}, ExpectedLenCar: 1},
-			{StartDate: 10, EndDate: 12, OptionParams: map[string]interface{}{"parking_lots": []string{string(model.ParkingLotGarage)}}, ExpectedLenCar: 2},
-			{StartDate: 10, EndDate: 12, OptionParams: map[string]interface{}{"parking_lots": []string{string(model.ParkingLotGarage)}, "motions": []string{string(model.MotionManualTransmission)}, "number_of_seats": []int{15}}, ExpectedLenCar: 1},
-			{StartDate: 10, EndDate: 12, OptionParams: map[string]interface{}{"parking_lots": []string{string(model.ParkingLotGarage)}, "motions": []string{string(model.MotionAutomaticTransmission)}}, ExpectedLenCar: 1},
-			{StartDate: 0, EndDate: 24, OptionParams: map[string]interface{}{"parking_lots": []string{string(model.ParkingLotGarage)}, "motions": []string{string(model.MotionAutomaticTransmission)}}, ExpectedLenCar: 0},
+			{StartDate: 0, EndDate: 2, Params: CarSearchParams{}, ExpectedLenCar: 2},
+			{StartDate: 2, EndDate: 4, Params: CarSearchParams{}, ExpectedLenCar: 2},
+			{StartDate: 10, EndDate: 12, Params: CarSearchParams{}, ExpectedLenCar: 3},
+			{StartDate: 0, EndDate: 2, Params: CarSearchParams{Fuels: []string{string(model.FuelElectricity)}}, ExpectedLenCar: 1},
+			{StartDate: 2, EndDate: 4, Params: CarSearchParams{Motions: []string{string(model.MotionAutomaticTransmission)}}, ExpectedLenCar: 1},
+			{StartDate: 10, EndDate: 12, Params: CarSearchParams{ParkingLots: []string{string(model.ParkingLotGarage)}}, ExpectedLenCar: 2},
+			{StartDate: 10, EndDate: 12, Params: CarSearchParams{ParkingLots: []string{string(model.ParkingLotGarage)}, Motions: []string{string(model.MotionManualTransmission)}, NumberOfSeats: []int{15}}, ExpectedLenCar: 1},
+			{StartDate: 10, EndDate: 12, Params: CarSearchParams{ParkingLots: []string{string(model.ParkingLotGarage)}, Motions: []string{string(model.MotionAutomaticTransmission)}}, ExpectedLenCar: 1},
+			{StartDate: 0, EndDate: 24, Params: CarSearchParams{ParkingLots: []string{string(model.ParkingLotGarage)}, Motions: []string{string(model.MotionAutomaticTransmission)}}, ExpectedLenCar: 0},
+			{StartDate: 10, EndDate: 12, Params: CarSearchParams{MinPrice: 150_000, MaxPrice: 250_000}, ExpectedLenCar: 1},
+			{StartDate: 10, EndDate: 12, Params: CarSearchParams{Keyword: "MEC maybach"}, ExpectedLenCar: 1},
+			{StartDate: 10, EndDate: 12, Params: CarSearchParams{MinYear: 2025}, ExpectedLenCar: 0},
+			{StartDate: 1000, EndDate: 1002, Params: CarSearchParams{}, ExpectedLenCar: 0},
 		}
 
 		toTime := func(hour int) time.Time {
@@ -263,10 +267,77 @@ func TestCarStore(t *testing.T) {
 
 		for _, tc := range testCases {
 			t.Run(fmt.Sprintf("%d -> %d", tc.StartDate, tc.EndDate), func(t *testing.T) {
-				foundCars, err := TestDb.CarStore.FindCars(toTime(tc.StartDate), toTime(tc.EndDate), tc.OptionParams)
+				params := tc.Params
+				params.StartDate, params.EndDate = toTime(tc.StartDate), toTime(tc.EndDate)
+				found, err := TestDb.CarStore.FindCars(&params)
 				require.NoError(t, err)
-				require.Len(t, foundCars, tc.ExpectedLenCar)
+				require.Len(t, found.Cars, tc.ExpectedLenCar)
 			})
 		}
+
+		t.Run("pages through cars sorted by price", func(t *testing.T) {
+			params := &CarSearchParams{StartDate: toTime(10), EndDate: toTime(12), Sort: CarSearchSortPriceDesc, Limit: 2}
+			found, err := TestDb.CarStore.FindCars(params)
+			require.NoError(t, err)
+			require.Len(t, found.Cars, 2)
+			require.Equal(t, 300_000, found.Cars[0].Price)
+			require.Equal(t, 200_000, found.Cars[1].Price)
+			require.NotEmpty(t, found.NextCursor)
+
+			params.Cursor = found.NextCursor
+			found, err = TestDb.CarStore.FindCars(params)
+			require.NoError(t, err)
+			require.Len(t, found.Cars, 1)
+			require.Equal(t, 100_000, found.Cars[0].Price)
+			require.Empty(t, found.NextCursor)
+
+			params.Cursor = "not a cursor"
+			_, err = TestDb.CarStore.FindCars(params)
+			require.ErrorIs(t, err, ErrInvalidCarSearchCursor)
+		})
+
+		t.Run("live holds block the car", func(t *testing.T) {
+			expiresAt := now.Add(time.Hour)
+			require.NoError(t, TestDb.DB.Create(&model.CarReservation{
+				CarID:              cars[2].ID,
+				CustomerContractID: &customerContracts[2].ID,
+				StartDate:          toTime(10),
+				EndDate:            toTime(12),
+				Status:             model.CarReservationStatusHold,
+				ExpiresAt:          &expiresAt,
+			}).Error)
+
+			found, err := TestDb.CarStore.FindCars(&CarSearchParams{StartDate: toTime(11), EndDate: toTime(13)})
+			require.NoError(t, err)
+			require.Len(t, found.Cars, 2)
+		})
+
+		t.Run("finds cars near a point", func(t *testing.T) {
+			locations := [][2]float64{
+				{10.7769, 106.7009}, // District 1
+				{10.8500, 106.7700}, // Thu Duc, about 11.1km away
+				{21.0285, 105.8542}, // Ha Noi
+			}
+			for i, l := range locations {
+				require.NoError(t, TestDb.CarStore.Update(cars[i].ID, map[string]interface{}{"latitude": l[0], "longitude": l[1]}))
+			}
+
+			found, err := TestDb.CarStore.FindCars(&CarSearchParams{
+				StartDate: toTime(20),
+				EndDate:   toTime(22),
+				Center:    &GeoPoint{Latitude: 10.7769, Longitude: 106.7009},
+				RadiusKm:  20,
+				Sort:      CarSearchSortDistance,
+			})
+			require.NoError(t, err)
+			require.Len(t, found.Cars, 2)
+			require.Equal(t, cars[0].ID, found.Cars[0].ID)
+			require.Equal(t, cars[1].ID, found.Cars[1].ID)
+			require.InDelta(t, 0, found.DistancesKm[cars[0].ID], 0.01)
+			require.InDelta(t, 11.1, found.DistancesKm[cars[1].ID], 0.1)
+
+			_, err = TestDb.CarStore.FindCars(&CarSearchParams{StartDate: toTime(20), EndDate: toTime(22), Sort: CarSearchSortDistance})
+			require.ErrorIs(t, err, ErrMissingCarSearchCenter)
+		})
 	})
 }
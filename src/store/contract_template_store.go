@@ -0,0 +1,127 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type ContractTemplateStore struct {
+	db *gorm.DB
+}
+
+func NewContractTemplateStore(db *gorm.DB) *ContractTemplateStore {
+	return &ContractTemplateStore{db: db}
+}
+
+// Seed stores a template shipped with the server when its type has no version yet
+func (s *ContractTemplateStore) Seed(template *model.ContractTemplate) error {
+	rawSql := `
+insert into contract_templates(type, version, body, note, status, published_at)
+select ?, ?, ?, ?, ?, ?
+where not exists (select 1 from contract_templates where type = ?)
+`
+	if err := s.db.Exec(rawSql,
+		template.Type, template.Version, template.Body, template.Note, template.Status, template.PublishedAt,
+		template.Type,
+	).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: Seed %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Create stores a template as the next version of its type. Two versions created at once for the
+// same type conflict on the unique version, the second one fails.
+func (s *ContractTemplateStore) Create(template *model.ContractTemplate) error {
+	rawSql := `
+insert into contract_templates(type, version, body, note, status, created_by)
+select ?, coalesce(max(version), 0) + 1, ?, ?, ?, ? from contract_templates where type = ?
+returning id, version, created_at, updated_at
+`
+	if err := s.db.Raw(rawSql,
+		template.Type, template.Body, template.Note, template.Status, template.CreatedBy, template.Type,
+	).Scan(template).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: Create %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *ContractTemplateStore) GetByID(id int) (*model.ContractTemplate, error) {
+	res := &model.ContractTemplate{}
+	if err := s.db.Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: GetByID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *ContractTemplateStore) GetByVersion(templateType model.ContractTemplateType, version int) (*model.ContractTemplate, error) {
+	res := &model.ContractTemplate{}
+	if err := s.db.Where("type = ? and version = ?", templateType, version).First(res).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: GetByVersion %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *ContractTemplateStore) GetPublished(templateType model.ContractTemplateType) (*model.ContractTemplate, error) {
+	res := &model.ContractTemplate{}
+	if err := s.db.Where("type = ? and status = ?", templateType, model.ContractTemplateStatusPublished).
+		Order("version desc").First(res).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: GetPublished %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *ContractTemplateStore) GetByType(templateType model.ContractTemplateType) ([]*model.ContractTemplate, error) {
+	res := make([]*model.ContractTemplate, 0)
+	if err := s.db.Where("type = ?", templateType).Order("version desc").Find(&res).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: GetByType %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// PublishTx publishes a draft and retires the version of its type published before. It returns
+// false when the template is not a draft.
+func (s *ContractTemplateStore) PublishTx(tx *gorm.DB, template *model.ContractTemplate, publishedAt time.Time) (bool, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", template.ID).First(template).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: PublishTx %v\n", err)
+		return false, err
+	}
+
+	if template.Status != model.ContractTemplateStatusDraft {
+		return false, nil
+	}
+
+	if err := tx.Model(model.ContractTemplate{}).
+		Where("type = ? and status = ?", template.Type, model.ContractTemplateStatusPublished).
+		Update("status", model.ContractTemplateStatusRetired).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: PublishTx %v\n", err)
+		return false, err
+	}
+
+	template.Status, template.PublishedAt = model.ContractTemplateStatusPublished, &publishedAt
+	if err := tx.Model(template).Updates(map[string]interface{}{
+		"status":       template.Status,
+		"published_at": publishedAt,
+	}).Error; err != nil {
+		fmt.Printf("ContractTemplateStore: PublishTx %v\n", err)
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type CustomerContractChargeStore struct {
+	db *gorm.DB
+}
+
+func NewCustomerContractChargeStore(db *gorm.DB) *CustomerContractChargeStore {
+	return &CustomerContractChargeStore{db: db}
+}
+
+func (s *CustomerContractChargeStore) CreateTx(tx *gorm.DB, charge *model.CustomerContractCharge) error {
+	if err := tx.Create(charge).Error; err != nil {
+		fmt.Printf("CustomerContractChargeStore: CreateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *CustomerContractChargeStore) GetByCustomerContractID(contractID int) ([]*model.CustomerContractCharge, error) {
+	res := make([]*model.CustomerContractCharge, 0)
+	if err := s.db.Where("customer_contract_id = ?", contractID).Order("id").Find(&res).Error; err != nil {
+		fmt.Printf("CustomerContractChargeStore: GetByCustomerContractID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// SumCollateralAmountTx returns how much of the cash collateral of the contract its charges took
+func (s *CustomerContractChargeStore) SumCollateralAmountTx(tx *gorm.DB, contractID int) (int, error) {
+	var sum int
+	if err := tx.Model(&model.CustomerContractCharge{}).
+		Select("coalesce(sum(collateral_amount), 0)").
+		Where("customer_contract_id = ?", contractID).
+		Scan(&sum).Error; err != nil {
+		fmt.Printf("CustomerContractChargeStore: SumCollateralAmountTx %v\n", err)
+		return 0, err
+	}
+
+	return sum, nil
+}
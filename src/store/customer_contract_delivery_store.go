@@ -0,0 +1,154 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type CustomerContractDeliveryStore struct {
+	db *gorm.DB
+}
+
+func NewCustomerContractDeliveryStore(db *gorm.DB) *CustomerContractDeliveryStore {
+	return &CustomerContractDeliveryStore{db: db}
+}
+
+func (s *CustomerContractDeliveryStore) GetByID(id int) (*model.CustomerContractDelivery, error) {
+	res := &model.CustomerContractDelivery{}
+	if err := s.db.Where("id = ?", id).
+		Preload("CustomerContract").
+		Preload("CustomerContract.Car").
+		Preload("CustomerContract.Car.CarModel").
+		Preload("Technician").
+		First(res).Error; err != nil {
+		fmt.Printf("CustomerContractDeliveryStore: GetByID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *CustomerContractDeliveryStore) GetByCustomerContractID(contractID int) ([]*model.CustomerContractDelivery, error) {
+	res := make([]*model.CustomerContractDelivery, 0)
+	if err := s.db.Where("customer_contract_id = ?", contractID).Order("scheduled_at").Find(&res).Error; err != nil {
+		fmt.Printf("CustomerContractDeliveryStore: GetByCustomerContractID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetSchedule lists the slots scheduled from from to to in order, of every technician when
+// technicianID is 0
+func (s *CustomerContractDeliveryStore) GetSchedule(
+	technicianID int,
+	from, to time.Time,
+	statuses []model.DeliveryStatus,
+) ([]*model.CustomerContractDelivery, error) {
+	res := make([]*model.CustomerContractDelivery, 0)
+	query := s.db.Where("scheduled_at >= ? and scheduled_at <= ?", from, to)
+	if technicianID != 0 {
+		query = query.Where("technician_id = ?", technicianID)
+	}
+	if len(statuses) > 0 {
+		query = query.Where("status in ?", statuses)
+	}
+
+	if err := query.
+		Preload("CustomerContract").
+		Preload("CustomerContract.Customer").
+		Preload("CustomerContract.Car").
+		Preload("CustomerContract.Car.CarModel").
+		Preload("Technician").
+		Order("scheduled_at").Order("id").
+		Find(&res).Error; err != nil {
+		fmt.Printf("CustomerContractDeliveryStore: GetSchedule %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CountTechnicianSlots counts the open slots of a technician scheduled from from to to, other than
+// excludeID
+func (s *CustomerContractDeliveryStore) CountTechnicianSlots(technicianID int, from, to time.Time, excludeID int) (int, error) {
+	var count int64
+	if err := s.db.Model(&model.CustomerContractDelivery{}).
+		Where("technician_id = ? and id <> ? and status in ?", technicianID, excludeID, []model.DeliveryStatus{
+			model.DeliveryStatusAssigned,
+			model.DeliveryStatusOnTheWay,
+		}).
+		Where("scheduled_at > ? and scheduled_at < ?", from, to).
+		Count(&count).Error; err != nil {
+		fmt.Printf("CustomerContractDeliveryStore: CountTechnicianSlots %v\n", err)
+		return -1, err
+	}
+
+	return int(count), nil
+}
+
+// UpdateWhenCurStatus updates the slot only if its status is still curStatus and returns the
+// number of updated rows
+func (s *CustomerContractDeliveryStore) UpdateWhenCurStatus(
+	id int,
+	curStatus model.DeliveryStatus,
+	values map[string]interface{},
+) (int64, error) {
+	return s.UpdateWhenCurStatusTx(s.db, id, curStatus, values)
+}
+
+func (s *CustomerContractDeliveryStore) UpdateWhenCurStatusTx(
+	tx *gorm.DB,
+	id int,
+	curStatus model.DeliveryStatus,
+	values map[string]interface{},
+) (int64, error) {
+	values["updated_at"] = time.Now()
+	row := tx.Model(&model.CustomerContractDelivery{}).Where("id = ? and status = ?", id, string(curStatus)).Updates(values)
+	if err := row.Error; err != nil {
+		fmt.Printf("CustomerContractDeliveryStore: UpdateWhenCurStatusTx %v\n", err)
+		return 0, err
+	}
+
+	return row.RowsAffected, nil
+}
+
+// CancelByCustomerContractTx cancels the slots of a contract nobody is driving yet
+func (s *CustomerContractDeliveryStore) CancelByCustomerContractTx(tx *gorm.DB, contractID int) error {
+	if err := tx.Model(&model.CustomerContractDelivery{}).
+		Where("customer_contract_id = ? and status in ?", contractID, []model.DeliveryStatus{
+			model.DeliveryStatusPending,
+			model.DeliveryStatusAssigned,
+		}).
+		Updates(map[string]interface{}{
+			"status":     string(model.DeliveryStatusCanceled),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		fmt.Printf("CustomerContractDeliveryStore: CancelByCustomerContractTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// RescheduleReturnTx moves the return slots of a contract nobody is driving yet to scheduledAt
+func (s *CustomerContractDeliveryStore) RescheduleReturnTx(tx *gorm.DB, contractID int, scheduledAt time.Time) error {
+	if err := tx.Model(&model.CustomerContractDelivery{}).
+		Where("customer_contract_id = ? and type = ? and status in ?", contractID, string(model.DeliveryTypeReturn), []model.DeliveryStatus{
+			model.DeliveryStatusPending,
+			model.DeliveryStatusAssigned,
+		}).
+		Updates(map[string]interface{}{
+			"scheduled_at": scheduledAt,
+			"updated_at":   time.Now(),
+		}).Error; err != nil {
+		fmt.Printf("CustomerContractDeliveryStore: RescheduleReturnTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
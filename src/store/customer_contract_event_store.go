@@ -0,0 +1,39 @@
+package store
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type CustomerContractEventStore struct {
+	db *gorm.DB
+}
+
+func NewCustomerContractEventStore(db *gorm.DB) *CustomerContractEventStore {
+	return &CustomerContractEventStore{db: db}
+}
+
+func (s *CustomerContractEventStore) CreateTx(tx *gorm.DB, event *model.CustomerContractEvent) error {
+	if err := tx.Create(event).Error; err != nil {
+		fmt.Printf("CustomerContractEventStore: CreateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *CustomerContractEventStore) GetByCustomerContractID(cusContractID int) ([]*model.CustomerContractEvent, error) {
+	res := make([]*model.CustomerContractEvent, 0)
+	if err := s.db.Where("customer_contract_id = ?", cusContractID).
+		Preload("Actor").
+		Order("id asc").
+		Find(&res).Error; err != nil {
+		fmt.Printf("CustomerContractEventStore: GetByCustomerContractID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -18,7 +18,7 @@ func NewCustomerContractRuleStore(db *gorm.DB) *CustomerContractRuleStore {
 
 func (s *CustomerContractRuleStore) GetLast() (*model.CustomerContractRule, error) {
 	res := &model.CustomerContractRule{}
-	if err := s.db.Order("id desc").First(res).Error; err != nil {
+	if err := s.db.Order("id desc").Preload("CancellationRefundTiers").Preload("DeliveryFeeTiers").First(res).Error; err != nil {
 		fmt.Printf("CustomerContractRuleStore: GetLast %v\n", err)
 		return nil, err
 	}
@@ -26,6 +26,16 @@ func (s *CustomerContractRuleStore) GetLast() (*model.CustomerContractRule, erro
 	return res, nil
 }
 
+func (s *CustomerContractRuleStore) GetByIDTx(tx *gorm.DB, id int) (*model.CustomerContractRule, error) {
+	res := &model.CustomerContractRule{}
+	if err := tx.Where("id = ?", id).Preload("CancellationRefundTiers").Preload("DeliveryFeeTiers").First(res).Error; err != nil {
+		fmt.Printf("CustomerContractRuleStore: GetByIDTx %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (s *CustomerContractRuleStore) Create(rule *model.CustomerContractRule) error {
 	if err := s.db.Create(rule).Error; err != nil {
 		fmt.Printf("CustomerContractRuleStore: Create %v\n", err)
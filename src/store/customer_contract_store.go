@@ -6,6 +6,7 @@ import (
 
 	"github.com/godev111222333/capstone-backend/src/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CustomerContractStore struct {
@@ -61,7 +62,7 @@ func (s *CustomerContractStore) IsOverlap(carID int, desiredStartDate time.Time,
 
 func (s *CustomerContractStore) FindByID(id int) (*model.CustomerContract, error) {
 	res := &model.CustomerContract{}
-	if err := s.db.Where("id = ?", id).Preload("Customer").Preload("Car").Preload("Car.Account").Preload("Car.CarModel").Preload("CustomerContractRule").First(res).Error; err != nil {
+	if err := s.db.Where("id = ?", id).Preload("Customer").Preload("Car").Preload("Car.Account").Preload("Car.CarModel").Preload("CustomerContractRule").Preload("Deliveries").Preload("Charges").First(res).Error; err != nil {
 		fmt.Printf("CustomerContractStore: FindByID %v\n", err)
 		return nil, err
 	}
@@ -128,14 +129,45 @@ func (s *CustomerContractStore) Update(id int, values map[string]interface{}) er
 	return nil
 }
 
-func (s *CustomerContractStore) UpdateBatchWhenCurStatus(ids []int, values map[string]interface{}, status model.CustomerContractStatus) error {
-	if err := s.db.Model(&model.CustomerContract{}).Where("id in ? and status = ?", ids, string(status)).Updates(values).Error; err != nil {
-		fmt.Printf("CustomerContractStore: Update %v\n", err)
+func (s *CustomerContractStore) UpdateTx(tx *gorm.DB, id int, values map[string]interface{}) error {
+	if err := tx.Model(&model.CustomerContract{}).Where("id = ?", id).Updates(values).Error; err != nil {
+		fmt.Printf("CustomerContractStore: UpdateTx %v\n", err)
 		return err
 	}
 	return nil
 }
 
+// FindByIDForUpdate locks the contract row until tx ends
+func (s *CustomerContractStore) FindByIDForUpdate(tx *gorm.DB, id int) (*model.CustomerContract, error) {
+	res := &model.CustomerContract{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("CustomerContractStore: FindByIDForUpdate %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// UpdateWhenCurStatusTx updates the contract only if its status is still curStatus and returns the number of updated rows
+func (s *CustomerContractStore) UpdateWhenCurStatusTx(tx *gorm.DB, id int, curStatus model.CustomerContractStatus, values map[string]interface{}) (int64, error) {
+	row := tx.Model(&model.CustomerContract{}).Where("id = ? and status = ?", id, string(curStatus)).Updates(values)
+	if err := row.Error; err != nil {
+		fmt.Printf("CustomerContractStore: UpdateWhenCurStatusTx %v\n", err)
+		return 0, err
+	}
+
+	return row.RowsAffected, nil
+}
+
+func (s *CustomerContractStore) CreateTx(tx *gorm.DB, c *model.CustomerContract) error {
+	if err := tx.Create(c).Error; err != nil {
+		fmt.Printf("CustomerContractStore: CreateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
 func (s *CustomerContractStore) GetByCustomerID(cusID int, status model.CustomerContractStatus, offset, limit int) ([]*model.CustomerContract, error) {
 	var res []*model.CustomerContract
 	if limit == 0 {
@@ -392,6 +424,66 @@ func (s *CustomerContractStore) GetByStatusEndTimeInRange(
 	return res, nil
 }
 
+// GetUnsettledCompletedTx returns the completed contracts ending in [fromDate, toDate) that no
+// partner payment settled yet, of the cars of partnerID or of every partner when it is 0
+func (s *CustomerContractStore) GetUnsettledCompletedTx(
+	tx *gorm.DB,
+	partnerID int,
+	fromDate, toDate time.Time,
+) ([]*model.CustomerContract, error) {
+	query := tx.Model(model.CustomerContract{}).
+		Joins("join cars on cars.id = customer_contracts.car_id").
+		Where("customer_contracts.status = ? and customer_contracts.end_date >= ? and customer_contracts.end_date < ?",
+			string(model.CustomerContractStatusCompleted), fromDate, toDate).
+		Where("not exists (select 1 from partner_payment_customer_contracts p where p.customer_contract_id = customer_contracts.id)")
+	if partnerID > 0 {
+		query = query.Where("cars.partner_id = ?", partnerID)
+	}
+
+	var res []*model.CustomerContract
+	if err := query.
+		Preload("Car").
+		Preload("Car.PartnerContractRule").
+		Order("customer_contracts.id").
+		Find(&res).Error; err != nil {
+		fmt.Printf("CustomerContractStore: GetUnsettledCompletedTx %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetLateCompletedTx returns the completed contracts ending before the given time that no partner
+// payment settled yet although their partner was settled for a period starting before they ended,
+// they were completed after that settlement. Of the cars of partnerID or of every partner when it is 0
+func (s *CustomerContractStore) GetLateCompletedTx(
+	tx *gorm.DB,
+	partnerID int,
+	before time.Time,
+) ([]*model.CustomerContract, error) {
+	query := tx.Model(model.CustomerContract{}).
+		Joins("join cars on cars.id = customer_contracts.car_id").
+		Where("customer_contracts.status = ? and customer_contracts.end_date < ?",
+			string(model.CustomerContractStatusCompleted), before).
+		Where("not exists (select 1 from partner_payment_customer_contracts p where p.customer_contract_id = customer_contracts.id)").
+		Where("exists (select 1 from partner_payment_histories h where h.partner_id = cars.partner_id and h.start_date <= customer_contracts.end_date)")
+	if partnerID > 0 {
+		query = query.Where("cars.partner_id = ?", partnerID)
+	}
+
+	var res []*model.CustomerContract
+	if err := query.
+		Preload("Car").
+		Preload("Car.PartnerContractRule").
+		Order("customer_contracts.id").
+		Find(&res).Error; err != nil {
+		fmt.Printf("CustomerContractStore: GetLateCompletedTx %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (s *CustomerContractStore) GetAverageRating(carID int) (float64, error) {
 	var avg struct {
 		Avg float64 `json:"avg"`
@@ -5,6 +5,7 @@ import (
 
 	"github.com/godev111222333/capstone-backend/src/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CustomerPaymentStore struct {
@@ -23,6 +24,15 @@ func (s *CustomerPaymentStore) Create(m *model.CustomerPayment) error {
 	return nil
 }
 
+func (s *CustomerPaymentStore) CreateTx(tx *gorm.DB, m *model.CustomerPayment) error {
+	if err := tx.Create(m).Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: CreateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
 func (s *CustomerPaymentStore) CreateBatch(m []*model.CustomerPayment) error {
 	if err := s.db.Create(m).Error; err != nil {
 		fmt.Printf("CustomerPaymentStore: CreateBatch %v\n", err)
@@ -48,6 +58,109 @@ func (s *CustomerPaymentStore) UpdateMulti(ids []int, values map[string]interfac
 	return nil
 }
 
+// MarkPaidTx moves pending payments to paid, records the gateway transaction that paid them
+// and returns how many were moved
+func (s *CustomerPaymentStore) MarkPaidTx(
+	tx *gorm.DB, ids []int, gateway model.PaymentGateway, externalTransactionID string,
+) (int64, error) {
+	return s.markPaidTx(tx, ids, model.PaymentStatusPending, gateway, externalTransactionID)
+}
+
+// MarkCanceledPaidTx moves canceled payments the gateway collected anyway to paid, so they can be
+// refunded, and returns how many were moved
+func (s *CustomerPaymentStore) MarkCanceledPaidTx(
+	tx *gorm.DB, ids []int, gateway model.PaymentGateway, externalTransactionID string,
+) (int64, error) {
+	return s.markPaidTx(tx, ids, model.PaymentStatusCanceled, gateway, externalTransactionID)
+}
+
+func (s *CustomerPaymentStore) markPaidTx(
+	tx *gorm.DB, ids []int, from model.PaymentStatus, gateway model.PaymentGateway, externalTransactionID string,
+) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	row := tx.Model(model.CustomerPayment{}).
+		Where("id in ? and status = ?", ids, string(from)).
+		Updates(map[string]interface{}{
+			"status":                  string(model.PaymentStatusPaid),
+			"gateway":                 string(gateway),
+			"external_transaction_id": externalTransactionID,
+		})
+	if err := row.Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: markPaidTx %v\n", err)
+		return 0, err
+	}
+
+	return row.RowsAffected, nil
+}
+
+// UpdateWhenCurStatusTx updates a payment that is still in curStatus and returns how many rows
+// were updated
+func (s *CustomerPaymentStore) UpdateWhenCurStatusTx(
+	tx *gorm.DB,
+	id int,
+	curStatus model.PaymentStatus,
+	values map[string]interface{},
+) (int64, error) {
+	row := tx.Model(model.CustomerPayment{}).Where("id = ? and status = ?", id, string(curStatus)).Updates(values)
+	if err := row.Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: UpdateWhenCurStatusTx %v\n", err)
+		return 0, err
+	}
+
+	return row.RowsAffected, nil
+}
+
+// CancelPendingTx cancels every payment of a contract that is not paid yet
+func (s *CustomerPaymentStore) CancelPendingTx(tx *gorm.DB, cusContractID int) error {
+	if err := tx.Model(model.CustomerPayment{}).
+		Where("customer_contract_id = ? and status = ?", cusContractID, string(model.PaymentStatusPending)).
+		Update("status", string(model.PaymentStatusCanceled)).Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: CancelPendingTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// CancelPendingByTypeTx cancels the payments of a type of a contract that are not paid yet
+func (s *CustomerPaymentStore) CancelPendingByTypeTx(tx *gorm.DB, cusContractID int, paymentType model.PaymentType) error {
+	if err := tx.Model(model.CustomerPayment{}).
+		Where("customer_contract_id = ? and payment_type = ? and status = ?",
+			cusContractID, string(paymentType), string(model.PaymentStatusPending)).
+		Update("status", string(model.PaymentStatusCanceled)).Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: CancelPendingByTypeTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *CustomerPaymentStore) GetByStatusTx(
+	tx *gorm.DB, cusContractID int, status model.PaymentStatus,
+) ([]*model.CustomerPayment, error) {
+	res := []*model.CustomerPayment{}
+	if err := tx.Where("customer_contract_id = ? and status = ?", cusContractID, string(status)).
+		Order("id").Find(&res).Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: GetByStatusTx %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *CustomerPaymentStore) FindByIDForUpdate(tx *gorm.DB, id int) (*model.CustomerPayment, error) {
+	res := &model.CustomerPayment{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: FindByIDForUpdate %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (s *CustomerPaymentStore) GetByID(id int) (*model.CustomerPayment, error) {
 	res := &model.CustomerPayment{}
 	if err := s.db.Where("id = ?", id).Preload("CustomerContract").Preload("CustomerContract.Car").First(res).Error; err != nil {
@@ -113,3 +226,50 @@ func (s *CustomerPaymentStore) GetLastByPaymentType(
 
 	return res, nil
 }
+
+// GetLastPendingByNoteTx returns the latest pending payment of a type of a contract whose note
+// starts with notePrefix, nil when there is none
+func (s *CustomerPaymentStore) GetLastPendingByNoteTx(
+	tx *gorm.DB,
+	cusContractID int,
+	paymentType model.PaymentType,
+	notePrefix string,
+) (*model.CustomerPayment, error) {
+	res := &model.CustomerPayment{}
+	row := tx.Where(
+		"customer_contract_id = ? and payment_type = ? and status = ? and note like ?",
+		cusContractID,
+		string(paymentType),
+		string(model.PaymentStatusPending),
+		notePrefix+"%",
+	).Order("id desc").Limit(1).Find(res)
+	if err := row.Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: GetLastPendingByNoteTx %v\n", err)
+		return nil, err
+	}
+
+	if row.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	return res, nil
+}
+
+// GetLastPaidByPaymentType returns the latest paid payment of a type of a contract
+func (s *CustomerPaymentStore) GetLastPaidByPaymentType(
+	cusContractID int,
+	paymentType model.PaymentType,
+) (*model.CustomerPayment, error) {
+	res := &model.CustomerPayment{}
+	if err := s.db.Where(
+		"customer_contract_id = ? and payment_type = ? and status = ?",
+		cusContractID,
+		string(paymentType),
+		string(model.PaymentStatusPaid),
+	).Order("id desc").First(res).Error; err != nil {
+		fmt.Printf("CustomerPaymentStore: GetLastPaidByPaymentType %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
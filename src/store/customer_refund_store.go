@@ -0,0 +1,119 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type CustomerRefundStore struct {
+	db *gorm.DB
+}
+
+func NewCustomerRefundStore(db *gorm.DB) *CustomerRefundStore {
+	return &CustomerRefundStore{db: db}
+}
+
+func (s *CustomerRefundStore) CreateTx(tx *gorm.DB, refund *model.CustomerRefund) error {
+	if err := tx.Create(refund).Error; err != nil {
+		fmt.Printf("CustomerRefundStore: CreateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *CustomerRefundStore) Update(id int, values map[string]interface{}) error {
+	if err := s.db.Model(model.CustomerRefund{}).Where("id = ?", id).Updates(values).Error; err != nil {
+		fmt.Printf("CustomerRefundStore: Update %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *CustomerRefundStore) UpdateTx(tx *gorm.DB, id int, values map[string]interface{}) error {
+	if err := tx.Model(model.CustomerRefund{}).Where("id = ?", id).Updates(values).Error; err != nil {
+		fmt.Printf("CustomerRefundStore: UpdateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateWhenPendingTx updates a refund only while it is pending and returns how many rows were
+// updated, so a refund is settled once even when the reconciler and a request race on it
+func (s *CustomerRefundStore) UpdateWhenPendingTx(tx *gorm.DB, id int, values map[string]interface{}) (int64, error) {
+	row := tx.Model(model.CustomerRefund{}).
+		Where("id = ? and status = ?", id, string(model.CustomerRefundStatusPending)).
+		Updates(values)
+	if err := row.Error; err != nil {
+		fmt.Printf("CustomerRefundStore: UpdateWhenPendingTx %v\n", err)
+		return 0, err
+	}
+
+	return row.RowsAffected, nil
+}
+
+func (s *CustomerRefundStore) GetByID(id int) (*model.CustomerRefund, error) {
+	res := &model.CustomerRefund{}
+	if err := s.db.Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("CustomerRefundStore: GetByID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *CustomerRefundStore) GetByCustomerPaymentID(cusPaymentID int) ([]*model.CustomerRefund, error) {
+	res := make([]*model.CustomerRefund, 0)
+	if err := s.db.Where("customer_payment_id = ?", cusPaymentID).Order("id asc").Find(&res).Error; err != nil {
+		fmt.Printf("CustomerRefundStore: GetByCustomerPaymentID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetPendingUpdatedBefore returns the pending refunds not touched since before, with their payment
+func (s *CustomerRefundStore) GetPendingUpdatedBefore(before time.Time) ([]*model.CustomerRefund, error) {
+	res := make([]*model.CustomerRefund, 0)
+	if err := s.db.Preload("CustomerPayment").
+		Where("status = ? and updated_at < ?", string(model.CustomerRefundStatusPending), before).
+		Order("id asc").Find(&res).Error; err != nil {
+		fmt.Printf("CustomerRefundStore: GetPendingUpdatedBefore %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetActiveByReturnPaymentIDTx returns the refund paying out a return payment that is not failed
+func (s *CustomerRefundStore) GetActiveByReturnPaymentIDTx(tx *gorm.DB, returnPaymentID int) (*model.CustomerRefund, error) {
+	res := &model.CustomerRefund{}
+	if err := tx.Where("return_payment_id = ? and status != ?", returnPaymentID, string(model.CustomerRefundStatusFailed)).
+		Order("id desc").First(res).Error; err != nil {
+		fmt.Printf("CustomerRefundStore: GetActiveByReturnPaymentIDTx %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetRefundedAmountTx sums the refunds of a payment that are not failed. Pending ones count too, as
+// the gateway may still refund them until the reconciler settles them.
+func (s *CustomerRefundStore) GetRefundedAmountTx(tx *gorm.DB, cusPaymentID int) (int, error) {
+	var amount int
+	if err := tx.Model(model.CustomerRefund{}).
+		Select("coalesce(sum(amount), 0)").
+		Where("customer_payment_id = ? and status != ?", cusPaymentID, string(model.CustomerRefundStatusFailed)).
+		Scan(&amount).Error; err != nil {
+		fmt.Printf("CustomerRefundStore: GetRefundedAmountTx %v\n", err)
+		return 0, err
+	}
+
+	return amount, nil
+}
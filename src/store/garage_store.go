@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type GarageStore struct {
+	db *gorm.DB
+}
+
+func NewGarageStore(db *gorm.DB) *GarageStore {
+	return &GarageStore{db: db}
+}
+
+func (s *GarageStore) Create(g *model.Garage) error {
+	if err := s.db.Create(g).Error; err != nil {
+		fmt.Printf("GarageStore: Create %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *GarageStore) GetByID(id int) (*model.Garage, error) {
+	res := &model.Garage{}
+	if err := s.db.Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("GarageStore: GetByID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *GarageStore) GetAll() ([]*model.Garage, error) {
+	res := make([]*model.Garage, 0)
+	if err := s.db.Order("id").Find(&res).Error; err != nil {
+		fmt.Printf("GarageStore: GetAll %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Update saves the garage and its capacity, and moves the pickup point of its cars along with it
+func (s *GarageStore) Update(g *model.Garage) error {
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Garage{}).Where("id = ?", g.ID).Updates(map[string]interface{}{
+			"name":         g.Name,
+			"address":      g.Address,
+			"latitude":     g.Latitude,
+			"longitude":    g.Longitude,
+			"max_4_seats":  g.Max4Seats,
+			"max_7_seats":  g.Max7Seats,
+			"max_15_seats": g.Max15Seats,
+			"updated_at":   time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&model.Car{}).Where("garage_id = ?", g.ID).Updates(map[string]interface{}{
+			"pickup_address": g.Address,
+			"latitude":       g.Latitude,
+			"longitude":      g.Longitude,
+		}).Error
+	}); err != nil {
+		fmt.Printf("GarageStore: Update %v\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type HolidayStore struct {
+	db *gorm.DB
+}
+
+func NewHolidayStore(db *gorm.DB) *HolidayStore {
+	return &HolidayStore{db: db}
+}
+
+func (s *HolidayStore) Create(holiday *model.Holiday) error {
+	if err := s.db.Create(holiday).Error; err != nil {
+		fmt.Printf("HolidayStore: Create %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *HolidayStore) Delete(id int) error {
+	if err := s.db.Where("id = ?", id).Delete(&model.Holiday{}).Error; err != nil {
+		fmt.Printf("HolidayStore: Delete %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetInRange returns the holidays between two dates, both included
+func (s *HolidayStore) GetInRange(from, to time.Time) ([]*model.Holiday, error) {
+	res := make([]*model.Holiday, 0)
+	if err := s.db.Where("date between ? and ?", from.Format(time.DateOnly), to.Format(time.DateOnly)).
+		Order("date").Find(&res).Error; err != nil {
+		fmt.Printf("HolidayStore: GetInRange %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
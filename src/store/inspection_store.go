@@ -0,0 +1,74 @@
+package store
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type InspectionStore struct {
+	db *gorm.DB
+}
+
+func NewInspectionStore(db *gorm.DB) *InspectionStore {
+	return &InspectionStore{db: db}
+}
+
+func preloadTemplateItems(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+func (s *InspectionStore) GetLastTemplate() (*model.InspectionTemplate, error) {
+	res := &model.InspectionTemplate{}
+	if err := s.db.Order("id desc").Preload("Items", preloadTemplateItems).First(res).Error; err != nil {
+		fmt.Printf("InspectionStore: GetLastTemplate %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *InspectionStore) GetTemplateByIDTx(tx *gorm.DB, id int) (*model.InspectionTemplate, error) {
+	res := &model.InspectionTemplate{}
+	if err := tx.Where("id = ?", id).Preload("Items", preloadTemplateItems).First(res).Error; err != nil {
+		fmt.Printf("InspectionStore: GetTemplateByIDTx %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *InspectionStore) CreateTemplate(template *model.InspectionTemplate) error {
+	if err := s.db.Create(template).Error; err != nil {
+		fmt.Printf("InspectionStore: CreateTemplate %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// CreateTx creates the inspection together with its items
+func (s *InspectionStore) CreateTx(tx *gorm.DB, inspection *model.CustomerContractInspection) error {
+	if err := tx.Create(inspection).Error; err != nil {
+		fmt.Printf("InspectionStore: CreateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *InspectionStore) GetByCustomerContractID(contractID int) ([]*model.CustomerContractInspection, error) {
+	res := make([]*model.CustomerContractInspection, 0)
+	if err := s.db.Where("customer_contract_id = ?", contractID).
+		Preload("Items").
+		Preload("Items.InspectionTemplateItem").
+		Order("id").
+		Find(&res).Error; err != nil {
+		fmt.Printf("InspectionStore: GetByCustomerContractID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
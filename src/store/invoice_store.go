@@ -0,0 +1,92 @@
+package store
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type InvoiceStore struct {
+	db *gorm.DB
+}
+
+func NewInvoiceStore(db *gorm.DB) *InvoiceStore {
+	return &InvoiceStore{db: db}
+}
+
+// NextNumberTx takes the next number of a series in a year. The sequence row stays locked until
+// tx ends, so numbers of rolled back invoices are taken again and the series has no gaps.
+func (s *InvoiceStore) NextNumberTx(tx *gorm.DB, series string, year int) (int, error) {
+	var number int
+	rawSql := `
+insert into invoice_sequences(series, year, last_number) values (?, ?, 1)
+on conflict (series, year) do update set last_number = invoice_sequences.last_number + 1
+returning last_number
+`
+	if err := tx.Raw(rawSql, series, year).Scan(&number).Error; err != nil {
+		fmt.Printf("InvoiceStore: NextNumberTx %v\n", err)
+		return 0, err
+	}
+
+	return number, nil
+}
+
+func (s *InvoiceStore) CreateTx(tx *gorm.DB, invoice *model.Invoice) error {
+	if err := tx.Create(invoice).Error; err != nil {
+		fmt.Printf("InvoiceStore: CreateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *InvoiceStore) Update(id int, values map[string]interface{}) error {
+	if err := s.db.Model(model.Invoice{}).Where("id = ?", id).Updates(values).Error; err != nil {
+		fmt.Printf("InvoiceStore: Update %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetByCustomerPaymentIDTx returns the invoice of a customer payment, or nil when it has none
+func (s *InvoiceStore) GetByCustomerPaymentIDTx(tx *gorm.DB, paymentID int) (*model.Invoice, error) {
+	var res []*model.Invoice
+	if err := tx.Where("customer_payment_id = ?", paymentID).Limit(1).Find(&res).Error; err != nil {
+		fmt.Printf("InvoiceStore: GetByCustomerPaymentIDTx %v\n", err)
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	return res[0], nil
+}
+
+// GetByPartnerPaymentHistoryIDTx returns the receipt of a partner payout, or nil when it has none
+func (s *InvoiceStore) GetByPartnerPaymentHistoryIDTx(tx *gorm.DB, historyID int) (*model.Invoice, error) {
+	var res []*model.Invoice
+	if err := tx.Where("partner_payment_history_id = ?", historyID).Limit(1).Find(&res).Error; err != nil {
+		fmt.Printf("InvoiceStore: GetByPartnerPaymentHistoryIDTx %v\n", err)
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	return res[0], nil
+}
+
+func (s *InvoiceStore) GetByCustomerContractID(contractID int) ([]*model.Invoice, error) {
+	res := make([]*model.Invoice, 0)
+	if err := s.db.Where("customer_contract_id = ?", contractID).Order("id").Find(&res).Error; err != nil {
+		fmt.Printf("InvoiceStore: GetByCustomerContractID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type LedgerStore struct {
+	db *gorm.DB
+}
+
+func NewLedgerStore(db *gorm.DB) *LedgerStore {
+	return &LedgerStore{db: db}
+}
+
+// LedgerAccountSum is the total of the debits and credits of an account
+type LedgerAccountSum struct {
+	AccountCode model.LedgerAccountCode
+	Debit       int
+	Credit      int
+}
+
+func (s *LedgerStore) GetAccounts() ([]*model.LedgerAccount, error) {
+	res := make([]*model.LedgerAccount, 0)
+	if err := s.db.Order("id").Find(&res).Error; err != nil {
+		fmt.Printf("LedgerStore: GetAccounts %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *LedgerStore) GetAccountByCode(code model.LedgerAccountCode) (*model.LedgerAccount, error) {
+	res := &model.LedgerAccount{}
+	if err := s.db.Where("code = ?", string(code)).First(res).Error; err != nil {
+		fmt.Printf("LedgerStore: GetAccountByCode %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CreateEntryTx inserts the entry with its lines and returns false, without inserting anything,
+// when an entry with the same reference was posted before
+func (s *LedgerStore) CreateEntryTx(tx *gorm.DB, entry *model.LedgerEntry) (bool, error) {
+	row := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Lines").Create(entry)
+	if err := row.Error; err != nil {
+		fmt.Printf("LedgerStore: CreateEntryTx %v\n", err)
+		return false, err
+	}
+
+	if row.RowsAffected == 0 {
+		return false, nil
+	}
+
+	for _, line := range entry.Lines {
+		line.LedgerEntryID = entry.ID
+	}
+	if err := tx.Create(entry.Lines).Error; err != nil {
+		fmt.Printf("LedgerStore: CreateEntryTx %v\n", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *LedgerStore) GetEntryByReference(reference string) (*model.LedgerEntry, error) {
+	res := &model.LedgerEntry{}
+	if err := s.db.Where("reference = ?", reference).Preload("Lines").First(res).Error; err != nil {
+		fmt.Printf("LedgerStore: GetEntryByReference %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *LedgerStore) lines(accountCode model.LedgerAccountCode, partnerID int) *gorm.DB {
+	query := s.db.Model(&model.LedgerLine{}).
+		Joins("join ledger_entries on ledger_entries.id = ledger_lines.ledger_entry_id")
+	if accountCode != "" {
+		query = query.Where("ledger_lines.account_code = ?", string(accountCode))
+	}
+	if partnerID > 0 {
+		query = query.Where("ledger_entries.partner_id = ?", partnerID)
+	}
+
+	return query
+}
+
+// SumByAccount sums the lines of every account posted before the given time, or of all lines
+// when it is zero
+func (s *LedgerStore) SumByAccount(before time.Time) ([]*LedgerAccountSum, error) {
+	query := s.lines("", 0)
+	if !before.IsZero() {
+		query = query.Where("ledger_entries.posted_at < ?", before)
+	}
+
+	res := make([]*LedgerAccountSum, 0)
+	if err := query.
+		Select("ledger_lines.account_code, coalesce(sum(ledger_lines.debit), 0) as debit, coalesce(sum(ledger_lines.credit), 0) as credit").
+		Group("ledger_lines.account_code").
+		Scan(&res).Error; err != nil {
+		fmt.Printf("LedgerStore: SumByAccount %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// SumAccount sums the lines of an account posted before the given time, of the entries of
+// partnerID only when it is not 0
+func (s *LedgerStore) SumAccount(accountCode model.LedgerAccountCode, partnerID int, before time.Time) (*LedgerAccountSum, error) {
+	res := &LedgerAccountSum{AccountCode: accountCode}
+	if err := s.lines(accountCode, partnerID).
+		Where("ledger_entries.posted_at < ?", before).
+		Select("coalesce(sum(ledger_lines.debit), 0) as debit, coalesce(sum(ledger_lines.credit), 0) as credit").
+		Scan(res).Error; err != nil {
+		fmt.Printf("LedgerStore: SumAccount %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetLines returns the lines of an account posted in [fromDate, toDate) in posting order, of the
+// entries of partnerID only when it is not 0
+func (s *LedgerStore) GetLines(
+	accountCode model.LedgerAccountCode,
+	partnerID int,
+	fromDate, toDate time.Time,
+) ([]*model.LedgerLine, error) {
+	res := make([]*model.LedgerLine, 0)
+	if err := s.lines(accountCode, partnerID).
+		Where("ledger_entries.posted_at >= ? and ledger_entries.posted_at < ?", fromDate, toDate).
+		Preload("LedgerEntry").
+		Order("ledger_entries.posted_at, ledger_lines.id").
+		Find(&res).Error; err != nil {
+		fmt.Printf("LedgerStore: GetLines %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
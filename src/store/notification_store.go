@@ -40,3 +40,20 @@ func (s *NotificationStore) GetByAcctID(acctID, offset, limit int) ([]*model.Not
 
 	return res, nil
 }
+
+// GetByAcctIDAfterID returns the active notifications created after afterID, oldest first
+func (s *NotificationStore) GetByAcctIDAfterID(acctID, afterID, limit int) ([]*model.Notification, error) {
+	if limit == 0 {
+		limit = 1000
+	}
+	var res []*model.Notification
+	if err := s.db.Model(model.Notification{}).
+		Where("account_id = ? and status = ? and id > ?", acctID, string(model.NotificationStatusActive), afterID).
+		Order("id asc").
+		Limit(limit).Find(&res).Error; err != nil {
+		fmt.Printf("NotificationStore: GetByAcctIDAfterID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
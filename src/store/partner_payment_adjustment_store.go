@@ -0,0 +1,49 @@
+package store
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type PartnerPaymentAdjustmentStore struct {
+	db *gorm.DB
+}
+
+func NewPartnerPaymentAdjustmentStore(db *gorm.DB) *PartnerPaymentAdjustmentStore {
+	return &PartnerPaymentAdjustmentStore{db: db}
+}
+
+func (s *PartnerPaymentAdjustmentStore) CreateTx(tx *gorm.DB, adjustment *model.PartnerPaymentAdjustment) error {
+	if err := tx.Create(adjustment).Error; err != nil {
+		fmt.Printf("PartnerPaymentAdjustmentStore: CreateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *PartnerPaymentAdjustmentStore) GetByPartnerPaymentHistoryID(historyID int) ([]*model.PartnerPaymentAdjustment, error) {
+	res := make([]*model.PartnerPaymentAdjustment, 0)
+	if err := s.db.Where("partner_payment_history_id = ?", historyID).Order("id").Find(&res).Error; err != nil {
+		fmt.Printf("PartnerPaymentAdjustmentStore: GetByPartnerPaymentHistoryID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *PartnerPaymentAdjustmentStore) SumAmountTx(tx *gorm.DB, historyID int) (int, error) {
+	var sum int
+	if err := tx.Model(&model.PartnerPaymentAdjustment{}).
+		Select("coalesce(sum(amount), 0)").
+		Where("partner_payment_history_id = ?", historyID).
+		Scan(&sum).Error; err != nil {
+		fmt.Printf("PartnerPaymentAdjustmentStore: SumAmountTx %v\n", err)
+		return 0, err
+	}
+
+	return sum, nil
+}
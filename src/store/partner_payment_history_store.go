@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/godev111222333/capstone-backend/src/model"
 )
@@ -17,32 +18,76 @@ func NewPartnerPaymentHistoryStore(db *gorm.DB) *PartnerPaymentHistoryStore {
 	return &PartnerPaymentHistoryStore{db: db}
 }
 
-func (s *PartnerPaymentHistoryStore) Create(history *model.PartnerPaymentHistory, cusContractIds []int) error {
-	if err := s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(history).Error; err != nil {
-			return err
-		}
+// FirstOrCreateTx creates the payment of a partner for a period or, when it exists, loads and locks
+// it until tx ends
+func (s *PartnerPaymentHistoryStore) FirstOrCreateTx(tx *gorm.DB, history *model.PartnerPaymentHistory) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(history).Error; err != nil {
+		fmt.Printf("PartnerPaymentHistoryStore: FirstOrCreateTx %v\n", err)
+		return err
+	}
 
-		for _, cusContractID := range cusContractIds {
-			m := &model.PartnerPaymentCustomerContract{
-				PartnerPaymentHistoryID: history.ID,
-				CustomerContractID:      cusContractID,
-			}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("partner_id = ? and start_date = ? and end_date = ?", history.PartnerID, history.StartDate, history.EndDate).
+		First(history).Error; err != nil {
+		fmt.Printf("PartnerPaymentHistoryStore: FirstOrCreateTx %v\n", err)
+		return err
+	}
 
-			if err := tx.Create(m).Error; err != nil {
-				return err
-			}
-		}
+	return nil
+}
+
+// GetByIDForUpdate locks the payment row until tx ends
+func (s *PartnerPaymentHistoryStore) GetByIDForUpdate(tx *gorm.DB, id int) (*model.PartnerPaymentHistory, error) {
+	res := &model.PartnerPaymentHistory{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("PartnerPaymentHistoryStore: GetByIDForUpdate %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
 
+func (s *PartnerPaymentHistoryStore) CreateCustomerContractsTx(tx *gorm.DB, items []*model.PartnerPaymentCustomerContract) error {
+	if len(items) == 0 {
 		return nil
-	}); err != nil {
-		fmt.Printf("PartnerPaymentHistoryStore: Create %v\n", err)
+	}
+
+	if err := tx.Create(items).Error; err != nil {
+		fmt.Printf("PartnerPaymentHistoryStore: CreateCustomerContractsTx %v\n", err)
 		return err
 	}
 
 	return nil
 }
 
+func (s *PartnerPaymentHistoryStore) GetCustomerContracts(id int) ([]*model.PartnerPaymentCustomerContract, error) {
+	res := make([]*model.PartnerPaymentCustomerContract, 0)
+	if err := s.db.Where("partner_payment_history_id = ?", id).
+		Preload("CustomerContract").
+		Preload("CustomerContract.Car").
+		Order("id").
+		Find(&res).Error; err != nil {
+		fmt.Printf("PartnerPaymentHistoryStore: GetCustomerContracts %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// SumNetAmountTx returns what the partner receives for the settled contracts of the payment
+func (s *PartnerPaymentHistoryStore) SumNetAmountTx(tx *gorm.DB, id int) (int, error) {
+	var sum int
+	if err := tx.Model(&model.PartnerPaymentCustomerContract{}).
+		Select("coalesce(sum(net_amount), 0)").
+		Where("partner_payment_history_id = ?", id).
+		Scan(&sum).Error; err != nil {
+		fmt.Printf("PartnerPaymentHistoryStore: SumNetAmountTx %v\n", err)
+		return 0, err
+	}
+
+	return sum, nil
+}
+
 func (s *PartnerPaymentHistoryStore) GetByID(id int) (*model.PartnerPaymentHistory, error) {
 	var res *model.PartnerPaymentHistory
 	if err := s.db.Where("id = ?", id).First(&res).Error; err != nil {
@@ -62,6 +107,15 @@ func (s *PartnerPaymentHistoryStore) Update(id int, values map[string]interface{
 	return nil
 }
 
+func (s *PartnerPaymentHistoryStore) UpdateTx(tx *gorm.DB, id int, values map[string]interface{}) error {
+	if err := tx.Model(model.PartnerPaymentHistory{}).Where("id = ?", id).Updates(values).Error; err != nil {
+		fmt.Printf("PartnerPaymentHistoryStore: UpdateTx %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
 func (s *PartnerPaymentHistoryStore) UpdateMulti(ids []int, values map[string]interface{}) error {
 	if err := s.db.Model(model.PartnerPaymentHistory{}).Where("id in ?", ids).Updates(values).Error; err != nil {
 		fmt.Printf("PartnerPaymentHistoryStore: UpdateMulti %v\n", err)
@@ -71,6 +125,19 @@ func (s *PartnerPaymentHistoryStore) UpdateMulti(ids []int, values map[string]in
 	return nil
 }
 
+// MarkPaidTx moves pending partner payments to paid and returns how many were moved
+func (s *PartnerPaymentHistoryStore) MarkPaidTx(tx *gorm.DB, ids []int) (int64, error) {
+	row := tx.Model(model.PartnerPaymentHistory{}).
+		Where("id in ? and status = ?", ids, string(model.PartnerPaymentHistoryStatusPending)).
+		Updates(map[string]interface{}{"status": string(model.PartnerPaymentHistoryStatusPaid)})
+	if err := row.Error; err != nil {
+		fmt.Printf("PartnerPaymentHistoryStore: MarkPaidTx %v\n", err)
+		return 0, err
+	}
+
+	return row.RowsAffected, nil
+}
+
 func (s *PartnerPaymentHistoryStore) GetInTimeRange(
 	fromDate, toDate time.Time, status model.PartnerPaymentHistoryStatus,
 	offset, limit int) ([]*model.PartnerPaymentHistory, error) {
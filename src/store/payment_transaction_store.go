@@ -0,0 +1,48 @@
+package store
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type PaymentTransactionStore struct {
+	db *gorm.DB
+}
+
+func NewPaymentTransactionStore(db *gorm.DB) *PaymentTransactionStore {
+	return &PaymentTransactionStore{db: db}
+}
+
+// CreateIfNotExistTx inserts the transaction and reports false when it was already recorded, that
+// is the same successful transaction number or the same failure of the order
+func (s *PaymentTransactionStore) CreateIfNotExistTx(tx *gorm.DB, t *model.PaymentTransaction) (bool, error) {
+	row := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(t)
+	if err := row.Error; err != nil {
+		fmt.Printf("PaymentTransactionStore: CreateIfNotExistTx %v\n", err)
+		return false, err
+	}
+
+	return row.RowsAffected > 0, nil
+}
+
+// GetSucceededByTransactionNo returns the successful transaction of the gateway, failures don't
+// have a transaction number of their own
+func (s *PaymentTransactionStore) GetSucceededByTransactionNo(gateway model.PaymentGateway, transactionNo string) (*model.PaymentTransaction, error) {
+	res := &model.PaymentTransaction{}
+	row := s.db.Where("gateway = ? and transaction_no = ? and status = ?",
+		string(gateway), transactionNo, string(model.PaymentTransactionStatusSucceeded)).Find(res)
+	if err := row.Error; err != nil {
+		fmt.Printf("PaymentTransactionStore: GetSucceededByTransactionNo %v\n", err)
+		return nil, err
+	}
+
+	if row.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	return res, nil
+}
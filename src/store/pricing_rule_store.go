@@ -0,0 +1,56 @@
+package store
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+type PricingRuleStore struct {
+	db *gorm.DB
+}
+
+func NewPricingRuleStore(db *gorm.DB) *PricingRuleStore {
+	return &PricingRuleStore{db: db}
+}
+
+func (s *PricingRuleStore) Create(rule *model.PricingRule) error {
+	if err := s.db.Create(rule).Error; err != nil {
+		fmt.Printf("PricingRuleStore: Create %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *PricingRuleStore) GetByID(id int) (*model.PricingRule, error) {
+	res := &model.PricingRule{}
+	if err := s.db.Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("PricingRuleStore: GetByID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *PricingRuleStore) Delete(id int) error {
+	if err := s.db.Where("id = ?", id).Delete(&model.PricingRule{}).Error; err != nil {
+		fmt.Printf("PricingRuleStore: Delete %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetByCarOrCarModel returns the rules of a car together with the rules of its car model
+func (s *PricingRuleStore) GetByCarOrCarModel(carID, carModelID int) ([]*model.PricingRule, error) {
+	res := make([]*model.PricingRule, 0)
+	if err := s.db.Where("car_id = ? or car_model_id = ?", carID, carModelID).Order("id").Find(&res).Error; err != nil {
+		fmt.Printf("PricingRuleStore: GetByCarOrCarModel %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/godev111222333/capstone-backend/src/model"
+)
+
+var ErrSessionAlreadyRotated = errors.New("session already rotated or revoked")
+
+type SessionStore struct {
+	db *gorm.DB
+}
+
+func NewSessionStore(db *gorm.DB) *SessionStore {
+	return &SessionStore{db: db}
+}
+
+func (s *SessionStore) Create(session *model.Session) error {
+	if err := s.db.Create(session).Error; err != nil {
+		fmt.Printf("SessionStore: Create %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *SessionStore) GetByID(id uuid.UUID) (*model.Session, error) {
+	res := &model.Session{}
+	if err := s.db.Where("id = ?", id).First(res).Error; err != nil {
+		fmt.Printf("SessionStore: GetByID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *SessionStore) GetByAccessTokenID(accessTokenID uuid.UUID) (*model.Session, error) {
+	res := &model.Session{}
+	if err := s.db.Where("access_token_id = ?", accessTokenID).First(res).Error; err != nil {
+		fmt.Printf("SessionStore: GetByAccessTokenID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetActiveByAccountID returns the sessions whose access tokens may still be alive.
+func (s *SessionStore) GetActiveByAccountID(acctID int) ([]*model.Session, error) {
+	var res []*model.Session
+	if err := s.db.
+		Where("account_id = ? and status = ? and expires_at > ?", acctID, string(model.SessionStatusActive), time.Now()).
+		Order("created_at desc").
+		Find(&res).Error; err != nil {
+		fmt.Printf("SessionStore: GetActiveByAccountID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *SessionStore) GetActiveByFamilyID(familyID uuid.UUID) ([]*model.Session, error) {
+	var res []*model.Session
+	if err := s.db.
+		Where("family_id = ? and status = ?", familyID, string(model.SessionStatusActive)).
+		Find(&res).Error; err != nil {
+		fmt.Printf("SessionStore: GetActiveByFamilyID %v\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Rotate marks the old session as rotated and creates its successor. The status check makes it
+// a compare-and-swap, so two concurrent renewals with the same refresh token can't both succeed.
+func (s *SessionStore) Rotate(oldID uuid.UUID, next *model.Session) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		row := tx.Model(&model.Session{}).
+			Where("id = ? and status = ?", oldID, string(model.SessionStatusActive)).
+			Updates(map[string]interface{}{
+				"status":     string(model.SessionStatusRotated),
+				"updated_at": time.Now(),
+			})
+		if err := row.Error; err != nil {
+			fmt.Printf("SessionStore: Rotate %v\n", err)
+			return err
+		}
+
+		if row.RowsAffected == 0 {
+			return ErrSessionAlreadyRotated
+		}
+
+		if err := tx.Create(next).Error; err != nil {
+			fmt.Printf("SessionStore: Rotate %v\n", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *SessionStore) Revoke(id uuid.UUID) error {
+	if err := s.db.Model(&model.Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     string(model.SessionStatusRevoked),
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		fmt.Printf("SessionStore: Revoke %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *SessionStore) RevokeFamily(familyID uuid.UUID) error {
+	if err := s.db.Model(&model.Session{}).Where("family_id = ?", familyID).Updates(map[string]interface{}{
+		"status":     string(model.SessionStatusRevoked),
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		fmt.Printf("SessionStore: RevokeFamily %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *SessionStore) RevokeByAccountID(acctID int) error {
+	if err := s.db.Model(&model.Session{}).Where("account_id = ?", acctID).Updates(map[string]interface{}{
+		"status":     string(model.SessionStatusRevoked),
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		fmt.Printf("SessionStore: RevokeByAccountID %v\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -10,22 +10,36 @@ import (
 )
 
 type DbStore struct {
-	DB                         *gorm.DB
-	AccountStore               *AccountStore
-	CarModelStore              *CarModelStore
-	CarStore                   *CarStore
-	CarImageStore              *CarImageStore
-	GarageConfigStore          *GarageConfigStore
-	CustomerContractStore      *CustomerContractStore
-	CustomerContractImageStore *CustomerContractImageStore
-	CustomerPaymentStore       *CustomerPaymentStore
-	DrivingLicenseImageStore   *DrivingLicenseImageStore
-	CustomerContractRuleStore  *CustomerContractRuleStore
-	PartnerContractRuleStore   *PartnerContractRuleStore
-	ConversationStore          *ConversationStore
-	MessageStore               *MessageStore
-	NotificationStore          *NotificationStore
-	PartnerPaymentHistoryStore *PartnerPaymentHistoryStore
+	DB                            *gorm.DB
+	AccountStore                  *AccountStore
+	CarModelStore                 *CarModelStore
+	CarStore                      *CarStore
+	CarImageStore                 *CarImageStore
+	CustomerContractStore         *CustomerContractStore
+	CustomerContractImageStore    *CustomerContractImageStore
+	CustomerPaymentStore          *CustomerPaymentStore
+	DrivingLicenseImageStore      *DrivingLicenseImageStore
+	CustomerContractRuleStore     *CustomerContractRuleStore
+	PartnerContractRuleStore      *PartnerContractRuleStore
+	ConversationStore             *ConversationStore
+	MessageStore                  *MessageStore
+	NotificationStore             *NotificationStore
+	PartnerPaymentHistoryStore    *PartnerPaymentHistoryStore
+	SessionStore                  *SessionStore
+	CustomerContractEventStore    *CustomerContractEventStore
+	PaymentTransactionStore       *PaymentTransactionStore
+	CustomerRefundStore           *CustomerRefundStore
+	PricingRuleStore              *PricingRuleStore
+	HolidayStore                  *HolidayStore
+	CarReservationStore           *CarReservationStore
+	GarageStore                   *GarageStore
+	CustomerContractDeliveryStore *CustomerContractDeliveryStore
+	CustomerContractChargeStore   *CustomerContractChargeStore
+	InspectionStore               *InspectionStore
+	PartnerPaymentAdjustmentStore *PartnerPaymentAdjustmentStore
+	LedgerStore                   *LedgerStore
+	InvoiceStore                  *InvoiceStore
+	ContractTemplateStore         *ContractTemplateStore
 }
 
 func NewDbStore(cfg *misc.DatabaseConfig) (*DbStore, error) {
@@ -40,21 +54,35 @@ func NewDbStore(cfg *misc.DatabaseConfig) (*DbStore, error) {
 	}
 
 	return &DbStore{
-		DB:                         db,
-		AccountStore:               NewAccountStore(db),
-		CarModelStore:              NewCarModelStore(db),
-		CarStore:                   NewCarStore(db),
-		CarImageStore:              NewCarImageStore(db),
-		GarageConfigStore:          NewGarageConfigStore(db),
-		CustomerContractStore:      NewCustomerContractStore(db),
-		CustomerContractImageStore: NewCustomerContractImageStore(db),
-		CustomerPaymentStore:       NewCustomerPaymentStore(db),
-		DrivingLicenseImageStore:   NewDrivingLicenseImageStore(db),
-		CustomerContractRuleStore:  NewCustomerContractRuleStore(db),
-		PartnerContractRuleStore:   NewPartnerContractRuleStore(db),
-		ConversationStore:          NewConversationStore(db),
-		MessageStore:               NewMessageStore(db),
-		NotificationStore:          NewNotificationStore(db),
-		PartnerPaymentHistoryStore: NewPartnerPaymentHistoryStore(db),
+		DB:                            db,
+		AccountStore:                  NewAccountStore(db),
+		CarModelStore:                 NewCarModelStore(db),
+		CarStore:                      NewCarStore(db),
+		CarImageStore:                 NewCarImageStore(db),
+		CustomerContractStore:         NewCustomerContractStore(db),
+		CustomerContractImageStore:    NewCustomerContractImageStore(db),
+		CustomerPaymentStore:          NewCustomerPaymentStore(db),
+		DrivingLicenseImageStore:      NewDrivingLicenseImageStore(db),
+		CustomerContractRuleStore:     NewCustomerContractRuleStore(db),
+		PartnerContractRuleStore:      NewPartnerContractRuleStore(db),
+		ConversationStore:             NewConversationStore(db),
+		MessageStore:                  NewMessageStore(db),
+		NotificationStore:             NewNotificationStore(db),
+		PartnerPaymentHistoryStore:    NewPartnerPaymentHistoryStore(db),
+		SessionStore:                  NewSessionStore(db),
+		CustomerContractEventStore:    NewCustomerContractEventStore(db),
+		PaymentTransactionStore:       NewPaymentTransactionStore(db),
+		CustomerRefundStore:           NewCustomerRefundStore(db),
+		PricingRuleStore:              NewPricingRuleStore(db),
+		HolidayStore:                  NewHolidayStore(db),
+		CarReservationStore:           NewCarReservationStore(db),
+		GarageStore:                   NewGarageStore(db),
+		CustomerContractDeliveryStore: NewCustomerContractDeliveryStore(db),
+		CustomerContractChargeStore:   NewCustomerContractChargeStore(db),
+		InspectionStore:               NewInspectionStore(db),
+		PartnerPaymentAdjustmentStore: NewPartnerPaymentAdjustmentStore(db),
+		LedgerStore:                   NewLedgerStore(db),
+		InvoiceStore:                  NewInvoiceStore(db),
+		ContractTemplateStore:         NewContractTemplateStore(db),
 	}, nil
 }
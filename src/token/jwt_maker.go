@@ -8,19 +8,50 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
-const minSecretKeySize = 32
+const (
+	minSecretKeySize = 32
+	keyIDHeader      = "kid"
+)
 
 // JWTMaker is a JSON Web Token maker
 type JWTMaker struct {
-	secretKey string
+	signingKey *Key
+	// verifyKeys contains every key still accepted for verification, indexed by kid
+	verifyKeys map[string]*Key
 }
 
-// NewJWTMaker creates a new JWTMaker
+// NewJWTMaker creates a new JWTMaker signing with a single HS256 secret
 func NewJWTMaker(secretKey string) (Maker, error) {
-	if len(secretKey) < minSecretKeySize {
-		return nil, fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
+	key, err := NewHMACKey("", secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJWTMakerWithKeys(key.ID, []*Key{key})
+}
+
+// NewJWTMakerWithKeys creates a new JWTMaker signing with the key signingKeyID. The other keys
+// are only used to verify tokens, so tokens issued under a rotated out key stay valid until expiry.
+// A key with an empty ID verifies tokens without a kid header.
+func NewJWTMakerWithKeys(signingKeyID string, keys []*Key) (Maker, error) {
+	verifyKeys := make(map[string]*Key, len(keys))
+	for _, key := range keys {
+		if _, ok := verifyKeys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicated key id %s", key.ID)
+		}
+		verifyKeys[key.ID] = key
 	}
-	return &JWTMaker{secretKey}, nil
+
+	signingKey, ok := verifyKeys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %s not found", signingKeyID)
+	}
+
+	if signingKey.SignKey == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", signingKeyID)
+	}
+
+	return &JWTMaker{signingKey, verifyKeys}, nil
 }
 
 // CreateToken creates a new token for a specific username and duration
@@ -30,19 +61,42 @@ func (maker *JWTMaker) CreateToken(username string, role string, duration time.D
 		return "", payload, err
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	token, err := jwtToken.SignedString([]byte(maker.secretKey))
+	return maker.sign(payload)
+}
+
+// CreateRefreshToken creates a new refresh token for a specific username and duration
+func (maker *JWTMaker) CreateRefreshToken(username string, role string, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewRefreshPayload(username, role, duration)
+	if err != nil {
+		return "", payload, err
+	}
+
+	return maker.sign(payload)
+}
+
+func (maker *JWTMaker) sign(payload *Payload) (string, *Payload, error) {
+	jwtToken := jwt.NewWithClaims(maker.signingKey.Method, payload)
+	if maker.signingKey.ID != "" {
+		jwtToken.Header[keyIDHeader] = maker.signingKey.ID
+	}
+	token, err := jwtToken.SignedString(maker.signingKey.SignKey)
 	return token, payload, err
 }
 
 // VerifyToken checks if the token is valid or not
 func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
 	keyFunc := func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+		keyID, _ := token.Header[keyIDHeader].(string)
+		key, ok := maker.verifyKeys[keyID]
 		if !ok {
 			return nil, ErrInvalidToken
 		}
-		return []byte(maker.secretKey), nil
+
+		// The algorithm must match the key, otherwise a public key could be used as HMAC secret
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return key.VerifyKey, nil
 	}
 
 	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
@@ -0,0 +1,111 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTMaker(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edBz, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	edPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edBz})
+	edPubBz, err := x509.MarshalPKIXPublicKey(edKey.Public())
+	require.NoError(t, err)
+	edPubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edPubBz})
+
+	t.Run("sign and verify with every algorithm", func(t *testing.T) {
+		t.Parallel()
+
+		hmacKey, err := NewHMACKey("hs", "12345678901234567890123456789012")
+		require.NoError(t, err)
+		rsKey, err := NewAsymmetricKey("rs", AlgorithmRS256, rsaPEM, nil)
+		require.NoError(t, err)
+		eddsaKey, err := NewAsymmetricKey("ed", AlgorithmEdDSA, edPEM, nil)
+		require.NoError(t, err)
+
+		for _, key := range []*Key{hmacKey, rsKey, eddsaKey} {
+			maker, err := NewJWTMakerWithKeys(key.ID, []*Key{key})
+			require.NoError(t, err)
+
+			token, payload, err := maker.CreateToken("0123456789", "customer", time.Minute)
+			require.NoError(t, err)
+
+			verified, err := maker.VerifyToken(token)
+			require.NoError(t, err)
+			require.Equal(t, payload.ID, verified.ID)
+			require.False(t, verified.IsRefreshToken())
+		}
+	})
+
+	t.Run("old key stays valid after rotation", func(t *testing.T) {
+		t.Parallel()
+
+		oldKey, err := NewAsymmetricKey("old", AlgorithmEdDSA, edPEM, nil)
+		require.NoError(t, err)
+		oldMaker, err := NewJWTMakerWithKeys("old", []*Key{oldKey})
+		require.NoError(t, err)
+		oldToken, _, err := oldMaker.CreateRefreshToken("0123456789", "customer", time.Minute)
+		require.NoError(t, err)
+
+		verifyOnlyKey, err := NewAsymmetricKey("old", AlgorithmEdDSA, nil, edPubPEM)
+		require.NoError(t, err)
+		newKey, err := NewAsymmetricKey("new", AlgorithmRS256, rsaPEM, nil)
+		require.NoError(t, err)
+		newMaker, err := NewJWTMakerWithKeys("new", []*Key{newKey, verifyOnlyKey})
+		require.NoError(t, err)
+
+		payload, err := newMaker.VerifyToken(oldToken)
+		require.NoError(t, err)
+		require.True(t, payload.IsRefreshToken())
+
+		// once the old key is removed its tokens are rejected
+		newOnlyMaker, err := NewJWTMakerWithKeys("new", []*Key{newKey})
+		require.NoError(t, err)
+		_, err = newOnlyMaker.VerifyToken(oldToken)
+		require.ErrorIs(t, err, ErrInvalidToken)
+
+		_, err = NewJWTMakerWithKeys("old", []*Key{verifyOnlyKey})
+		require.Error(t, err)
+	})
+
+	t.Run("reject expired token and algorithm mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		maker, err := NewJWTMaker("12345678901234567890123456789012")
+		require.NoError(t, err)
+		token, _, err := maker.CreateToken("0123456789", "customer", -time.Minute)
+		require.NoError(t, err)
+		_, err = maker.VerifyToken(token)
+		require.ErrorIs(t, err, ErrExpiredToken)
+
+		// a HS256 token carrying the kid of a RS256 key must not verify
+		rsKey, err := NewAsymmetricKey("rs", AlgorithmRS256, rsaPEM, nil)
+		require.NoError(t, err)
+		spoofKey, err := NewHMACKey("rs", "12345678901234567890123456789012")
+		require.NoError(t, err)
+		spoofMaker, err := NewJWTMakerWithKeys("rs", []*Key{spoofKey})
+		require.NoError(t, err)
+		spoofed, _, err := spoofMaker.CreateToken("0123456789", "admin", time.Minute)
+		require.NoError(t, err)
+
+		rsMaker, err := NewJWTMakerWithKeys("rs", []*Key{rsKey})
+		require.NoError(t, err)
+		_, err = rsMaker.VerifyToken(spoofed)
+		require.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
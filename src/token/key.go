@@ -0,0 +1,127 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key is a JWT key identified by the kid header. SignKey is nil for keys that are only kept
+// to verify tokens issued before a rotation.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// NewHMACKey creates a HS256 key from a shared secret
+func NewHMACKey(id string, secret string) (*Key, error) {
+	if len(secret) < minSecretKeySize {
+		return nil, fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
+	}
+
+	return &Key{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   []byte(secret),
+		VerifyKey: []byte(secret),
+	}, nil
+}
+
+// NewAsymmetricKey creates a RS256 or EdDSA key from PEM encoded keys. privatePEM may be empty
+// for verification only keys, the public key is derived from the private key when publicPEM is empty.
+func NewAsymmetricKey(id string, algorithm string, privatePEM, publicPEM []byte) (*Key, error) {
+	if len(privatePEM) == 0 && len(publicPEM) == 0 {
+		return nil, fmt.Errorf("key %s: missing both private and public key", id)
+	}
+
+	switch algorithm {
+	case AlgorithmRS256:
+		key := &Key{ID: id, Method: jwt.SigningMethodRS256}
+		if len(privatePEM) > 0 {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", id, err)
+			}
+			key.SignKey = privateKey
+			key.VerifyKey = &privateKey.PublicKey
+		}
+		if len(publicPEM) > 0 {
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", id, err)
+			}
+			key.VerifyKey = publicKey
+		}
+		return key, nil
+	case AlgorithmEdDSA:
+		key := &Key{ID: id, Method: SigningMethodEdDSA}
+		if len(privatePEM) > 0 {
+			privateKey, err := parseEd25519PrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", id, err)
+			}
+			key.SignKey = privateKey
+			key.VerifyKey = privateKey.Public().(ed25519.PublicKey)
+		}
+		if len(publicPEM) > 0 {
+			publicKey, err := parseEd25519PublicKeyFromPEM(publicPEM)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", id, err)
+			}
+			key.VerifyKey = publicKey
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported algorithm %s", id, algorithm)
+	}
+}
+
+func parseEd25519PrivateKeyFromPEM(bz []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(bz)
+	if block == nil {
+		return nil, errors.New("invalid PEM encoded private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an ed25519 key")
+	}
+
+	return privateKey, nil
+}
+
+func parseEd25519PublicKeyFromPEM(bz []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(bz)
+	if block == nil {
+		return nil, errors.New("invalid PEM encoded public key")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an ed25519 key")
+	}
+
+	return publicKey, nil
+}
@@ -7,6 +7,9 @@ type Maker interface {
 	// CreateToken creates a new token for a specific username and duration
 	CreateToken(username string, role string, duration time.Duration) (string, *Payload, error)
 
+	// CreateRefreshToken creates a new refresh token for a specific username and duration
+	CreateRefreshToken(username string, role string, duration time.Duration) (string, *Payload, error)
+
 	// VerifyToken checks if the token is valid or not
 	VerifyToken(token string) (*Payload, error)
 }
@@ -13,16 +13,33 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+type TokenType string
+
+const (
+	TokenTypeAccess  TokenType = "access"
+	TokenTypeRefresh TokenType = "refresh"
+)
+
 type Payload struct {
 	ID          uuid.UUID `json:"id"`
 	PhoneNumber string    `json:"phone_number"`
 	Role        string    `json:"role"`
+	TokenType   TokenType `json:"token_type,omitempty"`
 	IssuedAt    time.Time `json:"issued_at"`
 	ExpiredAt   time.Time `json:"expired_at"`
 }
 
-// NewPayload creates a new token payload with a specific username and duration
+// NewPayload creates a new access token payload with a specific username and duration
 func NewPayload(username string, role string, duration time.Duration) (*Payload, error) {
+	return newPayloadWithType(username, role, TokenTypeAccess, duration)
+}
+
+// NewRefreshPayload creates a new refresh token payload with a specific username and duration
+func NewRefreshPayload(username string, role string, duration time.Duration) (*Payload, error) {
+	return newPayloadWithType(username, role, TokenTypeRefresh, duration)
+}
+
+func newPayloadWithType(username string, role string, tokenType TokenType, duration time.Duration) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -32,12 +49,19 @@ func NewPayload(username string, role string, duration time.Duration) (*Payload,
 		ID:          tokenID,
 		PhoneNumber: username,
 		Role:        role,
+		TokenType:   tokenType,
 		IssuedAt:    time.Now(),
 		ExpiredAt:   time.Now().Add(duration),
 	}
 	return payload, nil
 }
 
+// IsRefreshToken reports whether the payload belongs to a refresh token.
+// Tokens issued before token types existed are treated as access tokens.
+func (payload *Payload) IsRefreshToken() bool {
+	return payload.TokenType == TokenTypeRefresh
+}
+
 // Valid checks if the token payload is valid or not
 func (payload *Payload) Valid() error {
 	if time.Now().After(payload.ExpiredAt) {